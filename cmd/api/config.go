@@ -1,16 +1,46 @@
 package main
 
 import (
+	"encoding/base64"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/freekobie/kora/mail"
+	"github.com/freekobie/kora/oidc"
+	"github.com/freekobie/kora/service"
+	"github.com/freekobie/kora/session"
+	"github.com/freekobie/kora/webauthn"
 )
 
 type Config struct {
 	MailConfig    *mail.Config
+	S3Config      *service.S3Config
 	PostgresURL   string
 	ServerAddress string
+	StorageDriver string
 	GCSBucket     string
+	LocalDir      string
+	// TrashRetention is how long deleted items are kept before they are purged.
+	TrashRetention time.Duration
+	// StorageQuota is the default per-user storage limit in bytes; 0 means unlimited.
+	StorageQuota int64
+	// TokenAlgorithm is the JWT signing algorithm, EdDSA or RS256.
+	TokenAlgorithm string
+	// KeyRotation is how often a new token signing key is made.
+	KeyRotation time.Duration
+	// KeyEncryptionKey encrypts token signing keys in the database.
+	KeyEncryptionKey []byte
+	// OIDC is the identity provider for single sign-on; nil if there is none.
+	OIDC *oidc.Config
+	// WebAuthn is the relying party passkeys are registered for; nil if
+	// passkeys are off.
+	WebAuthn *webauthn.RelyingParty
+	// TrustedProxies are the addresses or CIDR ranges of the reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers give the client address.
+	// With none, the client address is the address of the connection.
+	TrustedProxies []string
 }
 
 func loadConfig() *Config {
@@ -22,10 +52,77 @@ func loadConfig() *Config {
 		SenderName:  os.Getenv("SENDER_NAME"),
 	}
 
+	pathStyle, _ := strconv.ParseBool(os.Getenv("S3_PATH_STYLE"))
+	s3Cfg := &service.S3Config{
+		Endpoint:  getEnvDefault("S3_ENDPOINT", "https://s3.amazonaws.com"),
+		Region:    os.Getenv("S3_REGION"),
+		Bucket:    os.Getenv("S3_BUCKET"),
+		AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_SECRET_KEY"),
+		PathStyle: pathStyle,
+	}
+
+	trashRetention := service.DefaultTrashRetention
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days > 0 {
+		trashRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	storageQuota := service.DefaultStorageQuota
+	if gb, err := strconv.ParseInt(os.Getenv("STORAGE_QUOTA_GB"), 10, 64); err == nil && gb >= 0 {
+		storageQuota = gb << 30
+	}
+
+	keyRotation := 30 * 24 * time.Hour
+	if days, err := strconv.Atoi(os.Getenv("TOKEN_KEY_ROTATION_DAYS")); err == nil && days > 0 {
+		keyRotation = time.Duration(days) * 24 * time.Hour
+	}
+
+	// a missing or malformed key is rejected by session.NewKeySet
+	keyEncryptionKey, _ := base64.StdEncoding.DecodeString(os.Getenv("TOKEN_KEY_ENCRYPTION_KEY"))
+
+	var oidcCfg *oidc.Config
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		oidcCfg = &oidc.Config{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+		}
+	}
+
+	var webauthnCfg *webauthn.RelyingParty
+	if rpID := os.Getenv("WEBAUTHN_RP_ID"); rpID != "" {
+		webauthnCfg = &webauthn.RelyingParty{
+			ID:      rpID,
+			Name:    getEnvDefault("WEBAUTHN_RP_NAME", "Kora"),
+			Origins: strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ","),
+		}
+	}
+
 	return &Config{
 		MailConfig:    mailCfg,
+		S3Config:      s3Cfg,
 		PostgresURL:   os.Getenv("DB_URL"),
 		ServerAddress: os.Getenv("PORT"),
+		StorageDriver: getEnvDefault("STORAGE_DRIVER", "gcs"),
 		GCSBucket:     os.Getenv("GCS_BUCKET"),
+		LocalDir:      getEnvDefault("LOCAL_STORAGE_DIR", "data"),
+
+		TrashRetention:   trashRetention,
+		StorageQuota:     storageQuota,
+		TokenAlgorithm:   getEnvDefault("TOKEN_SIGNING_ALGORITHM", session.AlgorithmEdDSA),
+		KeyRotation:      keyRotation,
+		KeyEncryptionKey: keyEncryptionKey,
+		OIDC:             oidcCfg,
+		WebAuthn:         webauthnCfg,
+		TrustedProxies:   strings.Fields(strings.ReplaceAll(os.Getenv("TRUSTED_PROXIES"), ",", " ")),
+	}
+}
+
+func getEnvDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
+	return fallback
 }
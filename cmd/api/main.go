@@ -10,8 +10,10 @@ import (
 
 	"github.com/freekobie/kora/handler"
 	"github.com/freekobie/kora/mail"
+	"github.com/freekobie/kora/oidc"
 	"github.com/freekobie/kora/postgres"
 	"github.com/freekobie/kora/service"
+	"github.com/freekobie/kora/session"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
@@ -45,18 +47,50 @@ func main() {
 
 	userStore := postgres.NewUserStore(db)
 	fileStore := postgres.NewFileStore(db)
+	uploadStore := postgres.NewUploadStore(db)
+	shareStore := postgres.NewShareStore(db)
+	keyStore := postgres.NewKeyStore(db)
+	revocationStore := postgres.NewRevocationStore(db)
 
-	gcsService, err := service.NewGCS(context.Background(), cfg.GCSBucket)
+	keys, err := session.NewKeySet(keyStore, cfg.TokenAlgorithm, cfg.KeyEncryptionKey, cfg.KeyRotation, service.MaxTokenLifetime)
+	if err != nil {
+		panic(err)
+	}
+	if err := keys.Load(context.Background()); err != nil {
+		panic(err)
+	}
+	session.UseKeySet(keys)
+	session.UseDenyList(session.NewDenyList(revocationStore))
+
+	blobStore, err := newBlobStore(context.Background(), cfg)
 	if err != nil {
 		panic(err)
 	}
 
 	userService := service.NewUserService(userStore, mailer)
-	fileService := service.NewFileService(fileStore, gcsService)
+	if cfg.OIDC != nil {
+		provider, err := oidc.Discover(context.Background(), *cfg.OIDC)
+		if err != nil {
+			panic(err)
+		}
+		userService.SetOIDCProvider(provider)
+	}
+	if cfg.WebAuthn != nil {
+		userService.SetWebAuthn(cfg.WebAuthn)
+	}
+	fileService := service.NewFileService(fileStore, blobStore)
+	fileService.SetDefaultQuota(cfg.StorageQuota)
+	uploadService := service.NewUploadService(uploadStore, blobStore, fileService)
+	shareService := service.NewShareService(shareStore, userStore, fileService)
+
+	handler := handler.NewHandler(userService, fileService, uploadService, shareService)
 
-	handler := handler.NewHandler(userService, fileService)
+	app := newApplication(handler, cfg.ServerAddress, fileService, userService, cfg.TrustedProxies)
 
-	app := newApplication(handler, cfg.ServerAddress, fileService)
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go fileService.RunCleanup(jobCtx, cfg.TrashRetention, time.Hour)
+	go keys.RunRotation(jobCtx, 10*time.Minute)
 
 	// Graceful shutdown setup
 	stop := make(chan os.Signal, 1)
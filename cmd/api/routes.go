@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
+
 	"github.com/freekobie/kora/docs"
 	"github.com/freekobie/kora/middlewares"
+	"github.com/freekobie/kora/model"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -10,11 +13,18 @@ import (
 
 func (app *application) routes() *gin.Engine {
 	router := gin.New()
+	// Client addresses key the login attempt limits, so forwarding headers
+	// are only believed from known proxies.
+	if err := router.SetTrustedProxies(app.trustedProxies); err != nil {
+		panic(fmt.Errorf("invalid trusted proxies: %w", err))
+	}
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
 	docs.SwaggerInfo.BasePath = "/api/v1"
 
+	router.GET("/.well-known/jwks.json", app.handler.GetJWKS)
+
 	open := router.Group("/api/v1")
 	open.GET("/ping", func(ctx *gin.Context) {
 		ctx.JSON(200, gin.H{
@@ -26,23 +36,118 @@ func (app *application) routes() *gin.Engine {
 	// users
 	open.POST("/auth/register", app.handler.CreateUser)
 	open.POST("/auth/login", app.handler.LoginUser)
+	open.POST("/auth/login/2fa", app.handler.VerifyTwoFactor)
 	open.POST("/auth/access", app.handler.GetUserAccessToken)
 	open.POST("/auth/verify", app.handler.VerifyUser)
 	open.POST("/auth/verify/request", app.handler.RequestVerificationCode)
+	open.POST("/auth/logout", app.handler.LogoutUser)
+	open.POST("/auth/password/forgot", app.handler.ForgotPassword)
+	open.POST("/auth/password/reset", app.handler.ResetPassword)
+	open.GET("/auth/oidc/authorize", app.handler.StartOIDCLogin)
+	open.POST("/auth/oidc/callback", app.handler.CompleteOIDCLogin)
+	open.POST("/auth/login/passkey/options", app.handler.BeginPasskeyLogin)
+	open.POST("/auth/login/passkey", app.handler.FinishPasskeyLogin)
+
+	// public share links
+	open.GET("/shared/:token", app.handler.GetSharedItem)
+	open.GET("/shared/:token/children", app.handler.ListSharedFolder)
+	open.GET("/shared/:token/content", app.handler.DownloadSharedFile)
+	open.HEAD("/shared/:token/content", app.handler.DownloadSharedFile)
+	open.GET("/shared/:token/archive", app.handler.DownloadSharedArchive)
+
+	// resumable uploads (tus)
+	open.OPTIONS("/files/uploads", middlewares.TusResumable(), app.handler.UploadOptions)
+
+	// Everything below needs a JWT access token or a personal access token.
+	// Personal access tokens only work on the routes in the files group that
+	// their scopes allow.
+	authed := open.Group("/")
+	authed.Use(middlewares.Authentication(app.users))
 
-	protected := open.Group("/")
-	protected.Use(middlewares.Authentication())
+	protected := authed.Group("/")
+	protected.Use(middlewares.RequireSession())
 	{
 		//users
-		protected.GET("/users/:id", app.handler.GetUser)
+		protected.POST("/auth/logout/all", app.handler.LogoutEverywhere)
+		protected.GET("/users/:id", middlewares.OwnerOrAdmin("id"), app.handler.GetUser)
 		protected.PATCH("/users/profile", app.handler.UpdateUserData)
-		protected.DELETE("/users/:id", app.handler.DeleteUser)
+		protected.POST("/users/me/email", app.handler.RequestEmailChange)
+		protected.POST("/users/me/email/confirm", app.handler.ConfirmEmailChange)
+		protected.GET("/users/me/usage", app.handler.GetStorageUsage)
+		protected.GET("/users/me/sessions", app.handler.ListSessions)
+		protected.DELETE("/users/me/sessions/:id", app.handler.RevokeSession)
+		protected.POST("/users/me/tokens", app.handler.CreateAccessToken)
+		protected.GET("/users/me/tokens", app.handler.ListAccessTokens)
+		protected.DELETE("/users/me/tokens/:id", app.handler.RevokeAccessToken)
+		protected.POST("/users/me/passkeys/options", app.handler.BeginPasskeyRegistration)
+		protected.POST("/users/me/passkeys", app.handler.FinishPasskeyRegistration)
+		protected.GET("/users/me/passkeys", app.handler.ListPasskeys)
+		protected.DELETE("/users/me/passkeys/:id", app.handler.DeletePasskey)
+		protected.POST("/users/me/2fa/setup", app.handler.SetupTwoFactor)
+		protected.POST("/users/me/2fa/confirm", app.handler.ConfirmTwoFactor)
+		protected.POST("/users/me/2fa/recovery-codes", app.handler.RegenerateRecoveryCodes)
+		protected.DELETE("/users/me/2fa", app.handler.DisableTwoFactor)
+		protected.GET("/users/me/version-retention", app.handler.GetVersionRetention)
+		protected.PUT("/users/me/version-retention", app.handler.SetVersionRetention)
+		protected.DELETE("/users/:id", middlewares.OwnerOrAdmin("id"), app.handler.DeleteUser)
+		protected.PUT("/users/:id/role", middlewares.RequireAdmin(), app.handler.SetUserRole)
+		protected.PUT("/users/:id/quota", middlewares.RequireAdmin(), app.handler.SetUserQuota)
 
+		// share links
+		protected.POST("/shares", app.handler.CreateShareLink)
+		protected.GET("/shares", app.handler.ListShareLinks)
+		protected.DELETE("/shares/:id", app.handler.RevokeShareLink)
+
+		// sharing with other users
+		protected.POST("/permissions", app.handler.GrantAccess)
+		protected.GET("/permissions", app.handler.ListAccess)
+		protected.DELETE("/permissions/:id", app.handler.RevokeAccess)
+		protected.GET("/shared-with-me", app.handler.SharedWithMe)
+	}
+
+	files := authed.Group("/")
+	read := middlewares.RequireScope(model.ScopeFilesRead)
+	write := middlewares.RequireScope(model.ScopeFilesWrite)
+	{
 		// folders
-		protected.POST("/folders", app.handler.CreateFolder)
+		files.POST("/folders", write, app.handler.CreateFolder)
+		files.GET("/folders/tree", read, app.handler.GetFolderTree)
+		files.GET("/folders/:id/children", read, app.handler.ListFolder)
+		files.GET("/folders/:id/path", read, app.handler.GetFolderPath)
+		files.PATCH("/folders/:id", write, app.handler.RenameFolder)
+		files.POST("/folders/:id/move", write, app.handler.MoveFolder)
+		files.DELETE("/folders/:id", write, app.handler.DeleteFolder)
+
+		// trash
+		files.GET("/trash", read, app.handler.ListTrash)
+		files.DELETE("/trash", write, app.handler.EmptyTrash)
+		files.POST("/trash/files/:id/restore", write, app.handler.RestoreFile)
+		files.POST("/trash/folders/:id/restore", write, app.handler.RestoreFolder)
 
 		// files
-		protected.POST("/files/upload", app.handler.FileUpload)
+		files.POST("/files/upload", write, app.handler.FileUpload)
+		files.POST("/files/archive", read, app.handler.DownloadArchive)
+		files.GET("/files/:id", read, app.handler.GetFileInfo)
+		files.PATCH("/files/:id", write, app.handler.RenameFile)
+		files.POST("/files/:id/move", write, app.handler.MoveFile)
+		files.DELETE("/files/:id", write, app.handler.DeleteFile)
+		files.GET("/files/:id/content", read, app.handler.DownloadFile)
+		files.HEAD("/files/:id/content", read, app.handler.DownloadFile)
+		files.PUT("/files/:id/content", write, app.handler.UploadVersion)
+		files.GET("/files/:id/versions", read, app.handler.ListVersions)
+		files.GET("/files/:id/versions/:version/content", read, app.handler.DownloadVersion)
+		files.HEAD("/files/:id/versions/:version/content", read, app.handler.DownloadVersion)
+		files.POST("/files/:id/versions/:version/restore", write, app.handler.RestoreVersion)
+		files.DELETE("/files/:id/versions/:version", write, app.handler.DeleteVersion)
+
+		uploads := files.Group("/files/uploads")
+		uploads.Use(middlewares.TusResumable(), write)
+		{
+			uploads.POST("", app.handler.CreateUpload)
+			uploads.HEAD("/:id", app.handler.GetUploadOffset)
+			uploads.PATCH("/:id", app.handler.PatchUpload)
+			uploads.DELETE("/:id", app.handler.TerminateUpload)
+		}
 	}
 
 	// swagger
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// clientIP returns the client address the routes see for a request from
+// remoteAddr with the given headers. The address is what login attempts are
+// limited by.
+func clientIP(app *application, remoteAddr string, header http.Header) string {
+	router := app.routes()
+	router.GET("/client-ip", func(c *gin.Context) {
+		c.String(http.StatusOK, c.ClientIP())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/client-ip", nil)
+	req.RemoteAddr = remoteAddr
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestRoutes_ClientIP(t *testing.T) {
+	spoofed := http.Header{
+		"X-Forwarded-For": {"198.51.100.9"},
+		"X-Real-Ip":       {"198.51.100.9"},
+	}
+
+	t.Run("no trusted proxies", func(t *testing.T) {
+		app := &application{}
+		assert.Equal(t, "203.0.113.7", clientIP(app, "203.0.113.7:4711", spoofed), "forwarding headers must be ignored")
+	})
+
+	t.Run("untrusted peer", func(t *testing.T) {
+		app := &application{trustedProxies: []string{"10.0.0.0/8"}}
+		assert.Equal(t, "203.0.113.7", clientIP(app, "203.0.113.7:4711", spoofed))
+	})
+
+	t.Run("trusted proxy", func(t *testing.T) {
+		app := &application{trustedProxies: []string{"10.0.0.0/8"}}
+		forwarded := http.Header{"X-Forwarded-For": {"198.51.100.9"}}
+		assert.Equal(t, "198.51.100.9", clientIP(app, "10.1.2.3:4711", forwarded))
+	})
+}
@@ -13,9 +13,12 @@ type application struct {
 	handler     *handler.Handler
 	server      *http.Server
 	fileService *service.FileService
+	users       *service.UserService
+	// trustedProxies may set the client address in forwarding headers.
+	trustedProxies []string
 }
 
-func newApplication(handler *handler.Handler, address string, fileService *service.FileService) *application {
+func newApplication(handler *handler.Handler, address string, fileService *service.FileService, users *service.UserService, trustedProxies []string) *application {
 	server := http.Server{
 		Addr: fmt.Sprintf(":%s", address),
 	}
@@ -24,6 +27,9 @@ func newApplication(handler *handler.Handler, address string, fileService *servi
 		handler:     handler,
 		server:      &server,
 		fileService: fileService,
+		users:       users,
+
+		trustedProxies: trustedProxies,
 	}
 }
 
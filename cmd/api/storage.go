@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+)
+
+// newBlobStore creates the blob storage backend selected by cfg.StorageDriver.
+func newBlobStore(ctx context.Context, cfg *Config) (model.BlobStore, error) {
+	switch strings.ToLower(cfg.StorageDriver) {
+	case "gcs":
+		return service.NewGCS(ctx, cfg.GCSBucket)
+	case "local":
+		return service.NewLocalStorage(cfg.LocalDir)
+	case "s3":
+		return service.NewS3(*cfg.S3Config)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAccessToken godoc
+//
+//	@Summary		Create personal access token
+//	@Description	Create a long-lived token for scripts and CI, limited to the given scopes (files:read, files:write). The token is only shown in this response.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Accept			json
+//	@Produce		json
+//	@Param			token	body		service.CreateAccessTokenRequest	true	"Token name, scopes and optional expiry"
+//	@Success		201		{object}	AccessTokenResponse
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/users/me/tokens [post]
+func (h *Handler) CreateAccessToken(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input service.CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	token, secret, err := h.user.CreateAccessToken(c.Request.Context(), userID, input)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTokenName) || errors.Is(err, service.ErrInvalidScopes) ||
+			errors.Is(err, service.ErrInvalidExpiry) {
+			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, AccessTokenResponse{Status: http.StatusCreated, AccessToken: *token, Token: secret})
+}
+
+// ListAccessTokens godoc
+//
+//	@Summary		List personal access tokens
+//	@Description	List the user's personal access tokens, newest first
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Produce		json
+//	@Success		200	{object}	AccessTokensResponse
+//	@Failure		500	{object}	Response
+//	@Router			/users/me/tokens [get]
+func (h *Handler) ListAccessTokens(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	tokens, err := h.user.ListAccessTokens(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, AccessTokensResponse{Status: http.StatusOK, AccessTokens: tokens})
+}
+
+// RevokeAccessToken godoc
+//
+//	@Summary		Revoke personal access token
+//	@Description	Delete one of the user's personal access tokens. It stops working immediately.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Produce		json
+//	@Param			id	path		string	true	"Token ID"
+//	@Success		200	{object}	Response
+//	@Failure		400	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/users/me/tokens/{id} [delete]
+func (h *Handler) RevokeAccessToken(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	if err := h.user.RevokeAccessToken(c.Request.Context(), userID, id); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "access token revoked"})
+}
@@ -1,9 +1,17 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/freekobie/kora/model"
 	"github.com/freekobie/kora/service"
@@ -15,40 +23,15 @@ type FileUploader interface {
 	UploadFile(ctx *gin.Context, user *model.User, folderID *uuid.UUID, file multipart.File, header *multipart.FileHeader) (*model.File, error)
 }
 
-func (h *Handler) CreateFolder(c *gin.Context) {
-	var input service.CreateFolderRequest
-
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
-		return
-	}
-
-	userID, ok := c.Get("user_id")
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
-		return
-	}
-
-	folder, err := h.file.CreateFolder(c.Request.Context(), input, userID.(uuid.UUID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "internal server error"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, gin.H{"folder": folder})
-}
-
 // FileUploadHandler handles file uploads.
 func (h *Handler) FileUpload(c *gin.Context) {
-	idString, ok := c.Get("user_id")
-	if !ok {
-		slog.Error("failed to fetch user id from context")
-		c.JSON(http.StatusInternalServerError, gin.H{"message": ErrServerError.Error()})
+	userId, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
 		return
 	}
 
-	userId := uuid.MustParse(idString.(string))
-
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
@@ -67,11 +50,265 @@ func (h *Handler) FileUpload(c *gin.Context) {
 		folderId = id
 	}
 
-	dbFile, err := h.file.UploadFile(c, userId, folderId, file, header)
+	policy, err := service.ParseConflictPolicy(c.Query("onConflict"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload file"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dbFile, err := h.file.UploadFile(c, userId, folderId, file, header, policy)
+	if err != nil {
+		writeFileError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, dbFile)
 }
+
+// DownloadFile streams a file's contents. It supports Range requests and
+// conditional requests through If-None-Match, If-Modified-Since and If-Range.
+// Pass inline=true to have browsers display the file instead of saving it.
+func (h *Handler) DownloadFile(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	file, err := h.file.GetFile(c.Request.Context(), userID, id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	serveFile(c, file, h.file.OpenFile(c.Request.Context(), file))
+}
+
+// serveFile writes file to the response with content headers derived from
+// its metadata, leaving range and conditional handling to http.ServeContent.
+func serveFile(c *gin.Context, file *model.File, content io.ReadSeekCloser) {
+	defer content.Close()
+
+	disposition := "attachment"
+	if inline, _ := strconv.ParseBool(c.Query("inline")); inline {
+		disposition = "inline"
+	}
+
+	contentType := file.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
+	c.Header("ETag", fileETag(file))
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(c.Writer, c.Request, file.Name, file.LastModified, content)
+}
+
+// fileETag derives a strong ETag from a file's storage key. Objects are never
+// rewritten in place, so the key identifies the exact bytes served.
+func fileETag(file *model.File) string {
+	sum := sha256.Sum256([]byte(file.StorageKey))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// DownloadArchive streams the selected files and folders as a ZIP archive.
+func (h *Handler) DownloadArchive(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input service.ArchiveRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	entries, err := h.file.ResolveArchive(c.Request.Context(), userID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrNotFound):
+			c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: err.Error()})
+		case errors.Is(err, service.ErrEmptyArchive):
+			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		}
+		return
+	}
+
+	name := fmt.Sprintf("kora-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Status(http.StatusOK)
+
+	// the status is already sent, so a failure can only cut the stream short
+	if err := h.file.WriteArchive(c.Request.Context(), c.Writer, entries); err != nil {
+		slog.Error("failed to stream archive", "error", err)
+		c.Abort()
+	}
+}
+
+// GetFileInfo returns a file's metadata.
+func (h *Handler) GetFileInfo(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	file, err := h.file.GetFile(c.Request.Context(), userID, id)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FileResponse{Status: http.StatusOK, File: *file})
+}
+
+// RenameFile changes a file's name. The onConflict query parameter (fail,
+// rename or replace) decides what happens when the name is taken.
+func (h *Handler) RenameFile(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	policy, err := service.ParseConflictPolicy(c.Query("onConflict"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	file, err := h.file.RenameFile(c.Request.Context(), userID, id, input.Name, policy)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FileResponse{Status: http.StatusOK, File: *file})
+}
+
+// MoveFile moves a file to another folder. A null or missing folderId moves
+// it to the root. Name conflicts are handled as in RenameFile.
+func (h *Handler) MoveFile(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	var input struct {
+		FolderID uuid.UUID `json:"folderId"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	policy, err := service.ParseConflictPolicy(c.Query("onConflict"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	file, err := h.file.MoveFile(c.Request.Context(), userID, id, input.FolderID, policy)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FileResponse{Status: http.StatusOK, File: *file})
+}
+
+// DeleteFile moves a file to the trash.
+func (h *Handler) DeleteFile(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	if err := h.file.DeleteFile(c.Request.Context(), userID, id); err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "file moved to trash"})
+}
+
+// writeFileError maps errors from file and folder operations to responses.
+func writeFileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: err.Error()})
+	case errors.Is(err, service.ErrInvalidName), errors.Is(err, service.ErrInvalidSort), errors.Is(err, service.ErrReplaceFolder),
+		errors.Is(err, service.ErrInvalidDepth), errors.Is(err, service.ErrInvalidRetention), errors.Is(err, service.ErrMoveAcrossOwners),
+		errors.Is(err, service.ErrInvalidQuota):
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, Response{Status: http.StatusForbidden, Message: err.Error()})
+	case errors.Is(err, service.ErrFolderCycle), errors.Is(err, model.ErrDuplicateName), errors.Is(err, model.ErrConflict),
+		errors.Is(err, service.ErrCurrentVersion):
+		c.JSON(http.StatusConflict, Response{Status: http.StatusConflict, Message: err.Error()})
+	case errors.Is(err, service.ErrQuotaExceeded):
+		c.JSON(http.StatusInsufficientStorage, Response{Status: http.StatusInsufficientStorage, Message: err.Error()})
+	default:
+		slog.Error("file operation failed", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+	}
+}
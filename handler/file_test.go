@@ -0,0 +1,196 @@
+package handler_test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freekobie/kora/handler"
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadFile(t *testing.T) {
+	files := newMemFileStore()
+	blobs := newMemBlobStore()
+	h := handler.NewHandler(nil, service.NewFileService(files, blobs), nil, nil)
+
+	owner := uuid.New()
+	file := addFile(files, blobs, owner, "résumé.txt", "text/plain", []byte("0123456789"))
+
+	router := gin.New()
+	router.Use(withUser(owner))
+	router.GET("/files/:id/content", h.DownloadFile)
+
+	etag := ""
+
+	tests := []struct {
+		name       string
+		path       string
+		headers    func() map[string]string
+		wantStatus int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			name:       "full download",
+			path:       "/files/" + file.Id.String() + "/content",
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789",
+			wantHeader: map[string]string{
+				"Content-Type":        "text/plain",
+				"Content-Disposition": "attachment; filename*=utf-8''r%C3%A9sum%C3%A9.txt",
+				"Accept-Ranges":       "bytes",
+				"Last-Modified":       "Thu, 02 Jan 2025 03:04:05 GMT",
+			},
+		},
+		{
+			name:       "inline",
+			path:       "/files/" + file.Id.String() + "/content?inline=true",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Content-Disposition": "inline; filename*=utf-8''r%C3%A9sum%C3%A9.txt"},
+		},
+		{
+			name:       "range",
+			path:       "/files/" + file.Id.String() + "/content",
+			headers:    func() map[string]string { return map[string]string{"Range": "bytes=2-5"} },
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "2345",
+			wantHeader: map[string]string{"Content-Range": "bytes 2-5/10"},
+		},
+		{
+			name:       "suffix range",
+			path:       "/files/" + file.Id.String() + "/content",
+			headers:    func() map[string]string { return map[string]string{"Range": "bytes=-3"} },
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "789",
+		},
+		{
+			name:       "unsatisfiable range",
+			path:       "/files/" + file.Id.String() + "/content",
+			headers:    func() map[string]string { return map[string]string{"Range": "bytes=20-30"} },
+			wantStatus: http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:       "if-none-match",
+			path:       "/files/" + file.Id.String() + "/content",
+			headers:    func() map[string]string { return map[string]string{"If-None-Match": etag} },
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name: "stale if-range ignores range",
+			path: "/files/" + file.Id.String() + "/content",
+			headers: func() map[string]string {
+				return map[string]string{"Range": "bytes=2-5", "If-Range": `"stale"`}
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789",
+		},
+		{
+			name: "matching if-range",
+			path: "/files/" + file.Id.String() + "/content",
+			headers: func() map[string]string {
+				return map[string]string{"Range": "bytes=2-5", "If-Range": etag}
+			},
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "2345",
+		},
+		{
+			name:       "unknown file",
+			path:       "/files/" + uuid.NewString() + "/content",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.headers != nil {
+				for k, v := range tt.headers() {
+					req.Header.Set(k, v)
+				}
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			for k, v := range tt.wantHeader {
+				assert.Equal(t, v, w.Header().Get(k), k)
+			}
+			if etag == "" {
+				etag = w.Header().Get("ETag")
+				require.NotEmpty(t, etag)
+			}
+		})
+	}
+}
+
+func TestDownloadFile_OtherUser(t *testing.T) {
+	files := newMemFileStore()
+	blobs := newMemBlobStore()
+	h := handler.NewHandler(nil, service.NewFileService(files, blobs), nil, nil)
+
+	file := addFile(files, blobs, uuid.New(), "secret.txt", "text/plain", []byte("secret"))
+
+	router := gin.New()
+	router.Use(withUser(uuid.New()))
+	router.GET("/files/:id/content", h.DownloadFile)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/"+file.Id.String()+"/content", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestFileUpload_SharedFolder(t *testing.T) {
+	files := newMemFileStore()
+	blobs := newMemBlobStore()
+	h := handler.NewHandler(nil, service.NewFileService(files, blobs), nil, nil)
+
+	owner, viewer, stranger := uuid.New(), uuid.New(), uuid.New()
+	folder := model.Folder{Id: uuid.New(), Name: "shared", UserID: owner}
+	files.folders[folder.Id] = folder
+	files.access[viewer] = model.AccessViewer
+
+	tests := []struct {
+		name       string
+		userID     uuid.UUID
+		wantStatus int
+	}{
+		{name: "viewer", userID: viewer, wantStatus: http.StatusForbidden},
+		{name: "not shared", userID: stranger, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			part, err := form.CreateFormFile("file", "notes.txt")
+			require.NoError(t, err)
+			_, err = part.Write([]byte("hello"))
+			require.NoError(t, err)
+			require.NoError(t, form.WriteField("folder_id", folder.Id.String()))
+			require.NoError(t, form.Close())
+
+			router := gin.New()
+			router.Use(withUser(tt.userID))
+			router.POST("/files/upload", h.FileUpload)
+
+			req := httptest.NewRequest(http.MethodPost, "/files/upload", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Empty(t, files.files, "nothing is stored")
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// getFolderParam parses a folder ID path parameter, accepting "root" for
+// the user's top level.
+func getFolderParam(c *gin.Context, key string) (uuid.UUID, error) {
+	if c.Param(key) == "root" {
+		return uuid.Nil, nil
+	}
+	return getUUIDparam(c, key)
+}
+
+// CreateFolder creates a new folder. The onConflict query parameter (fail or
+// rename) decides what happens when the name is taken.
+func (h *Handler) CreateFolder(c *gin.Context) {
+	var input service.CreateFolderRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	input.OnConflict, err = service.ParseConflictPolicy(c.Query("onConflict"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	folder, err := h.file.CreateFolder(c.Request.Context(), input, userID)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, FolderResponse{Status: http.StatusCreated, Folder: folder})
+}
+
+// ListFolder lists a folder's subfolders and files, folders first. Use
+// "root" as the ID for the top level. Query parameters: sort (name,
+// createdAt, lastModified, size), order (asc, desc), limit and offset.
+func (h *Handler) ListFolder(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getFolderParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	opts, err := parseListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	contents, err := h.file.ListFolder(c.Request.Context(), userID, id, opts)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FolderContentsResponse{Status: http.StatusOK, Contents: contents})
+}
+
+// parseListOptions reads the sort, order, limit and offset query parameters.
+func parseListOptions(c *gin.Context) (model.ListOptions, error) {
+	opts := model.ListOptions{Sort: c.Query("sort")}
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return model.ListOptions{}, errors.New("order must be asc or desc")
+	}
+
+	var err error
+	if opts.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil {
+		return model.ListOptions{}, errors.New("invalid limit")
+	}
+	if opts.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil {
+		return model.ListOptions{}, errors.New("invalid offset")
+	}
+
+	return opts, nil
+}
+
+// GetFolderTree returns the user's folder tree with file counts and sizes.
+// Query parameters: parentId to start below a folder instead of the root,
+// and depth to limit the number of levels (0 for all).
+func (h *Handler) GetFolderTree(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var parentID uuid.UUID
+	if value := c.Query("parentId"); value != "" {
+		if parentID, err = uuid.Parse(value); err != nil {
+			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid parentId"})
+			return
+		}
+	}
+
+	depth, err := strconv.Atoi(c.DefaultQuery("depth", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid depth"})
+		return
+	}
+
+	tree, err := h.file.GetFolderTree(c.Request.Context(), userID, parentID, depth)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FolderTreeResponse{Status: http.StatusOK, Tree: tree})
+}
+
+// GetFolderPath returns the breadcrumb trail from the root to a folder.
+func (h *Handler) GetFolderPath(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	path, err := h.file.GetFolderPath(c.Request.Context(), userID, id)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FolderPathResponse{Status: http.StatusOK, Path: path})
+}
+
+// RenameFolder changes a folder's name.
+func (h *Handler) RenameFolder(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	policy, err := service.ParseConflictPolicy(c.Query("onConflict"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	folder, err := h.file.RenameFolder(c.Request.Context(), userID, id, input.Name, policy)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FolderResponse{Status: http.StatusOK, Folder: *folder})
+}
+
+// MoveFolder moves a folder under another folder. A null or missing
+// parentId moves it to the root.
+func (h *Handler) MoveFolder(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	var input struct {
+		ParentID uuid.UUID `json:"parentId"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	policy, err := service.ParseConflictPolicy(c.Query("onConflict"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	folder, err := h.file.MoveFolder(c.Request.Context(), userID, id, input.ParentID, policy)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FolderResponse{Status: http.StatusOK, Folder: *folder})
+}
+
+// DeleteFolder moves a folder to the trash with all of its contents.
+func (h *Handler) DeleteFolder(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	if err := h.file.DeleteFolder(c.Request.Context(), userID, id); err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "folder moved to trash"})
+}
@@ -5,13 +5,17 @@ import (
 )
 
 type Handler struct {
-	user *service.UserService
-	file *service.FileService
+	user   *service.UserService
+	file   *service.FileService
+	upload *service.UploadService
+	share  *service.ShareService
 }
 
-func NewHandler(us *service.UserService, fs *service.FileService) *Handler {
+func NewHandler(us *service.UserService, fs *service.FileService, ups *service.UploadService, ss *service.ShareService) *Handler {
 	return &Handler{
-		user: us,
-		file: fs,
+		user:   us,
+		file:   fs,
+		upload: ups,
+		share:  ss,
 	}
 }
@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"errors"
+
+	"github.com/freekobie/kora/model"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -9,3 +12,27 @@ func getUUIDparam(c *gin.Context, key string) (uuid.UUID, error) {
 	idString := c.Param(key)
 	return uuid.Parse(idString)
 }
+
+// getUserID returns the ID of the authenticated user set by middlewares.Authentication.
+func getUserID(c *gin.Context) (uuid.UUID, error) {
+	idString := c.GetString("user_id")
+	if idString == "" {
+		return uuid.Nil, errors.New("user id not found in context")
+	}
+	return uuid.Parse(idString)
+}
+
+// getSessionID returns the ID of the session the request's access token was
+// issued for, or uuid.Nil for tokens issued before sessions were tracked.
+func getSessionID(c *gin.Context) uuid.UUID {
+	id, err := uuid.Parse(c.GetString("session_id"))
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// clientInfo describes the device a request comes from.
+func clientInfo(c *gin.Context) model.ClientInfo {
+	return model.ClientInfo{UserAgent: c.Request.UserAgent(), IPAddress: c.ClientIP()}
+}
@@ -0,0 +1,154 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// memBlobStore is an in-memory model.BlobStore for handler tests.
+type memBlobStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemBlobStore() *memBlobStore {
+	return &memBlobStore{objects: make(map[string][]byte)}
+}
+
+func (m *memBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	return nil
+}
+
+func (m *memBlobStore) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	data = data[min(offset, int64(len(data))):]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memBlobStore) Stat(ctx context.Context, key string) (model.BlobInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return model.BlobInfo{}, model.ErrNotFound
+	}
+	return model.BlobInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func (m *memBlobStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[key]; !ok {
+		return model.ErrNotFound
+	}
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memBlobStore) List(ctx context.Context, prefix string) ([]model.BlobInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var blobs []model.BlobInfo
+	for key, data := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			blobs = append(blobs, model.BlobInfo{Key: key, Size: int64(len(data))})
+		}
+	}
+	return blobs, nil
+}
+
+// memFileStore is an in-memory model.FileStorage. Methods a test does not
+// need fall through to the embedded nil interface and panic.
+type memFileStore struct {
+	model.FileStorage
+	files   map[uuid.UUID]model.File
+	folders map[uuid.UUID]model.Folder
+	// access is what each user has been granted on everything they do not
+	// own.
+	access map[uuid.UUID]model.Access
+}
+
+func newMemFileStore() *memFileStore {
+	return &memFileStore{
+		files:   make(map[uuid.UUID]model.File),
+		folders: make(map[uuid.UUID]model.Folder),
+		access:  make(map[uuid.UUID]model.Access),
+	}
+}
+
+func (m *memFileStore) CreateFile(ctx context.Context, file *model.File) error {
+	m.files[file.Id] = *file
+	return nil
+}
+
+func (m *memFileStore) GetFile(ctx context.Context, id uuid.UUID) (model.File, error) {
+	file, ok := m.files[id]
+	if !ok {
+		return model.File{}, model.ErrNotFound
+	}
+	return file, nil
+}
+
+func (m *memFileStore) GetFolder(ctx context.Context, id uuid.UUID) (model.Folder, error) {
+	folder, ok := m.folders[id]
+	if !ok {
+		return model.Folder{}, model.ErrNotFound
+	}
+	return folder, nil
+}
+
+func (m *memFileStore) GetAccess(ctx context.Context, userID, fileID, folderID uuid.UUID) (model.Access, error) {
+	return m.access[userID], nil
+}
+
+// addFile stores a file owned by userID with the given contents.
+func addFile(files *memFileStore, blobs *memBlobStore, userID uuid.UUID, name, mimeType string, content []byte) model.File {
+	file := model.File{
+		Id:           uuid.New(),
+		Name:         name,
+		UserID:       userID,
+		MimeType:     mimeType,
+		Size:         int64(len(content)),
+		CreatedAt:    time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		LastModified: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	file.StorageKey = userID.String() + "/" + file.Id.String()
+	files.files[file.Id] = file
+	blobs.objects[file.StorageKey] = content
+	return file
+}
+
+// withUser simulates middlewares.Authentication for userID.
+func withUser(userID uuid.UUID) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", userID.String())
+		c.Next()
+	}
+}
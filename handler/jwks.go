@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/freekobie/kora/session"
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS serves the public keys tokens are signed with, so that other
+// services can verify them.
+func (h *Handler) GetJWKS(c *gin.Context) {
+	jwks, err := session.JWKS()
+	if err != nil {
+		slog.Error("failed to load signing keys", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(session.JWKSMaxAge.Seconds())))
+	c.JSON(http.StatusOK, jwks)
+}
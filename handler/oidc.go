@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/freekobie/kora/service"
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie keeps the state of a single sign-on login in the browser
+// that started it.
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/v1/auth/oidc"
+	oidcStateMaxAge     = 10 * 60
+)
+
+// StartOIDCLogin godoc
+//
+//	@Summary		Start single sign-on
+//	@Description	Get the identity provider URL to send the user to. The provider sends them back to the configured redirect URL with a code and state, to be posted to /auth/oidc/callback from the same browser, which is given a cookie tying it to the login.
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	AuthorizationURLResponse
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/auth/oidc/authorize [get]
+func (h *Handler) StartOIDCLogin(c *gin.Context) {
+	url, state, err := h.user.StartOIDCLogin(c.Request.Context())
+	if err != nil {
+		writeOIDCError(c, err)
+		return
+	}
+
+	setOIDCStateCookie(c, state, oidcStateMaxAge)
+
+	c.JSON(http.StatusOK, AuthorizationURLResponse{Status: http.StatusOK, URL: url})
+}
+
+// CompleteOIDCLogin godoc
+//
+//	@Summary		Complete single sign-on
+//	@Description	Exchange the code and state the identity provider sent the user back with for a session. Users with two-factor authentication get a challenge token instead, to be exchanged at /auth/login/2fa.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			callback	body		object	true	"Code and state from the identity provider"
+//	@Success		200			{object}	SessionResponse
+//	@Failure		400			{object}	Response
+//	@Failure		401			{object}	Response
+//	@Failure		403			{object}	Response
+//	@Failure		404			{object}	Response
+//	@Failure		500			{object}	Response
+//	@Router			/auth/oidc/callback [post]
+func (h *Handler) CompleteOIDCLogin(c *gin.Context) {
+	var input struct {
+		State string `json:"state" binding:"required"`
+		Code  string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	browserState, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1)
+
+	session, err := h.user.CompleteOIDCLogin(c.Request.Context(), input.State, browserState, input.Code, clientInfo(c))
+	if err != nil {
+		writeOIDCError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SessionResponse{Status: http.StatusOK, Session: *session})
+}
+
+func writeOIDCError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	message := ErrServerError.Error()
+
+	switch {
+	case errors.Is(err, service.ErrOIDCNotConfigured):
+		status, message = http.StatusNotFound, err.Error()
+	case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrOIDCBrowserMismatch):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, service.ErrOIDCLoginFailed):
+		status, message = http.StatusUnauthorized, err.Error()
+	case errors.Is(err, service.ErrUnverifiedIdentity):
+		status, message = http.StatusForbidden, err.Error()
+	default:
+		slog.Error("single sign-on request failed", "error", err)
+	}
+
+	c.JSON(status, Response{Status: status, Message: message})
+}
+
+// setOIDCStateCookie sets the state cookie, or deletes it if maxAge is
+// negative. Lax cookies are sent when the identity provider redirects back,
+// but not with requests other sites make.
+func setOIDCStateCookie(c *gin.Context, state string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, oidcStateCookiePath, "", true, true)
+}
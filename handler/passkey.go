@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/freekobie/kora/webauthn"
+	"github.com/gin-gonic/gin"
+)
+
+// BeginPasskeyRegistration godoc
+//
+//	@Summary		Start passkey registration
+//	@Description	Get the options to pass to navigator.credentials.create. Post the credential it returns to /users/me/passkeys within five minutes.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Produce		json
+//	@Success		200	{object}	CreationOptionsResponse
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/users/me/passkeys/options [post]
+func (h *Handler) BeginPasskeyRegistration(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	options, err := h.user.BeginPasskeyRegistration(c.Request.Context(), userID)
+	if err != nil {
+		writePasskeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, CreationOptionsResponse{Status: http.StatusOK, Options: *options})
+}
+
+// FinishPasskeyRegistration godoc
+//
+//	@Summary		Register passkey
+//	@Description	Save the credential navigator.credentials.create returned as a passkey with the given name
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Accept			json
+//	@Produce		json
+//	@Param			passkey	body		object	true	"Passkey name and credential"
+//	@Success		201		{object}	PasskeyResponse
+//	@Failure		400		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		409		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/users/me/passkeys [post]
+func (h *Handler) FinishPasskeyRegistration(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input struct {
+		Name       string                        `json:"name" binding:"required"`
+		Credential *webauthn.AttestationResponse `json:"credential" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	passkey, err := h.user.FinishPasskeyRegistration(c.Request.Context(), userID, input.Name, input.Credential)
+	if err != nil {
+		// the user is signed in; a bad credential is a bad request
+		if errors.Is(err, service.ErrInvalidPasskey) {
+			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+		writePasskeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, PasskeyResponse{Status: http.StatusCreated, Passkey: *passkey})
+}
+
+// ListPasskeys godoc
+//
+//	@Summary		List passkeys
+//	@Description	List the user's passkeys, newest first
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Produce		json
+//	@Success		200	{object}	PasskeysResponse
+//	@Failure		500	{object}	Response
+//	@Router			/users/me/passkeys [get]
+func (h *Handler) ListPasskeys(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	passkeys, err := h.user.ListPasskeys(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, PasskeysResponse{Status: http.StatusOK, Passkeys: passkeys})
+}
+
+// DeletePasskey godoc
+//
+//	@Summary		Delete passkey
+//	@Description	Delete one of the user's passkeys. It can no longer be used to log in.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Produce		json
+//	@Param			id	path		string	true	"Passkey ID"
+//	@Success		200	{object}	Response
+//	@Failure		400	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/users/me/passkeys/{id} [delete]
+func (h *Handler) DeletePasskey(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	if err := h.user.DeletePasskey(c.Request.Context(), userID, id); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "passkey deleted"})
+}
+
+// BeginPasskeyLogin godoc
+//
+//	@Summary		Start passkey login
+//	@Description	Get the options to pass to navigator.credentials.get. Post the credential it returns to /auth/login/passkey within five minutes.
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	RequestOptionsResponse
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/auth/login/passkey/options [post]
+func (h *Handler) BeginPasskeyLogin(c *gin.Context) {
+	options, err := h.user.BeginPasskeyLogin(c.Request.Context())
+	if err != nil {
+		writePasskeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RequestOptionsResponse{Status: http.StatusOK, Options: *options})
+}
+
+// FinishPasskeyLogin godoc
+//
+//	@Summary		Log in with passkey
+//	@Description	Exchange the credential navigator.credentials.get returned for a session
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			credential	body		webauthn.AssertionResponse	true	"Credential from navigator.credentials.get"
+//	@Success		200			{object}	SessionResponse
+//	@Failure		400			{object}	Response
+//	@Failure		401			{object}	Response
+//	@Failure		404			{object}	Response
+//	@Failure		500			{object}	Response
+//	@Router			/auth/login/passkey [post]
+func (h *Handler) FinishPasskeyLogin(c *gin.Context) {
+	var input webauthn.AssertionResponse
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	session, err := h.user.FinishPasskeyLogin(c.Request.Context(), &input, clientInfo(c))
+	if err != nil {
+		writePasskeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SessionResponse{Status: http.StatusOK, Session: *session})
+}
+
+func writePasskeyError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	message := ErrServerError.Error()
+
+	switch {
+	case errors.Is(err, service.ErrPasskeysNotConfigured):
+		status, message = http.StatusNotFound, err.Error()
+	case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrInvalidPasskeyName):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, service.ErrInvalidPasskey):
+		status, message = http.StatusUnauthorized, err.Error()
+	case errors.Is(err, service.ErrPasskeyExists):
+		status, message = http.StatusConflict, err.Error()
+	default:
+		slog.Error("passkey request failed", "error", err)
+	}
+
+	c.JSON(status, Response{Status: status, Message: message})
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/freekobie/kora/service"
+	"github.com/gin-gonic/gin"
+)
+
+// GrantAccess gives another user, identified by email, viewer or editor
+// access to a file or folder.
+func (h *Handler) GrantAccess(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input service.GrantAccessRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	permission, err := h.share.GrantAccess(c.Request.Context(), userID, input)
+	if err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PermissionResponse{Status: http.StatusOK, Permission: *permission})
+}
+
+// ListAccess lists who a file or folder, given by the fileId or folderId
+// query parameter, has been shared with.
+func (h *Handler) ListAccess(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	fileID, err := getOptionalUUIDQuery(c, "fileId")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid fileId"})
+		return
+	}
+	folderID, err := getOptionalUUIDQuery(c, "folderId")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid folderId"})
+		return
+	}
+
+	permissions, err := h.share.ListAccess(c.Request.Context(), userID, fileID, folderID)
+	if err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PermissionsResponse{Status: http.StatusOK, Permissions: permissions})
+}
+
+// RevokeAccess removes a grant, either from an item the user owns or one
+// made to the user themselves.
+func (h *Handler) RevokeAccess(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	if err := h.share.RevokeAccess(c.Request.Context(), userID, id); err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "access revoked"})
+}
+
+// SharedWithMe lists the files and folders other users have shared with the
+// user.
+func (h *Handler) SharedWithMe(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	items, err := h.share.SharedWithMe(c.Request.Context(), userID)
+	if err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SharedResourcesResponse{Status: http.StatusOK, Items: items})
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"github.com/freekobie/kora/model"
 	"github.com/freekobie/kora/session"
+	"github.com/freekobie/kora/webauthn"
 )
 
 type UserResponse struct {
@@ -15,11 +16,140 @@ type SessionResponse struct {
 	Session session.UserSession `json:"session"`
 }
 
+type AuthorizationURLResponse struct {
+	Status int    `json:"status"`
+	URL    string `json:"url"`
+}
+
+type SessionsResponse struct {
+	Status   int             `json:"status"`
+	Sessions []model.Session `json:"sessions"`
+}
+
+type TwoFactorSetupResponse struct {
+	Status    int                  `json:"status"`
+	TwoFactor model.TwoFactorSetup `json:"twoFactor"`
+}
+
+type RecoveryCodesResponse struct {
+	Status        int      `json:"status"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type CreationOptionsResponse struct {
+	Status  int                      `json:"status"`
+	Options webauthn.CreationOptions `json:"options"`
+}
+
+type RequestOptionsResponse struct {
+	Status  int                     `json:"status"`
+	Options webauthn.RequestOptions `json:"options"`
+}
+
+type PasskeyResponse struct {
+	Status  int           `json:"status"`
+	Passkey model.Passkey `json:"passkey"`
+}
+
+type PasskeysResponse struct {
+	Status   int             `json:"status"`
+	Passkeys []model.Passkey `json:"passkeys"`
+}
+
+type AccessTokenResponse struct {
+	Status      int               `json:"status"`
+	AccessToken model.AccessToken `json:"accessToken"`
+	// Token is only returned when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+type AccessTokensResponse struct {
+	Status       int                 `json:"status"`
+	AccessTokens []model.AccessToken `json:"accessTokens"`
+}
+
 type AccessResponse struct {
 	Status int                `json:"status"`
 	Access session.UserAccess `json:"access"`
 }
 
+type FileResponse struct {
+	Status int        `json:"status"`
+	File   model.File `json:"file"`
+}
+
+type FileVersionsResponse struct {
+	Status   int                 `json:"status"`
+	Versions []model.FileVersion `json:"versions"`
+}
+
+type VersionRetentionResponse struct {
+	Status    int                    `json:"status"`
+	Retention model.VersionRetention `json:"retention"`
+}
+
+type UsageResponse struct {
+	Status int                `json:"status"`
+	Usage  model.StorageUsage `json:"usage"`
+}
+
+type ShareLinkResponse struct {
+	Status    int             `json:"status"`
+	ShareLink model.ShareLink `json:"shareLink"`
+	// Token is only returned when the link is created.
+	Token string `json:"token,omitempty"`
+}
+
+type ShareLinksResponse struct {
+	Status     int               `json:"status"`
+	ShareLinks []model.ShareLink `json:"shareLinks"`
+}
+
+type SharedItemResponse struct {
+	Status int              `json:"status"`
+	Item   model.SharedItem `json:"item"`
+}
+
+type PermissionResponse struct {
+	Status     int              `json:"status"`
+	Permission model.Permission `json:"permission"`
+}
+
+type PermissionsResponse struct {
+	Status      int                `json:"status"`
+	Permissions []model.Permission `json:"permissions"`
+}
+
+type SharedResourcesResponse struct {
+	Status int                    `json:"status"`
+	Items  []model.SharedResource `json:"items"`
+}
+
+type FolderResponse struct {
+	Status int          `json:"status"`
+	Folder model.Folder `json:"folder"`
+}
+
+type FolderContentsResponse struct {
+	Status   int                  `json:"status"`
+	Contents model.FolderContents `json:"contents"`
+}
+
+type FolderTreeResponse struct {
+	Status int                 `json:"status"`
+	Tree   []*model.FolderNode `json:"tree"`
+}
+
+type TrashResponse struct {
+	Status int         `json:"status"`
+	Trash  model.Trash `json:"trash"`
+}
+
+type FolderPathResponse struct {
+	Status int            `json:"status"`
+	Path   []model.Folder `json:"path"`
+}
+
 type Response struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// sharePasswordHeader carries the password of a protected share link.
+const sharePasswordHeader = "X-Share-Password"
+
+// CreateShareLink creates a public link to a file or folder. The token in
+// the response is not shown again.
+func (h *Handler) CreateShareLink(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input service.CreateShareRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	link, token, err := h.share.CreateShareLink(c.Request.Context(), userID, input)
+	if err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ShareLinkResponse{Status: http.StatusCreated, ShareLink: *link, Token: token})
+}
+
+// ListShareLinks lists the links the user has created.
+func (h *Handler) ListShareLinks(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	links, err := h.share.ListShareLinks(c.Request.Context(), userID)
+	if err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ShareLinksResponse{Status: http.StatusOK, ShareLinks: links})
+}
+
+// RevokeShareLink disables a link.
+func (h *Handler) RevokeShareLink(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	if err := h.share.RevokeShareLink(c.Request.Context(), userID, id); err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "share link revoked"})
+}
+
+// The handlers below serve share link visitors and need no authentication.
+// Protected links expect the password in the X-Share-Password header.
+
+// GetSharedItem describes the file or folder behind a share link.
+func (h *Handler) GetSharedItem(c *gin.Context) {
+	item, err := h.share.GetSharedItem(c.Request.Context(), c.Param("token"), c.GetHeader(sharePasswordHeader))
+	if err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SharedItemResponse{Status: http.StatusOK, Item: *item})
+}
+
+// ListSharedFolder lists a shared folder, or the subfolder given by the
+// folderId query parameter. It takes the same sort, order, limit and offset
+// parameters as ListFolder.
+func (h *Handler) ListSharedFolder(c *gin.Context) {
+	folderID, err := getOptionalUUIDQuery(c, "folderId")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid folderId"})
+		return
+	}
+
+	opts, err := parseListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	contents, err := h.share.ListSharedFolder(c.Request.Context(), c.Param("token"), c.GetHeader(sharePasswordHeader), folderID, opts)
+	if err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FolderContentsResponse{Status: http.StatusOK, Contents: contents})
+}
+
+// DownloadSharedFile streams a shared file, or with a folder link the file
+// given by the fileId query parameter. Range requests that do not start at
+// the beginning of the file are not counted as downloads, so resuming or
+// seeking does not use up the link's download limit.
+func (h *Handler) DownloadSharedFile(c *gin.Context) {
+	fileID, err := getOptionalUUIDQuery(c, "fileId")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid fileId"})
+		return
+	}
+
+	file, err := h.share.OpenSharedFile(c.Request.Context(), c.Param("token"), c.GetHeader(sharePasswordHeader), fileID, countsAsDownload(c))
+	if err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	serveFile(c, file, h.file.OpenFile(c.Request.Context(), file))
+}
+
+// DownloadSharedArchive streams a shared folder, or the subfolder given by
+// the folderId query parameter, as a ZIP archive.
+func (h *Handler) DownloadSharedArchive(c *gin.Context) {
+	folderID, err := getOptionalUUIDQuery(c, "folderId")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid folderId"})
+		return
+	}
+
+	entries, err := h.share.ResolveSharedArchive(c.Request.Context(), c.Param("token"), c.GetHeader(sharePasswordHeader), folderID)
+	if err != nil {
+		writeShareError(c, err)
+		return
+	}
+
+	name := fmt.Sprintf("kora-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Status(http.StatusOK)
+
+	if err := h.file.WriteArchive(c.Request.Context(), c.Writer, entries); err != nil {
+		slog.Error("failed to stream shared archive", "error", err)
+		c.Abort()
+	}
+}
+
+// countsAsDownload reports whether a content request fetches the file from
+// its start.
+func countsAsDownload(c *gin.Context) bool {
+	if c.Request.Method != http.MethodGet {
+		return false
+	}
+	rangeHeader := c.GetHeader("Range")
+	return rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-")
+}
+
+// getOptionalUUIDQuery parses a UUID query parameter, returning uuid.Nil if
+// it is absent.
+func getOptionalUUIDQuery(c *gin.Context, key string) (uuid.UUID, error) {
+	value := c.Query(key)
+	if value == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(value)
+}
+
+func writeShareError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidShareTarget), errors.Is(err, service.ErrInvalidExpiry),
+		errors.Is(err, service.ErrInvalidMaxDownloads), errors.Is(err, service.ErrInvalidAccess),
+		errors.Is(err, service.ErrGrantToSelf):
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+	case errors.Is(err, service.ErrUnknownGrantee):
+		c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: err.Error()})
+	case errors.Is(err, service.ErrInvalidSharePassword):
+		c.JSON(http.StatusUnauthorized, Response{Status: http.StatusUnauthorized, Message: err.Error()})
+	case errors.Is(err, service.ErrShareExpired), errors.Is(err, service.ErrShareLimitReached):
+		c.JSON(http.StatusGone, Response{Status: http.StatusGone, Message: err.Error()})
+	case errors.Is(err, model.ErrNotFound):
+		c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: err.Error()})
+	default:
+		writeFileError(c, err)
+	}
+}
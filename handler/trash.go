@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListTrash lists the files and folders the user has deleted.
+func (h *Handler) ListTrash(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	trash, err := h.file.ListTrash(c.Request.Context(), userID)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, TrashResponse{Status: http.StatusOK, Trash: trash})
+}
+
+// RestoreFile moves a file out of the trash into its original folder.
+func (h *Handler) RestoreFile(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	file, err := h.file.RestoreFile(c.Request.Context(), userID, id)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FileResponse{Status: http.StatusOK, File: *file})
+}
+
+// RestoreFolder moves a folder and its contents out of the trash.
+func (h *Handler) RestoreFolder(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	folder, err := h.file.RestoreFolder(c.Request.Context(), userID, id)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FolderResponse{Status: http.StatusOK, Folder: *folder})
+}
+
+// EmptyTrash permanently deletes everything in the user's trash.
+func (h *Handler) EmptyTrash(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	if err := h.file.EmptyTrash(c.Request.Context(), userID); err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "trash emptied"})
+}
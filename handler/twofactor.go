@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/freekobie/kora/service"
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyTwoFactor godoc
+//
+//	@Summary		Complete two-factor login
+//	@Description	Exchange the challenge token from /auth/login and a code from the user's authenticator, or a recovery code, for a session
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			challenge	body		object	true	"Challenge token and code"
+//	@Success		200			{object}	SessionResponse
+//	@Failure		400			{object}	Response
+//	@Failure		401			{object}	Response
+//	@Failure		429			{object}	Response
+//	@Failure		500			{object}	Response
+//	@Router			/auth/login/2fa [post]
+func (h *Handler) VerifyTwoFactor(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challengeToken" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	session, err := h.user.VerifyTwoFactor(c.Request.Context(), input.ChallengeToken, input.Code, clientInfo(c))
+	if err != nil {
+		if writeTooManyAttempts(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrInvalidTwoFactorCode) {
+			c.JSON(http.StatusUnauthorized, Response{Status: http.StatusUnauthorized, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, SessionResponse{Status: http.StatusOK, Session: *session})
+}
+
+// SetupTwoFactor godoc
+//
+//	@Summary		Set up two-factor authentication
+//	@Description	Generate a TOTP secret and an otpauth:// URI to show as a QR code. Two-factor authentication is enabled once a code is confirmed.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Produce		json
+//	@Success		200	{object}	TwoFactorSetupResponse
+//	@Failure		409	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/users/me/2fa/setup [post]
+func (h *Handler) SetupTwoFactor(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	setup, err := h.user.SetupTwoFactor(c.Request.Context(), userID)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, TwoFactorSetupResponse{Status: http.StatusOK, TwoFactor: *setup})
+}
+
+// ConfirmTwoFactor godoc
+//
+//	@Summary		Enable two-factor authentication
+//	@Description	Confirm the authenticator with a code from it. The response holds one-time recovery codes, which are not shown again.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Accept			json
+//	@Produce		json
+//	@Param			code	body		object	true	"Code from the authenticator"
+//	@Success		200		{object}	RecoveryCodesResponse
+//	@Failure		400		{object}	Response
+//	@Failure		409		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/users/me/2fa/confirm [post]
+func (h *Handler) ConfirmTwoFactor(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	codes, err := h.user.ConfirmTwoFactor(c.Request.Context(), userID, input.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{Status: http.StatusOK, RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes godoc
+//
+//	@Summary		Regenerate recovery codes
+//	@Description	Replace the user's recovery codes with new ones
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Accept			json
+//	@Produce		json
+//	@Param			code	body		object	true	"Code from the authenticator or a recovery code"
+//	@Success		200		{object}	RecoveryCodesResponse
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/users/me/2fa/recovery-codes [post]
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	codes, err := h.user.RegenerateRecoveryCodes(c.Request.Context(), userID, input.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{Status: http.StatusOK, RecoveryCodes: codes})
+}
+
+// DisableTwoFactor godoc
+//
+//	@Summary		Disable two-factor authentication
+//	@Description	Turn off two-factor authentication. Requires the password and a code from the authenticator or a recovery code.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Accept			json
+//	@Produce		json
+//	@Param			credentials	body		object	true	"Password and code"
+//	@Success		200			{object}	Response
+//	@Failure		400			{object}	Response
+//	@Failure		401			{object}	Response
+//	@Failure		500			{object}	Response
+//	@Router			/users/me/2fa [delete]
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	if err := h.user.DisableTwoFactor(c.Request.Context(), userID, input.Password, input.Code); err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "two-factor authentication disabled"})
+}
+
+func writeTwoFactorError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	message := ErrServerError.Error()
+
+	switch {
+	case errors.Is(err, service.ErrInvalidCredentials):
+		status, message = http.StatusUnauthorized, err.Error()
+	case errors.Is(err, service.ErrTwoFactorEnabled):
+		status, message = http.StatusConflict, err.Error()
+	case errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrTwoFactorNotSetUp),
+		errors.Is(err, service.ErrTwoFactorNotEnabled):
+		status, message = http.StatusBadRequest, err.Error()
+	default:
+		slog.Error("two-factor request failed", "error", err)
+	}
+
+	c.JSON(status, Response{Status: status, Message: message})
+}
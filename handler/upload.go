@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/freekobie/kora/middlewares"
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// These handlers implement the tus 1.0 resumable upload protocol with the
+// creation, termination and checksum extensions. See https://tus.io/protocols/resumable-upload.
+
+const tusChunkContentType = "application/offset+octet-stream"
+
+// statusChecksumMismatch is the tus checksum extension's "460 Checksum Mismatch".
+const statusChecksumMismatch = 460
+
+// UploadOptions reports the server's tus capabilities.
+func (h *Handler) UploadOptions(c *gin.Context) {
+	c.Header("Tus-Version", middlewares.TusVersion)
+	c.Header("Tus-Extension", "creation,termination,checksum")
+	c.Header("Tus-Max-Size", strconv.FormatInt(service.MaxUploadSize, 10))
+	c.Header("Tus-Checksum-Algorithm", strings.Join(service.UploadChecksumAlgorithms, ","))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload starts a resumable upload. The file name, type, target folder
+// and conflict policy are read from the Upload-Metadata keys filename,
+// filetype, folderId and onConflict. Setting fileId instead uploads a new
+// version of that file.
+func (h *Handler) CreateUpload(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	size, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid Upload-Length header"})
+		return
+	}
+
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	policy, err := service.ParseConflictPolicy(metadata["onConflict"])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	req := service.CreateUploadRequest{
+		Name:       metadata["filename"],
+		MimeType:   metadata["filetype"],
+		Size:       size,
+		OnConflict: policy,
+	}
+	if folderID := metadata["folderId"]; folderID != "" {
+		req.FolderID, err = uuid.Parse(folderID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid folderId"})
+			return
+		}
+	}
+	if fileID := metadata["fileId"]; fileID != "" {
+		req.FileID, err = uuid.Parse(fileID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid fileId"})
+			return
+		}
+	}
+
+	upload, file, err := h.upload.CreateUpload(c.Request.Context(), userID, req)
+	if err != nil {
+		writeUploadError(c, err)
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.Id.String())
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if file != nil {
+		c.Header("X-File-Id", file.Id.String())
+	}
+	c.Status(http.StatusCreated)
+}
+
+// GetUploadOffset reports how many bytes of an upload have been received.
+func (h *Handler) GetUploadOffset(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	upload, err := h.upload.GetUpload(c.Request.Context(), userID, id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload appends a chunk to an upload.
+func (h *Handler) PatchUpload(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: model.ErrNotFound.Error()})
+		return
+	}
+
+	if c.ContentType() != tusChunkContentType {
+		c.JSON(http.StatusUnsupportedMediaType, Response{Status: http.StatusUnsupportedMediaType, Message: "content type must be " + tusChunkContentType})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid Upload-Offset header"})
+		return
+	}
+
+	upload, file, err := h.upload.WriteChunk(
+		c.Request.Context(),
+		userID,
+		id,
+		offset,
+		c.Request.Body,
+		c.Request.ContentLength,
+		c.GetHeader("Upload-Checksum"),
+	)
+	if err != nil {
+		writeUploadError(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if file != nil {
+		c.Header("X-File-Id", file.Id.String())
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// TerminateUpload cancels an upload and discards its data.
+func (h *Handler) TerminateUpload(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: model.ErrNotFound.Error()})
+		return
+	}
+
+	if err := h.upload.TerminateUpload(c.Request.Context(), userID, id); err != nil {
+		writeUploadError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func writeUploadError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	message := ErrServerError.Error()
+
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		status, message = http.StatusNotFound, err.Error()
+	case errors.Is(err, service.ErrForbidden):
+		status, message = http.StatusForbidden, err.Error()
+	case errors.Is(err, service.ErrOffsetMismatch), errors.Is(err, model.ErrDuplicateName), errors.Is(err, model.ErrConflict):
+		status, message = http.StatusConflict, err.Error()
+	case errors.Is(err, service.ErrUploadTooLarge):
+		status, message = http.StatusRequestEntityTooLarge, err.Error()
+	case errors.Is(err, service.ErrQuotaExceeded):
+		status, message = http.StatusInsufficientStorage, err.Error()
+	case errors.Is(err, service.ErrChecksumMismatch):
+		status, message = statusChecksumMismatch, err.Error()
+	case errors.Is(err, service.ErrUnsupportedChecksum), errors.Is(err, service.ErrInvalidUploadLength),
+		errors.Is(err, service.ErrInvalidName):
+		status, message = http.StatusBadRequest, err.Error()
+	default:
+		slog.Error("upload request failed", "error", err)
+	}
+
+	c.JSON(status, Response{Status: status, Message: message})
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma separated
+// pairs of a key and a base64 encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata header")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("invalid Upload-Metadata header")
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
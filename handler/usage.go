@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStorageUsage reports the user's used storage, their quota and a
+// breakdown by MIME type.
+func (h *Handler) GetStorageUsage(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	usage, err := h.file.GetUsage(c.Request.Context(), userID)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, UsageResponse{Status: http.StatusOK, Usage: usage})
+}
+
+// SetUserQuota godoc
+//
+//	@Summary		Set user quota
+//	@Description	Set a user's storage limit in bytes, 0 meaning unlimited. A null limit makes the server default apply again. Admins only.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string	true	"User ID"
+//	@Param			quota	body		object	true	"New limit"
+//	@Success		200		{object}	UsageResponse
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/users/{id}/quota [put]
+func (h *Handler) SetUserQuota(c *gin.Context) {
+	userID, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	var input struct {
+		Limit *int64 `json:"limit"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	usage, err := h.file.SetUserQuota(c.Request.Context(), userID, input.Limit)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, UsageResponse{Status: http.StatusOK, Usage: usage})
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/freekobie/kora/model"
@@ -79,7 +81,7 @@ func (h *Handler) VerifyUser(c *gin.Context) {
 
 	user, err := h.user.VerifyUser(c.Request.Context(), input.Code, input.Email)
 	if err != nil {
-		if errors.Is(err, service.ErrInvalidToken) {
+		if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrTooManyGuesses) {
 			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
 			return
 		}
@@ -132,10 +134,77 @@ func (h *Handler) RequestVerificationCode(c *gin.Context) {
 
 }
 
+// ForgotPassword godoc
+//
+//	@Summary		Request password reset
+//	@Description	Email a password reset code. The response is the same whether or not an account uses the address.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			email	body		object	true	"User email"
+//	@Success		202		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Router			/auth/password/forgot [post]
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	// failures are logged but not reported, so the response gives away nothing about the account
+	if err := h.user.RequestPasswordReset(c.Request.Context(), input.Email); err != nil {
+		slog.Error("failed to request password reset", "error", err)
+	}
+
+	c.JSON(http.StatusAccepted, Response{Status: http.StatusAccepted, Message: "if an account uses this email, a password reset code has been sent to it"})
+}
+
+// ResetPassword godoc
+//
+//	@Summary		Reset password
+//	@Description	Set a new password with a code from /auth/password/forgot. All existing sessions are ended.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			reset	body		object	true	"Email, reset code and new password"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/auth/password/reset [post]
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var input struct {
+		Email    string `json:"email" binding:"required,email"`
+		Code     string `json:"code" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	err := h.user.ResetPassword(c.Request.Context(), input.Email, input.Code, input.Password)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrTooManyGuesses) ||
+			errors.Is(err, service.ErrInvalidPassword) {
+			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "password has been reset"})
+}
+
 // LoginUser godoc
 //
 //	@Summary		Login user
-//	@Description	Authenticate user and return session tokens
+//	@Description	Authenticate user and return session tokens. Users with two-factor authentication get a challenge token instead, to be exchanged at /auth/login/2fa.
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
@@ -143,6 +212,7 @@ func (h *Handler) RequestVerificationCode(c *gin.Context) {
 //	@Success		200			{object}	SessionResponse
 //	@Failure		400			{object}	Response
 //	@Failure		401			{object}	Response
+//	@Failure		429			{object}	Response
 //	@Failure		500			{object}	Response
 //	@Router			/auth/login [post]
 func (h *Handler) LoginUser(c *gin.Context) {
@@ -156,8 +226,11 @@ func (h *Handler) LoginUser(c *gin.Context) {
 		return
 	}
 
-	session, err := h.user.NewSession(c.Request.Context(), input.Email, input.Password)
+	session, err := h.user.NewSession(c.Request.Context(), input.Email, input.Password, clientInfo(c))
 	if err != nil {
+		if writeTooManyAttempts(c, err) {
+			return
+		}
 		if errors.Is(err, service.ErrFailedOperation) {
 			c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
 			return
@@ -169,10 +242,24 @@ func (h *Handler) LoginUser(c *gin.Context) {
 	c.JSON(http.StatusOK, SessionResponse{Status: http.StatusOK, Session: *session})
 }
 
+// writeTooManyAttempts responds with 429 and a Retry-After header if err
+// refuses an attempt after too many failures, and reports whether it did.
+func writeTooManyAttempts(c *gin.Context, err error) bool {
+	var tooMany *service.TooManyAttemptsError
+	if !errors.As(err, &tooMany) {
+		return false
+	}
+
+	seconds := int(math.Ceil(tooMany.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, Response{Status: http.StatusTooManyRequests, Message: err.Error()})
+	return true
+}
+
 // GetUserAccessToken godoc
 //
 //	@Summary		Refresh access token
-//	@Description	Get a new access token using a refresh token
+//	@Description	Get a new access token using a refresh token. The refresh token is rotated: the response carries a new one and the old one stops working. Reusing an old refresh token ends the session.
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
@@ -193,7 +280,7 @@ func (h *Handler) GetUserAccessToken(c *gin.Context) {
 		return
 	}
 
-	access, err := h.user.RefreshSession(c.Request.Context(), input.RefresToken)
+	access, err := h.user.RefreshSession(c.Request.Context(), input.RefresToken, clientInfo(c))
 	if err != nil {
 		if errors.Is(err, service.ErrFailedOperation) {
 			c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
@@ -206,16 +293,144 @@ func (h *Handler) GetUserAccessToken(c *gin.Context) {
 	c.JSON(http.StatusOK, AccessResponse{Status: http.StatusOK, Access: *access})
 }
 
+// LogoutUser godoc
+//
+//	@Summary		Logout
+//	@Description	End the session a refresh token belongs to
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			refreshToken	body		object	true	"Refresh token"
+//	@Success		200				{object}	Response
+//	@Failure		400				{object}	Response
+//	@Failure		401				{object}	Response
+//	@Failure		500				{object}	Response
+//	@Router			/auth/logout [post]
+func (h *Handler) LogoutUser(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refreshToken" binding:"required,jwt"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	if err := h.user.Logout(c.Request.Context(), input.RefreshToken); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, Response{Status: http.StatusUnauthorized, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "logged out"})
+}
+
+// LogoutEverywhere godoc
+//
+//	@Summary		Logout everywhere
+//	@Description	End all of the user's sessions on every device
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/auth/logout/all [post]
+func (h *Handler) LogoutEverywhere(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	if err := h.user.LogoutEverywhere(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "logged out of all sessions"})
+}
+
+// ListSessions godoc
+//
+//	@Summary		List sessions
+//	@Description	List the devices the user is signed in on
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Produce		json
+//	@Success		200	{object}	SessionsResponse
+//	@Failure		500	{object}	Response
+//	@Router			/users/me/sessions [get]
+func (h *Handler) ListSessions(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	sessions, err := h.user.ListSessions(c.Request.Context(), userID, getSessionID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, SessionsResponse{Status: http.StatusOK, Sessions: sessions})
+}
+
+// RevokeSession godoc
+//
+//	@Summary		Revoke session
+//	@Description	Sign the user out of one of their sessions
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Produce		json
+//	@Param			id	path		string	true	"Session ID"
+//	@Success		200	{object}	Response
+//	@Failure		400	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/users/me/sessions/{id} [delete]
+func (h *Handler) RevokeSession(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	if err := h.user.RevokeSession(c.Request.Context(), userID, id); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "session revoked"})
+}
+
 // GetUser godoc
 //
 //	@Summary		Get user by ID
-//	@Description	Get user details by user ID
+//	@Description	Get user details by user ID. Users can only fetch themselves unless they are an admin.
 //	@Tags			users
 //	@Security		BearerAuth
 //	@Produce		json
 //	@Param			id	path		string	true	"User ID"
 //	@Success		200	{object}	UserResponse
 //	@Failure		400	{object}	Response
+//	@Failure		403	{object}	Response
 //	@Failure		404	{object}	Response
 //	@Failure		500	{object}	Response
 //	@Router			/users/{id} [get]
@@ -271,7 +486,7 @@ func (h *Handler) UpdateUserData(c *gin.Context) {
 	id := uuid.MustParse(idString.(string))
 	input["id"] = id
 
-	user, err := h.user.UpdateUser(c.Request.Context(), input)
+	user, err := h.user.UpdateUser(c.Request.Context(), getSessionID(c), input)
 	if err != nil {
 		if errors.Is(err, service.ErrFailedOperation) {
 			c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
@@ -284,16 +499,162 @@ func (h *Handler) UpdateUserData(c *gin.Context) {
 	c.JSON(http.StatusOK, UserResponse{Status: http.StatusOK, User: *user})
 }
 
+// RequestEmailChange godoc
+//
+//	@Summary		Request email change
+//	@Description	Send a confirmation code to a new email address. The current address is notified of the request.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Accept			json
+//	@Produce		json
+//	@Param			change	body		object	true	"New email and current password"
+//	@Success		202		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		401		{object}	Response
+//	@Failure		409		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/users/me/email [post]
+func (h *Handler) RequestEmailChange(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	err = h.user.RequestEmailChange(c.Request.Context(), userID, input.Email, input.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, Response{Status: http.StatusUnauthorized, Message: err.Error()})
+		case errors.Is(err, service.ErrSameEmail):
+			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		case errors.Is(err, service.ErrEmailInUse):
+			c.JSON(http.StatusConflict, Response{Status: http.StatusConflict, Message: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Response{Status: http.StatusAccepted, Message: fmt.Sprintf("a confirmation code has been sent to '%s'", input.Email)})
+}
+
+// ConfirmEmailChange godoc
+//
+//	@Summary		Confirm email change
+//	@Description	Switch to the new email address using the code sent to it. All sessions are ended, so the user has to log in again.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Accept			json
+//	@Produce		json
+//	@Param			code	body		object	true	"Confirmation code"
+//	@Success		200		{object}	UserResponse
+//	@Failure		400		{object}	Response
+//	@Failure		409		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/users/me/email/confirm [post]
+func (h *Handler) ConfirmEmailChange(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	user, err := h.user.ConfirmEmailChange(c.Request.Context(), userID, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrTooManyGuesses):
+			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		case errors.Is(err, service.ErrEmailInUse):
+			c.JSON(http.StatusConflict, Response{Status: http.StatusConflict, Message: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, UserResponse{Status: http.StatusOK, User: *user})
+}
+
+// SetUserRole godoc
+//
+//	@Summary		Set user role
+//	@Description	Make a user an admin or a regular user. Admins only. A change of role signs the user out everywhere.
+//	@Tags			users
+//	@Security		BearerAuth
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string	true	"User ID"
+//	@Param			role	body		object	true	"New role"
+//	@Success		200		{object}	UserResponse
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/users/{id}/role [put]
+func (h *Handler) SetUserRole(c *gin.Context) {
+	userId, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	user, err := h.user.SetUserRole(c.Request.Context(), userId, input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		case errors.Is(err, model.ErrNotFound):
+			c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, UserResponse{Status: http.StatusOK, User: *user})
+}
+
 // DeleteUser godoc
 //
 //	@Summary		Delete user
-//	@Description	Delete a user by ID
+//	@Description	Delete a user by ID. Users can only delete themselves unless they are an admin.
 //	@Tags			users
 //	@Security		BearerAuth
 //	@Produce		json
 //	@Param			id	path		string	true	"User ID"
 //	@Success		200	{object}	Response
 //	@Failure		400	{object}	Response
+//	@Failure		403	{object}	Response
 //	@Failure		404	{object}	Response
 //	@Failure		500	{object}	Response
 //	@Router			/users/{id} [delete]
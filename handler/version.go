@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/freekobie/kora/model"
+	"github.com/gin-gonic/gin"
+)
+
+// getVersionParam parses a positive version number from the path.
+func getVersionParam(c *gin.Context, key string) (int, error) {
+	version, err := strconv.Atoi(c.Param(key))
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version")
+	}
+	return version, nil
+}
+
+// UploadVersion replaces a file's contents with the uploaded "file" form
+// field, keeping the previous contents as an older version.
+func (h *Handler) UploadVersion(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	upload, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "file is required"})
+		return
+	}
+	defer upload.Close()
+
+	file, err := h.file.UploadVersion(c.Request.Context(), userID, id, upload, header)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FileResponse{Status: http.StatusOK, File: *file})
+}
+
+// ListVersions lists a file's versions, newest first.
+func (h *Handler) ListVersions(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	versions, err := h.file.ListVersions(c.Request.Context(), userID, id)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FileVersionsResponse{Status: http.StatusOK, Versions: versions})
+}
+
+// DownloadVersion streams the contents of one version of a file, with the
+// same range and conditional request support as DownloadFile.
+func (h *Handler) DownloadVersion(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	version, err := getVersionParam(c, "version")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	file, err := h.file.GetVersion(c.Request.Context(), userID, id, version)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			c.JSON(http.StatusNotFound, Response{Status: http.StatusNotFound, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	serveFile(c, file, h.file.OpenFile(c.Request.Context(), file))
+}
+
+// RestoreVersion makes an older version of a file its current contents.
+func (h *Handler) RestoreVersion(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	version, err := getVersionParam(c, "version")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	file, err := h.file.RestoreVersion(c.Request.Context(), userID, id, version)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FileResponse{Status: http.StatusOK, File: *file})
+}
+
+// DeleteVersion permanently deletes an old version of a file.
+func (h *Handler) DeleteVersion(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	id, err := getUUIDparam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: "invalid id"})
+		return
+	}
+
+	version, err := getVersionParam(c, "version")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	if err := h.file.DeleteVersion(c.Request.Context(), userID, id, version); err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Status: http.StatusOK, Message: "version deleted"})
+}
+
+// GetVersionRetention returns how many and how old versions the user keeps.
+func (h *Handler) GetVersionRetention(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	retention, err := h.file.GetVersionRetention(c.Request.Context(), userID)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, VersionRetentionResponse{Status: http.StatusOK, Retention: retention})
+}
+
+// SetVersionRetention updates the user's version limits. A limit of 0 means
+// no limit.
+func (h *Handler) SetVersionRetention(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		slog.Error("failed to fetch user id from context", "error", err)
+		c.JSON(http.StatusInternalServerError, Response{Status: http.StatusInternalServerError, Message: ErrServerError.Error()})
+		return
+	}
+
+	var input model.VersionRetention
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	if err := h.file.SetVersionRetention(c.Request.Context(), userID, input); err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, VersionRetentionResponse{Status: http.StatusOK, Retention: input})
+}
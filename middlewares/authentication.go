@@ -1,14 +1,25 @@
 package middlewares
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/freekobie/kora/model"
 	"github.com/freekobie/kora/session"
 	"github.com/gin-gonic/gin"
 )
 
-func Authentication() gin.HandlerFunc {
+// AccessTokenVerifier looks up personal access tokens.
+type AccessTokenVerifier interface {
+	VerifyAccessToken(ctx context.Context, secret string) (*model.AccessToken, *model.User, error)
+}
+
+// Authentication accepts a JWT access token or a personal access token as a
+// bearer token. Requests made with a personal access token have no session;
+// the token's scopes are stored as token_scopes instead.
+func Authentication(tokens AccessTokenVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
@@ -17,13 +28,40 @@ func Authentication() gin.HandlerFunc {
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if strings.HasPrefix(tokenString, model.AccessTokenPrefix) {
+			token, user, err := tokens.VerifyAccessToken(c.Request.Context(), tokenString)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid token"})
+				return
+			}
+
+			c.Set("user_id", user.Id.String())
+			c.Set("user_role", user.Role)
+			c.Set("token_scopes", token.Scopes)
+
+			c.Next()
+			return
+		}
+
 		claims, err := session.ValidateToken(tokenString, session.TokenTypeAccess)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid token"})
 			return
 		}
+		revoked, err := session.IsRevoked(c.Request.Context(), claims.SessionID)
+		if err != nil {
+			slog.Error("failed to check session revocation", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "the server could not process your request"})
+			return
+		}
+		if revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Session has been revoked"})
+			return
+		}
 
 		c.Set("user_id", claims.Subject)
+		c.Set("user_role", claims.Role)
+		c.Set("session_id", claims.SessionID)
 
 		c.Next()
 	}
@@ -0,0 +1,97 @@
+package middlewares_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/middlewares"
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/session"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthentication_RevokedSession(t *testing.T) {
+
+	user := &model.User{Id: uuid.New(), Email: "alice@example.com", Role: model.RoleUser}
+	sessionID := uuid.New()
+	token, err := session.GenerateToken(user, sessionID, time.Hour, session.TokenTypeAccess)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/me", middlewares.Authentication(nil), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("session_id"))
+	})
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, sessionID.String(), w.Body.String())
+
+	require.NoError(t, session.RevokeSession(context.Background(), sessionID.String(), time.Now().Add(time.Hour)))
+	assert.Equal(t, http.StatusUnauthorized, get().Code)
+}
+
+// stubTokens accepts a single personal access token.
+type stubTokens struct {
+	secret string
+	token  model.AccessToken
+	user   model.User
+}
+
+func (s stubTokens) VerifyAccessToken(ctx context.Context, secret string) (*model.AccessToken, *model.User, error) {
+	if secret != s.secret {
+		return nil, nil, errors.New("invalid token")
+	}
+	return &s.token, &s.user, nil
+}
+
+func TestAuthentication_AccessToken(t *testing.T) {
+
+	user := model.User{Id: uuid.New(), Email: "alice@example.com", Role: model.RoleUser}
+	tokens := stubTokens{
+		secret: model.AccessTokenPrefix + "secret",
+		token:  model.AccessToken{Id: uuid.New(), UserID: user.Id, Scopes: []string{model.ScopeFilesRead}},
+		user:   user,
+	}
+	jwt, err := session.GenerateToken(&user, uuid.New(), time.Hour, session.TokenTypeAccess)
+	require.NoError(t, err)
+
+	router := gin.New()
+	authed := router.Group("/", middlewares.Authentication(tokens))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, c.GetString("user_id")) }
+	authed.GET("/files", middlewares.RequireScope(model.ScopeFilesRead), ok)
+	authed.POST("/files", middlewares.RequireScope(model.ScopeFilesWrite), ok)
+	authed.GET("/sessions", middlewares.RequireSession(), ok)
+
+	do := func(method, path, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/files", tokens.secret)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, user.Id.String(), w.Body.String())
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/files", tokens.secret).Code, "the token lacks files:write")
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/sessions", tokens.secret).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/files", model.AccessTokenPrefix+"wrong").Code)
+
+	// logged in users have every scope
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/files", jwt).Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/sessions", jwt).Code)
+}
@@ -0,0 +1,83 @@
+package middlewares
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/freekobie/kora/model"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// These middlewares run after Authentication and rely on the user_id,
+// user_role and token_scopes it stores in the context.
+
+// IsAdmin reports whether the authenticated user is an admin.
+func IsAdmin(c *gin.Context) bool {
+	return c.GetString("user_role") == model.RoleAdmin
+}
+
+// IsOwnerOrAdmin reports whether the authenticated user is the user with the
+// given ID or an admin.
+func IsOwnerOrAdmin(c *gin.Context, userID string) bool {
+	if IsAdmin(c) {
+		return true
+	}
+	id, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		return false
+	}
+	target, err := uuid.Parse(userID)
+	return err == nil && target == id
+}
+
+// RequireAdmin rejects requests from users who are not admins.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "admin access required"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// OwnerOrAdmin rejects requests for a user, given by the path parameter
+// param, other than the authenticated user, unless they are an admin.
+func OwnerOrAdmin(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsOwnerOrAdmin(c, c.Param(param)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "you can only access your own account"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSession rejects requests made with a personal access token, for
+// endpoints that only a logged in user may use.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("token_scopes"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "personal access tokens cannot be used for this endpoint"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope rejects requests made with a personal access token that does
+// not have scope. Requests in a login session have every scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scopes, ok := c.Get("token_scopes"); ok && !slices.Contains(scopes.([]string), scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "token is missing the " + scope + " scope"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,69 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freekobie/kora/middlewares"
+	"github.com/freekobie/kora/model"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// withClaims simulates Authentication for a user with the given role.
+func withClaims(userID uuid.UUID, role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", userID.String())
+		c.Set("user_role", role)
+		c.Next()
+	}
+}
+
+func TestOwnerOrAdmin(t *testing.T) {
+	self := uuid.New()
+	other := uuid.New()
+
+	tests := []struct {
+		name   string
+		role   string
+		target string
+		want   int
+	}{
+		{"own account", model.RoleUser, self.String(), http.StatusOK},
+		{"own account in upper case", model.RoleUser, strings.ToUpper(self.String()), http.StatusOK},
+		{"other account", model.RoleUser, other.String(), http.StatusForbidden},
+		{"token without role", "", other.String(), http.StatusForbidden},
+		{"admin on other account", model.RoleAdmin, other.String(), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(withClaims(self, tt.role))
+			router.GET("/users/:id", middlewares.OwnerOrAdmin("id"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/"+tt.target, nil))
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	for role, want := range map[string]int{model.RoleUser: http.StatusForbidden, model.RoleAdmin: http.StatusOK} {
+		router := gin.New()
+		router.Use(withClaims(uuid.New(), role))
+		router.PUT("/users/:id/role", middlewares.RequireAdmin(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/users/"+uuid.NewString()+"/role", nil))
+		assert.Equal(t, want, w.Code, role)
+	}
+}
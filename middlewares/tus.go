@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const TusVersion = "1.0.0"
+
+// TusResumable sets the Tus-Resumable header on every response and rejects
+// requests made with an unsupported version of the tus protocol.
+func TusResumable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", TusVersion)
+
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != TusVersion {
+			c.Header("Tus-Version", TusVersion)
+			c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"message": "unsupported tus version"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS uploads (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    folder_id uuid REFERENCES folders(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_modified TIMESTAMP NOT NULL DEFAULT now(),
+    CHECK (upload_offset <= size)
+);
+
+CREATE TABLE IF NOT EXISTS upload_chunks (
+    upload_id uuid NOT NULL REFERENCES uploads(id) ON DELETE CASCADE,
+    chunk_offset BIGINT NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key TEXT NOT NULL,
+    PRIMARY KEY (upload_id, chunk_offset)
+);
+
+CREATE INDEX idx_uploads_user_id ON uploads (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS upload_chunks;
+DROP TABLE IF EXISTS uploads;
+-- +goose StatementEnd
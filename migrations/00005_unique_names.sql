@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Rename existing duplicates before the unique indexes are created. The
+-- oldest entry keeps its name; the others get part of their ID appended
+-- before the extension, e.g. "report (1a2b3c4d).pdf".
+WITH duplicates AS (
+    SELECT id, row_number() OVER (
+        PARTITION BY user_id, parent_id, lower(name) ORDER BY created_at, id
+    ) AS n
+    FROM folders
+)
+UPDATE folders
+SET name = left(regexp_replace(name, '(\.[^.]*)?$', ' (' || left(folders.id::text, 8) || ')\1'), 255)
+FROM duplicates
+WHERE folders.id = duplicates.id AND duplicates.n > 1;
+
+WITH duplicates AS (
+    SELECT id, row_number() OVER (
+        PARTITION BY user_id, folder_id, lower(name) ORDER BY created_at, id
+    ) AS n
+    FROM files
+)
+UPDATE files
+SET name = left(regexp_replace(name, '(\.[^.]*)?$', ' (' || left(files.id::text, 8) || ')\1'), 255)
+FROM duplicates
+WHERE files.id = duplicates.id AND duplicates.n > 1;
+
+-- NULL parents mean the user's root, so they are mapped to the nil UUID to
+-- make root-level names collide as well. Names are compared case-insensitively.
+CREATE UNIQUE INDEX idx_folders_unique_name
+    ON folders (user_id, COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'::uuid), lower(name));
+CREATE UNIQUE INDEX idx_files_unique_name
+    ON files (user_id, COALESCE(folder_id, '00000000-0000-0000-0000-000000000000'::uuid), lower(name));
+
+ALTER TABLE uploads ADD COLUMN on_conflict VARCHAR(16) NOT NULL DEFAULT 'fail';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE uploads DROP COLUMN IF EXISTS on_conflict;
+DROP INDEX IF EXISTS idx_files_unique_name;
+DROP INDEX IF EXISTS idx_folders_unique_name;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Walking the folder hierarchy joins on parent_id at every level.
+CREATE INDEX IF NOT EXISTS idx_folders_parent_id ON folders (parent_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_folders_parent_id;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deleted items stay in place with deleted_at set. trash_id groups everything
+-- deleted in one operation: it is the ID of the file or folder the user
+-- deleted, so the entries listed in the trash are the rows where trash_id = id.
+ALTER TABLE folders ADD COLUMN deleted_at TIMESTAMP, ADD COLUMN trash_id uuid;
+ALTER TABLE files ADD COLUMN deleted_at TIMESTAMP, ADD COLUMN trash_id uuid;
+
+CREATE INDEX idx_folders_trash_id ON folders (trash_id) WHERE trash_id IS NOT NULL;
+CREATE INDEX idx_files_trash_id ON files (trash_id) WHERE trash_id IS NOT NULL;
+
+-- names only have to be unique among items that are not in the trash
+DROP INDEX idx_folders_unique_name;
+DROP INDEX idx_files_unique_name;
+CREATE UNIQUE INDEX idx_folders_unique_name
+    ON folders (user_id, COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'::uuid), lower(name))
+    WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_files_unique_name
+    ON files (user_id, COALESCE(folder_id, '00000000-0000-0000-0000-000000000000'::uuid), lower(name))
+    WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM files WHERE deleted_at IS NOT NULL;
+DELETE FROM folders WHERE deleted_at IS NOT NULL;
+
+DROP INDEX idx_folders_unique_name;
+DROP INDEX idx_files_unique_name;
+CREATE UNIQUE INDEX idx_folders_unique_name
+    ON folders (user_id, COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'::uuid), lower(name));
+CREATE UNIQUE INDEX idx_files_unique_name
+    ON files (user_id, COALESCE(folder_id, '00000000-0000-0000-0000-000000000000'::uuid), lower(name));
+
+DROP INDEX IF EXISTS idx_files_trash_id;
+DROP INDEX IF EXISTS idx_folders_trash_id;
+ALTER TABLE files DROP COLUMN deleted_at, DROP COLUMN trash_id;
+ALTER TABLE folders DROP COLUMN deleted_at, DROP COLUMN trash_id;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every version of a file, including the current one. The files row mirrors
+-- the content of the version it points to.
+CREATE TABLE IF NOT EXISTS file_versions (
+    id uuid PRIMARY KEY,
+    file_id uuid NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    mime_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (file_id, version)
+);
+
+ALTER TABLE files ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+INSERT INTO file_versions (id, file_id, version, mime_type, size, storage_key, created_at)
+SELECT gen_random_uuid(), id, 1, mime_type, size, storage_key, last_modified
+FROM files;
+
+-- Per-user limits on old versions. 0 means no limit.
+CREATE TABLE IF NOT EXISTS file_version_settings (
+    user_id uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    max_versions INTEGER NOT NULL DEFAULT 0 CHECK (max_versions >= 0),
+    max_age_days INTEGER NOT NULL DEFAULT 0 CHECK (max_age_days >= 0)
+);
+
+ALTER TABLE uploads ADD COLUMN file_id uuid REFERENCES files(id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE uploads DROP COLUMN IF EXISTS file_id;
+DROP TABLE IF EXISTS file_version_settings;
+ALTER TABLE files DROP COLUMN IF EXISTS version;
+DROP TABLE IF EXISTS file_versions;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+-- used_bytes is the total size of every stored file version, trashed ones
+-- included. It is maintained by the trigger below. storage_quota overrides
+-- the server's default limit when set.
+ALTER TABLE users ADD COLUMN used_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN storage_quota BIGINT CHECK (storage_quota >= 0);
+
+ALTER TABLE file_versions ADD COLUMN user_id uuid REFERENCES users(id) ON DELETE CASCADE;
+UPDATE file_versions SET user_id = files.user_id FROM files WHERE files.id = file_versions.file_id;
+ALTER TABLE file_versions ALTER COLUMN user_id SET NOT NULL;
+CREATE INDEX idx_file_versions_user_id ON file_versions (user_id);
+
+CREATE FUNCTION track_used_bytes() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET used_bytes = used_bytes + NEW.size WHERE id = NEW.user_id;
+    ELSE
+        UPDATE users SET used_bytes = used_bytes - OLD.size WHERE id = OLD.user_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER file_versions_used_bytes
+AFTER INSERT OR DELETE ON file_versions
+FOR EACH ROW EXECUTE FUNCTION track_used_bytes();
+
+UPDATE users SET used_bytes = COALESCE((SELECT sum(size) FROM file_versions WHERE user_id = users.id), 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS file_versions_used_bytes ON file_versions;
+DROP FUNCTION IF EXISTS track_used_bytes();
+ALTER TABLE file_versions DROP COLUMN IF EXISTS user_id;
+ALTER TABLE users DROP COLUMN IF EXISTS storage_quota;
+ALTER TABLE users DROP COLUMN IF EXISTS used_bytes;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Public links to a file or a folder. Only a hash of the link token is kept.
+CREATE TABLE IF NOT EXISTS share_links (
+    id uuid PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    file_id uuid REFERENCES files(id) ON DELETE CASCADE,
+    folder_id uuid REFERENCES folders(id) ON DELETE CASCADE,
+    password_hash bytea,
+    expires_at TIMESTAMP,
+    max_downloads INTEGER CHECK (max_downloads > 0),
+    download_count INTEGER NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CHECK ((file_id IS NULL) <> (folder_id IS NULL))
+);
+
+CREATE INDEX idx_share_links_user_id ON share_links (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS share_links;
+-- +goose StatementEnd
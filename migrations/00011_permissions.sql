@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Access to a file or a folder granted to another user. Access to a folder
+-- extends to everything below it.
+CREATE TABLE IF NOT EXISTS permissions (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    file_id uuid REFERENCES files(id) ON DELETE CASCADE,
+    folder_id uuid REFERENCES folders(id) ON DELETE CASCADE,
+    access VARCHAR(16) NOT NULL CHECK (access IN ('viewer', 'editor')),
+    granted_by uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CHECK ((file_id IS NULL) <> (folder_id IS NULL))
+);
+
+CREATE UNIQUE INDEX idx_permissions_file_user ON permissions (file_id, user_id) WHERE file_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_permissions_folder_user ON permissions (folder_id, user_id) WHERE folder_id IS NOT NULL;
+CREATE INDEX idx_permissions_user_id ON permissions (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS permissions;
+-- +goose StatementEnd
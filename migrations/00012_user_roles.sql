@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every user is a regular user until an admin promotes them. The first admin
+-- has to be promoted directly in the database.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Refresh tokens are rotated on every use. All tokens descending from one
+-- login share a family_id; rotated tokens are kept with rotated_at set so that
+-- reusing one can be detected and the whole family revoked.
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS family_id uuid;
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP;
+
+UPDATE user_tokens SET family_id = gen_random_uuid() WHERE scope = 'authentication';
+
+CREATE INDEX idx_user_tokens_family_id ON user_tokens (family_id);
+CREATE INDEX idx_user_tokens_user_id ON user_tokens (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_user_tokens_user_id;
+DROP INDEX IF EXISTS idx_user_tokens_family_id;
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS rotated_at;
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS family_id;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Device details of the sessions behind refresh tokens. They are copied to
+-- each new token when a refresh token is rotated.
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS ip_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP NOT NULL DEFAULT now();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS last_used_at;
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS created_at;
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS ip_address;
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS user_agent;
+-- +goose StatementEnd
@@ -0,0 +1,7 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+ALTER TYPE scope_type ADD VALUE IF NOT EXISTS 'password_reset';
+
+-- +goose Down
+-- enum values cannot be dropped; remove leftover reset codes instead
+DELETE FROM user_tokens WHERE scope = 'password_reset';
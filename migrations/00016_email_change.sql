@@ -0,0 +1,11 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+ALTER TYPE scope_type ADD VALUE IF NOT EXISTS 'email_change';
+
+-- the address an email_change code would switch the account to
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS new_email VARCHAR(255);
+
+-- +goose Down
+DELETE FROM user_tokens WHERE scope = 'email_change';
+
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS new_email;
@@ -0,0 +1,26 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+ALTER TYPE scope_type ADD VALUE IF NOT EXISTS 'two_factor';
+
+-- A row is created when a user starts enrolling and enabled once they have
+-- confirmed a code from their authenticator. last_step is the time step of
+-- the last accepted code, so that a code cannot be replayed.
+CREATE TABLE IF NOT EXISTS two_factor (
+    user_id uuid PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT now ()
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    code_hash bytea PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS two_factor;
+DELETE FROM user_tokens WHERE scope = 'two_factor';
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Keys that access and refresh tokens are signed with. The newest key signs;
+-- older ones are kept to verify tokens issued before a rotation until
+-- retires_at, when every token they signed has expired.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    kid TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    private_key bytea NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now (),
+    retires_at TIMESTAMP NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS signing_keys;
+-- +goose StatementEnd
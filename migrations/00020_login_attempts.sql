@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Failed login and code attempts, keyed by what they were made against: an
+-- account, a client IP address or a user's one-time codes.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL DEFAULT now (),
+    locked_until TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_attempts;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Logins started at the identity provider, waiting for the user to be sent
+-- back with a code.
+CREATE TABLE IF NOT EXISTS oidc_states (
+    state_hash TEXT PRIMARY KEY,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Accounts at identity providers that users sign in with.
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now (),
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS oidc_states;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Challenges of WebAuthn ceremonies in progress. user_id is set while
+-- registering a passkey and null while signing in with one.
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    challenge_hash TEXT PRIMARY KEY,
+    user_id uuid REFERENCES users (id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS passkeys (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    credential_id bytea NOT NULL UNIQUE,
+    -- COSE_Key encoded credential public key
+    public_key bytea NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT now (),
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX idx_passkeys_user_id ON passkeys (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS passkeys;
+DROP TABLE IF EXISTS webauthn_challenges;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Signing keys are now encrypted with a key encryption key from the
+-- environment. The keys stored so far are in the clear and may have been
+-- copied with the database, so they are dropped rather than encrypted; a new
+-- key is made on startup and users sign in again.
+DELETE FROM signing_keys;
+ALTER TABLE signing_keys RENAME COLUMN private_key TO encrypted_private_key;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM signing_keys;
+ALTER TABLE signing_keys RENAME COLUMN encrypted_private_key TO private_key;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Sessions whose access tokens are rejected. Rows are kept until expires_at,
+-- when every access token issued for the session has expired.
+CREATE TABLE IF NOT EXISTS revoked_sessions (
+    session_id uuid PRIMARY KEY,
+    revoked_at TIMESTAMP NOT NULL DEFAULT now (),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_revoked_sessions_expires_at ON revoked_sessions (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS revoked_sessions;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Bytes set aside for files being written, so that concurrent writes cannot
+-- together exceed a quota. A reservation is released once the file version
+-- is recorded and counts in used_bytes; reservations of writes that never
+-- finish lapse at expires_at.
+CREATE TABLE IF NOT EXISTS quota_reservations (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    bytes BIGINT NOT NULL CHECK (bytes >= 0),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_quota_reservations_user_id ON quota_reservations (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS quota_reservations;
+-- +goose StatementEnd
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AccessTokenPrefix starts every personal access token, which tells them
+// apart from JWTs and makes leaked tokens easy to search for.
+const AccessTokenPrefix = "kora_pat_"
+
+// Scopes limit what a personal access token can be used for.
+const (
+	ScopeFilesRead  = "files:read"
+	ScopeFilesWrite = "files:write"
+)
+
+// AccessToken is a long-lived personal access token for scripts and CI.
+// The token itself is only known when it is created; just its hash is kept.
+type AccessToken struct {
+	Id         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"userId"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// HasScope reports whether the token grants scope.
+func (t AccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// AccessTokenStorage is an interface for persisting personal access tokens.
+type AccessTokenStorage interface {
+	InsertAccessToken(ctx context.Context, token *AccessToken, tokenHash string) error
+	// GetAccessTokenByHash returns an unexpired token.
+	GetAccessTokenByHash(ctx context.Context, tokenHash string) (AccessToken, error)
+	// ListAccessTokens returns a user's tokens, newest first, including
+	// expired ones.
+	ListAccessTokens(ctx context.Context, userID uuid.UUID) ([]AccessToken, error)
+	// DeleteAccessToken revokes one of a user's tokens, returning ErrNotFound
+	// if they have no such token.
+	DeleteAccessToken(ctx context.Context, userID, id uuid.UUID) error
+	// TouchAccessToken records that a token was used.
+	TouchAccessToken(ctx context.Context, id uuid.UUID) error
+}
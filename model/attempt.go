@@ -0,0 +1,28 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttempts counts recent failed attempts against a key, such as an
+// account or a client address.
+type LoginAttempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	// LockedUntil is set while further attempts are refused.
+	LockedUntil *time.Time
+}
+
+// LoginAttemptStorage is an interface for persisting failed attempts, so
+// that limits hold across instances of the API.
+type LoginAttemptStorage interface {
+	GetLoginAttempts(ctx context.Context, key string) (LoginAttempts, error)
+	// RecordFailedAttempt counts a failure against key and returns the
+	// number of failures. Failures before window ago are forgotten.
+	RecordFailedAttempt(ctx context.Context, key string, window time.Duration) (int, error)
+	// LockAttempts refuses attempts against key until the given time.
+	LockAttempts(ctx context.Context, key string, until time.Time) error
+	ClearLoginAttempts(ctx context.Context, key string) error
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// BlobInfo describes an object held by a BlobStore.
+type BlobInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// BlobStore is an interface for storing and retrieving file contents.
+// Implementations return ErrNotFound when a key does not exist.
+type BlobStore interface {
+	// Put stores the contents of r under key. size may be -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns a reader for length bytes of the object starting at offset.
+	// A negative length reads to the end of the object.
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+}
@@ -7,4 +7,7 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrInvalidToken       = errors.New("invalid token")
 	ErrDuplicateUser      = errors.New("user already exists")
+	ErrConflict           = errors.New("resource was modified concurrently")
+	ErrDuplicateName      = errors.New("an item with this name already exists in the folder")
+	ErrCycle              = errors.New("a folder cannot be inside itself")
 )
@@ -7,29 +7,149 @@ import (
 	"github.com/google/uuid"
 )
 
+// Folder is a folder owned by a user. ParentID is uuid.Nil for folders at
+// the user's root. Folders in the trash keep their original ParentID.
 type Folder struct {
-	Id           uuid.UUID `json:"id"`
-	Name         string    `json:"name"`
-	UserID       uuid.UUID `json:"userId"`
-	ParentID     uuid.UUID `json:"parentId,omitempty"`
-	CreatedAt    time.Time `json:"createdAt"`
-	LastModified time.Time `json:"lastModified"`
+	Id           uuid.UUID  `json:"id"`
+	Name         string     `json:"name"`
+	UserID       uuid.UUID  `json:"userId"`
+	ParentID     uuid.UUID  `json:"parentId,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastModified time.Time  `json:"lastModified"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	// TrashID is the ID of the item whose deletion put this one in the
+	// trash. It equals Id for the items listed in the trash.
+	TrashID uuid.UUID `json:"-"`
 }
 
+// File is the metadata of a stored file. FolderID is uuid.Nil for files at
+// the user's root. Files in the trash keep their original FolderID.
 type File struct {
-	Id           uuid.UUID `json:"id"`
-	Name         string    `json:"name"`
-	UserID       uuid.UUID `json:"userId"`
-	FolderID     uuid.UUID `json:"folderId,omitempty"`
-	MimeType     string    `json:"mimeType"`
-	Size         int64     `json:"size"`
-	StorageKey   string    `json:"-"`
-	CreatedAt    time.Time `json:"createdAt"`
-	LastModified time.Time `json:"lastModified"`
+	Id           uuid.UUID  `json:"id"`
+	Name         string     `json:"name"`
+	UserID       uuid.UUID  `json:"userId"`
+	FolderID     uuid.UUID  `json:"folderId,omitempty"`
+	MimeType     string     `json:"mimeType"`
+	Size         int64      `json:"size"`
+	StorageKey   string     `json:"-"`
+	Version      int        `json:"version"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastModified time.Time  `json:"lastModified"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	// TrashID works like Folder.TrashID.
+	TrashID uuid.UUID `json:"-"`
+}
+
+// Trash lists the items a user deleted, most recent first. Items deleted
+// along with a folder are not listed separately.
+type Trash struct {
+	Folders []Folder `json:"folders"`
+	Files   []File   `json:"files"`
+}
+
+// FolderNode is a folder in a folder tree. FileCount and Size cover the files
+// directly inside the folder; the totals include every subfolder as well.
+type FolderNode struct {
+	Folder
+	FileCount      int64         `json:"fileCount"`
+	Size           int64         `json:"size"`
+	TotalFileCount int64         `json:"totalFileCount"`
+	TotalSize      int64         `json:"totalSize"`
+	HasChildren    bool          `json:"hasChildren"`
+	Children       []*FolderNode `json:"children"`
+}
+
+// ConflictPolicy decides what happens when a file or folder is saved under a
+// name that is already taken in the destination folder.
+type ConflictPolicy string
+
+const (
+	// ConflictFail rejects the operation with ErrDuplicateName.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictRename saves under the first free name, e.g. "report (1).pdf".
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictReplace stores the contents as a new version of the existing
+	// file. It does not apply to folders.
+	ConflictReplace ConflictPolicy = "replace"
+)
+
+// Sort keys accepted by ListOptions.
+const (
+	SortByName         = "name"
+	SortByCreatedAt    = "createdAt"
+	SortByLastModified = "lastModified"
+	SortBySize         = "size"
+)
+
+// ListOptions controls the ordering and pagination of a folder listing.
+type ListOptions struct {
+	Sort   string
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+// FolderContents is one page of a folder's children. Folders are always
+// listed before files; Total counts both.
+type FolderContents struct {
+	Folders []Folder `json:"folders"`
+	Files   []File   `json:"files"`
+	Total   int      `json:"total"`
 }
 
 // FileStorage is an interface for storing and retrieving file metadata.
+// GetFile, GetFolder and GetAncestors include items in the trash; every
+// other lookup and listing skips them.
 type FileStorage interface {
 	CreateFolder(ctx context.Context, folder *Folder) error
 	CreateFile(ctx context.Context, file *File) error
+	GetFile(ctx context.Context, id uuid.UUID) (File, error)
+	UpdateFile(ctx context.Context, file *File) error
+	DeleteFile(ctx context.Context, id uuid.UUID) error
+	GetFolder(ctx context.Context, id uuid.UUID) (Folder, error)
+	// UpdateFolder fails with ErrCycle if the folder's parent is the folder
+	// itself or one of its descendants.
+	UpdateFolder(ctx context.Context, folder *Folder) error
+	DeleteFolder(ctx context.Context, id uuid.UUID) error
+	// ListFolder returns the children of folderID, or of the user's root
+	// when folderID is uuid.Nil.
+	ListFolder(ctx context.Context, userID, folderID uuid.UUID, opts ListOptions) (FolderContents, error)
+	// GetAncestors returns the path from the root down to and including folderID.
+	GetAncestors(ctx context.Context, folderID uuid.UUID) ([]Folder, error)
+	// GetSubtree returns a folder, followed by all its descendant folders,
+	// and the files they contain.
+	GetSubtree(ctx context.Context, folderID uuid.UUID) ([]Folder, []File, error)
+	// GetFolderTree returns every folder below parentID, or below the user's
+	// root when parentID is uuid.Nil, with FileCount and Size filled in.
+	// Parents come before their children and siblings are ordered by name.
+	GetFolderTree(ctx context.Context, userID, parentID uuid.UUID) ([]FolderNode, error)
+	// GetFileByName finds a file by name, ignoring case, in folderID or the
+	// user's root.
+	GetFileByName(ctx context.Context, userID, folderID uuid.UUID, name string) (File, error)
+	// ListFolderNames and ListFileNames return the names of the subfolders or
+	// files of folderID that start with prefix, ignoring case.
+	ListFolderNames(ctx context.Context, userID, folderID uuid.UUID, prefix string) ([]string, error)
+	ListFileNames(ctx context.Context, userID, folderID uuid.UUID, prefix string) ([]string, error)
+	// GetFolderByName finds a folder by name, ignoring case, in parentID or
+	// the user's root.
+	GetFolderByName(ctx context.Context, userID, parentID uuid.UUID, name string) (Folder, error)
+
+	// TrashFile moves a file to the trash.
+	TrashFile(ctx context.Context, id uuid.UUID, deletedAt time.Time) error
+	// TrashFolder moves a folder to the trash along with everything in it.
+	TrashFolder(ctx context.Context, id uuid.UUID, deletedAt time.Time) error
+	ListTrash(ctx context.Context, userID uuid.UUID) (Trash, error)
+	// RestoreFile and RestoreFolder take an item listed in the trash out of
+	// it, saving the name and location set on it. Restoring a folder also
+	// restores everything deleted with it.
+	RestoreFile(ctx context.Context, file *File) error
+	RestoreFolder(ctx context.Context, folder *Folder) error
+	// PurgeTrash permanently removes the trash entries deleted before the
+	// given time, for one user or for everyone when userID is uuid.Nil. It
+	// returns the storage keys of every version of the removed files.
+	PurgeTrash(ctx context.Context, userID uuid.UUID, before time.Time) ([]string, error)
+
+	FileVersionStorage
+	QuotaStorage
+	PermissionStorage
 }
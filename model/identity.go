@@ -0,0 +1,40 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OIDCState is a login started at an identity provider. StateHash is the
+// hash of the state parameter the provider sends back.
+type OIDCState struct {
+	StateHash string
+	Nonce     string
+	// Verifier is the PKCE code verifier the login is completed with.
+	Verifier  string
+	ExpiresAt time.Time
+}
+
+// Identity links a user to their account at an identity provider.
+type Identity struct {
+	Issuer  string
+	Subject string
+	UserID  uuid.UUID
+	// Email is the address the provider gave when the identity was linked.
+	Email     string
+	CreatedAt time.Time
+}
+
+// IdentityStorage is an interface for persisting single sign-on logins and
+// the identities users sign in with.
+type IdentityStorage interface {
+	InsertOIDCState(ctx context.Context, state *OIDCState) error
+	// TakeOIDCState deletes and returns a state, so that it is used once. It
+	// returns ErrNotFound if there is no such state.
+	TakeOIDCState(ctx context.Context, stateHash string) (OIDCState, error)
+	GetIdentity(ctx context.Context, issuer, subject string) (Identity, error)
+	// InsertIdentity returns ErrConflict if the identity is already linked.
+	InsertIdentity(ctx context.Context, identity *Identity) error
+}
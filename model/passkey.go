@@ -0,0 +1,54 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Passkey is a WebAuthn credential a user signs in with instead of a
+// password.
+type Passkey struct {
+	Id     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"userId"`
+	Name   string    `json:"name"`
+	// CredentialID is chosen by the authenticator and names the passkey in
+	// ceremonies.
+	CredentialID []byte `json:"-"`
+	// PublicKey is the credential public key in COSE_Key form.
+	PublicKey []byte `json:"-"`
+	// SignCount is the authenticator's signature counter at the last use.
+	SignCount  uint32     `json:"-"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// WebAuthnChallenge is the challenge of a WebAuthn ceremony in progress.
+// UserID is the user registering a passkey, or uuid.Nil for a sign-in.
+type WebAuthnChallenge struct {
+	ChallengeHash string
+	UserID        uuid.UUID
+	ExpiresAt     time.Time
+}
+
+// PasskeyStorage is an interface for persisting passkeys and the challenges
+// of WebAuthn ceremonies.
+type PasskeyStorage interface {
+	InsertWebAuthnChallenge(ctx context.Context, challenge *WebAuthnChallenge) error
+	// TakeWebAuthnChallenge deletes and returns a challenge, so that it is
+	// used once. It returns ErrNotFound if there is no such challenge.
+	TakeWebAuthnChallenge(ctx context.Context, challengeHash string) (WebAuthnChallenge, error)
+	// InsertPasskey returns ErrConflict if the credential is already
+	// registered.
+	InsertPasskey(ctx context.Context, passkey *Passkey) error
+	GetPasskeyByCredentialID(ctx context.Context, credentialID []byte) (Passkey, error)
+	// ListPasskeys returns a user's passkeys, newest first.
+	ListPasskeys(ctx context.Context, userID uuid.UUID) ([]Passkey, error)
+	// UsePasskey records a sign-in that reported signCount. It returns
+	// ErrConflict if a sign-in with that count or a later one already was,
+	// unless the authenticator does not count and reports zero.
+	UsePasskey(ctx context.Context, id uuid.UUID, signCount uint32) error
+	// DeletePasskey returns ErrNotFound if the user has no such passkey.
+	DeletePasskey(ctx context.Context, userID, id uuid.UUID) error
+}
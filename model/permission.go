@@ -0,0 +1,62 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Access is a level of access to a file or folder. Each level includes the
+// ones before it.
+type Access string
+
+const (
+	AccessViewer Access = "viewer"
+	AccessEditor Access = "editor"
+	// AccessOwner is never granted; it belongs to the user who owns an item.
+	AccessOwner Access = "owner"
+)
+
+// Permission grants another user access to a file, or to a folder and
+// everything below it. Exactly one of FileID and FolderID is set.
+type Permission struct {
+	Id uuid.UUID `json:"id"`
+	// UserID is the user the access is granted to.
+	UserID    uuid.UUID `json:"userId"`
+	Email     string    `json:"email,omitempty"`
+	FileID    uuid.UUID `json:"fileId,omitempty"`
+	FolderID  uuid.UUID `json:"folderId,omitempty"`
+	Access    Access    `json:"access"`
+	GrantedBy uuid.UUID `json:"grantedBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SharedResource is a file or folder another user has granted access to.
+type SharedResource struct {
+	PermissionID uuid.UUID `json:"permissionId"`
+	Access       Access    `json:"access"`
+	SharedAt     time.Time `json:"sharedAt"`
+	File         *File     `json:"file,omitempty"`
+	Folder       *Folder   `json:"folder,omitempty"`
+}
+
+// PermissionStorage is an interface for persisting access granted to other
+// users.
+type PermissionStorage interface {
+	// SavePermission grants access, replacing the access level of an
+	// existing grant to the same user on the same item, whose ID and creation
+	// time are then set on permission.
+	SavePermission(ctx context.Context, permission *Permission) error
+	GetPermission(ctx context.Context, id uuid.UUID) (Permission, error)
+	// ListPermissions returns the grants on a file or a folder, with the
+	// grantees' email addresses filled in.
+	ListPermissions(ctx context.Context, fileID, folderID uuid.UUID) ([]Permission, error)
+	// ListUserPermissions returns the grants made to a user, newest first.
+	ListUserPermissions(ctx context.Context, userID uuid.UUID) ([]Permission, error)
+	DeletePermission(ctx context.Context, id uuid.UUID) error
+	// GetAccess returns the highest access granted to userID on a file or a
+	// folder, directly or through any folder above it, or "" if there is
+	// none. One of fileID and folderID is set.
+	GetAccess(ctx context.Context, userID, fileID, folderID uuid.UUID) (Access, error)
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StorageUsage reports how much of their quota a user has used. Every
+// stored version counts, including those of files in the trash.
+type StorageUsage struct {
+	Used int64 `json:"used"`
+	// Limit is the user's quota in bytes, or 0 when there is none.
+	Limit  int64       `json:"limit"`
+	ByType []TypeUsage `json:"byType"`
+}
+
+// TypeUsage is the share of a user's storage taken by one MIME type.
+type TypeUsage struct {
+	MimeType string `json:"mimeType"`
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// QuotaReservation sets bytes aside in a user's quota for a file being
+// written.
+type QuotaReservation struct {
+	Id     uuid.UUID
+	UserID uuid.UUID
+	Bytes  int64
+	// ExpiresAt is when the reservation lapses if it is not released.
+	ExpiresAt time.Time
+}
+
+// QuotaStorage is an interface for reading users' storage consumption and
+// reserving space in it.
+type QuotaStorage interface {
+	// GetQuota returns the bytes stored by a user and their own limit, which
+	// is nil when the server default applies.
+	GetQuota(ctx context.Context, userID uuid.UUID) (used int64, limit *int64, err error)
+	// SetQuota sets a user's own limit, or clears it when limit is nil so
+	// that the server default applies.
+	SetQuota(ctx context.Context, userID uuid.UUID, limit *int64) error
+	// GetUsageByType breaks a user's stored bytes down by MIME type, largest
+	// first.
+	GetUsageByType(ctx context.Context, userID uuid.UUID) ([]TypeUsage, error)
+	// ReserveQuota adds reservation.Bytes to the reservation, creating it if
+	// needed and moving its expiry to reservation.ExpiresAt, if the user's
+	// stored and reserved bytes then stay within their limit. defaultLimit
+	// applies to users without a limit of their own; 0 means unlimited. It
+	// reports whether the bytes fit.
+	ReserveQuota(ctx context.Context, reservation *QuotaReservation, defaultLimit int64) (bool, error)
+	// ReleaseQuota deletes a reservation.
+	ReleaseQuota(ctx context.Context, id uuid.UUID) error
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevocationStorage is an interface for persisting revoked sessions, so that
+// every instance of the API rejects their access tokens.
+type RevocationStorage interface {
+	// InsertRevocation rejects the access tokens of sessionID until
+	// expiresAt. Revoking a session again keeps the later expiry.
+	InsertRevocation(ctx context.Context, sessionID uuid.UUID, expiresAt time.Time) error
+	// GetRevocation returns when the revocation of sessionID lapses. It
+	// returns ErrNotFound if the session is not revoked.
+	GetRevocation(ctx context.Context, sessionID uuid.UUID) (time.Time, error)
+}
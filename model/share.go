@@ -0,0 +1,48 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink gives anyone holding its token access to a file, or to a folder
+// and everything below it, without signing in. Exactly one of FileID and
+// FolderID is set.
+type ShareLink struct {
+	Id            uuid.UUID  `json:"id"`
+	TokenHash     string     `json:"-"`
+	UserID        uuid.UUID  `json:"userId"`
+	FileID        uuid.UUID  `json:"fileId,omitempty"`
+	FolderID      uuid.UUID  `json:"folderId,omitempty"`
+	PasswordHash  []byte     `json:"-"`
+	HasPassword   bool       `json:"hasPassword"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	MaxDownloads  *int       `json:"maxDownloads,omitempty"`
+	DownloadCount int        `json:"downloadCount"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// SharedItem is what a share link points at, as shown to its visitors.
+type SharedItem struct {
+	File          *File      `json:"file,omitempty"`
+	Folder        *Folder    `json:"folder,omitempty"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	DownloadsLeft *int       `json:"downloadsLeft,omitempty"`
+}
+
+// ShareStorage is an interface for persisting share links.
+type ShareStorage interface {
+	CreateShareLink(ctx context.Context, link *ShareLink) error
+	GetShareLink(ctx context.Context, id uuid.UUID) (ShareLink, error)
+	GetShareLinkByToken(ctx context.Context, tokenHash string) (ShareLink, error)
+	// ListShareLinks returns a user's links, newest first.
+	ListShareLinks(ctx context.Context, userID uuid.UUID) ([]ShareLink, error)
+	// RevokeShareLink returns ErrNotFound if the link is already revoked.
+	RevokeShareLink(ctx context.Context, id uuid.UUID, revokedAt time.Time) error
+	// RecordShareDownload counts a download, returning ErrConflict if the
+	// link has reached its MaxDownloads.
+	RecordShareDownload(ctx context.Context, id uuid.UUID) error
+}
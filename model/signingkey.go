@@ -0,0 +1,29 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// SigningKey is a key tokens are signed with.
+type SigningKey struct {
+	Kid       string
+	Algorithm string
+	// PrivateKey is PKCS #8, ASN.1 DER encoded, then encrypted with the key
+	// encryption key by session.KeySet.
+	PrivateKey []byte
+	CreatedAt  time.Time
+	// RetiresAt is when the key is no longer needed to verify tokens.
+	RetiresAt time.Time
+}
+
+// SigningKeyStorage is an interface for persisting token signing keys, so
+// that every instance of the API signs and verifies with the same keys.
+type SigningKeyStorage interface {
+	// ListSigningKeys returns the keys that have not retired, newest first.
+	ListSigningKeys(ctx context.Context) ([]SigningKey, error)
+	InsertSigningKey(ctx context.Context, key *SigningKey) error
+	// DeleteRetiredSigningKeys removes retired keys and returns how many
+	// there were.
+	DeleteRetiredSigningKeys(ctx context.Context) (int64, error)
+}
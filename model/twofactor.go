@@ -0,0 +1,49 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TwoFactor is a user's TOTP authenticator. It is only checked at login once
+// Enabled is set, which happens when the user confirms a first code.
+type TwoFactor struct {
+	UserID  uuid.UUID
+	Secret  string
+	Enabled bool
+	// LastStep is the TOTP time step of the last code accepted.
+	LastStep  int64
+	CreatedAt time.Time
+}
+
+// TwoFactorSetup is what a user adds to their authenticator app.
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	// URI is an otpauth:// URI, to be shown as a QR code.
+	URI string `json:"uri"`
+}
+
+// TwoFactorStorage is an interface for persisting TOTP authenticators and
+// recovery codes.
+type TwoFactorStorage interface {
+	GetTwoFactor(ctx context.Context, userID uuid.UUID) (TwoFactor, error)
+	// SaveTwoFactor stores a new, not yet enabled authenticator, replacing
+	// one the user did not finish setting up.
+	SaveTwoFactor(ctx context.Context, tf *TwoFactor) error
+	// EnableTwoFactor turns on an authenticator whose code for step has been
+	// confirmed and stores the hashes of the user's recovery codes.
+	EnableTwoFactor(ctx context.Context, userID uuid.UUID, step int64, recoveryHashes []string) error
+	// UseTwoFactorStep records that the code for step was used. It returns
+	// ErrConflict if a code for that step or a later one already was.
+	UseTwoFactorStep(ctx context.Context, userID uuid.UUID, step int64) error
+	// ReplaceRecoveryCodes discards a user's recovery codes and stores new
+	// ones.
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, recoveryHashes []string) error
+	// UseRecoveryCode deletes a recovery code, returning ErrNotFound if the
+	// user has no such code.
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error
+	// DeleteTwoFactor removes a user's authenticator and recovery codes.
+	DeleteTwoFactor(ctx context.Context, userID uuid.UUID) error
+}
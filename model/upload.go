@@ -0,0 +1,47 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Upload is a resumable upload session. Bytes arrive as chunks and the
+// file is created once Offset reaches Size. When FileID is set the upload
+// becomes a new version of that file instead.
+type Upload struct {
+	Id           uuid.UUID      `json:"id"`
+	UserID       uuid.UUID      `json:"userId"`
+	FolderID     uuid.UUID      `json:"folderId,omitempty"`
+	FileID       uuid.UUID      `json:"fileId,omitempty"`
+	Name         string         `json:"name"`
+	MimeType     string         `json:"mimeType"`
+	Size         int64          `json:"size"`
+	Offset       int64          `json:"offset"`
+	OnConflict   ConflictPolicy `json:"onConflict"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	LastModified time.Time      `json:"lastModified"`
+}
+
+// UploadChunk is a contiguous range of an upload held in the blob store.
+type UploadChunk struct {
+	UploadID   uuid.UUID
+	Offset     int64
+	Size       int64
+	StorageKey string
+}
+
+// UploadStorage is an interface for persisting resumable upload sessions.
+type UploadStorage interface {
+	CreateUpload(ctx context.Context, upload *Upload) error
+	GetUpload(ctx context.Context, id uuid.UUID) (Upload, error)
+	// AppendChunk records chunk and advances the upload offset. It returns
+	// ErrConflict if the upload offset is no longer chunk.Offset.
+	AppendChunk(ctx context.Context, chunk *UploadChunk) error
+	GetChunks(ctx context.Context, uploadID uuid.UUID) ([]UploadChunk, error)
+	DeleteUpload(ctx context.Context, id uuid.UUID) error
+	// PendingUploadSize returns the total declared size of a user's
+	// unfinished uploads.
+	PendingUploadSize(ctx context.Context, userID uuid.UUID) (int64, error)
+}
@@ -7,11 +7,17 @@ import (
 	"github.com/google/uuid"
 )
 
+// Roles a user can have. Admins may act on any user's account.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	Id           uuid.UUID `json:"id"`
 	Name         string    `json:"name"`
 	Email        string    `json:"email"`
-	Role         string    `json:"role,omitempty"`
+	Role         string    `json:"role"`
 	PasswordHash []byte    `json:"-"`
 	ProfilePhoto string    `json:"profilePhoto"`
 	CreatedAt    time.Time `json:"createdAt"`
@@ -24,9 +30,45 @@ type UserToken struct {
 	UserId    uuid.UUID
 	ExpiresAt time.Time
 	Scope     string
+	// FamilyID groups the refresh tokens descending from one login.
+	FamilyID uuid.UUID
+	// RotatedAt is set once a refresh token has been exchanged for a new one.
+	RotatedAt *time.Time
+	// The device a refresh token was issued to, and when its session
+	// started and was last refreshed.
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	// NewEmail is the address an email change token switches to.
+	NewEmail string
+}
+
+// ClientInfo describes the device a request comes from.
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Session is a device a user is signed in on: one family of refresh tokens.
+type Session struct {
+	Id         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IPAddress  string    `json:"ipAddress"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	// Current marks the session the request listing the sessions was made in.
+	Current bool `json:"current"`
 }
 
 type UserStore interface {
+	TwoFactorStorage
+	AccessTokenStorage
+	LoginAttemptStorage
+	IdentityStorage
+	PasskeyStorage
+
 	InsertUser(ctx context.Context, user *User) error
 	UpdateUser(ctx context.Context, user *User) error
 	GetUser(ctx context.Context, id uuid.UUID) (User, error)
@@ -35,6 +77,24 @@ type UserStore interface {
 	InsertToken(ctx context.Context, token *UserToken) error
 	GetUserForToken(ctx context.Context, tokenHash, scope, email string) (*User, error)
 	DeleteToken(ctx context.Context, tokenHash, scope string) error
+	// GetToken returns an unexpired token, including rotated ones.
+	GetToken(ctx context.Context, tokenHash, scope string) (UserToken, error)
+	// RotateToken marks the token oldHash as rotated and stores next in its
+	// place. It returns ErrConflict if oldHash has already been rotated.
+	RotateToken(ctx context.Context, oldHash string, next *UserToken) error
+	DeleteTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	// DeleteUserTokens removes all of a user's tokens with the given scope.
+	DeleteUserTokens(ctx context.Context, userID uuid.UUID, scope string) error
+	// ListSessions returns a user's active sessions, most recently used
+	// first.
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]Session, error)
+	// DeleteSession revokes one of a user's sessions, returning ErrNotFound
+	// if they have no such session.
+	DeleteSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	// ChangeEmail sets a user's email and discards their pending email
+	// changes in one transaction. It returns ErrDuplicateUser if another
+	// user has the address.
+	ChangeEmail(ctx context.Context, userID uuid.UUID, email string) error
 }
 
 type UserDetails struct {
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileVersion is one stored revision of a file's contents. Version numbers
+// start at 1 and grow with every new upload; restoring an old version makes
+// it current without renumbering anything.
+type FileVersion struct {
+	Id         uuid.UUID `json:"id"`
+	FileID     uuid.UUID `json:"fileId"`
+	Version    int       `json:"version"`
+	MimeType   string    `json:"mimeType"`
+	Size       int64     `json:"size"`
+	StorageKey string    `json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Current    bool      `json:"current"`
+}
+
+// VersionRetention limits how many old versions a user keeps. Zero values
+// mean no limit. The current version of a file is never removed.
+type VersionRetention struct {
+	// MaxVersions is the most versions kept per file, counting the current one.
+	MaxVersions int `json:"maxVersions"`
+	// MaxAgeDays removes versions older than this many days.
+	MaxAgeDays int `json:"maxAgeDays"`
+}
+
+// FileVersionStorage is an interface for storing file versions.
+type FileVersionStorage interface {
+	// AddFileVersion records the content in file's StorageKey, MimeType and
+	// Size as a new version and makes it current, setting file.Version. It
+	// returns ErrConflict if the current storage key is no longer oldKey.
+	// When sourceID is not uuid.Nil, that file, whose content is being taken
+	// over, is deleted in the same transaction and the storage keys of its
+	// other versions are returned.
+	AddFileVersion(ctx context.Context, file *File, oldKey string, sourceID uuid.UUID) ([]string, error)
+	// ListFileVersions returns a file's versions, newest first.
+	ListFileVersions(ctx context.Context, fileID uuid.UUID) ([]FileVersion, error)
+	GetFileVersion(ctx context.Context, fileID uuid.UUID, version int) (FileVersion, error)
+	// SetCurrentVersion points file at the version in file.Version, copying
+	// its content fields. It returns ErrConflict if the current storage key
+	// is no longer oldKey.
+	SetCurrentVersion(ctx context.Context, file *File, oldKey string) error
+	// DeleteFileVersion removes a version that is not current and returns its
+	// storage key.
+	DeleteFileVersion(ctx context.Context, fileID uuid.UUID, version int) (string, error)
+	// PruneFileVersions removes the versions of a file beyond the newest keep
+	// (when keep > 0) or created before the given time (when it is not zero),
+	// sparing the current one. It returns the removed storage keys.
+	PruneFileVersions(ctx context.Context, fileID uuid.UUID, keep int, before time.Time) ([]string, error)
+	// PruneExpiredVersions applies every user's MaxAgeDays, or defaultMaxAgeDays
+	// for users without settings, and returns the removed storage keys.
+	PruneExpiredVersions(ctx context.Context, now time.Time, defaultMaxAgeDays int) ([]string, error)
+	// GetVersionRetention returns ErrNotFound if the user has no settings.
+	GetVersionRetention(ctx context.Context, userID uuid.UUID) (VersionRetention, error)
+	SetVersionRetention(ctx context.Context, userID uuid.UUID, retention VersionRetention) error
+}
@@ -0,0 +1,327 @@
+// Package oidc signs users in with an OpenID Connect identity provider,
+// using the authorization code flow with PKCE (RFC 7636).
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// keyRefreshInterval limits how often the provider's JWKS is fetched again
+// when an ID token names a key that is not known.
+const keyRefreshInterval = time.Minute
+
+var (
+	ErrDiscovery      = errors.New("oidc: provider discovery failed")
+	ErrExchange       = errors.New("oidc: authorization code exchange failed")
+	ErrInvalidIDToken = errors.New("oidc: invalid ID token")
+)
+
+// signingMethods are the algorithms ID tokens may be signed with.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}
+
+// Config identifies the provider and this application's registration with
+// it.
+type Config struct {
+	// Issuer is the provider's issuer URL, where its discovery document is.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends users back to with a code.
+	RedirectURL string
+	// Scopes requested in addition to openid.
+	Scopes []string
+}
+
+// Claims are the ID token claims used to find or create the user.
+type Claims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+	// AuthorizedParty is the client the token was issued to, when the token
+	// has several audiences.
+	AuthorizedParty string `json:"azp,omitempty"`
+}
+
+// Provider is an identity provider found by Discover.
+type Provider struct {
+	config  Config
+	oauth   oauth2.Config
+	jwksURI string
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover reads the provider's configuration from its discovery document
+// and fetches its signing keys.
+func Discover(ctx context.Context, config Config) (*Provider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	issuer := strings.TrimSuffix(config.Issuer, "/")
+	var doc discoveryDocument
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrDiscovery, doc.Issuer, config.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete discovery document", ErrDiscovery)
+	}
+	config.Issuer = doc.Issuer
+
+	p := &Provider{
+		config: config,
+		oauth: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Scopes:       append([]string{"openid", "email", "profile"}, config.Scopes...),
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  doc.AuthorizationEndpoint,
+				TokenURL: doc.TokenEndpoint,
+			},
+		},
+		jwksURI: doc.JWKSURI,
+		client:  client,
+	}
+	if err := p.refreshKeys(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	return p, nil
+}
+
+// Issuer returns the provider's issuer identifier.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// GenerateVerifier returns a new PKCE code verifier.
+func GenerateVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// AuthCodeURL returns the provider URL to send the user to. state and nonce
+// come back in the redirect and the ID token; verifier is kept to complete
+// the login with Exchange.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	)
+}
+
+// Exchange redeems the code the provider redirected the user back with and
+// returns the claims of the validated ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token in response", ErrExchange)
+	}
+
+	return p.VerifyIDToken(ctx, rawIDToken, nonce)
+}
+
+// VerifyIDToken checks an ID token's signature against the provider's keys,
+// its issuer, audience, expiry and nonce, and returns its claims.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, fmt.Errorf("%w: issued to another client", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// key returns the provider's public key with the given ID. Unknown keys
+// cause the JWKS to be fetched again, in case the provider rotated its keys,
+// at most once every keyRefreshInterval.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.fetchedAt) >= keyRefreshInterval
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	if err := p.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// refreshKeys fetches the provider's JWKS. Keys that are not for signing or
+// cannot be decoded are skipped.
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, p.client, p.jwksURI, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
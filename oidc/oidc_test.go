@@ -0,0 +1,108 @@
+package oidc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var alice = oidctest.User{Subject: "alice-1", Email: "alice@corp.example", EmailVerified: true, Name: "Alice"}
+
+func newProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	t.Helper()
+	idp := oidctest.NewServer("kora", "secret")
+	t.Cleanup(idp.Close)
+
+	p, err := Discover(context.Background(), Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "kora",
+		ClientSecret: "secret",
+		RedirectURL:  "https://kora.example/auth/callback",
+	})
+	require.NoError(t, err)
+	return p, idp
+}
+
+// login goes through the flow for user and returns the result of Exchange.
+func login(t *testing.T, p *Provider, idp *oidctest.Server, user oidctest.User) (*Claims, error) {
+	t.Helper()
+	verifier := GenerateVerifier()
+	code, state, err := idp.Authorize(p.AuthCodeURL("state-1", "nonce-1", verifier), user)
+	require.NoError(t, err)
+	require.Equal(t, "state-1", state)
+
+	return p.Exchange(context.Background(), code, verifier, "nonce-1")
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	p, idp := newProvider(t)
+
+	claims, err := login(t, p, idp, alice)
+	require.NoError(t, err)
+	assert.Equal(t, alice.Subject, claims.Subject)
+	assert.Equal(t, alice.Email, claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, alice.Name, claims.Name)
+	assert.Equal(t, idp.Issuer(), p.Issuer())
+}
+
+func TestProvider_ExchangeRequiresVerifier(t *testing.T) {
+	p, idp := newProvider(t)
+
+	code, _, err := idp.Authorize(p.AuthCodeURL("state", "nonce", GenerateVerifier()), alice)
+	require.NoError(t, err)
+	_, err = p.Exchange(context.Background(), code, GenerateVerifier(), "nonce")
+	assert.ErrorIs(t, err, ErrExchange, "a code is useless without the verifier it was requested with")
+}
+
+func TestProvider_RejectsBadIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+	}{
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"replayed nonce", func(c jwt.MapClaims) { c["nonce"] = "nonce-0" }},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+		{"several audiences", func(c jwt.MapClaims) { c["aud"] = []string{"kora", "other"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, idp := newProvider(t)
+			idp.ModifyClaims = tt.modify
+
+			_, err := login(t, p, idp, alice)
+			assert.ErrorIs(t, err, ErrInvalidIDToken)
+		})
+	}
+}
+
+func TestProvider_KeyRotation(t *testing.T) {
+	p, idp := newProvider(t)
+
+	idp.RotateKey()
+	_, err := login(t, p, idp, alice)
+	assert.ErrorIs(t, err, ErrInvalidIDToken, "the JWKS is not fetched again right away")
+
+	p.mu.Lock()
+	p.fetchedAt = time.Now().Add(-keyRefreshInterval)
+	p.mu.Unlock()
+	_, err = login(t, p, idp, alice)
+	assert.NoError(t, err, "unknown keys are picked up once the JWKS may be refreshed")
+}
+
+func TestDiscover_IssuerMismatch(t *testing.T) {
+	idp := oidctest.NewServer("kora", "secret")
+	defer idp.Close()
+
+	_, err := Discover(context.Background(), Config{Issuer: idp.Issuer() + "/tenant", ClientID: "kora"})
+	assert.ErrorIs(t, err, ErrDiscovery)
+}
@@ -0,0 +1,240 @@
+// Package oidctest provides an in-process OpenID Connect identity provider
+// for tests.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// User is an account at the identity provider.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Server is an identity provider serving discovery, JWKS and token
+// endpoints. There is no login page: Authorize stands in for the user
+// signing in and being sent back with a code.
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	// ModifyClaims, if set, is called on each ID token's claims before it is
+	// signed, to make bad tokens.
+	ModifyClaims func(claims jwt.MapClaims)
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	kid    string
+	grants map[string]grant
+}
+
+type grant struct {
+	user        User
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// NewServer starts an identity provider that knows one client. Close it
+// when done.
+func NewServer(clientID, clientSecret string) *Server {
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		grants:       make(map[string]grant),
+	}
+	s.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("POST /token", s.token)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Issuer returns the provider's issuer URL.
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// RotateKey replaces the key ID tokens are signed with. The old key is no
+// longer published.
+func (s *Server) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = key
+	s.kid = fmt.Sprintf("key-%d", time.Now().UnixNano())
+}
+
+// Authorize signs user in at the authorization URL a relying party sent
+// them to, and returns the code and state it would redirect them back with.
+func (s *Server) Authorize(authURL string, user User) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+
+	switch {
+	case q.Get("client_id") != s.ClientID:
+		return "", "", errors.New("unknown client")
+	case q.Get("response_type") != "code":
+		return "", "", errors.New("unsupported response type")
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		return "", "", errors.New("PKCE with S256 is required")
+	case q.Get("nonce") == "":
+		return "", "", errors.New("nonce is required")
+	}
+
+	code = rand.Text()
+	s.mu.Lock()
+	s.grants[code] = grant{
+		user:        user,
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		redirectURI: q.Get("redirect_uri"),
+	}
+	s.mu.Unlock()
+
+	return code, q.Get("state"), nil
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	public := s.key.PublicKey
+	kid := s.kid
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.ClientID || clientSecret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok, r.PostForm.Get("redirect_uri") != g.redirectURI:
+		tokenError(w, "invalid_grant")
+		return
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != g.challenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	idToken, err := s.idToken(g)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) idToken(g grant) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.URL,
+		"sub":            g.user.Subject,
+		"aud":            s.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.user.Email,
+		"email_verified": g.user.EmailVerified,
+		"name":           g.user.Name,
+	}
+	if s.ModifyClaims != nil {
+		s.ModifyClaims(claims)
+	}
+
+	s.mu.Lock()
+	key, kid := s.key, s.kid
+	s.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
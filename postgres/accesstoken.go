@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const accessTokenColumns = `id, user_id, name, scopes, expires_at, last_used_at, created_at`
+
+// InsertAccessToken implements model.UserStore.
+func (u *UserStore) InsertAccessToken(ctx context.Context, token *model.AccessToken, tokenHash string) error {
+	query := `
+		INSERT INTO access_tokens (id, user_id, name, token_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`
+
+	_, err := u.conn.Exec(ctx, query,
+		token.Id,
+		token.UserID,
+		token.Name,
+		tokenHash,
+		token.Scopes,
+		token.ExpiresAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		slog.Error("failed to insert access token", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetAccessTokenByHash implements model.UserStore.
+func (u *UserStore) GetAccessTokenByHash(ctx context.Context, tokenHash string) (model.AccessToken, error) {
+	query := `SELECT ` + accessTokenColumns + ` FROM access_tokens
+		WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > now());`
+
+	token, err := scanAccessToken(u.conn.QueryRow(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.AccessToken{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch access token", "error", err)
+		return model.AccessToken{}, err
+	}
+
+	return token, nil
+}
+
+// ListAccessTokens implements model.UserStore.
+func (u *UserStore) ListAccessTokens(ctx context.Context, userID uuid.UUID) ([]model.AccessToken, error) {
+	query := `SELECT ` + accessTokenColumns + ` FROM access_tokens WHERE user_id = $1 ORDER BY created_at DESC;`
+
+	rows, err := u.conn.Query(ctx, query, userID)
+	if err != nil {
+		slog.Error("failed to list access tokens", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []model.AccessToken{}
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			slog.Error("failed to scan access token", "error", err)
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("failed to list access tokens", "error", err)
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// DeleteAccessToken implements model.UserStore.
+func (u *UserStore) DeleteAccessToken(ctx context.Context, userID, id uuid.UUID) error {
+	result, err := u.conn.Exec(ctx, `DELETE FROM access_tokens WHERE id = $1 AND user_id = $2;`, id, userID)
+	if err != nil {
+		slog.Error("failed to delete access token", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// TouchAccessToken implements model.UserStore. The time is updated at most
+// once a minute so that busy tokens don't cost a write per request.
+func (u *UserStore) TouchAccessToken(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE access_tokens SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute');`
+
+	if _, err := u.conn.Exec(ctx, query, id); err != nil {
+		slog.Error("failed to update access token use", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func scanAccessToken(row pgx.Row) (model.AccessToken, error) {
+	var token model.AccessToken
+	err := row.Scan(
+		&token.Id,
+		&token.UserID,
+		&token.Name,
+		&token.Scopes,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+	)
+	return token, err
+}
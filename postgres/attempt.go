@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetLoginAttempts implements model.UserStore.
+func (u *UserStore) GetLoginAttempts(ctx context.Context, key string) (model.LoginAttempts, error) {
+	query := `SELECT key, failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1;`
+
+	var attempts model.LoginAttempts
+	err := u.conn.QueryRow(ctx, query, key).Scan(
+		&attempts.Key,
+		&attempts.Failures,
+		&attempts.LastFailureAt,
+		&attempts.LockedUntil,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.LoginAttempts{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch login attempts", "error", err)
+		return model.LoginAttempts{}, err
+	}
+
+	return attempts, nil
+}
+
+// RecordFailedAttempt implements model.UserStore.
+func (u *UserStore) RecordFailedAttempt(ctx context.Context, key string, window time.Duration) (int, error) {
+	query := `
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, now())
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE
+				WHEN login_attempts.last_failure_at < now() - $2::interval THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = now()
+		RETURNING failures;`
+
+	var failures int
+	err := u.conn.QueryRow(ctx, query, key, window).Scan(&failures)
+	if err != nil {
+		slog.Error("failed to record failed attempt", "error", err)
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+// LockAttempts implements model.UserStore.
+func (u *UserStore) LockAttempts(ctx context.Context, key string, until time.Time) error {
+	_, err := u.conn.Exec(ctx, `UPDATE login_attempts SET locked_until = $2 WHERE key = $1;`, key, until)
+	if err != nil {
+		slog.Error("failed to lock attempts", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// ClearLoginAttempts implements model.UserStore.
+func (u *UserStore) ClearLoginAttempts(ctx context.Context, key string) error {
+	_, err := u.conn.Exec(ctx, `DELETE FROM login_attempts WHERE key = $1;`, key)
+	if err != nil {
+		slog.Error("failed to clear login attempts", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -2,9 +2,12 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 
 	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -27,12 +30,15 @@ func (s *FileStore) CreateFolder(ctx context.Context, folder *model.Folder) erro
 		folder.Id,
 		folder.Name,
 		folder.UserID,
-		folder.ParentID,
+		nullableUUID(folder.ParentID),
 		folder.CreatedAt,
 		folder.LastModified,
 	)
 
 	if err != nil {
+		if isUniqueViolation(err, "idx_folders_unique_name") {
+			return model.ErrDuplicateName
+		}
 		slog.Error("failed to insert folder", "error", err)
 		return err
 	}
@@ -40,12 +46,559 @@ func (s *FileStore) CreateFolder(ctx context.Context, folder *model.Folder) erro
 	return nil
 }
 
-// CreateFile creates a new file in the database.
+// CreateFile creates a new file in the database along with its first version.
 func (r *FileStore) CreateFile(ctx context.Context, file *model.File) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	file.Version = 1
 	query := `
-		INSERT INTO files (id, name, user_id, folder_id, mime_type, size, storage_key)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO files (id, name, user_id, folder_id, mime_type, size, storage_key, version, created_at, last_modified)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
-	_, err := r.conn.Exec(ctx, query, file.Id, file.Name, file.UserID, file.FolderID, file.MimeType, file.Size, file.StorageKey)
-	return err
+	_, err = tx.Exec(ctx, query,
+		file.Id,
+		file.Name,
+		file.UserID,
+		nullableUUID(file.FolderID),
+		file.MimeType,
+		file.Size,
+		file.StorageKey,
+		file.Version,
+		file.CreatedAt,
+		file.LastModified,
+	)
+	if err != nil {
+		if isUniqueViolation(err, "idx_files_unique_name") {
+			return model.ErrDuplicateName
+		}
+		slog.Error("failed to insert file", "error", err)
+		return err
+	}
+
+	if err := insertFileVersion(ctx, tx, file); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit file insert", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetFile fetches a file's metadata by ID.
+func (r *FileStore) GetFile(ctx context.Context, id uuid.UUID) (model.File, error) {
+	query := `
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE id = $1;`
+
+	file, err := scanFile(r.conn.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.File{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch file", "error", err)
+		return model.File{}, err
+	}
+
+	return file, nil
+}
+
+// GetFolder fetches a folder by ID.
+func (s *FileStore) GetFolder(ctx context.Context, id uuid.UUID) (model.Folder, error) {
+	query := `
+		SELECT ` + folderColumns + `
+		FROM folders
+		WHERE id = $1;`
+
+	folder, err := scanFolder(s.conn.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Folder{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch folder", "error", err)
+		return model.Folder{}, err
+	}
+
+	return folder, nil
+}
+
+// GetSubtree fetches a folder, all of its descendant folders and every file
+// inside them.
+func (s *FileStore) GetSubtree(ctx context.Context, folderID uuid.UUID) ([]model.Folder, []model.File, error) {
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT folders.*, 0 AS depth FROM folders WHERE id = $1
+			UNION ALL
+			SELECT folders.*, tree.depth + 1 FROM folders JOIN tree ON folders.parent_id = tree.id
+			WHERE folders.deleted_at IS NULL
+		) CYCLE id SET is_cycle USING path
+		SELECT ` + folderColumns + ` FROM tree WHERE NOT is_cycle ORDER BY depth;`
+
+	rows, err := s.conn.Query(ctx, query, folderID)
+	if err != nil {
+		slog.Error("failed to fetch folder tree", "error", err)
+		return nil, nil, err
+	}
+	folders, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Folder, error) {
+		return scanFolder(row)
+	})
+	if err != nil {
+		slog.Error("failed to scan folder tree", "error", err)
+		return nil, nil, err
+	}
+	if len(folders) == 0 {
+		return nil, nil, model.ErrNotFound
+	}
+
+	ids := make([]uuid.UUID, len(folders))
+	for i, folder := range folders {
+		ids[i] = folder.Id
+	}
+
+	query = `
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE folder_id = ANY($1) AND deleted_at IS NULL;`
+
+	rows, err = s.conn.Query(ctx, query, ids)
+	if err != nil {
+		slog.Error("failed to fetch folder files", "error", err)
+		return nil, nil, err
+	}
+	files, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.File, error) {
+		return scanFile(row)
+	})
+	if err != nil {
+		slog.Error("failed to scan folder files", "error", err)
+		return nil, nil, err
+	}
+
+	return folders, files, nil
+}
+
+// UpdateFile updates a file's name and folder.
+func (r *FileStore) UpdateFile(ctx context.Context, file *model.File) error {
+	query := `
+		UPDATE files
+		SET name = $1, folder_id = $2, last_modified = $3
+		WHERE id = $4;`
+
+	result, err := r.conn.Exec(ctx, query, file.Name, nullableUUID(file.FolderID), file.LastModified, file.Id)
+	if err != nil {
+		if isUniqueViolation(err, "idx_files_unique_name") {
+			return model.ErrDuplicateName
+		}
+		slog.Error("failed to update file", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteFile removes a file's metadata.
+func (r *FileStore) DeleteFile(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM files WHERE id = $1;`
+
+	result, err := r.conn.Exec(ctx, query, id)
+	if err != nil {
+		slog.Error("failed to delete file", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateFolder updates a folder's name and parent. The owner's row is
+// locked for the transaction, so that concurrent moves of their folders are
+// checked for cycles one after another.
+func (s *FileStore) UpdateFolder(ctx context.Context, folder *model.Folder) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT 1 FROM users WHERE id = (SELECT user_id FROM folders WHERE id = $1) FOR UPDATE;`
+	if _, err := tx.Exec(ctx, query, folder.Id); err != nil {
+		slog.Error("failed to lock folder owner", "error", err)
+		return err
+	}
+
+	if folder.ParentID != uuid.Nil {
+		query = `
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id FROM folders WHERE id = $1
+				UNION ALL
+				SELECT folders.id, folders.parent_id FROM folders JOIN ancestors ON folders.id = ancestors.parent_id
+			) CYCLE id SET is_cycle USING path
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2);`
+
+		var cycle bool
+		if err := tx.QueryRow(ctx, query, folder.ParentID, folder.Id).Scan(&cycle); err != nil {
+			slog.Error("failed to check folder ancestors", "error", err)
+			return err
+		}
+		if cycle {
+			return model.ErrCycle
+		}
+	}
+
+	query = `
+		UPDATE folders
+		SET name = $1, parent_id = $2, last_modified = $3
+		WHERE id = $4;`
+
+	result, err := tx.Exec(ctx, query, folder.Name, nullableUUID(folder.ParentID), folder.LastModified, folder.Id)
+	if err != nil {
+		if isUniqueViolation(err, "idx_folders_unique_name") {
+			return model.ErrDuplicateName
+		}
+		slog.Error("failed to update folder", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit folder update", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteFolder removes a folder. Subfolders and files are removed by the
+// ON DELETE CASCADE constraints.
+func (s *FileStore) DeleteFolder(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM folders WHERE id = $1;`
+
+	result, err := s.conn.Exec(ctx, query, id)
+	if err != nil {
+		slog.Error("failed to delete folder", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// listSortColumns maps model sort keys to SQL expressions over the combined
+// folder and file rows of ListFolder.
+var listSortColumns = map[string]string{
+	model.SortByName:         "lower(name)",
+	model.SortByCreatedAt:    "created_at",
+	model.SortByLastModified: "last_modified",
+	model.SortBySize:         "size",
+}
+
+// ListFolder returns one page of a folder's subfolders and files.
+func (s *FileStore) ListFolder(ctx context.Context, userID, folderID uuid.UUID, opts model.ListOptions) (model.FolderContents, error) {
+	column, ok := listSortColumns[opts.Sort]
+	if !ok {
+		column = listSortColumns[model.SortByName]
+	}
+	direction := "ASC"
+	if opts.Desc {
+		direction = "DESC"
+	}
+
+	query := `
+		SELECT is_file, id, name, user_id, parent_id, mime_type, size, storage_key, version, created_at, last_modified, count(*) OVER ()
+		FROM (
+			SELECT false AS is_file, id, name, user_id, parent_id, '' AS mime_type, 0::bigint AS size, '' AS storage_key, 0 AS version, created_at, last_modified
+			FROM folders
+			WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND deleted_at IS NULL
+			UNION ALL
+			SELECT true, id, name, user_id, folder_id, mime_type, size, storage_key, version, created_at, last_modified
+			FROM files
+			WHERE user_id = $1 AND folder_id IS NOT DISTINCT FROM $2 AND deleted_at IS NULL
+		) AS children
+		ORDER BY is_file, ` + column + ` ` + direction + `, id
+		LIMIT $3 OFFSET $4;`
+
+	rows, err := s.conn.Query(ctx, query, userID, nullableUUID(folderID), opts.Limit, opts.Offset)
+	if err != nil {
+		slog.Error("failed to list folder", "error", err)
+		return model.FolderContents{}, err
+	}
+	defer rows.Close()
+
+	contents := model.FolderContents{Folders: []model.Folder{}, Files: []model.File{}}
+	for rows.Next() {
+		var isFile bool
+		var file model.File
+		var parentID *uuid.UUID
+		err := rows.Scan(
+			&isFile,
+			&file.Id,
+			&file.Name,
+			&file.UserID,
+			&parentID,
+			&file.MimeType,
+			&file.Size,
+			&file.StorageKey,
+			&file.Version,
+			&file.CreatedAt,
+			&file.LastModified,
+			&contents.Total,
+		)
+		if err != nil {
+			slog.Error("failed to scan folder listing", "error", err)
+			return model.FolderContents{}, err
+		}
+
+		if isFile {
+			file.FolderID = uuidValue(parentID)
+			contents.Files = append(contents.Files, file)
+		} else {
+			contents.Folders = append(contents.Folders, model.Folder{
+				Id:           file.Id,
+				Name:         file.Name,
+				UserID:       file.UserID,
+				ParentID:     uuidValue(parentID),
+				CreatedAt:    file.CreatedAt,
+				LastModified: file.LastModified,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("failed to list folder", "error", err)
+		return model.FolderContents{}, err
+	}
+
+	// count(*) OVER () is only available when the page has rows
+	if contents.Total == 0 && opts.Offset > 0 {
+		query = `
+			SELECT (SELECT count(*) FROM folders WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND deleted_at IS NULL)
+			     + (SELECT count(*) FROM files WHERE user_id = $1 AND folder_id IS NOT DISTINCT FROM $2 AND deleted_at IS NULL);`
+		if err := s.conn.QueryRow(ctx, query, userID, nullableUUID(folderID)).Scan(&contents.Total); err != nil {
+			slog.Error("failed to count folder children", "error", err)
+			return model.FolderContents{}, err
+		}
+	}
+
+	return contents, nil
+}
+
+// GetAncestors returns the chain of folders from the root to folderID.
+func (s *FileStore) GetAncestors(ctx context.Context, folderID uuid.UUID) ([]model.Folder, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT folders.*, 0 AS depth FROM folders WHERE id = $1
+			UNION ALL
+			SELECT folders.*, ancestors.depth + 1 FROM folders JOIN ancestors ON folders.id = ancestors.parent_id
+		) CYCLE id SET is_cycle USING path
+		SELECT ` + folderColumns + ` FROM ancestors WHERE NOT is_cycle ORDER BY depth DESC;`
+
+	rows, err := s.conn.Query(ctx, query, folderID)
+	if err != nil {
+		slog.Error("failed to fetch folder ancestors", "error", err)
+		return nil, err
+	}
+	folders, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Folder, error) {
+		return scanFolder(row)
+	})
+	if err != nil {
+		slog.Error("failed to scan folder ancestors", "error", err)
+		return nil, err
+	}
+	if len(folders) == 0 {
+		return nil, model.ErrNotFound
+	}
+
+	return folders, nil
+}
+
+// GetFolderTree walks the folder hierarchy below parentID with a recursive
+// CTE and joins in the number and total size of the files in each folder.
+func (s *FileStore) GetFolderTree(ctx context.Context, userID, parentID uuid.UUID) ([]model.FolderNode, error) {
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT folders.*, 0 AS depth
+			FROM folders
+			WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND deleted_at IS NULL
+			UNION ALL
+			SELECT folders.*, tree.depth + 1
+			FROM folders JOIN tree ON folders.parent_id = tree.id
+			WHERE folders.deleted_at IS NULL
+		) CYCLE id SET is_cycle USING path, stats AS (
+			SELECT folder_id, count(*) AS file_count, sum(size) AS size
+			FROM files
+			WHERE user_id = $1 AND folder_id IS NOT NULL AND deleted_at IS NULL
+			GROUP BY folder_id
+		)
+		SELECT tree.id, tree.name, tree.user_id, tree.parent_id, tree.created_at, tree.last_modified,
+			COALESCE(stats.file_count, 0), COALESCE(stats.size, 0)
+		FROM tree LEFT JOIN stats ON stats.folder_id = tree.id
+		WHERE NOT tree.is_cycle
+		ORDER BY tree.depth, lower(tree.name), tree.id;`
+
+	rows, err := s.conn.Query(ctx, query, userID, nullableUUID(parentID))
+	if err != nil {
+		slog.Error("failed to fetch folder tree", "error", err)
+		return nil, err
+	}
+
+	nodes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.FolderNode, error) {
+		var node model.FolderNode
+		var parent *uuid.UUID
+		err := row.Scan(
+			&node.Id,
+			&node.Name,
+			&node.UserID,
+			&parent,
+			&node.CreatedAt,
+			&node.LastModified,
+			&node.FileCount,
+			&node.Size,
+		)
+		node.ParentID = uuidValue(parent)
+		return node, err
+	})
+	if err != nil {
+		slog.Error("failed to scan folder tree", "error", err)
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// GetFileByName fetches a file by its case-insensitive name within a folder.
+func (r *FileStore) GetFileByName(ctx context.Context, userID, folderID uuid.UUID, name string) (model.File, error) {
+	query := `
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE user_id = $1 AND folder_id IS NOT DISTINCT FROM $2 AND lower(name) = lower($3) AND deleted_at IS NULL;`
+
+	file, err := scanFile(r.conn.QueryRow(ctx, query, userID, nullableUUID(folderID), name))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.File{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch file by name", "error", err)
+		return model.File{}, err
+	}
+
+	return file, nil
+}
+
+// GetFolderByName fetches a folder by its case-insensitive name within a parent.
+func (s *FileStore) GetFolderByName(ctx context.Context, userID, parentID uuid.UUID, name string) (model.Folder, error) {
+	query := `
+		SELECT ` + folderColumns + `
+		FROM folders
+		WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND lower(name) = lower($3) AND deleted_at IS NULL;`
+
+	folder, err := scanFolder(s.conn.QueryRow(ctx, query, userID, nullableUUID(parentID), name))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Folder{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch folder by name", "error", err)
+		return model.Folder{}, err
+	}
+
+	return folder, nil
+}
+
+// ListFolderNames returns the names of a folder's subfolders that start with prefix.
+func (s *FileStore) ListFolderNames(ctx context.Context, userID, folderID uuid.UUID, prefix string) ([]string, error) {
+	query := `
+		SELECT name
+		FROM folders
+		WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND starts_with(lower(name), lower($3)) AND deleted_at IS NULL;`
+
+	return s.listNames(ctx, query, userID, folderID, prefix)
+}
+
+// ListFileNames returns the names of a folder's files that start with prefix.
+func (s *FileStore) ListFileNames(ctx context.Context, userID, folderID uuid.UUID, prefix string) ([]string, error) {
+	query := `
+		SELECT name
+		FROM files
+		WHERE user_id = $1 AND folder_id IS NOT DISTINCT FROM $2 AND starts_with(lower(name), lower($3)) AND deleted_at IS NULL;`
+
+	return s.listNames(ctx, query, userID, folderID, prefix)
+}
+
+func (s *FileStore) listNames(ctx context.Context, query string, userID, folderID uuid.UUID, prefix string) ([]string, error) {
+	rows, err := s.conn.Query(ctx, query, userID, nullableUUID(folderID), prefix)
+	if err != nil {
+		slog.Error("failed to list names", "error", err)
+		return nil, err
+	}
+
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		slog.Error("failed to scan names", "error", err)
+		return nil, err
+	}
+
+	return names, nil
+}
+
+const folderColumns = `id, name, user_id, parent_id, created_at, last_modified, deleted_at, trash_id`
+
+func scanFolder(row pgx.Row) (model.Folder, error) {
+	var folder model.Folder
+	var parentID, trashID *uuid.UUID
+	err := row.Scan(
+		&folder.Id,
+		&folder.Name,
+		&folder.UserID,
+		&parentID,
+		&folder.CreatedAt,
+		&folder.LastModified,
+		&folder.DeletedAt,
+		&trashID,
+	)
+	folder.ParentID = uuidValue(parentID)
+	folder.TrashID = uuidValue(trashID)
+	return folder, err
+}
+
+const fileColumns = `id, name, user_id, folder_id, mime_type, size, storage_key, version, created_at, last_modified, deleted_at, trash_id`
+
+func scanFile(row pgx.Row) (model.File, error) {
+	var file model.File
+	var folderID, trashID *uuid.UUID
+	err := row.Scan(
+		&file.Id,
+		&file.Name,
+		&file.UserID,
+		&folderID,
+		&file.MimeType,
+		&file.Size,
+		&file.StorageKey,
+		&file.Version,
+		&file.CreatedAt,
+		&file.LastModified,
+		&file.DeletedAt,
+		&trashID,
+	)
+	file.FolderID = uuidValue(folderID)
+	file.TrashID = uuidValue(trashID)
+	return file, err
 }
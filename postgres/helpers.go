@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// nullableUUID maps uuid.Nil to NULL for optional references such as a
+// folder's parent or a file's folder, where the zero value means "root".
+func nullableUUID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+// uuidValue is the inverse of nullableUUID for scanned columns.
+func uuidValue(id *uuid.UUID) uuid.UUID {
+	if id == nil {
+		return uuid.Nil
+	}
+	return *id
+}
+
+// isUniqueViolation reports whether err was caused by the unique index named
+// constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
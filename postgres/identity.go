@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/freekobie/kora/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// InsertOIDCState implements model.UserStore. Expired states are deleted
+// along the way.
+func (u *UserStore) InsertOIDCState(ctx context.Context, state *model.OIDCState) error {
+	if _, err := u.conn.Exec(ctx, `DELETE FROM oidc_states WHERE expires_at < now();`); err != nil {
+		slog.Error("failed to delete expired oidc states", "error", err)
+		return err
+	}
+
+	query := `
+		INSERT INTO oidc_states (state_hash, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4);`
+
+	_, err := u.conn.Exec(ctx, query, state.StateHash, state.Nonce, state.Verifier, state.ExpiresAt)
+	if err != nil {
+		slog.Error("failed to insert oidc state", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// TakeOIDCState implements model.UserStore.
+func (u *UserStore) TakeOIDCState(ctx context.Context, stateHash string) (model.OIDCState, error) {
+	query := `
+		DELETE FROM oidc_states WHERE state_hash = $1
+		RETURNING state_hash, nonce, code_verifier, expires_at;`
+
+	var state model.OIDCState
+	err := u.conn.QueryRow(ctx, query, stateHash).Scan(&state.StateHash, &state.Nonce, &state.Verifier, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.OIDCState{}, model.ErrNotFound
+		}
+		slog.Error("failed to take oidc state", "error", err)
+		return model.OIDCState{}, err
+	}
+
+	return state, nil
+}
+
+// GetIdentity implements model.UserStore.
+func (u *UserStore) GetIdentity(ctx context.Context, issuer, subject string) (model.Identity, error) {
+	query := `
+		SELECT issuer, subject, user_id, email, created_at
+		FROM user_identities WHERE issuer = $1 AND subject = $2;`
+
+	var identity model.Identity
+	err := u.conn.QueryRow(ctx, query, issuer, subject).Scan(
+		&identity.Issuer,
+		&identity.Subject,
+		&identity.UserID,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Identity{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch identity", "error", err)
+		return model.Identity{}, err
+	}
+
+	return identity, nil
+}
+
+// InsertIdentity implements model.UserStore.
+func (u *UserStore) InsertIdentity(ctx context.Context, identity *model.Identity) error {
+	query := `
+		INSERT INTO user_identities (issuer, subject, user_id, email, created_at)
+		VALUES ($1, $2, $3, $4, $5);`
+
+	_, err := u.conn.Exec(ctx, query, identity.Issuer, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "user_identities_pkey") {
+			return model.ErrConflict
+		}
+		slog.Error("failed to insert identity", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const passkeyColumns = `id, user_id, name, credential_id, public_key, sign_count, last_used_at, created_at`
+
+// InsertWebAuthnChallenge implements model.UserStore. Expired challenges are
+// deleted along the way.
+func (u *UserStore) InsertWebAuthnChallenge(ctx context.Context, challenge *model.WebAuthnChallenge) error {
+	if _, err := u.conn.Exec(ctx, `DELETE FROM webauthn_challenges WHERE expires_at < now();`); err != nil {
+		slog.Error("failed to delete expired webauthn challenges", "error", err)
+		return err
+	}
+
+	query := `
+		INSERT INTO webauthn_challenges (challenge_hash, user_id, expires_at)
+		VALUES ($1, $2, $3);`
+
+	_, err := u.conn.Exec(ctx, query, challenge.ChallengeHash, nullableUUID(challenge.UserID), challenge.ExpiresAt)
+	if err != nil {
+		slog.Error("failed to insert webauthn challenge", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// TakeWebAuthnChallenge implements model.UserStore.
+func (u *UserStore) TakeWebAuthnChallenge(ctx context.Context, challengeHash string) (model.WebAuthnChallenge, error) {
+	query := `
+		DELETE FROM webauthn_challenges WHERE challenge_hash = $1
+		RETURNING challenge_hash, user_id, expires_at;`
+
+	var challenge model.WebAuthnChallenge
+	var userID *uuid.UUID
+	err := u.conn.QueryRow(ctx, query, challengeHash).Scan(&challenge.ChallengeHash, &userID, &challenge.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.WebAuthnChallenge{}, model.ErrNotFound
+		}
+		slog.Error("failed to take webauthn challenge", "error", err)
+		return model.WebAuthnChallenge{}, err
+	}
+	challenge.UserID = uuidValue(userID)
+
+	return challenge, nil
+}
+
+// InsertPasskey implements model.UserStore.
+func (u *UserStore) InsertPasskey(ctx context.Context, passkey *model.Passkey) error {
+	query := `
+		INSERT INTO passkeys (id, user_id, name, credential_id, public_key, sign_count, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`
+
+	_, err := u.conn.Exec(ctx, query,
+		passkey.Id,
+		passkey.UserID,
+		passkey.Name,
+		passkey.CredentialID,
+		passkey.PublicKey,
+		int64(passkey.SignCount),
+		passkey.CreatedAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err, "passkeys_credential_id_key") {
+			return model.ErrConflict
+		}
+		slog.Error("failed to insert passkey", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetPasskeyByCredentialID implements model.UserStore.
+func (u *UserStore) GetPasskeyByCredentialID(ctx context.Context, credentialID []byte) (model.Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE credential_id = $1;`
+
+	passkey, err := scanPasskey(u.conn.QueryRow(ctx, query, credentialID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Passkey{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch passkey", "error", err)
+		return model.Passkey{}, err
+	}
+
+	return passkey, nil
+}
+
+// ListPasskeys implements model.UserStore.
+func (u *UserStore) ListPasskeys(ctx context.Context, userID uuid.UUID) ([]model.Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE user_id = $1 ORDER BY created_at DESC;`
+
+	rows, err := u.conn.Query(ctx, query, userID)
+	if err != nil {
+		slog.Error("failed to list passkeys", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []model.Passkey{}
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			slog.Error("failed to scan passkey", "error", err)
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("failed to list passkeys", "error", err)
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+// UsePasskey implements model.UserStore. The counter is compared and set in
+// one statement so that two sign-ins with the same count cannot both pass.
+func (u *UserStore) UsePasskey(ctx context.Context, id uuid.UUID, signCount uint32) error {
+	query := `
+		UPDATE passkeys SET sign_count = $2, last_used_at = now()
+		WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0));`
+
+	result, err := u.conn.Exec(ctx, query, id, int64(signCount))
+	if err != nil {
+		slog.Error("failed to update passkey use", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrConflict
+	}
+
+	return nil
+}
+
+// DeletePasskey implements model.UserStore.
+func (u *UserStore) DeletePasskey(ctx context.Context, userID, id uuid.UUID) error {
+	result, err := u.conn.Exec(ctx, `DELETE FROM passkeys WHERE id = $1 AND user_id = $2;`, id, userID)
+	if err != nil {
+		slog.Error("failed to delete passkey", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+func scanPasskey(row pgx.Row) (model.Passkey, error) {
+	var passkey model.Passkey
+	var signCount int64
+	err := row.Scan(
+		&passkey.Id,
+		&passkey.UserID,
+		&passkey.Name,
+		&passkey.CredentialID,
+		&passkey.PublicKey,
+		&signCount,
+		&passkey.LastUsedAt,
+		&passkey.CreatedAt,
+	)
+	passkey.SignCount = uint32(signCount)
+	return passkey, err
+}
@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// SavePermission implements model.FileStorage. A grant on the same item for
+// the same user is updated in place, keeping its ID.
+func (r *FileStore) SavePermission(ctx context.Context, permission *model.Permission) error {
+	target := `(folder_id, user_id) WHERE folder_id IS NOT NULL`
+	if permission.FileID != uuid.Nil {
+		target = `(file_id, user_id) WHERE file_id IS NOT NULL`
+	}
+	query := `
+		INSERT INTO permissions (id, user_id, file_id, folder_id, access, granted_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT ` + target + `
+		DO UPDATE SET access = EXCLUDED.access, granted_by = EXCLUDED.granted_by
+		RETURNING id, created_at;`
+
+	err := r.conn.QueryRow(ctx, query,
+		permission.Id,
+		permission.UserID,
+		nullableUUID(permission.FileID),
+		nullableUUID(permission.FolderID),
+		permission.Access,
+		permission.GrantedBy,
+		permission.CreatedAt,
+	).Scan(&permission.Id, &permission.CreatedAt)
+	if err != nil {
+		slog.Error("failed to save permission", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetPermission implements model.FileStorage.
+func (r *FileStore) GetPermission(ctx context.Context, id uuid.UUID) (model.Permission, error) {
+	query := `SELECT ` + permissionColumns + ` FROM permissions JOIN users ON users.id = permissions.user_id WHERE permissions.id = $1;`
+
+	permission, err := scanPermission(r.conn.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Permission{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch permission", "error", err)
+		return model.Permission{}, err
+	}
+
+	return permission, nil
+}
+
+// ListPermissions implements model.FileStorage.
+func (r *FileStore) ListPermissions(ctx context.Context, fileID, folderID uuid.UUID) ([]model.Permission, error) {
+	query := `
+		SELECT ` + permissionColumns + `
+		FROM permissions JOIN users ON users.id = permissions.user_id
+		WHERE permissions.file_id = $1 OR permissions.folder_id = $2
+		ORDER BY permissions.created_at, permissions.id;`
+
+	return r.queryPermissions(ctx, query, nullableUUID(fileID), nullableUUID(folderID))
+}
+
+// ListUserPermissions implements model.FileStorage.
+func (r *FileStore) ListUserPermissions(ctx context.Context, userID uuid.UUID) ([]model.Permission, error) {
+	query := `
+		SELECT ` + permissionColumns + `
+		FROM permissions JOIN users ON users.id = permissions.user_id
+		WHERE permissions.user_id = $1
+		ORDER BY permissions.created_at DESC, permissions.id;`
+
+	return r.queryPermissions(ctx, query, userID)
+}
+
+func (r *FileStore) queryPermissions(ctx context.Context, query string, args ...any) ([]model.Permission, error) {
+	rows, err := r.conn.Query(ctx, query, args...)
+	if err != nil {
+		slog.Error("failed to list permissions", "error", err)
+		return nil, err
+	}
+	permissions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Permission, error) {
+		return scanPermission(row)
+	})
+	if err != nil {
+		slog.Error("failed to scan permissions", "error", err)
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// DeletePermission implements model.FileStorage.
+func (r *FileStore) DeletePermission(ctx context.Context, id uuid.UUID) error {
+	result, err := r.conn.Exec(ctx, `DELETE FROM permissions WHERE id = $1;`, id)
+	if err != nil {
+		slog.Error("failed to delete permission", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// GetAccess implements model.FileStorage. It collects the folder chain above
+// the item with a recursive CTE and takes the strongest grant on the item or
+// any folder in the chain.
+func (r *FileStore) GetAccess(ctx context.Context, userID, fileID, folderID uuid.UUID) (model.Access, error) {
+	query := `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id FROM folders
+			WHERE id = COALESCE($3::uuid, (SELECT folder_id FROM files WHERE id = $2::uuid))
+			UNION ALL
+			SELECT folders.id, folders.parent_id FROM folders JOIN chain ON folders.id = chain.parent_id
+		) CYCLE id SET is_cycle USING path
+		SELECT access FROM permissions
+		WHERE user_id = $1 AND (file_id = $2::uuid OR folder_id IN (SELECT id FROM chain))
+		ORDER BY access = 'editor' DESC
+		LIMIT 1;`
+
+	var access model.Access
+	err := r.conn.QueryRow(ctx, query, userID, nullableUUID(fileID), nullableUUID(folderID)).Scan(&access)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		slog.Error("failed to fetch access", "error", err)
+		return "", err
+	}
+
+	return access, nil
+}
+
+const permissionColumns = `permissions.id, permissions.user_id, users.email, permissions.file_id, permissions.folder_id, permissions.access, permissions.granted_by, permissions.created_at`
+
+func scanPermission(row pgx.Row) (model.Permission, error) {
+	var permission model.Permission
+	var fileID, folderID *uuid.UUID
+	err := row.Scan(
+		&permission.Id,
+		&permission.UserID,
+		&permission.Email,
+		&fileID,
+		&folderID,
+		&permission.Access,
+		&permission.GrantedBy,
+		&permission.CreatedAt,
+	)
+	permission.FileID = uuidValue(fileID)
+	permission.FolderID = uuidValue(folderID)
+	return permission, err
+}
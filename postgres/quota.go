@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetQuota implements model.FileStorage. used_bytes is kept up to date by a
+// trigger on file_versions.
+func (r *FileStore) GetQuota(ctx context.Context, userID uuid.UUID) (int64, *int64, error) {
+	query := `SELECT used_bytes, storage_quota FROM users WHERE id = $1;`
+
+	var used int64
+	var limit *int64
+	if err := r.conn.QueryRow(ctx, query, userID).Scan(&used, &limit); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, model.ErrNotFound
+		}
+		slog.Error("failed to fetch storage quota", "error", err)
+		return 0, nil, err
+	}
+
+	return used, limit, nil
+}
+
+// SetQuota implements model.FileStorage.
+func (r *FileStore) SetQuota(ctx context.Context, userID uuid.UUID, limit *int64) error {
+	query := `UPDATE users SET storage_quota = $1 WHERE id = $2;`
+
+	result, err := r.conn.Exec(ctx, query, limit, userID)
+	if err != nil {
+		slog.Error("failed to set storage quota", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// GetUsageByType implements model.FileStorage.
+func (r *FileStore) GetUsageByType(ctx context.Context, userID uuid.UUID) ([]model.TypeUsage, error) {
+	query := `
+		SELECT mime_type, count(DISTINCT file_id), sum(size)
+		FROM file_versions
+		WHERE user_id = $1
+		GROUP BY mime_type
+		ORDER BY sum(size) DESC, mime_type;`
+
+	rows, err := r.conn.Query(ctx, query, userID)
+	if err != nil {
+		slog.Error("failed to fetch storage usage", "error", err)
+		return nil, err
+	}
+	usage, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.TypeUsage, error) {
+		var usage model.TypeUsage
+		err := row.Scan(&usage.MimeType, &usage.Files, &usage.Bytes)
+		return usage, err
+	})
+	if err != nil {
+		slog.Error("failed to scan storage usage", "error", err)
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// ReserveQuota implements model.FileStorage. The user's row is locked while
+// their stored and reserved bytes are added up, so concurrent reservations
+// are checked one after another.
+func (r *FileStore) ReserveQuota(ctx context.Context, reservation *model.QuotaReservation, defaultLimit int64) (bool, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var used int64
+	var limit *int64
+	query := `SELECT used_bytes, storage_quota FROM users WHERE id = $1 FOR UPDATE;`
+	if err := tx.QueryRow(ctx, query, reservation.UserID).Scan(&used, &limit); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, model.ErrNotFound
+		}
+		slog.Error("failed to lock storage quota", "error", err)
+		return false, err
+	}
+
+	query = `DELETE FROM quota_reservations WHERE user_id = $1 AND expires_at <= now();`
+	if _, err := tx.Exec(ctx, query, reservation.UserID); err != nil {
+		slog.Error("failed to delete lapsed quota reservations", "error", err)
+		return false, err
+	}
+
+	var reserved int64
+	query = `SELECT COALESCE(sum(bytes), 0) FROM quota_reservations WHERE user_id = $1;`
+	if err := tx.QueryRow(ctx, query, reservation.UserID).Scan(&reserved); err != nil {
+		slog.Error("failed to sum quota reservations", "error", err)
+		return false, err
+	}
+
+	if limit == nil {
+		limit = &defaultLimit
+	}
+	if reservation.Bytes > 0 && *limit > 0 && used+reserved+reservation.Bytes > *limit {
+		return false, nil
+	}
+
+	query = `
+		INSERT INTO quota_reservations (id, user_id, bytes, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE
+		SET bytes = quota_reservations.bytes + EXCLUDED.bytes, expires_at = EXCLUDED.expires_at;`
+	_, err = tx.Exec(ctx, query, reservation.Id, reservation.UserID, reservation.Bytes, reservation.ExpiresAt)
+	if err != nil {
+		slog.Error("failed to reserve quota", "error", err)
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit quota reservation", "error", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReleaseQuota implements model.FileStorage.
+func (r *FileStore) ReleaseQuota(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.conn.Exec(ctx, `DELETE FROM quota_reservations WHERE id = $1;`, id); err != nil {
+		slog.Error("failed to release quota reservation", "error", err)
+		return err
+	}
+
+	return nil
+}
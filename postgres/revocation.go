@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RevocationStore persists revoked sessions in PostgreSQL.
+type RevocationStore struct {
+	conn *pgxpool.Pool
+}
+
+// NewRevocationStore creates a new RevocationStore.
+func NewRevocationStore(conn *pgxpool.Pool) model.RevocationStorage {
+	return &RevocationStore{conn: conn}
+}
+
+// InsertRevocation implements model.RevocationStorage. Lapsed revocations
+// are deleted along the way.
+func (r *RevocationStore) InsertRevocation(ctx context.Context, sessionID uuid.UUID, expiresAt time.Time) error {
+	if _, err := r.conn.Exec(ctx, `DELETE FROM revoked_sessions WHERE expires_at <= now();`); err != nil {
+		slog.Error("failed to delete lapsed session revocations", "error", err)
+		return err
+	}
+
+	query := `
+		INSERT INTO revoked_sessions (session_id, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (session_id) DO UPDATE
+		SET expires_at = GREATEST(revoked_sessions.expires_at, EXCLUDED.expires_at);`
+
+	if _, err := r.conn.Exec(ctx, query, sessionID, expiresAt); err != nil {
+		slog.Error("failed to revoke session", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetRevocation implements model.RevocationStorage.
+func (r *RevocationStore) GetRevocation(ctx context.Context, sessionID uuid.UUID) (time.Time, error) {
+	query := `SELECT expires_at FROM revoked_sessions WHERE session_id = $1 AND expires_at > now();`
+
+	var expiresAt time.Time
+	if err := r.conn.QueryRow(ctx, query, sessionID).Scan(&expiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch session revocation", "error", err)
+		return time.Time{}, err
+	}
+
+	return expiresAt, nil
+}
@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ShareStore persists share links in PostgreSQL.
+type ShareStore struct {
+	conn *pgxpool.Pool
+}
+
+// NewShareStore creates a new ShareStore.
+func NewShareStore(conn *pgxpool.Pool) model.ShareStorage {
+	return &ShareStore{conn: conn}
+}
+
+// CreateShareLink implements model.ShareStorage.
+func (s *ShareStore) CreateShareLink(ctx context.Context, link *model.ShareLink) error {
+	query := `
+		INSERT INTO share_links (id, token_hash, user_id, file_id, folder_id, password_hash, expires_at, max_downloads, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`
+
+	_, err := s.conn.Exec(ctx, query,
+		link.Id,
+		link.TokenHash,
+		link.UserID,
+		nullableUUID(link.FileID),
+		nullableUUID(link.FolderID),
+		link.PasswordHash,
+		link.ExpiresAt,
+		link.MaxDownloads,
+		link.CreatedAt,
+	)
+	if err != nil {
+		slog.Error("failed to insert share link", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetShareLink implements model.ShareStorage.
+func (s *ShareStore) GetShareLink(ctx context.Context, id uuid.UUID) (model.ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_links WHERE id = $1;`
+
+	link, err := scanShareLink(s.conn.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ShareLink{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch share link", "error", err)
+		return model.ShareLink{}, err
+	}
+
+	return link, nil
+}
+
+// GetShareLinkByToken implements model.ShareStorage.
+func (s *ShareStore) GetShareLinkByToken(ctx context.Context, tokenHash string) (model.ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_links WHERE token_hash = $1;`
+
+	link, err := scanShareLink(s.conn.QueryRow(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ShareLink{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch share link", "error", err)
+		return model.ShareLink{}, err
+	}
+
+	return link, nil
+}
+
+// ListShareLinks implements model.ShareStorage.
+func (s *ShareStore) ListShareLinks(ctx context.Context, userID uuid.UUID) ([]model.ShareLink, error) {
+	query := `
+		SELECT ` + shareLinkColumns + `
+		FROM share_links
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id;`
+
+	rows, err := s.conn.Query(ctx, query, userID)
+	if err != nil {
+		slog.Error("failed to list share links", "error", err)
+		return nil, err
+	}
+	links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.ShareLink, error) {
+		return scanShareLink(row)
+	})
+	if err != nil {
+		slog.Error("failed to scan share links", "error", err)
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// RevokeShareLink implements model.ShareStorage.
+func (s *ShareStore) RevokeShareLink(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE share_links SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL;`
+
+	result, err := s.conn.Exec(ctx, query, revokedAt, id)
+	if err != nil {
+		slog.Error("failed to revoke share link", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// RecordShareDownload implements model.ShareStorage.
+func (s *ShareStore) RecordShareDownload(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE share_links
+		SET download_count = download_count + 1
+		WHERE id = $1 AND (max_downloads IS NULL OR download_count < max_downloads);`
+
+	result, err := s.conn.Exec(ctx, query, id)
+	if err != nil {
+		slog.Error("failed to record share download", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrConflict
+	}
+
+	return nil
+}
+
+const shareLinkColumns = `id, token_hash, user_id, file_id, folder_id, password_hash, expires_at, max_downloads, download_count, revoked_at, created_at`
+
+func scanShareLink(row pgx.Row) (model.ShareLink, error) {
+	var link model.ShareLink
+	var fileID, folderID *uuid.UUID
+	err := row.Scan(
+		&link.Id,
+		&link.TokenHash,
+		&link.UserID,
+		&fileID,
+		&folderID,
+		&link.PasswordHash,
+		&link.ExpiresAt,
+		&link.MaxDownloads,
+		&link.DownloadCount,
+		&link.RevokedAt,
+		&link.CreatedAt,
+	)
+	link.FileID = uuidValue(fileID)
+	link.FolderID = uuidValue(folderID)
+	link.HasPassword = len(link.PasswordHash) > 0
+	return link, err
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/freekobie/kora/model"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// KeyStore persists token signing keys in PostgreSQL.
+type KeyStore struct {
+	conn *pgxpool.Pool
+}
+
+// NewKeyStore creates a new KeyStore.
+func NewKeyStore(conn *pgxpool.Pool) model.SigningKeyStorage {
+	return &KeyStore{conn: conn}
+}
+
+// ListSigningKeys implements model.SigningKeyStorage.
+func (k *KeyStore) ListSigningKeys(ctx context.Context) ([]model.SigningKey, error) {
+	query := `
+		SELECT kid, algorithm, encrypted_private_key, created_at, retires_at
+		FROM signing_keys
+		WHERE retires_at > now()
+		ORDER BY created_at DESC;`
+
+	rows, err := k.conn.Query(ctx, query)
+	if err != nil {
+		slog.Error("failed to list signing keys", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []model.SigningKey
+	for rows.Next() {
+		var key model.SigningKey
+		if err := rows.Scan(&key.Kid, &key.Algorithm, &key.PrivateKey, &key.CreatedAt, &key.RetiresAt); err != nil {
+			slog.Error("failed to scan signing key", "error", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("failed to list signing keys", "error", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// InsertSigningKey implements model.SigningKeyStorage.
+func (k *KeyStore) InsertSigningKey(ctx context.Context, key *model.SigningKey) error {
+	query := `
+		INSERT INTO signing_keys (kid, algorithm, encrypted_private_key, created_at, retires_at)
+		VALUES ($1, $2, $3, $4, $5);`
+
+	_, err := k.conn.Exec(ctx, query, key.Kid, key.Algorithm, key.PrivateKey, key.CreatedAt, key.RetiresAt)
+	if err != nil {
+		slog.Error("failed to insert signing key", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRetiredSigningKeys implements model.SigningKeyStorage.
+func (k *KeyStore) DeleteRetiredSigningKeys(ctx context.Context) (int64, error) {
+	result, err := k.conn.Exec(ctx, `DELETE FROM signing_keys WHERE retires_at <= now();`)
+	if err != nil {
+		slog.Error("failed to delete retired signing keys", "error", err)
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,256 @@
+package postgres
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// TrashFile implements model.FileStorage.
+func (r *FileStore) TrashFile(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	query := `
+		UPDATE files
+		SET deleted_at = $1, trash_id = id
+		WHERE id = $2 AND deleted_at IS NULL;`
+
+	result, err := r.conn.Exec(ctx, query, deletedAt, id)
+	if err != nil {
+		slog.Error("failed to trash file", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// TrashFolder marks a folder and every folder and file below it that is not
+// already in the trash as deleted together.
+func (s *FileStore) TrashFolder(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT id FROM folders WHERE id = $1 AND deleted_at IS NULL
+			UNION ALL
+			SELECT folders.id FROM folders JOIN tree ON folders.parent_id = tree.id
+			WHERE folders.deleted_at IS NULL
+		) CYCLE id SET is_cycle USING path
+		UPDATE folders
+		SET deleted_at = $2, trash_id = $1
+		WHERE id IN (SELECT id FROM tree)
+		RETURNING id;`
+
+	rows, err := tx.Query(ctx, query, id, deletedAt)
+	if err != nil {
+		slog.Error("failed to trash folders", "error", err)
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		slog.Error("failed to trash folders", "error", err)
+		return err
+	}
+	if len(ids) == 0 {
+		return model.ErrNotFound
+	}
+
+	query = `
+		UPDATE files
+		SET deleted_at = $1, trash_id = $2
+		WHERE folder_id = ANY($3) AND deleted_at IS NULL;`
+
+	if _, err := tx.Exec(ctx, query, deletedAt, id, ids); err != nil {
+		slog.Error("failed to trash folder files", "error", err)
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit folder trash", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListTrash implements model.FileStorage.
+func (s *FileStore) ListTrash(ctx context.Context, userID uuid.UUID) (model.Trash, error) {
+	query := `
+		SELECT ` + folderColumns + `
+		FROM folders
+		WHERE user_id = $1 AND trash_id = id
+		ORDER BY deleted_at DESC, id;`
+
+	rows, err := s.conn.Query(ctx, query, userID)
+	if err != nil {
+		slog.Error("failed to list trashed folders", "error", err)
+		return model.Trash{}, err
+	}
+	folders, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Folder, error) {
+		return scanFolder(row)
+	})
+	if err != nil {
+		slog.Error("failed to scan trashed folders", "error", err)
+		return model.Trash{}, err
+	}
+
+	query = `
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE user_id = $1 AND trash_id = id
+		ORDER BY deleted_at DESC, id;`
+
+	rows, err = s.conn.Query(ctx, query, userID)
+	if err != nil {
+		slog.Error("failed to list trashed files", "error", err)
+		return model.Trash{}, err
+	}
+	files, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.File, error) {
+		return scanFile(row)
+	})
+	if err != nil {
+		slog.Error("failed to scan trashed files", "error", err)
+		return model.Trash{}, err
+	}
+
+	return model.Trash{Folders: folders, Files: files}, nil
+}
+
+// RestoreFile implements model.FileStorage.
+func (r *FileStore) RestoreFile(ctx context.Context, file *model.File) error {
+	query := `
+		UPDATE files
+		SET name = $1, folder_id = $2, last_modified = $3, deleted_at = NULL, trash_id = NULL
+		WHERE id = $4 AND trash_id = id;`
+
+	result, err := r.conn.Exec(ctx, query, file.Name, nullableUUID(file.FolderID), file.LastModified, file.Id)
+	if err != nil {
+		if isUniqueViolation(err, "idx_files_unique_name") {
+			return model.ErrDuplicateName
+		}
+		slog.Error("failed to restore file", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// RestoreFolder implements model.FileStorage.
+func (s *FileStore) RestoreFolder(ctx context.Context, folder *model.Folder) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE folders
+		SET name = $1, parent_id = $2, last_modified = $3, deleted_at = NULL, trash_id = NULL
+		WHERE id = $4 AND trash_id = id;`
+
+	result, err := tx.Exec(ctx, query, folder.Name, nullableUUID(folder.ParentID), folder.LastModified, folder.Id)
+	if err != nil {
+		if isUniqueViolation(err, "idx_folders_unique_name") {
+			return model.ErrDuplicateName
+		}
+		slog.Error("failed to restore folder", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	for _, query := range []string{
+		`UPDATE folders SET deleted_at = NULL, trash_id = NULL WHERE trash_id = $1;`,
+		`UPDATE files SET deleted_at = NULL, trash_id = NULL WHERE trash_id = $1;`,
+	} {
+		if _, err := tx.Exec(ctx, query, folder.Id); err != nil {
+			slog.Error("failed to restore folder contents", "error", err)
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit folder restore", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// PurgeTrash deletes expired trash entries. Deleting a folder cascades to
+// everything below it, including items that were trashed separately, so the
+// storage keys are collected from the whole subtree first.
+func (s *FileStore) PurgeTrash(ctx context.Context, userID uuid.UUID, before time.Time) ([]string, error) {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// collect the keys before the cascade removes the file rows
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT id FROM folders
+			WHERE trash_id = id AND deleted_at <= $1 AND ($2::uuid IS NULL OR user_id = $2)
+			UNION ALL
+			SELECT folders.id FROM folders JOIN tree ON folders.parent_id = tree.id
+		) CYCLE id SET is_cycle USING path
+		SELECT file_versions.storage_key
+		FROM file_versions JOIN files ON files.id = file_versions.file_id
+		WHERE files.folder_id IN (SELECT id FROM tree)
+			OR (files.trash_id = files.id AND files.deleted_at <= $1 AND ($2::uuid IS NULL OR files.user_id = $2));`
+
+	rows, err := tx.Query(ctx, query, before, nullableUUID(userID))
+	if err != nil {
+		slog.Error("failed to collect trashed storage keys", "error", err)
+		return nil, err
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		slog.Error("failed to scan trashed storage keys", "error", err)
+		return nil, err
+	}
+
+	query = `
+		DELETE FROM folders
+		WHERE trash_id = id AND deleted_at <= $1 AND ($2::uuid IS NULL OR user_id = $2);`
+
+	if _, err := tx.Exec(ctx, query, before, nullableUUID(userID)); err != nil {
+		slog.Error("failed to purge trashed folders", "error", err)
+		return nil, err
+	}
+
+	query = `
+		DELETE FROM files
+		WHERE trash_id = id AND deleted_at <= $1 AND ($2::uuid IS NULL OR user_id = $2);`
+
+	if _, err := tx.Exec(ctx, query, before, nullableUUID(userID)); err != nil {
+		slog.Error("failed to purge trashed files", "error", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit trash purge", "error", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,184 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetTwoFactor implements model.UserStore.
+func (u *UserStore) GetTwoFactor(ctx context.Context, userID uuid.UUID) (model.TwoFactor, error) {
+	query := `SELECT user_id, secret, enabled, last_step, created_at FROM two_factor WHERE user_id = $1;`
+
+	var tf model.TwoFactor
+	err := u.conn.QueryRow(ctx, query, userID).Scan(&tf.UserID, &tf.Secret, &tf.Enabled, &tf.LastStep, &tf.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.TwoFactor{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch two-factor settings", "error", err)
+		return model.TwoFactor{}, err
+	}
+
+	return tf, nil
+}
+
+// SaveTwoFactor implements model.UserStore. An enabled authenticator is
+// never replaced; ErrConflict is returned instead.
+func (u *UserStore) SaveTwoFactor(ctx context.Context, tf *model.TwoFactor) error {
+	query := `
+		INSERT INTO two_factor (user_id, secret, enabled, last_step, created_at)
+		VALUES ($1, $2, false, 0, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, created_at = EXCLUDED.created_at
+		WHERE two_factor.enabled = false;`
+
+	result, err := u.conn.Exec(ctx, query, tf.UserID, tf.Secret, tf.CreatedAt)
+	if err != nil {
+		slog.Error("failed to save two-factor settings", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrConflict
+	}
+
+	return nil
+}
+
+// EnableTwoFactor implements model.UserStore.
+func (u *UserStore) EnableTwoFactor(ctx context.Context, userID uuid.UUID, step int64, recoveryHashes []string) error {
+	tx, err := u.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx,
+		`UPDATE two_factor SET enabled = true, last_step = $2 WHERE user_id = $1 AND enabled = false;`,
+		userID, step,
+	)
+	if err != nil {
+		slog.Error("failed to enable two-factor authentication", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrConflict
+	}
+
+	if err := insertRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit two-factor enrollment", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// UseTwoFactorStep implements model.UserStore.
+func (u *UserStore) UseTwoFactorStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	result, err := u.conn.Exec(ctx,
+		`UPDATE two_factor SET last_step = $2 WHERE user_id = $1 AND last_step < $2;`,
+		userID, step,
+	)
+	if err != nil {
+		slog.Error("failed to record two-factor code", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrConflict
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes implements model.UserStore.
+func (u *UserStore) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, recoveryHashes []string) error {
+	tx, err := u.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit recovery codes", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// UseRecoveryCode implements model.UserStore.
+func (u *UserStore) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	result, err := u.conn.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1 AND code_hash = $2;`, userID, codeHash)
+	if err != nil {
+		slog.Error("failed to use recovery code", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteTwoFactor implements model.UserStore.
+func (u *UserStore) DeleteTwoFactor(ctx context.Context, userID uuid.UUID) error {
+	tx, err := u.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1;`, userID); err != nil {
+		slog.Error("failed to delete recovery codes", "error", err)
+		return err
+	}
+
+	result, err := tx.Exec(ctx, `DELETE FROM two_factor WHERE user_id = $1;`, userID)
+	if err != nil {
+		slog.Error("failed to delete two-factor settings", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit two-factor removal", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// insertRecoveryCodes replaces a user's recovery codes within tx.
+func insertRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uuid.UUID, recoveryHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1;`, userID); err != nil {
+		slog.Error("failed to delete recovery codes", "error", err)
+		return err
+	}
+
+	for _, hash := range recoveryHashes {
+		_, err := tx.Exec(ctx, `INSERT INTO recovery_codes (code_hash, user_id) VALUES ($1, $2);`, hash, userID)
+		if err != nil {
+			slog.Error("failed to insert recovery code", "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
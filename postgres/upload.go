@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UploadStore persists resumable upload sessions in PostgreSQL.
+type UploadStore struct {
+	conn *pgxpool.Pool
+}
+
+// NewUploadStore creates a new UploadStore.
+func NewUploadStore(conn *pgxpool.Pool) model.UploadStorage {
+	return &UploadStore{conn: conn}
+}
+
+// CreateUpload implements model.UploadStorage.
+func (s *UploadStore) CreateUpload(ctx context.Context, upload *model.Upload) error {
+	query := `
+		INSERT INTO uploads (id, user_id, folder_id, file_id, name, mime_type, size, upload_offset, on_conflict, created_at, last_modified)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`
+
+	_, err := s.conn.Exec(ctx, query,
+		upload.Id,
+		upload.UserID,
+		nullableUUID(upload.FolderID),
+		nullableUUID(upload.FileID),
+		upload.Name,
+		upload.MimeType,
+		upload.Size,
+		upload.Offset,
+		upload.OnConflict,
+		upload.CreatedAt,
+		upload.LastModified,
+	)
+	if err != nil {
+		slog.Error("failed to insert upload", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetUpload implements model.UploadStorage.
+func (s *UploadStore) GetUpload(ctx context.Context, id uuid.UUID) (model.Upload, error) {
+	query := `
+		SELECT id, user_id, folder_id, file_id, name, mime_type, size, upload_offset, on_conflict, created_at, last_modified
+		FROM uploads
+		WHERE id = $1;`
+
+	var upload model.Upload
+	var folderID, fileID *uuid.UUID
+	err := s.conn.QueryRow(ctx, query, id).Scan(
+		&upload.Id,
+		&upload.UserID,
+		&folderID,
+		&fileID,
+		&upload.Name,
+		&upload.MimeType,
+		&upload.Size,
+		&upload.Offset,
+		&upload.OnConflict,
+		&upload.CreatedAt,
+		&upload.LastModified,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Upload{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch upload", "error", err)
+		return model.Upload{}, err
+	}
+	upload.FolderID = uuidValue(folderID)
+	upload.FileID = uuidValue(fileID)
+
+	return upload, nil
+}
+
+// AppendChunk implements model.UploadStorage.
+func (s *UploadStore) AppendChunk(ctx context.Context, chunk *model.UploadChunk) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE uploads
+		SET upload_offset = upload_offset + $1, last_modified = now()
+		WHERE id = $2 AND upload_offset = $3 AND upload_offset + $1 <= size;`
+
+	result, err := tx.Exec(ctx, query, chunk.Size, chunk.UploadID, chunk.Offset)
+	if err != nil {
+		slog.Error("failed to advance upload offset", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrConflict
+	}
+
+	query = `
+		INSERT INTO upload_chunks (upload_id, chunk_offset, size, storage_key)
+		VALUES ($1, $2, $3, $4);`
+
+	_, err = tx.Exec(ctx, query, chunk.UploadID, chunk.Offset, chunk.Size, chunk.StorageKey)
+	if err != nil {
+		slog.Error("failed to insert upload chunk", "error", err)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetChunks implements model.UploadStorage.
+func (s *UploadStore) GetChunks(ctx context.Context, uploadID uuid.UUID) ([]model.UploadChunk, error) {
+	query := `
+		SELECT upload_id, chunk_offset, size, storage_key
+		FROM upload_chunks
+		WHERE upload_id = $1
+		ORDER BY chunk_offset;`
+
+	rows, err := s.conn.Query(ctx, query, uploadID)
+	if err != nil {
+		slog.Error("failed to fetch upload chunks", "error", err)
+		return nil, err
+	}
+
+	chunks, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.UploadChunk, error) {
+		var chunk model.UploadChunk
+		err := row.Scan(&chunk.UploadID, &chunk.Offset, &chunk.Size, &chunk.StorageKey)
+		return chunk, err
+	})
+	if err != nil {
+		slog.Error("failed to scan upload chunks", "error", err)
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// PendingUploadSize implements model.UploadStorage.
+func (s *UploadStore) PendingUploadSize(ctx context.Context, userID uuid.UUID) (int64, error) {
+	query := `SELECT COALESCE(sum(size), 0) FROM uploads WHERE user_id = $1;`
+
+	var size int64
+	if err := s.conn.QueryRow(ctx, query, userID).Scan(&size); err != nil {
+		slog.Error("failed to sum pending uploads", "error", err)
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// DeleteUpload implements model.UploadStorage.
+func (s *UploadStore) DeleteUpload(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM uploads WHERE id = $1;`
+
+	result, err := s.conn.Exec(ctx, query, id)
+	if err != nil {
+		slog.Error("failed to delete upload", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
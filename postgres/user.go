@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/freekobie/kora/model"
 	"github.com/google/uuid"
@@ -25,8 +26,8 @@ func NewUserStore(conn *pgxpool.Pool) model.UserStore {
 // InsertUser implements model.UserStore.
 func (u *UserStore) InsertUser(ctx context.Context, user *model.User) error {
 	query := `
-		INSERT INTO users (id, name, email, password_hash, profile_photo, created_at, last_modified, verified)
-		VALUES ($1, NULLIF($2,''), $3, $4, $5, $6, $7, $8);`
+		INSERT INTO users (id, name, email, password_hash, profile_photo, created_at, last_modified, verified, role)
+		VALUES ($1, NULLIF($2,''), $3, $4, $5, $6, $7, $8, COALESCE(NULLIF($9, ''), 'user'));`
 
 	_, err := u.conn.Exec(ctx, query,
 		user.Id,
@@ -37,6 +38,7 @@ func (u *UserStore) InsertUser(ctx context.Context, user *model.User) error {
 		user.CreatedAt,
 		user.LastModifed,
 		user.Verified,
+		user.Role,
 	)
 	if err != nil {
 		if strings.Contains(err.Error(), "SQLSTATE 23505") {
@@ -67,7 +69,7 @@ func (u *UserStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
 // GetUser implements model.UserStore.
 func (u *UserStore) GetUser(ctx context.Context, id uuid.UUID) (model.User, error) {
 	query := `
-		SELECT id, name, email, password_hash, profile_photo, created_at, last_modified, verified
+		SELECT id, name, email, password_hash, profile_photo, created_at, last_modified, verified, role
 		FROM users
 		WHERE id = $1;`
 
@@ -81,6 +83,7 @@ func (u *UserStore) GetUser(ctx context.Context, id uuid.UUID) (model.User, erro
 		&user.CreatedAt,
 		&user.LastModifed,
 		&user.Verified,
+		&user.Role,
 	)
 
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -93,7 +96,7 @@ func (u *UserStore) GetUser(ctx context.Context, id uuid.UUID) (model.User, erro
 // GetUserByMail implements model.UserStore.
 func (u *UserStore) GetUserByMail(ctx context.Context, email string) (model.User, error) {
 	query := `
-		SELECT id, name, email, password_hash, profile_photo, created_at, last_modified, verified
+		SELECT id, name, email, password_hash, profile_photo, created_at, last_modified, verified, role
 		FROM users
 		WHERE email = $1;`
 
@@ -107,6 +110,7 @@ func (u *UserStore) GetUserByMail(ctx context.Context, email string) (model.User
 		&user.CreatedAt,
 		&user.LastModifed,
 		&user.Verified,
+		&user.Role,
 	)
 
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -120,8 +124,8 @@ func (u *UserStore) GetUserByMail(ctx context.Context, email string) (model.User
 func (u *UserStore) UpdateUser(ctx context.Context, user *model.User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, password_hash = $3, profile_photo = $4, last_modified = $5, verified = $6
-		WHERE id = $7;`
+		SET name = $1, email = $2, password_hash = $3, profile_photo = $4, last_modified = $5, verified = $6, role = $7
+		WHERE id = $8;`
 
 	result, err := u.conn.Exec(ctx, query,
 		user.Name,
@@ -130,6 +134,7 @@ func (u *UserStore) UpdateUser(ctx context.Context, user *model.User) error {
 		user.ProfilePhoto,
 		user.LastModifed,
 		user.Verified,
+		user.Role,
 		user.Id,
 	)
 	if err != nil {
@@ -146,10 +151,7 @@ func (u *UserStore) UpdateUser(ctx context.Context, user *model.User) error {
 
 // InsertToken implements model.TokenStore.
 func (t *UserStore) InsertToken(ctx context.Context, token *model.UserToken) error {
-	query := `INSERT INTO user_tokens(token_hash, user_id, scope, expires_at)
-	VALUES($1, $2, $3, $4);`
-
-	_, err := t.conn.Exec(ctx, query, token.Hash, token.UserId, token.Scope, token.ExpiresAt)
+	_, err := t.conn.Exec(ctx, insertTokenQuery, tokenArgs(token)...)
 	if err != nil {
 		slog.Error("failed to insert token", "error", err)
 		return err
@@ -168,7 +170,8 @@ func (t *UserStore) GetUserForToken(ctx context.Context, tokenHash string, scope
 	users.profile_photo,
 	users.verified,
 	users.created_at,
-	users.last_modified
+	users.last_modified,
+	users.role
 	FROM users
 	JOIN user_tokens AS tokens
 	ON users.id = tokens.user_id
@@ -180,7 +183,7 @@ func (t *UserStore) GetUserForToken(ctx context.Context, tokenHash string, scope
 
 	var user model.User
 	row := t.conn.QueryRow(ctx, query, tokenHash, scope, email)
-	err := row.Scan(&user.Id, &user.Name, &user.Email, &user.PasswordHash, &user.ProfilePhoto, &user.Verified, &user.CreatedAt, &user.LastModifed)
+	err := row.Scan(&user.Id, &user.Name, &user.Email, &user.PasswordHash, &user.ProfilePhoto, &user.Verified, &user.CreatedAt, &user.LastModifed, &user.Role)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, model.ErrNotFound
@@ -204,3 +207,208 @@ func (t *UserStore) DeleteToken(ctx context.Context, tokenHash, scope string) er
 
 	return nil
 }
+
+// GetToken implements model.UserStore.
+func (t *UserStore) GetToken(ctx context.Context, tokenHash, scope string) (model.UserToken, error) {
+	query := `
+		SELECT token_hash, user_id, scope, expires_at, family_id, rotated_at, user_agent, ip_address, created_at, last_used_at,
+			COALESCE(new_email, '')
+		FROM user_tokens
+		WHERE token_hash = $1 AND scope = $2 AND expires_at > now();`
+
+	var token model.UserToken
+	var hash []byte
+	var familyID *uuid.UUID
+	err := t.conn.QueryRow(ctx, query, tokenHash, scope).Scan(
+		&hash,
+		&token.UserId,
+		&token.Scope,
+		&token.ExpiresAt,
+		&familyID,
+		&token.RotatedAt,
+		&token.UserAgent,
+		&token.IPAddress,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+		&token.NewEmail,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.UserToken{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch token", "error", err)
+		return model.UserToken{}, err
+	}
+	token.Hash = string(hash)
+	token.FamilyID = uuidValue(familyID)
+
+	return token, nil
+}
+
+// RotateToken implements model.UserStore. Marking the old token and storing
+// the new one happen in one transaction, and the conditional update makes
+// concurrent rotations of the same token fail for all but one caller.
+func (t *UserStore) RotateToken(ctx context.Context, oldHash string, next *model.UserToken) error {
+	tx, err := t.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx,
+		`UPDATE user_tokens SET rotated_at = now() WHERE token_hash = $1 AND scope = $2 AND rotated_at IS NULL;`,
+		oldHash, next.Scope,
+	)
+	if err != nil {
+		slog.Error("failed to rotate token", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrConflict
+	}
+
+	_, err = tx.Exec(ctx, insertTokenQuery, tokenArgs(next)...)
+	if err != nil {
+		slog.Error("failed to insert rotated token", "error", err)
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit token rotation", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteTokenFamily implements model.UserStore.
+func (t *UserStore) DeleteTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := t.conn.Exec(ctx, `DELETE FROM user_tokens WHERE family_id = $1;`, familyID)
+	if err != nil {
+		slog.Error("failed to delete token family", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUserTokens implements model.UserStore.
+func (t *UserStore) DeleteUserTokens(ctx context.Context, userID uuid.UUID, scope string) error {
+	_, err := t.conn.Exec(ctx, `DELETE FROM user_tokens WHERE user_id = $1 AND scope = $2;`, userID, scope)
+	if err != nil {
+		slog.Error("failed to delete user tokens", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListSessions implements model.UserStore. The current token of each family
+// stands for its session.
+func (t *UserStore) ListSessions(ctx context.Context, userID uuid.UUID) ([]model.Session, error) {
+	query := `
+		SELECT family_id, user_agent, ip_address, created_at, last_used_at, expires_at
+		FROM user_tokens
+		WHERE user_id = $1 AND scope = 'authentication' AND family_id IS NOT NULL
+		AND rotated_at IS NULL AND expires_at > now()
+		ORDER BY last_used_at DESC, family_id;`
+
+	rows, err := t.conn.Query(ctx, query, userID)
+	if err != nil {
+		slog.Error("failed to list sessions", "error", err)
+		return nil, err
+	}
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Session, error) {
+		var session model.Session
+		err := row.Scan(&session.Id, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+		return session, err
+	})
+	if err != nil {
+		slog.Error("failed to scan sessions", "error", err)
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession implements model.UserStore.
+func (t *UserStore) DeleteSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	query := `DELETE FROM user_tokens WHERE user_id = $1 AND family_id = $2 AND scope = 'authentication';`
+
+	result, err := t.conn.Exec(ctx, query, userID, sessionID)
+	if err != nil {
+		slog.Error("failed to delete session", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// ChangeEmail implements model.UserStore.
+func (u *UserStore) ChangeEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	tx, err := u.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `UPDATE users SET email = $1, last_modified = now() WHERE id = $2;`, email, userID)
+	if err != nil {
+		if isUniqueViolation(err, "users_email_key") {
+			return model.ErrDuplicateUser
+		}
+		slog.Error("failed to change user email", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM user_tokens WHERE user_id = $1 AND scope = 'email_change';`, userID)
+	if err != nil {
+		slog.Error("failed to delete email change tokens", "error", err)
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit email change", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+const insertTokenQuery = `
+	INSERT INTO user_tokens(token_hash, user_id, scope, expires_at, family_id, user_agent, ip_address, created_at, last_used_at, new_email)
+	VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''));`
+
+// tokenArgs returns the arguments of insertTokenQuery. Tokens that are not
+// refresh tokens have no session times, so they default to now.
+func tokenArgs(token *model.UserToken) []any {
+	createdAt, lastUsedAt := token.CreatedAt, token.LastUsedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+	if lastUsedAt.IsZero() {
+		lastUsedAt = createdAt
+	}
+
+	return []any{
+		token.Hash,
+		token.UserId,
+		token.Scope,
+		token.ExpiresAt,
+		nullableUUID(token.FamilyID),
+		token.UserAgent,
+		token.IPAddress,
+		createdAt,
+		lastUsedAt,
+		token.NewEmail,
+	}
+}
@@ -37,6 +37,7 @@ func createTestUser(name, email string) *model.User {
 		CreatedAt:    time.Now().UTC(),
 		LastModifed:  time.Now().UTC(),
 		Verified:     true,
+		Role:         model.RoleUser,
 	}
 }
 
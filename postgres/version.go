@@ -0,0 +1,294 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// AddFileVersion implements model.FileStorage.
+func (r *FileStore) AddFileVersion(ctx context.Context, file *model.File, oldKey string, sourceID uuid.UUID) ([]string, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		slog.Error("failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var orphaned []string
+	if sourceID != uuid.Nil {
+		// the source's current content lives on as the new version, its
+		// older versions go away with it
+		query := `SELECT storage_key FROM file_versions WHERE file_id = $1 AND storage_key <> $2;`
+		rows, err := tx.Query(ctx, query, sourceID, file.StorageKey)
+		if err != nil {
+			slog.Error("failed to collect replacing file versions", "error", err)
+			return nil, err
+		}
+		orphaned, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			slog.Error("failed to scan replacing file versions", "error", err)
+			return nil, err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM files WHERE id = $1;`, sourceID); err != nil {
+			slog.Error("failed to delete replacing file", "error", err)
+			return nil, err
+		}
+	}
+
+	query := `
+		UPDATE files
+		SET mime_type = $1, size = $2, storage_key = $3, last_modified = $4,
+			version = (SELECT COALESCE(max(version), 0) + 1 FROM file_versions WHERE file_id = $5)
+		WHERE id = $5 AND storage_key = $6
+		RETURNING version;`
+
+	err = tx.QueryRow(ctx, query, file.MimeType, file.Size, file.StorageKey, file.LastModified, file.Id, oldKey).Scan(&file.Version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrConflict
+		}
+		slog.Error("failed to update file version", "error", err)
+		return nil, err
+	}
+
+	if err := insertFileVersion(ctx, tx, file); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit file version", "error", err)
+		return nil, err
+	}
+
+	return orphaned, nil
+}
+
+// insertFileVersion records the current content of file as version
+// file.Version.
+func insertFileVersion(ctx context.Context, tx pgx.Tx, file *model.File) error {
+	query := `
+		INSERT INTO file_versions (id, file_id, user_id, version, mime_type, size, storage_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+
+	_, err := tx.Exec(ctx, query,
+		uuid.New(),
+		file.Id,
+		file.UserID,
+		file.Version,
+		file.MimeType,
+		file.Size,
+		file.StorageKey,
+		file.LastModified,
+	)
+	if err != nil {
+		slog.Error("failed to insert file version", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+const versionColumns = `v.id, v.file_id, v.version, v.mime_type, v.size, v.storage_key, v.created_at, v.version = f.version`
+
+func scanFileVersion(row pgx.Row) (model.FileVersion, error) {
+	var version model.FileVersion
+	err := row.Scan(
+		&version.Id,
+		&version.FileID,
+		&version.Version,
+		&version.MimeType,
+		&version.Size,
+		&version.StorageKey,
+		&version.CreatedAt,
+		&version.Current,
+	)
+	return version, err
+}
+
+// ListFileVersions implements model.FileStorage.
+func (r *FileStore) ListFileVersions(ctx context.Context, fileID uuid.UUID) ([]model.FileVersion, error) {
+	query := `
+		SELECT ` + versionColumns + `
+		FROM file_versions v JOIN files f ON f.id = v.file_id
+		WHERE v.file_id = $1
+		ORDER BY v.version DESC;`
+
+	rows, err := r.conn.Query(ctx, query, fileID)
+	if err != nil {
+		slog.Error("failed to list file versions", "error", err)
+		return nil, err
+	}
+	versions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.FileVersion, error) {
+		return scanFileVersion(row)
+	})
+	if err != nil {
+		slog.Error("failed to scan file versions", "error", err)
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// GetFileVersion implements model.FileStorage.
+func (r *FileStore) GetFileVersion(ctx context.Context, fileID uuid.UUID, version int) (model.FileVersion, error) {
+	query := `
+		SELECT ` + versionColumns + `
+		FROM file_versions v JOIN files f ON f.id = v.file_id
+		WHERE v.file_id = $1 AND v.version = $2;`
+
+	fileVersion, err := scanFileVersion(r.conn.QueryRow(ctx, query, fileID, version))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.FileVersion{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch file version", "error", err)
+		return model.FileVersion{}, err
+	}
+
+	return fileVersion, nil
+}
+
+// SetCurrentVersion implements model.FileStorage.
+func (r *FileStore) SetCurrentVersion(ctx context.Context, file *model.File, oldKey string) error {
+	query := `
+		UPDATE files f
+		SET mime_type = v.mime_type, size = v.size, storage_key = v.storage_key, version = v.version, last_modified = $3
+		FROM file_versions v
+		WHERE f.id = $1 AND v.file_id = f.id AND v.version = $2 AND f.storage_key = $4
+		RETURNING f.mime_type, f.size, f.storage_key;`
+
+	err := r.conn.QueryRow(ctx, query, file.Id, file.Version, file.LastModified, oldKey).Scan(
+		&file.MimeType,
+		&file.Size,
+		&file.StorageKey,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrConflict
+		}
+		slog.Error("failed to set current file version", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteFileVersion implements model.FileStorage.
+func (r *FileStore) DeleteFileVersion(ctx context.Context, fileID uuid.UUID, version int) (string, error) {
+	query := `
+		DELETE FROM file_versions v
+		USING files f
+		WHERE v.file_id = $1 AND v.version = $2 AND f.id = v.file_id AND f.version <> v.version
+		RETURNING v.storage_key;`
+
+	var key string
+	if err := r.conn.QueryRow(ctx, query, fileID, version).Scan(&key); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", model.ErrNotFound
+		}
+		slog.Error("failed to delete file version", "error", err)
+		return "", err
+	}
+
+	return key, nil
+}
+
+// PruneFileVersions implements model.FileStorage. The current version is
+// always kept, so only keep-1 of the others survive the count limit.
+func (r *FileStore) PruneFileVersions(ctx context.Context, fileID uuid.UUID, keep int, before time.Time) ([]string, error) {
+	var cutoff *time.Time
+	if !before.IsZero() {
+		cutoff = &before
+	}
+
+	query := `
+		DELETE FROM file_versions v
+		USING files f
+		WHERE v.file_id = $1 AND f.id = v.file_id AND v.version <> f.version
+			AND (
+				($2::int > 0 AND v.version NOT IN (
+					SELECT version FROM file_versions
+					WHERE file_id = $1 AND version <> f.version
+					ORDER BY version DESC
+					LIMIT greatest($2::int - 1, 0)
+				))
+				OR v.created_at < $3::timestamp
+			)
+		RETURNING v.storage_key;`
+
+	rows, err := r.conn.Query(ctx, query, fileID, keep, cutoff)
+	if err != nil {
+		slog.Error("failed to prune file versions", "error", err)
+		return nil, err
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		slog.Error("failed to prune file versions", "error", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// PruneExpiredVersions implements model.FileStorage.
+func (r *FileStore) PruneExpiredVersions(ctx context.Context, now time.Time, defaultMaxAgeDays int) ([]string, error) {
+	query := `
+		DELETE FROM file_versions v
+		USING files f LEFT JOIN file_version_settings s ON s.user_id = f.user_id
+		WHERE f.id = v.file_id AND v.version <> f.version
+			AND COALESCE(s.max_age_days, $2::int) > 0
+			AND v.created_at < $1::timestamp - make_interval(days => COALESCE(s.max_age_days, $2::int))
+		RETURNING v.storage_key;`
+
+	rows, err := r.conn.Query(ctx, query, now, defaultMaxAgeDays)
+	if err != nil {
+		slog.Error("failed to prune expired file versions", "error", err)
+		return nil, err
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		slog.Error("failed to prune expired file versions", "error", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetVersionRetention implements model.FileStorage.
+func (r *FileStore) GetVersionRetention(ctx context.Context, userID uuid.UUID) (model.VersionRetention, error) {
+	query := `SELECT max_versions, max_age_days FROM file_version_settings WHERE user_id = $1;`
+
+	var retention model.VersionRetention
+	if err := r.conn.QueryRow(ctx, query, userID).Scan(&retention.MaxVersions, &retention.MaxAgeDays); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.VersionRetention{}, model.ErrNotFound
+		}
+		slog.Error("failed to fetch version retention", "error", err)
+		return model.VersionRetention{}, err
+	}
+
+	return retention, nil
+}
+
+// SetVersionRetention implements model.FileStorage.
+func (r *FileStore) SetVersionRetention(ctx context.Context, userID uuid.UUID, retention model.VersionRetention) error {
+	query := `
+		INSERT INTO file_version_settings (user_id, max_versions, max_age_days)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET max_versions = EXCLUDED.max_versions, max_age_days = EXCLUDED.max_age_days;`
+
+	if _, err := r.conn.Exec(ctx, query, userID, retention.MaxVersions, retention.MaxAgeDays); err != nil {
+		slog.Error("failed to save version retention", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+)
+
+// AccessTokenScopes are the scopes a personal access token can have.
+var AccessTokenScopes = []string{model.ScopeFilesRead, model.ScopeFilesWrite}
+
+type CreateAccessTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is optional; tokens without it last until revoked.
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// CreateAccessToken creates a personal access token for userID. The token is
+// returned along with its metadata and cannot be retrieved again.
+func (us *UserService) CreateAccessToken(ctx context.Context, userID uuid.UUID, req CreateAccessTokenRequest) (*model.AccessToken, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, "", ErrInvalidTokenName
+	}
+
+	if len(req.Scopes) == 0 {
+		return nil, "", ErrInvalidScopes
+	}
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !slices.Contains(AccessTokenScopes, scope) {
+			return nil, "", ErrInvalidScopes
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	now := time.Now().UTC()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, "", ErrInvalidExpiry
+	}
+
+	secret := model.AccessTokenPrefix + generateToken()
+	token := model.AccessToken{
+		Id:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: now,
+	}
+	if err := us.store.InsertAccessToken(ctx, &token, hashString(secret)); err != nil {
+		return nil, "", err
+	}
+
+	return &token, secret, nil
+}
+
+// ListAccessTokens returns a user's personal access tokens.
+func (us *UserService) ListAccessTokens(ctx context.Context, userID uuid.UUID) ([]model.AccessToken, error) {
+	return us.store.ListAccessTokens(ctx, userID)
+}
+
+// RevokeAccessToken deletes one of a user's personal access tokens.
+func (us *UserService) RevokeAccessToken(ctx context.Context, userID, id uuid.UUID) error {
+	return us.store.DeleteAccessToken(ctx, userID, id)
+}
+
+// VerifyAccessToken returns the personal access token secret belongs to and
+// its user. Expired and revoked tokens give ErrInvalidToken.
+func (us *UserService) VerifyAccessToken(ctx context.Context, secret string) (*model.AccessToken, *model.User, error) {
+	if !strings.HasPrefix(secret, model.AccessTokenPrefix) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	token, err := us.store.GetAccessTokenByHash(ctx, hashString(secret))
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+
+	user, err := us.store.GetUser(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+
+	if err := us.store.TouchAccessToken(ctx, token.Id); err != nil {
+		// not worth failing the request over
+		slog.Error("failed to record access token use", "token", token.Id, "error", err)
+	}
+
+	return &token, &user, nil
+}
@@ -0,0 +1,144 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memAccessToken is a stored personal access token with its hash.
+type memAccessToken struct {
+	model.AccessToken
+	hash string
+}
+
+func (m *memUserStore) InsertAccessToken(ctx context.Context, token *model.AccessToken, tokenHash string) error {
+	m.accessTokens = append(m.accessTokens, memAccessToken{AccessToken: *token, hash: tokenHash})
+	return nil
+}
+
+func (m *memUserStore) GetAccessTokenByHash(ctx context.Context, tokenHash string) (model.AccessToken, error) {
+	for _, token := range m.accessTokens {
+		if token.hash == tokenHash && (token.ExpiresAt == nil || token.ExpiresAt.After(time.Now())) {
+			return token.AccessToken, nil
+		}
+	}
+	return model.AccessToken{}, model.ErrNotFound
+}
+
+func (m *memUserStore) ListAccessTokens(ctx context.Context, userID uuid.UUID) ([]model.AccessToken, error) {
+	tokens := []model.AccessToken{}
+	for _, token := range m.accessTokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token.AccessToken)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *memUserStore) DeleteAccessToken(ctx context.Context, userID, id uuid.UUID) error {
+	for i, token := range m.accessTokens {
+		if token.Id == id && token.UserID == userID {
+			m.accessTokens = append(m.accessTokens[:i], m.accessTokens[i+1:]...)
+			return nil
+		}
+	}
+	return model.ErrNotFound
+}
+
+func (m *memUserStore) TouchAccessToken(ctx context.Context, id uuid.UUID) error {
+	for i, token := range m.accessTokens {
+		if token.Id == id {
+			now := time.Now()
+			m.accessTokens[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func TestUserService_CreateAccessToken(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name string
+		req  service.CreateAccessTokenRequest
+		err  error
+	}{
+		{"no name", service.CreateAccessTokenRequest{Name: " ", Scopes: []string{model.ScopeFilesRead}}, service.ErrInvalidTokenName},
+		{"long name", service.CreateAccessTokenRequest{Name: strings.Repeat("a", 101), Scopes: []string{model.ScopeFilesRead}}, service.ErrInvalidTokenName},
+		{"no scopes", service.CreateAccessTokenRequest{Name: "ci"}, service.ErrInvalidScopes},
+		{"unknown scope", service.CreateAccessTokenRequest{Name: "ci", Scopes: []string{"admin"}}, service.ErrInvalidScopes},
+		{"expired", service.CreateAccessTokenRequest{Name: "ci", Scopes: []string{model.ScopeFilesRead}, ExpiresAt: &past}, service.ErrInvalidExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := svc.CreateAccessToken(ctx, user.Id, tt.req)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	token, secret, err := svc.CreateAccessToken(ctx, user.Id, service.CreateAccessTokenRequest{
+		Name:   " ci ",
+		Scopes: []string{model.ScopeFilesWrite, model.ScopeFilesWrite},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ci", token.Name)
+	assert.Equal(t, []string{model.ScopeFilesWrite}, token.Scopes)
+	assert.True(t, strings.HasPrefix(secret, model.AccessTokenPrefix))
+	assert.NotContains(t, users.accessTokens[0].hash, secret, "tokens are stored hashed")
+}
+
+func TestUserService_VerifyAccessToken(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	token, secret, err := svc.CreateAccessToken(ctx, user.Id, service.CreateAccessTokenRequest{
+		Name:   "ci",
+		Scopes: []string{model.ScopeFilesRead},
+	})
+	require.NoError(t, err)
+
+	got, owner, err := svc.VerifyAccessToken(ctx, secret)
+	require.NoError(t, err)
+	assert.Equal(t, token.Id, got.Id)
+	assert.Equal(t, user.Id, owner.Id)
+	tokens, err := svc.ListAccessTokens(ctx, user.Id)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].LastUsedAt, "use is recorded")
+
+	_, _, err = svc.VerifyAccessToken(ctx, model.AccessTokenPrefix+"unknown")
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+
+	// expired tokens stop working
+	soon := time.Now().Add(time.Millisecond)
+	_, expiring, err := svc.CreateAccessToken(ctx, user.Id, service.CreateAccessTokenRequest{
+		Name:      "short",
+		Scopes:    []string{model.ScopeFilesRead},
+		ExpiresAt: &soon,
+	})
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, _, err = svc.VerifyAccessToken(ctx, expiring)
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+
+	assert.ErrorIs(t, svc.RevokeAccessToken(ctx, uuid.New(), token.Id), model.ErrNotFound, "only the owner can revoke a token")
+	require.NoError(t, svc.RevokeAccessToken(ctx, user.Id, token.Id))
+	_, _, err = svc.VerifyAccessToken(ctx, secret)
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+}
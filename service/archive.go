@@ -0,0 +1,168 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+)
+
+// ArchiveEntry is a file or directory placed in a ZIP archive. Directory
+// entries have a nil File and a Path ending in "/".
+type ArchiveEntry struct {
+	Path     string
+	File     *model.File
+	Modified time.Time
+}
+
+type ArchiveRequest struct {
+	FileIDs   []uuid.UUID `json:"fileIds"`
+	FolderIDs []uuid.UUID `json:"folderIds"`
+}
+
+// ResolveArchive expands the requested files and folders userID can view
+// into archive entries. Folders keep their hierarchy as directories in the
+// archive and names that collide within a directory are de-duplicated.
+func (s *FileService) ResolveArchive(ctx context.Context, userID uuid.UUID, req ArchiveRequest) ([]ArchiveEntry, error) {
+	if len(req.FileIDs) == 0 && len(req.FolderIDs) == 0 {
+		return nil, ErrEmptyArchive
+	}
+
+	var entries []ArchiveEntry
+	root := newArchiveDir()
+
+	for _, id := range req.FolderIDs {
+		folders, files, err := s.store.GetSubtree(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		// GetSubtree returns the requested folder first
+		if folders[0].DeletedAt != nil {
+			return nil, model.ErrNotFound
+		}
+		if err := s.authorize(ctx, userID, folders[0].UserID, uuid.Nil, id, model.AccessViewer); err != nil {
+			return nil, err
+		}
+
+		children := make(map[uuid.UUID][]model.Folder)
+		for _, folder := range folders[1:] {
+			children[folder.ParentID] = append(children[folder.ParentID], folder)
+		}
+
+		dirs := make(map[uuid.UUID]*archiveDir, len(folders))
+		paths := make(map[uuid.UUID]string, len(folders))
+
+		var visit func(folder model.Folder, parent *archiveDir, parentPath string)
+		visit = func(folder model.Folder, parent *archiveDir, parentPath string) {
+			dirs[folder.Id] = newArchiveDir()
+			paths[folder.Id] = parentPath + parent.reserve(folder.Name) + "/"
+			entries = append(entries, ArchiveEntry{Path: paths[folder.Id], Modified: folder.LastModified})
+
+			for _, child := range children[folder.Id] {
+				visit(child, dirs[folder.Id], paths[folder.Id])
+			}
+		}
+		visit(folders[0], root, "")
+
+		for i := range files {
+			file := &files[i]
+			name := dirs[file.FolderID].reserve(file.Name)
+			entries = append(entries, ArchiveEntry{Path: paths[file.FolderID] + name, File: file, Modified: file.LastModified})
+		}
+	}
+
+	for _, id := range req.FileIDs {
+		file, err := s.GetFile(ctx, userID, id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ArchiveEntry{Path: root.reserve(file.Name), File: file, Modified: file.LastModified})
+	}
+
+	return entries, nil
+}
+
+// WriteArchive streams entries as a ZIP archive to w, reading each file from
+// blob storage as it goes. Archives larger than 4 GiB use zip64 records.
+func (s *FileService) WriteArchive(ctx context.Context, w io.Writer, entries []ArchiveEntry) error {
+	zw := zip.NewWriter(w)
+
+	for _, entry := range entries {
+		header := &zip.FileHeader{
+			Name:     entry.Path,
+			Modified: entry.Modified,
+			Method:   zip.Store,
+		}
+
+		if entry.File == nil {
+			if _, err := zw.CreateHeader(header); err != nil {
+				return fmt.Errorf("failed to write archive directory: %w", err)
+			}
+			continue
+		}
+
+		if compressible(entry.File.MimeType) {
+			header.Method = zip.Deflate
+		}
+		header.UncompressedSize64 = uint64(entry.File.Size)
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to write archive entry: %w", err)
+		}
+
+		rc, err := s.blobs.Get(ctx, entry.File.StorageKey, 0, -1)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", entry.Path, err)
+		}
+		_, err = io.Copy(fw, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to copy %s into archive: %w", entry.Path, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+// compressible reports whether a file is worth deflating. Media and archive
+// formats are already compressed, so they are stored as-is.
+func compressible(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "text/"):
+		return true
+	case strings.HasSuffix(mimeType, "json"), strings.HasSuffix(mimeType, "xml"):
+		return true
+	case mimeType == "application/javascript", mimeType == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// archiveDir tracks the names already used in one archive directory.
+type archiveDir struct {
+	used map[string]bool
+}
+
+func newArchiveDir() *archiveDir {
+	return &archiveDir{used: make(map[string]bool)}
+}
+
+// reserve returns a safe, unused name based on name, adding " (n)" before
+// the extension when it is taken.
+func (d *archiveDir) reserve(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		name = "_"
+	}
+
+	candidate := uniqueName(name, func(c string) bool { return d.used[strings.ToLower(c)] })
+	d.used[strings.ToLower(candidate)] = true
+
+	return candidate
+}
@@ -0,0 +1,103 @@
+package service_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileService_Archive(t *testing.T) {
+	ctx := context.Background()
+	blobs := newMemBlobStore()
+	store := newMemFileStore()
+	fs := service.NewFileService(store, blobs)
+
+	userID := uuid.New()
+	docs := store.addFolder(userID, uuid.Nil, "docs")
+	nested := store.addFolder(userID, docs.Id, "nested")
+	store.addFolder(userID, docs.Id, "empty")
+	store.addFile(blobs, userID, docs.Id, "a.txt", []byte("docs a"))
+	store.addFile(blobs, userID, nested.Id, "b.txt", []byte("nested b"))
+	loose := store.addFile(blobs, userID, uuid.Nil, "a.txt", []byte("loose a"))
+	clash := store.addFile(blobs, userID, uuid.Nil, "docs", []byte("file named docs"))
+
+	entries, err := fs.ResolveArchive(ctx, userID, service.ArchiveRequest{
+		FolderIDs: []uuid.UUID{docs.Id},
+		FileIDs:   []uuid.UUID{loose.Id, clash.Id},
+	})
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, fs.WriteArchive(ctx, buf, entries))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	contents := make(map[string]string)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		contents[f.Name] = string(data)
+	}
+	sort.Strings(names)
+
+	assert.Equal(t, []string{
+		"a.txt",
+		"docs (1)",
+		"docs/",
+		"docs/a.txt",
+		"docs/empty/",
+		"docs/nested/",
+		"docs/nested/b.txt",
+	}, names)
+	assert.Equal(t, "docs a", contents["docs/a.txt"])
+	assert.Equal(t, "nested b", contents["docs/nested/b.txt"])
+	assert.Equal(t, "loose a", contents["a.txt"])
+	assert.Equal(t, "file named docs", contents["docs (1)"])
+}
+
+func TestFileService_ArchiveErrors(t *testing.T) {
+	ctx := context.Background()
+	blobs := newMemBlobStore()
+	store := newMemFileStore()
+	fs := service.NewFileService(store, blobs)
+
+	owner := uuid.New()
+	folder := store.addFolder(owner, uuid.Nil, "private")
+	file := store.addFile(blobs, owner, uuid.Nil, "private.txt", []byte("x"))
+
+	tests := []struct {
+		name    string
+		req     service.ArchiveRequest
+		wantErr error
+	}{
+		{name: "empty request", req: service.ArchiveRequest{}, wantErr: service.ErrEmptyArchive},
+		{name: "other user's folder", req: service.ArchiveRequest{FolderIDs: []uuid.UUID{folder.Id}}, wantErr: model.ErrNotFound},
+		{name: "other user's file", req: service.ArchiveRequest{FileIDs: []uuid.UUID{file.Id}}, wantErr: model.ErrNotFound},
+		{name: "unknown folder", req: service.ArchiveRequest{FolderIDs: []uuid.UUID{uuid.New()}}, wantErr: model.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fs.ResolveArchive(ctx, uuid.New(), tt.req)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/freekobie/kora/mail"
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+)
+
+const (
+	// attemptWindow is how long failed attempts are remembered.
+	attemptWindow = time.Hour
+	// freeAttempts is how many failures are allowed before attempts are
+	// slowed down. Each failure after that doubles the wait, starting at
+	// backoffBase, up to maxBackoff.
+	freeAttempts = 3
+	backoffBase  = time.Second
+	maxBackoff   = 15 * time.Minute
+	// accountLockoutThreshold failures against one account lock it for
+	// accountLockout and notify its owner.
+	accountLockoutThreshold = 10
+	accountLockout          = 30 * time.Minute
+	// maxCodeGuesses wrong guesses at an emailed code invalidate it.
+	maxCodeGuesses = 5
+)
+
+// TooManyAttemptsError is returned while attempts are refused after too
+// many failures.
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many failed attempts; try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrTooManyAttempts) true.
+func (e *TooManyAttemptsError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+func accountAttemptKey(userID uuid.UUID) string {
+	return "account:" + userID.String()
+}
+
+// ipAttemptKey returns "" if the client address is not known, so that
+// unknown clients do not share one limit.
+func ipAttemptKey(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	return "ip:" + ip
+}
+
+func codeAttemptKey(scope string, userID uuid.UUID) string {
+	return "code:" + scope + ":" + userID.String()
+}
+
+// backoff returns how long to refuse attempts after the given number of
+// consecutive failures.
+func backoff(failures int) time.Duration {
+	if failures < freeAttempts {
+		return 0
+	}
+	shift := failures - freeAttempts
+	if shift > 20 {
+		return maxBackoff
+	}
+	return min(backoffBase<<shift, maxBackoff)
+}
+
+// checkAttempts returns a TooManyAttemptsError if any of keys is locked.
+// Empty keys are skipped.
+func (us *UserService) checkAttempts(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		attempts, err := us.store.GetLoginAttempts(ctx, key)
+		if err != nil {
+			if errors.Is(err, model.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		if attempts.LockedUntil != nil {
+			if wait := time.Until(*attempts.LockedUntil); wait > 0 {
+				return &TooManyAttemptsError{RetryAfter: wait}
+			}
+		}
+	}
+
+	return nil
+}
+
+// recordFailure counts a failed attempt against key and refuses further
+// attempts for the backoff that calls for, or for lockout once there have
+// been threshold failures. It returns the number of failures.
+func (us *UserService) recordFailure(ctx context.Context, key string, threshold int, lockout time.Duration) int {
+	if key == "" {
+		return 0
+	}
+
+	failures, err := us.store.RecordFailedAttempt(ctx, key, attemptWindow)
+	if err != nil {
+		return 0
+	}
+
+	wait := backoff(failures)
+	if threshold > 0 && failures >= threshold {
+		wait = lockout
+	}
+	if wait > 0 {
+		if err := us.store.LockAttempts(ctx, key, time.Now().UTC().Add(wait)); err != nil {
+			slog.Error("failed to lock attempts", "key", key, "error", err)
+		}
+	}
+
+	return failures
+}
+
+// failedLogin records a wrong password or second factor for user from ip,
+// locking the account and telling its owner once it reaches the threshold.
+func (us *UserService) failedLogin(ctx context.Context, user model.User, ip string) {
+	us.recordFailure(ctx, ipAttemptKey(ip), 0, 0)
+
+	failures := us.recordFailure(ctx, accountAttemptKey(user.Id), accountLockoutThreshold, accountLockout)
+	if failures == accountLockoutThreshold {
+		slog.Warn("account locked after failed logins", "user", user.Id)
+		address := mail.Address{Name: user.Name, Email: user.Email}
+		us.sendEmail([]mail.Address{address}, "account_locked.gotmpl", mail.Data{
+			"Address": address,
+			"Minutes": int(accountLockout.Minutes()),
+		})
+	}
+}
+
+// failedCodeGuess records a wrong guess at one of user's emailed codes of
+// the given scope. Once there have been maxCodeGuesses, all of the user's
+// codes of that scope are deleted and ErrTooManyGuesses is returned; until
+// then ErrInvalidToken is.
+func (us *UserService) failedCodeGuess(ctx context.Context, userID uuid.UUID, scope string) error {
+	key := codeAttemptKey(scope, userID)
+	guesses, err := us.store.RecordFailedAttempt(ctx, key, attemptWindow)
+	if err != nil {
+		return err
+	}
+	if guesses < maxCodeGuesses {
+		return ErrInvalidToken
+	}
+
+	if err := us.store.DeleteUserTokens(ctx, userID, scope); err != nil {
+		return err
+	}
+	us.clearAttempts(ctx, key)
+
+	return ErrTooManyGuesses
+}
+
+// wrongCode handles a code of the given scope that did not match any sent to
+// email, counting it against the account with that email if there is one.
+func (us *UserService) wrongCode(ctx context.Context, email, scope string) error {
+	user, err := us.store.GetUserByMail(ctx, email)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+
+	return us.failedCodeGuess(ctx, user.Id, scope)
+}
+
+// clearAttempts forgets the failures against key, after a success.
+func (us *UserService) clearAttempts(ctx context.Context, key string) {
+	if err := us.store.ClearLoginAttempts(ctx, key); err != nil {
+		slog.Error("failed to clear attempts", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,192 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *memUserStore) GetLoginAttempts(ctx context.Context, key string) (model.LoginAttempts, error) {
+	attempts, ok := m.attempts[key]
+	if !ok {
+		return model.LoginAttempts{}, model.ErrNotFound
+	}
+	return attempts, nil
+}
+
+func (m *memUserStore) RecordFailedAttempt(ctx context.Context, key string, window time.Duration) (int, error) {
+	attempts := m.attempts[key]
+	if time.Since(attempts.LastFailureAt) > window {
+		attempts.Failures = 0
+	}
+	attempts.Key = key
+	attempts.Failures++
+	attempts.LastFailureAt = time.Now()
+	m.attempts[key] = attempts
+	return attempts.Failures, nil
+}
+
+func (m *memUserStore) LockAttempts(ctx context.Context, key string, until time.Time) error {
+	attempts := m.attempts[key]
+	attempts.LockedUntil = &until
+	m.attempts[key] = attempts
+	return nil
+}
+
+func (m *memUserStore) ClearLoginAttempts(ctx context.Context, key string) error {
+	delete(m.attempts, key)
+	return nil
+}
+
+// expireLocks lets locked attempts through again, as if their wait had
+// passed, without forgetting the failures.
+func (m *memUserStore) expireLocks() {
+	for key, attempts := range m.attempts {
+		attempts.LockedUntil = nil
+		m.attempts[key] = attempts
+	}
+}
+
+// requireTooManyAttempts checks that err refuses an attempt for at most max.
+func requireTooManyAttempts(t *testing.T, err error, max time.Duration) {
+	t.Helper()
+	require.ErrorIs(t, err, service.ErrTooManyAttempts)
+	var tooMany *service.TooManyAttemptsError
+	require.True(t, errors.As(err, &tooMany))
+	assert.Positive(t, tooMany.RetryAfter)
+	assert.LessOrEqual(t, tooMany.RetryAfter, max)
+}
+
+func TestUserService_LoginBackoff(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	client := func(n int) model.ClientInfo {
+		return model.ClientInfo{IPAddress: fmt.Sprintf("10.0.0.%d", n)}
+	}
+
+	for i := range 3 {
+		_, err := svc.NewSession(ctx, user.Email, "wrong", client(i))
+		assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	}
+	_, err := svc.NewSession(ctx, user.Email, "password", client(4))
+	requireTooManyAttempts(t, err, time.Second)
+
+	users.expireLocks()
+	_, err = svc.NewSession(ctx, user.Email, "wrong", client(5))
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	_, err = svc.NewSession(ctx, user.Email, "password", client(6))
+	requireTooManyAttempts(t, err, 2*time.Second)
+
+	users.expireLocks()
+	_, err = svc.NewSession(ctx, user.Email, "password", client(7))
+	require.NoError(t, err)
+
+	// a successful login starts the count again
+	_, err = svc.NewSession(ctx, user.Email, "wrong", client(8))
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	_, err = svc.NewSession(ctx, user.Email, "password", client(8))
+	assert.NoError(t, err)
+}
+
+func TestUserService_LoginBackoffPerAddress(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	attacker := model.ClientInfo{IPAddress: "203.0.113.7"}
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		_, err := svc.NewSession(ctx, email, "password", attacker)
+		assert.ErrorIs(t, err, service.ErrInvalidCredentials, "unknown accounts look like wrong passwords")
+	}
+
+	_, err := svc.NewSession(ctx, user.Email, "password", attacker)
+	requireTooManyAttempts(t, err, time.Second)
+
+	_, err = svc.NewSession(ctx, user.Email, "password", model.ClientInfo{IPAddress: "198.51.100.1"})
+	assert.NoError(t, err, "other addresses are not slowed down")
+}
+
+func TestUserService_AccountLockout(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	mailer, sent := newTestMailer(t)
+	svc := service.NewUserService(users, mailer)
+
+	for i := range 10 {
+		users.expireLocks()
+		_, err := svc.NewSession(ctx, user.Email, "wrong", model.ClientInfo{IPAddress: fmt.Sprintf("10.0.1.%d", i)})
+		require.ErrorIs(t, err, service.ErrInvalidCredentials)
+	}
+
+	_, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{IPAddress: "198.51.100.1"})
+	requireTooManyAttempts(t, err, 30*time.Minute)
+	var tooMany *service.TooManyAttemptsError
+	require.True(t, errors.As(err, &tooMany))
+	assert.Greater(t, tooMany.RetryAfter, 29*time.Minute)
+
+	recipients := receiveMail(t, sent, 1)
+	assert.Contains(t, recipients[user.Email], "30 minutes", "the owner is told the account is locked")
+}
+
+func TestUserService_TwoFactorBackoff(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	setup, err := svc.SetupTwoFactor(ctx, user.Id)
+	require.NoError(t, err)
+	_, err = svc.ConfirmTwoFactor(ctx, user.Id, currentCode(t, setup.Secret, -1))
+	require.NoError(t, err)
+
+	login, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	for range 3 {
+		_, err = svc.VerifyTwoFactor(ctx, login.ChallengeToken, "999999", model.ClientInfo{})
+		assert.ErrorIs(t, err, service.ErrInvalidTwoFactorCode)
+	}
+	_, err = svc.VerifyTwoFactor(ctx, login.ChallengeToken, currentCode(t, setup.Secret, 0), model.ClientInfo{})
+	requireTooManyAttempts(t, err, time.Second)
+}
+
+func TestUserService_CodeGuesses(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	mailer, sent := newTestMailer(t)
+	svc := service.NewUserService(users, mailer)
+
+	require.NoError(t, svc.RequestPasswordReset(ctx, user.Email))
+	code := receiveCode(t, sent)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for range 4 {
+		assert.ErrorIs(t, svc.ResetPassword(ctx, user.Email, wrong, "new-password"), service.ErrInvalidToken)
+	}
+	assert.ErrorIs(t, svc.ResetPassword(ctx, user.Email, wrong, "new-password"), service.ErrTooManyGuesses)
+	assert.ErrorIs(t, svc.ResetPassword(ctx, user.Email, code, "new-password"), service.ErrInvalidToken, "the code no longer works")
+
+	require.NoError(t, svc.RequestPasswordReset(ctx, user.Email))
+	code = receiveCode(t, sent)
+	assert.NoError(t, svc.ResetPassword(ctx, user.Email, code, "new-password"), "a new code can be requested")
+}
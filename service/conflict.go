@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/freekobie/kora/model"
+)
+
+// maxRenameAttempts bounds how often an auto-renamed save is retried when a
+// concurrent request takes the chosen name first.
+const maxRenameAttempts = 5
+
+// ParseConflictPolicy parses a conflict policy. An empty value means
+// model.ConflictFail.
+func ParseConflictPolicy(value string) (model.ConflictPolicy, error) {
+	switch policy := model.ConflictPolicy(value); policy {
+	case "":
+		return model.ConflictFail, nil
+	case model.ConflictFail, model.ConflictRename, model.ConflictReplace:
+		return policy, nil
+	default:
+		return "", ErrInvalidConflictPolicy
+	}
+}
+
+// saveUnique calls save with name. If the name is taken and policy is
+// model.ConflictRename, it retries with the first free variant among the
+// names returned by taken. Any other policy gets model.ErrDuplicateName.
+func saveUnique(ctx context.Context, policy model.ConflictPolicy, name string, save func(name string) error, taken func(ctx context.Context, prefix string) ([]string, error)) error {
+	err := save(name)
+	for attempt := 0; attempt < maxRenameAttempts && policy == model.ConflictRename && errors.Is(err, model.ErrDuplicateName); attempt++ {
+		base, _ := splitName(name)
+		names, listErr := taken(ctx, base)
+		if listErr != nil {
+			return listErr
+		}
+
+		used := make(map[string]bool, len(names))
+		for _, n := range names {
+			used[strings.ToLower(n)] = true
+		}
+		err = save(uniqueName(name, func(candidate string) bool { return used[strings.ToLower(candidate)] }))
+	}
+	return err
+}
+
+// uniqueName returns name, or the first of "name (1)", "name (2)", ... that
+// is not taken. The counter goes before the extension and the base name is
+// shortened if needed to stay within maxNameLength.
+func uniqueName(name string, taken func(string) bool) string {
+	base, ext := splitName(name)
+	candidate := name
+	for n := 1; taken(candidate); n++ {
+		suffix := fmt.Sprintf(" (%d)%s", n, ext)
+		candidate = truncateName(base, maxNameLength-len(suffix)) + suffix
+	}
+	return candidate
+}
+
+// splitName splits name into base and extension. Dotfiles such as ".env"
+// have no extension.
+func splitName(name string) (string, string) {
+	ext := path.Ext(name)
+	if ext == name {
+		return name, ""
+	}
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// truncateName cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncateName(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,170 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    model.ConflictPolicy
+		wantErr bool
+	}{
+		{value: "", want: model.ConflictFail},
+		{value: "fail", want: model.ConflictFail},
+		{value: "rename", want: model.ConflictRename},
+		{value: "replace", want: model.ConflictReplace},
+		{value: "overwrite", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := service.ParseConflictPolicy(tt.value)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, service.ErrInvalidConflictPolicy)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFileService_SaveFileConflicts(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	save := func(fs *service.FileService, name, content string, policy model.ConflictPolicy) (*model.File, error) {
+		return fs.SaveFile(ctx, &model.File{
+			Name:     name,
+			UserID:   userID,
+			MimeType: "text/plain",
+			Size:     int64(len(content)),
+		}, bytes.NewReader([]byte(content)), policy)
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		blobs := newMemBlobStore()
+		fs := service.NewFileService(newMemFileStore(), blobs)
+
+		_, err := save(fs, "report.pdf", "v1", model.ConflictFail)
+		require.NoError(t, err)
+		_, err = save(fs, "Report.PDF", "v2", model.ConflictFail)
+		assert.ErrorIs(t, err, model.ErrDuplicateName)
+
+		objects, err := blobs.List(ctx, userID.String()+"/")
+		require.NoError(t, err)
+		assert.Len(t, objects, 1, "rejected upload should not leave its blob behind")
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		fs := service.NewFileService(newMemFileStore(), newMemBlobStore())
+
+		var names []string
+		for range 3 {
+			file, err := save(fs, "report.pdf", "data", model.ConflictRename)
+			require.NoError(t, err)
+			names = append(names, file.Name)
+		}
+		assert.Equal(t, []string{"report.pdf", "report (1).pdf", "report (2).pdf"}, names)
+
+		file, err := save(fs, ".env", "data", model.ConflictRename)
+		require.NoError(t, err)
+		assert.Equal(t, ".env", file.Name)
+		file, err = save(fs, ".env", "data", model.ConflictRename)
+		require.NoError(t, err)
+		assert.Equal(t, ".env (1)", file.Name)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		blobs := newMemBlobStore()
+		store := newMemFileStore()
+		fs := service.NewFileService(store, blobs)
+
+		first, err := save(fs, "report.pdf", "v1", model.ConflictFail)
+		require.NoError(t, err)
+		oldKey := first.StorageKey
+
+		second, err := save(fs, "report.pdf", "version 2", model.ConflictReplace)
+		require.NoError(t, err)
+		assert.Equal(t, first.Id, second.Id)
+		assert.Equal(t, 2, second.Version)
+		assert.Equal(t, int64(len("version 2")), second.Size)
+		assert.Len(t, store.files, 1)
+
+		_, err = blobs.Stat(ctx, oldKey)
+		assert.NoError(t, err, "replaced content should be kept as an old version")
+
+		rc := fs.OpenFile(ctx, second)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, "version 2", string(data))
+	})
+}
+
+func TestFileService_RenameFileConflicts(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	store := newMemFileStore()
+	fs := service.NewFileService(store, blobs)
+
+	target := store.addFile(blobs, userID, uuid.Nil, "notes.txt", []byte("old"))
+	draft := store.addFile(blobs, userID, uuid.Nil, "draft.txt", []byte("new"))
+
+	_, err := fs.RenameFile(ctx, userID, draft.Id, "NOTES.txt", model.ConflictFail)
+	assert.ErrorIs(t, err, model.ErrDuplicateName)
+
+	renamed, err := fs.RenameFile(ctx, userID, draft.Id, "notes.txt", model.ConflictRename)
+	require.NoError(t, err)
+	assert.Equal(t, "notes (1).txt", renamed.Name)
+
+	replaced, err := fs.RenameFile(ctx, userID, draft.Id, "notes.txt", model.ConflictReplace)
+	require.NoError(t, err)
+	assert.Equal(t, target.Id, replaced.Id)
+	assert.Equal(t, draft.StorageKey, replaced.StorageKey)
+	assert.Equal(t, 2, replaced.Version)
+	assert.NotContains(t, store.files, draft.Id, "the renamed file is merged into the existing one")
+
+	_, err = blobs.Stat(ctx, target.StorageKey)
+	assert.NoError(t, err, "the replaced content should be kept as an old version")
+}
+
+func TestFileService_FolderConflicts(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	store := newMemFileStore()
+	fs := service.NewFileService(store, newMemBlobStore())
+
+	docs, err := fs.CreateFolder(ctx, service.CreateFolderRequest{Name: "Docs"}, userID)
+	require.NoError(t, err)
+
+	_, err = fs.CreateFolder(ctx, service.CreateFolderRequest{Name: "docs"}, userID)
+	assert.ErrorIs(t, err, model.ErrDuplicateName)
+
+	_, err = fs.CreateFolder(ctx, service.CreateFolderRequest{Name: "docs", OnConflict: model.ConflictReplace}, userID)
+	assert.ErrorIs(t, err, service.ErrReplaceFolder)
+
+	renamed, err := fs.CreateFolder(ctx, service.CreateFolderRequest{Name: "docs", OnConflict: model.ConflictRename}, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "docs (1)", renamed.Name)
+
+	// the same name is fine in another folder
+	_, err = fs.CreateFolder(ctx, service.CreateFolderRequest{Name: "docs", ParentID: docs.Id}, userID)
+	require.NoError(t, err)
+
+	_, err = fs.RenameFolder(ctx, userID, renamed.Id, "DOCS", model.ConflictFail)
+	assert.ErrorIs(t, err, model.ErrDuplicateName)
+}
@@ -8,4 +8,62 @@ var (
 	ErrInvalidToken       = errors.New("token is invalid or expired")
 	ErrFailedOperation    = errors.New("failed to complete operation")
 	ErrInvalidPassword    = errors.New("password must be between 8 and 20 characters")
+	ErrInvalidKey         = errors.New("invalid storage key")
+	ErrInvalidRole        = errors.New("role must be one of user or admin")
+	ErrEmailInUse         = errors.New("email is already in use")
+	ErrSameEmail          = errors.New("new email must differ from the current one")
+	ErrTooManyAttempts    = errors.New("too many failed attempts")
+	ErrTooManyGuesses     = errors.New("too many wrong codes; request a new one")
+
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotSetUp    = errors.New("two-factor authentication has not been set up")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+	ErrOIDCNotConfigured   = errors.New("single sign-on is not configured")
+	ErrOIDCLoginFailed     = errors.New("sign-in with the identity provider failed")
+	ErrUnverifiedIdentity  = errors.New("the identity provider has not verified your email")
+	ErrOIDCBrowserMismatch = errors.New("single sign-on was started in another browser")
+
+	ErrPasskeysNotConfigured = errors.New("passkeys are not configured")
+	ErrInvalidPasskey        = errors.New("passkey could not be verified")
+	ErrInvalidPasskeyName    = errors.New("passkey name must be 1 to 100 characters")
+	ErrPasskeyExists         = errors.New("passkey is already registered")
+
+	ErrInvalidTokenName = errors.New("token name must be 1 to 100 characters")
+	ErrInvalidScopes    = errors.New("scopes must be one or more of files:read and files:write")
+
+	ErrInvalidUploadLength = errors.New("upload length must not be negative")
+	ErrUploadTooLarge      = errors.New("upload exceeds the maximum size")
+	ErrOffsetMismatch      = errors.New("upload offset does not match")
+	ErrChecksumMismatch    = errors.New("checksum mismatch")
+	ErrUnsupportedChecksum = errors.New("unsupported checksum algorithm")
+
+	ErrEmptyArchive = errors.New("no files or folders selected")
+	ErrInvalidName  = errors.New("name must be 1 to 255 characters and must not contain slashes")
+	ErrInvalidSort  = errors.New("sort must be one of name, createdAt, lastModified or size")
+	ErrFolderCycle  = errors.New("a folder cannot be moved into itself or one of its subfolders")
+	ErrInvalidDepth = errors.New("depth must not be negative")
+
+	ErrInvalidConflictPolicy = errors.New("onConflict must be one of fail, rename or replace")
+	ErrReplaceFolder         = errors.New("folders cannot be replaced; use fail or rename")
+
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	ErrInvalidQuota  = errors.New("limit must not be negative")
+
+	ErrInvalidShareTarget   = errors.New("exactly one of fileId and folderId must be set")
+	ErrInvalidExpiry        = errors.New("expiresAt must be in the future")
+	ErrInvalidMaxDownloads  = errors.New("maxDownloads must be at least 1")
+	ErrShareExpired         = errors.New("share link has expired")
+	ErrShareLimitReached    = errors.New("share link has reached its download limit")
+	ErrInvalidSharePassword = errors.New("a valid password is required for this share link")
+
+	ErrForbidden        = errors.New("you do not have permission to do this")
+	ErrMoveAcrossOwners = errors.New("items cannot be moved into another user's folders")
+	ErrInvalidAccess    = errors.New("access must be one of viewer or editor")
+	ErrUnknownGrantee   = errors.New("no user with that email")
+	ErrGrantToSelf      = errors.New("you cannot share with yourself")
+
+	ErrCurrentVersion   = errors.New("the current version of a file cannot be deleted")
+	ErrInvalidRetention = errors.New("maxVersions and maxAgeDays must not be negative")
 )
@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"time"
 
@@ -12,31 +14,56 @@ import (
 
 // FileService is a service for managing files.
 type FileService struct {
-	store model.FileStorage
-	gcs   *GCS
+	store        model.FileStorage
+	blobs        model.BlobStore
+	defaultQuota int64
 }
 
-// NewFileService creates a new FileService.
-func NewFileService(store model.FileStorage, gcs *GCS) *FileService {
-	return &FileService{store: store, gcs: gcs}
+// NewFileService creates a new FileService with DefaultStorageQuota as the
+// default quota.
+func NewFileService(store model.FileStorage, blobs model.BlobStore) *FileService {
+	return &FileService{store: store, blobs: blobs, defaultQuota: DefaultStorageQuota}
 }
 
 type CreateFolderRequest struct {
-	Name     string    `json:"name"`
-	ParentID uuid.UUID `json:"parentId"`
+	Name       string               `json:"name"`
+	ParentID   uuid.UUID            `json:"parentId"`
+	OnConflict model.ConflictPolicy `json:"-"`
 }
 
+// CreateFolder creates a folder under req.ParentID, or at the root when no
+// parent is given. A folder created in a folder shared with userID belongs to
+// the owner of that folder.
 func (s *FileService) CreateFolder(ctx context.Context, req CreateFolderRequest, userID uuid.UUID) (model.Folder, error) {
+	name, err := validateName(req.Name)
+	if err != nil {
+		return model.Folder{}, err
+	}
+	if req.OnConflict == model.ConflictReplace {
+		return model.Folder{}, ErrReplaceFolder
+	}
+
+	ownerID, err := s.checkFolder(ctx, userID, req.ParentID, model.AccessEditor)
+	if err != nil {
+		return model.Folder{}, err
+	}
+
+	now := time.Now().UTC()
 	folder := model.Folder{
 		Id:           uuid.New(),
-		Name:         req.Name,
-		UserID:       userID,
+		Name:         name,
+		UserID:       ownerID,
 		ParentID:     req.ParentID,
-		CreatedAt:    time.Now(),
-		LastModified: time.Now(),
+		CreatedAt:    now,
+		LastModified: now,
 	}
 
-	err := s.store.CreateFolder(ctx, &folder)
+	err = saveUnique(ctx, req.OnConflict, name, func(name string) error {
+		folder.Name = name
+		return s.store.CreateFolder(ctx, &folder)
+	}, func(ctx context.Context, prefix string) ([]string, error) {
+		return s.store.ListFolderNames(ctx, ownerID, folder.ParentID, prefix)
+	})
 	if err != nil {
 		return model.Folder{}, err
 	}
@@ -44,28 +71,182 @@ func (s *FileService) CreateFolder(ctx context.Context, req CreateFolderRequest,
 	return folder, nil
 }
 
-// UploadFile uploads a file and saves its metadata.
-func (s *FileService) UploadFile(ctx context.Context, userId, folderID uuid.UUID, file multipart.File, header *multipart.FileHeader) (*model.File, error) {
-	fileID := uuid.New()
-	storageKey := fmt.Sprintf("%s/%s", userId, fileID.String())
+// UploadFile uploads a file and saves its metadata. policy decides what
+// happens when the folder already has a file with the same name.
+func (s *FileService) UploadFile(ctx context.Context, userId, folderID uuid.UUID, file multipart.File, header *multipart.FileHeader, policy model.ConflictPolicy) (*model.File, error) {
+	dbFile := &model.File{
+		Name:     header.Filename,
+		UserID:   userId,
+		FolderID: folderID,
+		MimeType: header.Header.Get("Content-Type"),
+		Size:     header.Size,
+	}
+
+	return s.SaveFile(ctx, dbFile, file, policy)
+}
 
-	if err := s.gcs.UploadFile(ctx, storageKey, file); err != nil {
+// SaveFile writes the contents of r to blob storage and records file in the
+// files table. The caller fills in the name, folder, type and size, and sets
+// UserID to the uploading user; a file saved in a folder shared with them
+// belongs to the folder's owner, whose UserID replaces theirs. SaveFile
+// assigns the ID, storage key and timestamps and sets the size to the number
+// of bytes actually read. Files that would take the owner over their quota
+// are rejected with ErrQuotaExceeded. If the name is taken,
+// policy decides whether to fail, pick a free name, or add the contents as a
+// new version of the existing file, which is then returned instead.
+func (s *FileService) SaveFile(ctx context.Context, file *model.File, r io.Reader, policy model.ConflictPolicy) (*model.File, error) {
+	name, err := validateName(file.Name)
+	if err != nil {
 		return nil, err
 	}
+	file.Name = name
 
-	dbFile := &model.File{
-		Id:         fileID,
-		Name:       header.Filename,
-		UserID:     userId,
-		FolderID:   folderID,
-		MimeType:   header.Header.Get("Content-Type"),
-		Size:       header.Size,
-		StorageKey: storageKey,
+	file.UserID, err = s.checkFolder(ctx, file.UserID, file.FolderID, model.AccessEditor)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.store.CreateFile(ctx, dbFile); err != nil {
+	now := time.Now().UTC()
+	file.Id = uuid.New()
+	file.StorageKey = fmt.Sprintf("%s/%s", file.UserID, file.Id.String())
+	file.CreatedAt = now
+	file.LastModified = now
+
+	var reservation uuid.UUID
+	file.Size, reservation, err = s.putBlob(ctx, file.UserID, file.StorageKey, r, file.Size, file.MimeType)
+	if err != nil {
 		return nil, err
 	}
+	defer s.releaseQuota(ctx, reservation)
+
+	err = saveUnique(ctx, policy, file.Name, func(name string) error {
+		file.Name = name
+		return s.store.CreateFile(ctx, file)
+	}, func(ctx context.Context, prefix string) ([]string, error) {
+		return s.store.ListFileNames(ctx, file.UserID, file.FolderID, prefix)
+	})
+	if errors.Is(err, model.ErrDuplicateName) && policy == model.ConflictReplace {
+		var existing *model.File
+		if existing, err = s.replaceFile(ctx, file, uuid.Nil); err == nil {
+			return existing, nil
+		}
+	}
+	if err != nil {
+		// don't leave an orphaned object behind when the metadata insert fails
+		_ = s.blobs.Delete(ctx, file.StorageKey)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// replaceFile adds the contents of src as a new version of the existing file
+// named like src in src's folder. sourceID is the ID of the file record src
+// came from, if any, which is deleted along with the replacement.
+func (s *FileService) replaceFile(ctx context.Context, src *model.File, sourceID uuid.UUID) (*model.File, error) {
+	existing, err := s.store.GetFileByName(ctx, src.UserID, src.FolderID, src.Name)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			// the conflicting file went away in the meantime
+			return nil, model.ErrConflict
+		}
+		return nil, err
+	}
+
+	oldKey := existing.StorageKey
+	existing.MimeType = src.MimeType
+	existing.Size = src.Size
+	existing.StorageKey = src.StorageKey
+	existing.LastModified = time.Now().UTC()
+	orphaned, err := s.store.AddFileVersion(ctx, &existing, oldKey, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range orphaned {
+		s.deleteBlob(ctx, key)
+	}
+	s.pruneVersions(ctx, &existing)
+
+	return &existing, nil
+}
+
+// GetFile returns the metadata of a file userID owns or can view. Files in
+// the trash are not found.
+func (s *FileService) GetFile(ctx context.Context, userID, id uuid.UUID) (*model.File, error) {
+	return s.file(ctx, userID, id, model.AccessViewer)
+}
+
+// OpenFile returns a seekable reader over a file's contents. Data is fetched
+// from blob storage lazily, one range request per seek, so it can back
+// http.ServeContent without downloading the whole object.
+func (s *FileService) OpenFile(ctx context.Context, file *model.File) io.ReadSeekCloser {
+	return &blobReader{ctx: ctx, blobs: s.blobs, key: file.StorageKey, size: file.Size}
+}
+
+// RenameFile changes a file's name. With model.ConflictReplace, a file that
+// already has the name takes over this file's contents and is returned.
+func (s *FileService) RenameFile(ctx context.Context, userID, id uuid.UUID, name string, policy model.ConflictPolicy) (*model.File, error) {
+	name, err := validateName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := s.file(ctx, userID, id, model.AccessEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.relocateFile(ctx, file, file.FolderID, name, policy)
+}
+
+// MoveFile moves a file into folderID, or to the root when folderID is
+// uuid.Nil. Name conflicts are handled as in RenameFile. Files stay with their
+// owner, so they can only be moved between folders of the same user.
+func (s *FileService) MoveFile(ctx context.Context, userID, id, folderID uuid.UUID, policy model.ConflictPolicy) (*model.File, error) {
+	file, err := s.file(ctx, userID, id, model.AccessEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	ownerID, err := s.checkFolder(ctx, userID, folderID, model.AccessEditor)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID != file.UserID {
+		return nil, ErrMoveAcrossOwners
+	}
+
+	return s.relocateFile(ctx, file, folderID, file.Name, policy)
+}
+
+// relocateFile saves file under a new name and folder, resolving conflicts
+// with policy.
+func (s *FileService) relocateFile(ctx context.Context, file *model.File, folderID uuid.UUID, name string, policy model.ConflictPolicy) (*model.File, error) {
+	file.FolderID = folderID
+	file.LastModified = time.Now().UTC()
+
+	err := saveUnique(ctx, policy, name, func(name string) error {
+		file.Name = name
+		return s.store.UpdateFile(ctx, file)
+	}, func(ctx context.Context, prefix string) ([]string, error) {
+		return s.store.ListFileNames(ctx, file.UserID, folderID, prefix)
+	})
+	if errors.Is(err, model.ErrDuplicateName) && policy == model.ConflictReplace {
+		return s.replaceFile(ctx, file, file.Id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// DeleteFile moves a file to the trash.
+func (s *FileService) DeleteFile(ctx context.Context, userID, id uuid.UUID) error {
+	file, err := s.file(ctx, userID, id, model.AccessEditor)
+	if err != nil {
+		return err
+	}
 
-	return dbFile, nil
+	return s.store.TrashFile(ctx, file.Id, time.Now().UTC())
 }
@@ -0,0 +1,331 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memFileStore is an in-memory model.FileStorage. Methods that a test does
+// not need fall through to the embedded nil interface and panic.
+type memFileStore struct {
+	model.FileStorage
+	folders  map[uuid.UUID]model.Folder
+	files    map[uuid.UUID]model.File
+	versions map[uuid.UUID][]model.FileVersion
+	settings map[uuid.UUID]model.VersionRetention
+	quotas   map[uuid.UUID]int64
+	reserved map[uuid.UUID]model.QuotaReservation
+	grants   map[uuid.UUID]model.Permission
+	err      error
+}
+
+func newMemFileStore() *memFileStore {
+	return &memFileStore{
+		folders:  make(map[uuid.UUID]model.Folder),
+		files:    make(map[uuid.UUID]model.File),
+		versions: make(map[uuid.UUID][]model.FileVersion),
+		settings: make(map[uuid.UUID]model.VersionRetention),
+		quotas:   make(map[uuid.UUID]int64),
+		reserved: make(map[uuid.UUID]model.QuotaReservation),
+		grants:   make(map[uuid.UUID]model.Permission),
+	}
+}
+
+func (m *memFileStore) CreateFolder(ctx context.Context, folder *model.Folder) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.folderNameTaken(folder) {
+		return model.ErrDuplicateName
+	}
+	m.folders[folder.Id] = *folder
+	return nil
+}
+
+func (m *memFileStore) CreateFile(ctx context.Context, file *model.File) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.fileNameTaken(file) {
+		return model.ErrDuplicateName
+	}
+	file.Version = 1
+	m.files[file.Id] = *file
+	m.addVersion(file)
+	return nil
+}
+
+// folderNameTaken and fileNameTaken mirror the unique name indexes.
+func (m *memFileStore) folderNameTaken(folder *model.Folder) bool {
+	for _, other := range m.folders {
+		if other.Id != folder.Id && other.DeletedAt == nil && other.UserID == folder.UserID && other.ParentID == folder.ParentID && strings.EqualFold(other.Name, folder.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memFileStore) fileNameTaken(file *model.File) bool {
+	for _, other := range m.files {
+		if other.Id != file.Id && other.DeletedAt == nil && other.UserID == file.UserID && other.FolderID == file.FolderID && strings.EqualFold(other.Name, file.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memFileStore) UpdateFile(ctx context.Context, file *model.File) error {
+	if _, ok := m.files[file.Id]; !ok {
+		return model.ErrNotFound
+	}
+	if m.fileNameTaken(file) {
+		return model.ErrDuplicateName
+	}
+	m.files[file.Id] = *file
+	return nil
+}
+
+func (m *memFileStore) GetFileByName(ctx context.Context, userID, folderID uuid.UUID, name string) (model.File, error) {
+	for _, file := range m.files {
+		if file.DeletedAt == nil && file.UserID == userID && file.FolderID == folderID && strings.EqualFold(file.Name, name) {
+			return file, nil
+		}
+	}
+	return model.File{}, model.ErrNotFound
+}
+
+func (m *memFileStore) ListFolderNames(ctx context.Context, userID, folderID uuid.UUID, prefix string) ([]string, error) {
+	var names []string
+	for _, folder := range m.folders {
+		if folder.DeletedAt == nil && folder.UserID == userID && folder.ParentID == folderID && strings.HasPrefix(strings.ToLower(folder.Name), strings.ToLower(prefix)) {
+			names = append(names, folder.Name)
+		}
+	}
+	return names, nil
+}
+
+func (m *memFileStore) ListFileNames(ctx context.Context, userID, folderID uuid.UUID, prefix string) ([]string, error) {
+	var names []string
+	for _, file := range m.files {
+		if file.DeletedAt == nil && file.UserID == userID && file.FolderID == folderID && strings.HasPrefix(strings.ToLower(file.Name), strings.ToLower(prefix)) {
+			names = append(names, file.Name)
+		}
+	}
+	return names, nil
+}
+
+func (m *memFileStore) GetFile(ctx context.Context, id uuid.UUID) (model.File, error) {
+	file, ok := m.files[id]
+	if !ok {
+		return model.File{}, model.ErrNotFound
+	}
+	return file, nil
+}
+
+func (m *memFileStore) GetFolder(ctx context.Context, id uuid.UUID) (model.Folder, error) {
+	folder, ok := m.folders[id]
+	if !ok {
+		return model.Folder{}, model.ErrNotFound
+	}
+	return folder, nil
+}
+
+func (m *memFileStore) GetSubtree(ctx context.Context, folderID uuid.UUID) ([]model.Folder, []model.File, error) {
+	root, ok := m.folders[folderID]
+	if !ok {
+		return nil, nil, model.ErrNotFound
+	}
+
+	folders := []model.Folder{root}
+	inTree := map[uuid.UUID]bool{folderID: true}
+	for i := 0; i < len(folders); i++ {
+		for _, folder := range m.folders {
+			if folder.ParentID == folders[i].Id && folder.DeletedAt == nil {
+				folders = append(folders, folder)
+				inTree[folder.Id] = true
+			}
+		}
+	}
+
+	var files []model.File
+	for _, file := range m.files {
+		if inTree[file.FolderID] && file.DeletedAt == nil {
+			files = append(files, file)
+		}
+	}
+	return folders, files, nil
+}
+
+func (m *memFileStore) UpdateFolder(ctx context.Context, folder *model.Folder) error {
+	if _, ok := m.folders[folder.Id]; !ok {
+		return model.ErrNotFound
+	}
+	if m.folderNameTaken(folder) {
+		return model.ErrDuplicateName
+	}
+	for id := folder.ParentID; id != uuid.Nil; id = m.folders[id].ParentID {
+		if id == folder.Id {
+			return model.ErrCycle
+		}
+	}
+	m.folders[folder.Id] = *folder
+	return nil
+}
+
+func (m *memFileStore) GetAncestors(ctx context.Context, folderID uuid.UUID) ([]model.Folder, error) {
+	var path []model.Folder
+	for id := folderID; id != uuid.Nil; {
+		folder, ok := m.folders[id]
+		if !ok {
+			return nil, model.ErrNotFound
+		}
+		path = append([]model.Folder{folder}, path...)
+		id = folder.ParentID
+	}
+	return path, nil
+}
+
+func (m *memFileStore) GetFolderTree(ctx context.Context, userID, parentID uuid.UUID) ([]model.FolderNode, error) {
+	var nodes []model.FolderNode
+	level := []uuid.UUID{parentID}
+	for len(level) > 0 {
+		var next []model.FolderNode
+		for _, folder := range m.folders {
+			if folder.DeletedAt == nil && folder.UserID == userID && slices.Contains(level, folder.ParentID) {
+				node := model.FolderNode{Folder: folder}
+				for _, file := range m.files {
+					if file.FolderID == folder.Id && file.DeletedAt == nil {
+						node.FileCount++
+						node.Size += file.Size
+					}
+				}
+				next = append(next, node)
+			}
+		}
+		slices.SortFunc(next, func(a, b model.FolderNode) int { return strings.Compare(a.Name, b.Name) })
+
+		level = level[:0]
+		for _, node := range next {
+			level = append(level, node.Id)
+		}
+		nodes = append(nodes, next...)
+	}
+	return nodes, nil
+}
+
+// addFolder stores a folder owned by userID under parentID.
+func (m *memFileStore) addFolder(userID, parentID uuid.UUID, name string) model.Folder {
+	folder := model.Folder{Id: uuid.New(), Name: name, UserID: userID, ParentID: parentID}
+	m.folders[folder.Id] = folder
+	return folder
+}
+
+// addFile stores a file owned by userID in folderID with the given contents.
+func (m *memFileStore) addFile(blobs *memBlobStore, userID, folderID uuid.UUID, name string, content []byte) model.File {
+	file := model.File{
+		Id:       uuid.New(),
+		Name:     name,
+		UserID:   userID,
+		FolderID: folderID,
+		MimeType: "text/plain",
+		Size:     int64(len(content)),
+	}
+	file.StorageKey = userID.String() + "/" + file.Id.String()
+	file.Version = 1
+	m.files[file.Id] = file
+	m.addVersion(&file)
+	_ = blobs.Put(context.Background(), file.StorageKey, bytes.NewReader(content), file.Size, file.MimeType)
+	return file
+}
+
+func newMultipartFile(t *testing.T, name, contentType string, content []byte) (multipart.File, *multipart.FileHeader) {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="file"; filename="`+name+`"`)
+	h.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(h)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	file, header, err := req.FormFile("file")
+	require.NoError(t, err)
+	t.Cleanup(func() { file.Close() })
+
+	return file, header
+}
+
+func TestFileService_UploadFile(t *testing.T) {
+	ctx := context.Background()
+	content := []byte("hello, kora")
+
+	tests := []struct {
+		name     string
+		storeErr error
+		wantErr  bool
+	}{
+		{
+			name:    "valid upload",
+			wantErr: false,
+		},
+		{
+			name:     "metadata insert fails",
+			storeErr: errors.New("insert failed"),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobs := newMemBlobStore()
+			store := newMemFileStore()
+			store.err = tt.storeErr
+			fs := service.NewFileService(store, blobs)
+
+			userID := uuid.New()
+			file, header := newMultipartFile(t, "notes.txt", "text/plain", content)
+
+			got, err := fs.UploadFile(ctx, userID, uuid.Nil, file, header, model.ConflictFail)
+			if tt.wantErr {
+				assert.Error(t, err)
+				objects, err := blobs.List(ctx, userID.String()+"/")
+				require.NoError(t, err)
+				assert.Empty(t, objects, "blob should be removed when metadata insert fails")
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, "notes.txt", got.Name)
+			assert.Equal(t, "text/plain", got.MimeType)
+			assert.Equal(t, int64(len(content)), got.Size)
+			assert.Equal(t, userID.String()+"/"+got.Id.String(), got.StorageKey)
+
+			rc, err := blobs.Get(ctx, got.StorageKey, 0, -1)
+			require.NoError(t, err)
+			defer rc.Close()
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			assert.Equal(t, content, data)
+		})
+	}
+}
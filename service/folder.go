@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+	maxNameLength    = 255
+)
+
+// validateName checks a file or folder name and returns it trimmed.
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || len(name) > maxNameLength {
+		return "", ErrInvalidName
+	}
+	if strings.ContainsAny(name, "/\\\x00") {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// GetFolder returns a folder userID owns or can view. Folders in the trash
+// are not found.
+func (s *FileService) GetFolder(ctx context.Context, userID, id uuid.UUID) (*model.Folder, error) {
+	return s.folder(ctx, userID, id, model.AccessViewer)
+}
+
+// checkFolder verifies that userID has need access to folderID and returns
+// the folder's owner. The root (uuid.Nil) always belongs to userID.
+func (s *FileService) checkFolder(ctx context.Context, userID, folderID uuid.UUID, need model.Access) (uuid.UUID, error) {
+	if folderID == uuid.Nil {
+		return userID, nil
+	}
+	folder, err := s.folder(ctx, userID, folderID, need)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return folder.UserID, nil
+}
+
+// ListFolder returns one page of the children of folderID, or of the
+// user's root folder when folderID is uuid.Nil.
+func (s *FileService) ListFolder(ctx context.Context, userID, folderID uuid.UUID, opts model.ListOptions) (model.FolderContents, error) {
+	ownerID, err := s.checkFolder(ctx, userID, folderID, model.AccessViewer)
+	if err != nil {
+		return model.FolderContents{}, err
+	}
+
+	switch opts.Sort {
+	case "":
+		opts.Sort = model.SortByName
+	case model.SortByName, model.SortByCreatedAt, model.SortByLastModified, model.SortBySize:
+	default:
+		return model.FolderContents{}, ErrInvalidSort
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultListLimit
+	}
+	opts.Limit = min(opts.Limit, maxListLimit)
+	opts.Offset = max(opts.Offset, 0)
+
+	return s.store.ListFolder(ctx, ownerID, folderID, opts)
+}
+
+// GetFolderTree returns the folders below parentID, or below the user's root
+// when parentID is uuid.Nil, as a tree. A positive depth limits how many
+// levels are included; totals always cover the whole subtree.
+func (s *FileService) GetFolderTree(ctx context.Context, userID, parentID uuid.UUID, depth int) ([]*model.FolderNode, error) {
+	if depth < 0 {
+		return nil, ErrInvalidDepth
+	}
+	ownerID, err := s.checkFolder(ctx, userID, parentID, model.AccessViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.store.GetFolderTree(ctx, ownerID, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// rows list parents before children, so every parent is already in the
+	// map when one of its children is reached
+	nodes := make(map[uuid.UUID]*model.FolderNode, len(rows))
+	roots := []*model.FolderNode{}
+	for i := range rows {
+		node := &rows[i]
+		node.Children = []*model.FolderNode{}
+		nodes[node.Id] = node
+
+		if parent, ok := nodes[node.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	for _, root := range roots {
+		sumFolderNode(root)
+		pruneFolderNode(root, depth)
+	}
+
+	return roots, nil
+}
+
+// sumFolderNode fills in the totals of node and its descendants.
+func sumFolderNode(node *model.FolderNode) {
+	node.TotalFileCount = node.FileCount
+	node.TotalSize = node.Size
+	node.HasChildren = len(node.Children) > 0
+	for _, child := range node.Children {
+		sumFolderNode(child)
+		node.TotalFileCount += child.TotalFileCount
+		node.TotalSize += child.TotalSize
+	}
+}
+
+// pruneFolderNode drops the levels below depth, where depth 1 keeps only
+// node itself. A depth of 0 keeps everything.
+func pruneFolderNode(node *model.FolderNode, depth int) {
+	if depth == 1 {
+		node.Children = []*model.FolderNode{}
+		return
+	}
+	for _, child := range node.Children {
+		pruneFolderNode(child, max(depth-1, 0))
+	}
+}
+
+// GetFolderPath returns the breadcrumb trail from the root to a folder. For
+// a folder shared with userID the trail starts at the topmost folder they
+// can see.
+func (s *FileService) GetFolderPath(ctx context.Context, userID, id uuid.UUID) ([]model.Folder, error) {
+	folder, err := s.GetFolder(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors, err := s.store.GetAncestors(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if folder.UserID == userID {
+		return ancestors, nil
+	}
+
+	// access is inherited, so everything below the first visible folder is
+	// visible as well
+	for i, ancestor := range ancestors {
+		err := s.authorize(ctx, userID, ancestor.UserID, uuid.Nil, ancestor.Id, model.AccessViewer)
+		if err == nil {
+			return ancestors[i:], nil
+		}
+		if !errors.Is(err, model.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	return ancestors[len(ancestors)-1:], nil
+}
+
+// RenameFolder changes a folder's name.
+func (s *FileService) RenameFolder(ctx context.Context, userID, id uuid.UUID, name string, policy model.ConflictPolicy) (*model.Folder, error) {
+	name, err := validateName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, err := s.folder(ctx, userID, id, model.AccessEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.relocateFolder(ctx, folder, folder.ParentID, name, policy)
+}
+
+// MoveFolder moves a folder under parentID, or to the root when parentID is
+// uuid.Nil. A folder cannot be moved into itself or one of its descendants,
+// nor into a folder of another user.
+func (s *FileService) MoveFolder(ctx context.Context, userID, id, parentID uuid.UUID, policy model.ConflictPolicy) (*model.Folder, error) {
+	folder, err := s.folder(ctx, userID, id, model.AccessEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	ownerID, err := s.checkFolder(ctx, userID, parentID, model.AccessEditor)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID != folder.UserID {
+		return nil, ErrMoveAcrossOwners
+	}
+
+	folder, err = s.relocateFolder(ctx, folder, parentID, folder.Name, policy)
+	if errors.Is(err, model.ErrCycle) {
+		return nil, ErrFolderCycle
+	}
+	return folder, err
+}
+
+// relocateFolder saves folder under a new name and parent, resolving
+// conflicts with policy.
+func (s *FileService) relocateFolder(ctx context.Context, folder *model.Folder, parentID uuid.UUID, name string, policy model.ConflictPolicy) (*model.Folder, error) {
+	if policy == model.ConflictReplace {
+		return nil, ErrReplaceFolder
+	}
+
+	folder.ParentID = parentID
+	folder.LastModified = time.Now().UTC()
+
+	err := saveUnique(ctx, policy, name, func(name string) error {
+		folder.Name = name
+		return s.store.UpdateFolder(ctx, folder)
+	}, func(ctx context.Context, prefix string) ([]string, error) {
+		return s.store.ListFolderNames(ctx, folder.UserID, parentID, prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return folder, nil
+}
+
+// DeleteFolder moves a folder to the trash with everything inside it.
+func (s *FileService) DeleteFolder(ctx context.Context, userID, id uuid.UUID) error {
+	if _, err := s.folder(ctx, userID, id, model.AccessEditor); err != nil {
+		return err
+	}
+
+	return s.store.TrashFolder(ctx, id, time.Now().UTC())
+}
+
+func (s *FileService) deleteBlob(ctx context.Context, key string) {
+	err := s.blobs.Delete(context.WithoutCancel(ctx), key)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		slog.Error("failed to delete file contents", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,141 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileService_MoveFolder(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	store := newMemFileStore()
+	fs := service.NewFileService(store, newMemBlobStore())
+
+	docs := store.addFolder(userID, uuid.Nil, "docs")
+	work := store.addFolder(userID, docs.Id, "work")
+	reports := store.addFolder(userID, work.Id, "reports")
+	other := store.addFolder(uuid.New(), uuid.Nil, "other")
+
+	tests := []struct {
+		name     string
+		id       uuid.UUID
+		parentID uuid.UUID
+		wantErr  error
+	}{
+		{name: "into itself", id: docs.Id, parentID: docs.Id, wantErr: service.ErrFolderCycle},
+		{name: "into a descendant", id: docs.Id, parentID: reports.Id, wantErr: service.ErrFolderCycle},
+		{name: "into another user's folder", id: reports.Id, parentID: other.Id, wantErr: model.ErrNotFound},
+		{name: "to the root", id: reports.Id, parentID: uuid.Nil},
+		{name: "into a sibling tree", id: work.Id, parentID: reports.Id},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fs.MoveFolder(ctx, userID, tt.id, tt.parentID, model.ConflictFail)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.parentID, got.ParentID)
+		})
+	}
+}
+
+func TestFileService_ListFolderOptions(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	store := newMemFileStore()
+	fs := service.NewFileService(store, newMemBlobStore())
+
+	_, err := fs.ListFolder(ctx, userID, uuid.Nil, model.ListOptions{Sort: "owner"})
+	assert.ErrorIs(t, err, service.ErrInvalidSort)
+
+	other := store.addFolder(uuid.New(), uuid.Nil, "other")
+	_, err = fs.ListFolder(ctx, userID, other.Id, model.ListOptions{})
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestFileService_GetFolderPath(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	store := newMemFileStore()
+	fs := service.NewFileService(store, newMemBlobStore())
+
+	docs := store.addFolder(userID, uuid.Nil, "docs")
+	work := store.addFolder(userID, docs.Id, "work")
+
+	path, err := fs.GetFolderPath(ctx, userID, work.Id)
+	require.NoError(t, err)
+	require.Len(t, path, 2)
+	assert.Equal(t, "docs", path[0].Name)
+	assert.Equal(t, "work", path[1].Name)
+}
+
+func TestFileService_GetFolderTree(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	store := newMemFileStore()
+	fs := service.NewFileService(store, blobs)
+
+	docs := store.addFolder(userID, uuid.Nil, "docs")
+	work := store.addFolder(userID, docs.Id, "work")
+	reports := store.addFolder(userID, work.Id, "reports")
+	store.addFolder(userID, uuid.Nil, "music")
+	store.addFolder(uuid.New(), uuid.Nil, "other")
+
+	store.addFile(blobs, userID, docs.Id, "a.txt", []byte("aaaa"))
+	store.addFile(blobs, userID, work.Id, "b.txt", []byte("bb"))
+	store.addFile(blobs, userID, reports.Id, "c.txt", []byte("c"))
+	store.addFile(blobs, userID, reports.Id, "d.txt", []byte("dd"))
+
+	tree, err := fs.GetFolderTree(ctx, userID, uuid.Nil, 0)
+	require.NoError(t, err)
+	require.Len(t, tree, 2)
+	assert.Equal(t, "docs", tree[0].Name)
+	assert.Equal(t, "music", tree[1].Name)
+	assert.False(t, tree[1].HasChildren)
+
+	root := tree[0]
+	assert.Equal(t, int64(1), root.FileCount)
+	assert.Equal(t, int64(4), root.Size)
+	assert.Equal(t, int64(4), root.TotalFileCount)
+	assert.Equal(t, int64(9), root.TotalSize)
+	require.Len(t, root.Children, 1)
+	require.Len(t, root.Children[0].Children, 1)
+	assert.Equal(t, "reports", root.Children[0].Children[0].Name)
+
+	t.Run("depth limit keeps totals", func(t *testing.T) {
+		tree, err := fs.GetFolderTree(ctx, userID, uuid.Nil, 2)
+		require.NoError(t, err)
+		work := tree[0].Children[0]
+		assert.Empty(t, work.Children)
+		assert.True(t, work.HasChildren)
+		assert.Equal(t, int64(3), work.TotalFileCount)
+	})
+
+	t.Run("below a folder", func(t *testing.T) {
+		tree, err := fs.GetFolderTree(ctx, userID, docs.Id, 0)
+		require.NoError(t, err)
+		require.Len(t, tree, 1)
+		assert.Equal(t, work.Id, tree[0].Id)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		_, err := fs.GetFolderTree(ctx, userID, uuid.Nil, -1)
+		assert.ErrorIs(t, err, service.ErrInvalidDepth)
+		_, err = fs.GetFolderTree(ctx, uuid.New(), docs.Id, 0)
+		assert.ErrorIs(t, err, model.ErrNotFound)
+	})
+}
@@ -2,14 +2,16 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/freekobie/kora/model"
+	"google.golang.org/api/iterator"
 )
 
-// GCS is a service for interacting with Google Cloud Storage.
+// GCS is a model.BlobStore backed by Google Cloud Storage.
 type GCS struct {
 	client *storage.Client
 	bucket string
@@ -17,26 +19,32 @@ type GCS struct {
 
 // NewGCS creates a new GCS service.
 func NewGCS(ctx context.Context, bucket string) (*GCS, error) {
-	// client, err := storage.NewClient(ctx)
-	// if err != nil {
-	// 	return nil, fmt.Errorf("failed to create gcs client: %w", err)
-	// }
+	if bucket == "" {
+		return nil, errors.New("gcs bucket name is required")
+	}
 
-	// return &GCS{
-	// 	client: client,
-	// 	bucket: bucket,
-	// }, nil
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcs client: %w", err)
+	}
 
-	return &GCS{}, nil
+	return &GCS{
+		client: client,
+		bucket: bucket,
+	}, nil
 }
 
-// UploadFile uploads a file to Google Cloud Storage.
-func (s *GCS) UploadFile(ctx context.Context, key string, file io.Reader) error {
-	ctx, cancel := context.WithTimeout(ctx, time.Second*50)
+// Put uploads an object to Google Cloud Storage.
+func (s *GCS) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	wc := s.client.Bucket(s.bucket).Object(key).NewWriter(ctx)
-	if _, err := io.Copy(wc, file); err != nil {
+	wc.ContentType = contentType
+	if _, err := io.Copy(wc, r); err != nil {
+		// cancelling the context before Close aborts the upload
+		cancel()
+		_ = wc.Close()
 		return fmt.Errorf("failed to copy file to gcs: %w", err)
 	}
 
@@ -46,3 +54,71 @@ func (s *GCS) UploadFile(ctx context.Context, key string, file io.Reader) error
 
 	return nil
 }
+
+// Get opens a reader over a range of an object.
+func (s *GCS) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := s.client.Bucket(s.bucket).Object(key).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, model.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read gcs object: %w", err)
+	}
+
+	return rc, nil
+}
+
+// Stat returns the attributes of an object.
+func (s *GCS) Stat(ctx context.Context, key string) (model.BlobInfo, error) {
+	attrs, err := s.client.Bucket(s.bucket).Object(key).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return model.BlobInfo{}, model.ErrNotFound
+		}
+		return model.BlobInfo{}, fmt.Errorf("failed to stat gcs object: %w", err)
+	}
+
+	return gcsBlobInfo(attrs), nil
+}
+
+// Delete removes an object.
+func (s *GCS) Delete(ctx context.Context, key string) error {
+	err := s.client.Bucket(s.bucket).Object(key).Delete(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return model.ErrNotFound
+		}
+		return fmt.Errorf("failed to delete gcs object: %w", err)
+	}
+
+	return nil
+}
+
+// List returns all objects whose key starts with prefix.
+func (s *GCS) List(ctx context.Context, prefix string) ([]model.BlobInfo, error) {
+	var blobs []model.BlobInfo
+
+	it := s.client.Bucket(s.bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list gcs objects: %w", err)
+		}
+		blobs = append(blobs, gcsBlobInfo(attrs))
+	}
+
+	return blobs, nil
+}
+
+func gcsBlobInfo(attrs *storage.ObjectAttrs) model.BlobInfo {
+	return model.BlobInfo{
+		Key:          attrs.Name,
+		Size:         attrs.Size,
+		ContentType:  attrs.ContentType,
+		ETag:         attrs.Etag,
+		LastModified: attrs.Updated,
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"log/slog"
@@ -18,6 +19,13 @@ func generateOTP() string {
 	return fmt.Sprintf("%06d", n.Int64())
 }
 
+// generateToken returns a random URL-safe token with 256 bits of entropy.
+func generateToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
 // hashString hashes the token using SHA-256 and returns the hex-encoded hash
 func hashString(token string) string {
 	hash := sha256.Sum256([]byte(token))
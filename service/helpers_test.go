@@ -0,0 +1,93 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freekobie/kora/model"
+)
+
+// memBlobStore is an in-memory model.BlobStore used by the service tests.
+type memBlobStore struct {
+	mu      sync.Mutex
+	objects map[string]memObject
+}
+
+type memObject struct {
+	data        []byte
+	contentType string
+	modified    time.Time
+}
+
+func newMemBlobStore() *memBlobStore {
+	return &memBlobStore{objects: make(map[string]memObject)}
+}
+
+func (m *memBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memObject{data: data, contentType: contentType, modified: time.Now()}
+	return nil
+}
+
+func (m *memBlobStore) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	data := obj.data[min(offset, int64(len(obj.data))):]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memBlobStore) Stat(ctx context.Context, key string) (model.BlobInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[key]
+	if !ok {
+		return model.BlobInfo{}, model.ErrNotFound
+	}
+	return model.BlobInfo{Key: key, Size: int64(len(obj.data)), ContentType: obj.contentType, LastModified: obj.modified}, nil
+}
+
+func (m *memBlobStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.objects[key]; !ok {
+		return model.ErrNotFound
+	}
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memBlobStore) List(ctx context.Context, prefix string) ([]model.BlobInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var blobs []model.BlobInfo
+	for key, obj := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			blobs = append(blobs, model.BlobInfo{Key: key, Size: int64(len(obj.data)), ContentType: obj.contentType, LastModified: obj.modified})
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Key < blobs[j].Key })
+	return blobs, nil
+}
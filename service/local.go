@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/freekobie/kora/model"
+)
+
+// maxLocalNameLength is the longest file name most filesystems accept.
+const maxLocalNameLength = 255
+
+// LocalStorage is a model.BlobStore that keeps objects on the local filesystem.
+//
+// Objects live under <root>/objects/<aa>/<bb>/<escaped key>, where aa and bb
+// are the first bytes of the SHA-256 of the key. Keys are escaped into a
+// single path element, so they can never point outside the root directory.
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage creates a LocalStorage rooted at dir, creating it if needed.
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if dir == "" {
+		return nil, errors.New("local storage directory is required")
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage directory: %w", err)
+	}
+
+	for _, sub := range []string{"objects", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(root, sub), 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+	}
+
+	return &LocalStorage{root: root}, nil
+}
+
+// Put writes an object to a temporary file and renames it into place once
+// all bytes are flushed to disk, so readers never observe partial objects.
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create object directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.root, "tmp"), "upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, contextReader{ctx: ctx, r: r})
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("expected %d bytes but received %d", size, written)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move object into place: %w", err)
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// Get opens a reader over a range of an object.
+func (s *LocalStorage) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	path, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, model.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open object: %w", err)
+	}
+
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to seek object: %w", err)
+		}
+	}
+
+	if length < 0 {
+		return f, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+// Stat returns the attributes of an object. LocalStorage does not record
+// content types, so BlobInfo.ContentType is always empty.
+func (s *LocalStorage) Stat(ctx context.Context, key string) (model.BlobInfo, error) {
+	path, err := s.objectPath(key)
+	if err != nil {
+		return model.BlobInfo{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return model.BlobInfo{}, model.ErrNotFound
+		}
+		return model.BlobInfo{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	return localBlobInfo(key, info), nil
+}
+
+// Delete removes an object.
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return model.ErrNotFound
+		}
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+
+	return nil
+}
+
+// List returns all objects whose key starts with prefix. Objects are sharded
+// by hash, so this walks the whole object tree.
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]model.BlobInfo, error) {
+	var blobs []model.BlobInfo
+
+	err := filepath.WalkDir(filepath.Join(s.root, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		key, err := url.PathUnescape(d.Name())
+		if err != nil || !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, localBlobInfo(key, info))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Key < blobs[j].Key })
+
+	return blobs, nil
+}
+
+// objectPath maps a key to its location on disk, rejecting keys that could
+// escape the storage root.
+func (s *LocalStorage) objectPath(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+
+	name := url.PathEscape(key)
+	if len(name) > maxLocalNameLength {
+		return "", ErrInvalidKey
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	shard := hex.EncodeToString(sum[:2])
+	path := filepath.Join(s.root, "objects", shard[:2], shard[2:], name)
+
+	rel, err := filepath.Rel(filepath.Join(s.root, "objects"), path)
+	if err != nil || strings.HasPrefix(rel, "..") || filepath.IsAbs(rel) {
+		return "", ErrInvalidKey
+	}
+
+	return path, nil
+}
+
+func validateKey(key string) error {
+	if key == "" {
+		return ErrInvalidKey
+	}
+	if strings.ContainsAny(key, "\\\x00") || strings.HasPrefix(key, "/") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+func localBlobInfo(key string, info fs.FileInfo) model.BlobInfo {
+	return model.BlobInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ETag:         fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}
+}
+
+// syncDir flushes a directory entry so a completed rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open object directory: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync object directory: %w", err)
+	}
+	return nil
+}
+
+// contextReader stops a copy once its context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,127 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStorage_PutGet(t *testing.T) {
+	root := t.TempDir()
+	store, err := service.NewLocalStorage(root)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	content := []byte("0123456789")
+	require.NoError(t, store.Put(ctx, "user/file", bytes.NewReader(content), int64(len(content)), "text/plain"))
+
+	tests := []struct {
+		name   string
+		offset int64
+		length int64
+		want   string
+	}{
+		{name: "whole object", offset: 0, length: -1, want: "0123456789"},
+		{name: "prefix", offset: 0, length: 4, want: "0123"},
+		{name: "middle", offset: 3, length: 4, want: "3456"},
+		{name: "suffix", offset: 7, length: -1, want: "789"},
+		{name: "length past end", offset: 8, length: 10, want: "89"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := store.Get(ctx, "user/file", tt.offset, tt.length)
+			require.NoError(t, err)
+			defer rc.Close()
+
+			got, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	info, err := store.Stat(ctx, "user/file")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+	assert.NotEmpty(t, info.ETag)
+
+	tmp, err := os.ReadDir(filepath.Join(root, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmp, "temp files should be cleaned up")
+}
+
+func TestLocalStorage_PutSizeMismatch(t *testing.T) {
+	store, err := service.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	err = store.Put(ctx, "user/short", strings.NewReader("abc"), 10, "")
+	assert.Error(t, err)
+
+	_, err = store.Stat(ctx, "user/short")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestLocalStorage_InvalidKeys(t *testing.T) {
+	store, err := service.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	keys := []string{
+		"",
+		"..",
+		"../escape",
+		"user/../../escape",
+		"/etc/passwd",
+		"user//file",
+		"user/./file",
+		`user\..\file`,
+		"user/\x00file",
+		strings.Repeat("a", 300),
+	}
+
+	for _, key := range keys {
+		t.Run(key, func(t *testing.T) {
+			err := store.Put(ctx, key, strings.NewReader("x"), 1, "")
+			assert.ErrorIs(t, err, service.ErrInvalidKey)
+
+			_, err = store.Get(ctx, key, 0, -1)
+			assert.ErrorIs(t, err, service.ErrInvalidKey)
+		})
+	}
+}
+
+func TestLocalStorage_DeleteAndList(t *testing.T) {
+	store, err := service.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for _, key := range []string{"alice/1", "alice/2", "bob/1"} {
+		require.NoError(t, store.Put(ctx, key, strings.NewReader(key), -1, ""))
+	}
+
+	blobs, err := store.List(ctx, "alice/")
+	require.NoError(t, err)
+	require.Len(t, blobs, 2)
+	assert.Equal(t, "alice/1", blobs[0].Key)
+	assert.Equal(t, "alice/2", blobs[1].Key)
+
+	require.NoError(t, store.Delete(ctx, "alice/1"))
+	assert.ErrorIs(t, store.Delete(ctx, "alice/1"), model.ErrNotFound)
+
+	_, err = store.Get(ctx, "alice/1", 0, -1)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	blobs, err = store.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, blobs, 2)
+}
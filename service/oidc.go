@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/oidc"
+	"github.com/freekobie/kora/session"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oidcLoginTTL is how long a user has to sign in at the identity provider
+// and come back.
+const oidcLoginTTL = 10 * time.Minute
+
+// SetOIDCProvider enables single sign-on with provider.
+func (us *UserService) SetOIDCProvider(provider *oidc.Provider) {
+	us.oidc = provider
+}
+
+// StartOIDCLogin begins a single sign-on login and returns the identity
+// provider URL to send the user to, along with the state. The provider sends
+// them back to the configured redirect URL with a code and the state for
+// CompleteOIDCLogin. The caller must also keep the state in the browser that
+// started the login, such as in a cookie, and pass it to CompleteOIDCLogin,
+// so that nobody can finish a login they started in another browser.
+func (us *UserService) StartOIDCLogin(ctx context.Context) (string, string, error) {
+	if us.oidc == nil {
+		return "", "", ErrOIDCNotConfigured
+	}
+
+	state := generateToken()
+	login := model.OIDCState{
+		StateHash: hashString(state),
+		Nonce:     generateToken(),
+		Verifier:  oidc.GenerateVerifier(),
+		ExpiresAt: time.Now().UTC().Add(oidcLoginTTL),
+	}
+	if err := us.store.InsertOIDCState(ctx, &login); err != nil {
+		return "", "", err
+	}
+
+	return us.oidc.AuthCodeURL(state, login.Nonce, login.Verifier), state, nil
+}
+
+// CompleteOIDCLogin finishes a login started by StartOIDCLogin. The user is
+// the one linked to the provider account, or else the one with the email the
+// provider has verified, who is then linked to it; a new user is created if
+// there is none. As with NewSession, users with two-factor authentication
+// get a challenge token instead of a session. browserState is the state kept
+// in the browser by StartOIDCLogin's caller; it must match state.
+func (us *UserService) CompleteOIDCLogin(ctx context.Context, state, browserState, code string, client model.ClientInfo) (*session.UserSession, error) {
+	if us.oidc == nil {
+		return nil, ErrOIDCNotConfigured
+	}
+	// otherwise an attacker could start a login and have a victim finish
+	// it, signing the victim in to the attacker's account
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return nil, ErrOIDCBrowserMismatch
+	}
+
+	login, err := us.store.TakeOIDCState(ctx, hashString(state))
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if time.Now().After(login.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	claims, err := us.oidc.Exchange(ctx, code, login.Verifier, login.Nonce)
+	if err != nil {
+		slog.Warn("single sign-on failed", "error", err)
+		return nil, ErrOIDCLoginFailed
+	}
+
+	user, err := us.oidcUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	tf, err := us.store.GetTwoFactor(ctx, user.Id)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && tf.Enabled {
+		return us.newTwoFactorChallenge(ctx, user)
+	}
+
+	return us.startSession(ctx, user, client)
+}
+
+// oidcUser finds, links or creates the user an ID token is for.
+func (us *UserService) oidcUser(ctx context.Context, claims *oidc.Claims) (model.User, error) {
+	issuer := us.oidc.Issuer()
+
+	identity, err := us.store.GetIdentity(ctx, issuer, claims.Subject)
+	if err == nil {
+		return us.store.GetUser(ctx, identity.UserID)
+	}
+	if !errors.Is(err, model.ErrNotFound) {
+		return model.User{}, err
+	}
+
+	// only an address the provider vouches for may claim an account
+	if claims.Email == "" || !claims.EmailVerified {
+		return model.User{}, ErrUnverifiedIdentity
+	}
+
+	user, err := us.store.GetUserByMail(ctx, claims.Email)
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		user, err = us.provisionUser(ctx, claims)
+		if err != nil {
+			return model.User{}, err
+		}
+	case err != nil:
+		return model.User{}, err
+	case !user.Verified:
+		// whoever registered the address never proved they own it, so the
+		// password they chose is not kept
+		if err := us.claimUnverifiedUser(ctx, &user); err != nil {
+			return model.User{}, err
+		}
+	}
+
+	err = us.store.InsertIdentity(ctx, &model.Identity{
+		Issuer:    issuer,
+		Subject:   claims.Subject,
+		UserID:    user.Id,
+		Email:     claims.Email,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil && !errors.Is(err, model.ErrConflict) {
+		return model.User{}, err
+	}
+	slog.Info("linked identity", "user", user.Id, "issuer", issuer)
+
+	return user, nil
+}
+
+// provisionUser creates a verified user for a new provider account. The
+// user has no password they know; they can set one with a password reset.
+func (us *UserService) provisionUser(ctx context.Context, claims *oidc.Claims) (model.User, error) {
+	hash, err := unusablePasswordHash()
+	if err != nil {
+		return model.User{}, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+	now := time.Now().UTC()
+	user := model.User{
+		Id:           uuid.New(),
+		Name:         name,
+		Email:        claims.Email,
+		PasswordHash: hash,
+		CreatedAt:    now,
+		LastModifed:  now,
+		Verified:     true,
+		Role:         model.RoleUser,
+	}
+	if err := us.store.InsertUser(ctx, &user); err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+// claimUnverifiedUser verifies user on behalf of the provider account with
+// their address, replacing their password.
+func (us *UserService) claimUnverifiedUser(ctx context.Context, user *model.User) error {
+	hash, err := unusablePasswordHash()
+	if err != nil {
+		return err
+	}
+
+	user.PasswordHash = hash
+	user.Verified = true
+	user.LastModifed = time.Now().UTC()
+	if err := us.store.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	return us.store.DeleteUserTokens(ctx, user.Id, VERIFICATION)
+}
+
+// unusablePasswordHash returns the hash of a random password nobody knows.
+func unusablePasswordHash() ([]byte, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(generateToken()), bcrypt.DefaultCost)
+	if err != nil {
+		slog.Error("failed to hash password", "error", err)
+		return nil, ErrFailedOperation
+	}
+	return hash, nil
+}
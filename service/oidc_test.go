@@ -0,0 +1,220 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/oidc"
+	"github.com/freekobie/kora/oidc/oidctest"
+	"github.com/freekobie/kora/service"
+	"github.com/freekobie/kora/session"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *memUserStore) InsertOIDCState(ctx context.Context, state *model.OIDCState) error {
+	m.oidcStates[state.StateHash] = *state
+	return nil
+}
+
+func (m *memUserStore) TakeOIDCState(ctx context.Context, stateHash string) (model.OIDCState, error) {
+	state, ok := m.oidcStates[stateHash]
+	if !ok {
+		return model.OIDCState{}, model.ErrNotFound
+	}
+	delete(m.oidcStates, stateHash)
+	return state, nil
+}
+
+func (m *memUserStore) GetIdentity(ctx context.Context, issuer, subject string) (model.Identity, error) {
+	identity, ok := m.identities[[2]string{issuer, subject}]
+	if !ok {
+		return model.Identity{}, model.ErrNotFound
+	}
+	return identity, nil
+}
+
+func (m *memUserStore) InsertIdentity(ctx context.Context, identity *model.Identity) error {
+	key := [2]string{identity.Issuer, identity.Subject}
+	if _, ok := m.identities[key]; ok {
+		return model.ErrConflict
+	}
+	m.identities[key] = *identity
+	return nil
+}
+
+// newOIDCService returns a user service that signs in with a fake identity
+// provider.
+func newOIDCService(t *testing.T, users *memUserStore) (*service.UserService, *oidctest.Server) {
+	t.Helper()
+	idp := oidctest.NewServer("kora", "secret")
+	t.Cleanup(idp.Close)
+
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "kora",
+		ClientSecret: "secret",
+		RedirectURL:  "https://kora.example/auth/callback",
+	})
+	require.NoError(t, err)
+
+	svc := service.NewUserService(users, nil)
+	svc.SetOIDCProvider(provider)
+	return svc, idp
+}
+
+// oidcLogin signs user in at idp and completes the login.
+func oidcLogin(t *testing.T, svc *service.UserService, idp *oidctest.Server, user oidctest.User) (*session.UserSession, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	url, browserState, err := svc.StartOIDCLogin(ctx)
+	require.NoError(t, err)
+	code, state, err := idp.Authorize(url, user)
+	require.NoError(t, err)
+
+	return svc.CompleteOIDCLogin(ctx, state, browserState, code, model.ClientInfo{UserAgent: "Browser"})
+}
+
+func TestUserService_OIDCNotConfigured(t *testing.T) {
+	svc := service.NewUserService(newMemUserStore(), nil)
+
+	_, _, err := svc.StartOIDCLogin(context.Background())
+	assert.ErrorIs(t, err, service.ErrOIDCNotConfigured)
+	_, err = svc.CompleteOIDCLogin(context.Background(), "state", "state", "code", model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrOIDCNotConfigured)
+}
+
+func TestUserService_OIDCProvisionsUsers(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserStore()
+	svc, idp := newOIDCService(t, users)
+
+	carol := oidctest.User{Subject: "carol-1", Email: "carol@corp.example", EmailVerified: true, Name: "Carol"}
+	login, err := oidcLogin(t, svc, idp, carol)
+	require.NoError(t, err)
+	assert.NotEmpty(t, login.RefreshToken)
+	assert.Equal(t, carol.Email, login.User.Email)
+	assert.Equal(t, "Carol", login.User.Name)
+	assert.True(t, login.User.Verified)
+	_, err = svc.RefreshSession(ctx, login.RefreshToken, model.ClientInfo{})
+	assert.NoError(t, err)
+
+	// later logins find the user by their provider account, even if the
+	// provider has a new address for them
+	carol.Email = "carol.smith@corp.example"
+	again, err := oidcLogin(t, svc, idp, carol)
+	require.NoError(t, err)
+	assert.Equal(t, login.User.Id, again.User.Id)
+	assert.Len(t, users.users, 1)
+}
+
+func TestUserService_OIDCLinksExistingUsers(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserStore()
+	alice := users.addUser("alice@corp.example")
+	svc, idp := newOIDCService(t, users)
+
+	_, err := oidcLogin(t, svc, idp, oidctest.User{Subject: "alice-1", Email: alice.Email})
+	assert.ErrorIs(t, err, service.ErrUnverifiedIdentity, "unverified provider addresses cannot claim accounts")
+
+	login, err := oidcLogin(t, svc, idp, oidctest.User{Subject: "alice-1", Email: alice.Email, EmailVerified: true})
+	require.NoError(t, err)
+	assert.Equal(t, alice.Id, login.User.Id)
+	assert.Len(t, users.identities, 1)
+
+	_, err = svc.NewSession(ctx, alice.Email, "password", model.ClientInfo{})
+	assert.NoError(t, err, "the password keeps working")
+}
+
+func TestUserService_OIDCClaimsUnverifiedUsers(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserStore()
+	squatter := users.addUser("dave@corp.example")
+	squatter.Verified = false
+	users.users[squatter.Id] = squatter
+	svc, idp := newOIDCService(t, users)
+
+	login, err := oidcLogin(t, svc, idp, oidctest.User{Subject: "dave-1", Email: squatter.Email, EmailVerified: true})
+	require.NoError(t, err)
+	assert.Equal(t, squatter.Id, login.User.Id)
+	assert.True(t, users.users[squatter.Id].Verified)
+
+	_, err = svc.NewSession(ctx, squatter.Email, "password", model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials, "a password set before the address was verified stops working")
+}
+
+func TestUserService_OIDCState(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserStore()
+	svc, idp := newOIDCService(t, users)
+	erin := oidctest.User{Subject: "erin-1", Email: "erin@corp.example", EmailVerified: true}
+
+	url, _, err := svc.StartOIDCLogin(ctx)
+	require.NoError(t, err)
+	code, state, err := idp.Authorize(url, erin)
+	require.NoError(t, err)
+
+	_, err = svc.CompleteOIDCLogin(ctx, "forged", "forged", code, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+	_, err = svc.CompleteOIDCLogin(ctx, state, state, code, model.ClientInfo{})
+	require.NoError(t, err)
+	_, err = svc.CompleteOIDCLogin(ctx, state, state, code, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken, "states work once")
+}
+
+func TestUserService_OIDCLoginCSRF(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserStore()
+	svc, idp := newOIDCService(t, users)
+	mallory := oidctest.User{Subject: "mallory-1", Email: "mallory@corp.example", EmailVerified: true}
+
+	// the attacker starts a login and signs in as themselves
+	url, _, err := svc.StartOIDCLogin(ctx)
+	require.NoError(t, err)
+	code, state, err := idp.Authorize(url, mallory)
+	require.NoError(t, err)
+
+	// then sends the callback to a victim, whose browser has no state or
+	// the state of a login of its own
+	_, victimState, err := svc.StartOIDCLogin(ctx)
+	require.NoError(t, err)
+	for _, browserState := range []string{"", victimState} {
+		_, err = svc.CompleteOIDCLogin(ctx, state, browserState, code, model.ClientInfo{})
+		assert.ErrorIs(t, err, service.ErrOIDCBrowserMismatch)
+	}
+	assert.Empty(t, users.users, "nobody is signed in")
+}
+
+func TestUserService_OIDCRejectsBadIDTokens(t *testing.T) {
+	users := newMemUserStore()
+	svc, idp := newOIDCService(t, users)
+	idp.ModifyClaims = func(claims jwt.MapClaims) { claims["aud"] = "another-app" }
+
+	_, err := oidcLogin(t, svc, idp, oidctest.User{Subject: "frank-1", Email: "frank@corp.example", EmailVerified: true})
+	assert.ErrorIs(t, err, service.ErrOIDCLoginFailed)
+	assert.Empty(t, users.users)
+}
+
+func TestUserService_OIDCTwoFactor(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserStore()
+	grace := users.addUser("grace@corp.example")
+	svc, idp := newOIDCService(t, users)
+
+	setup, err := svc.SetupTwoFactor(ctx, grace.Id)
+	require.NoError(t, err)
+	_, err = svc.ConfirmTwoFactor(ctx, grace.Id, currentCode(t, setup.Secret, -1))
+	require.NoError(t, err)
+
+	login, err := oidcLogin(t, svc, idp, oidctest.User{Subject: "grace-1", Email: grace.Email, EmailVerified: true})
+	require.NoError(t, err)
+	assert.True(t, login.TwoFactorRequired, "single sign-on does not skip the second factor")
+	assert.Empty(t, login.RefreshToken)
+
+	verified, err := svc.VerifyTwoFactor(ctx, login.ChallengeToken, currentCode(t, setup.Secret, 0), model.ClientInfo{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, verified.RefreshToken)
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/session"
+	"github.com/freekobie/kora/webauthn"
+	"github.com/google/uuid"
+)
+
+// SetWebAuthn enables passkeys for relying party rp.
+func (us *UserService) SetWebAuthn(rp *webauthn.RelyingParty) {
+	us.webauthn = rp
+}
+
+// BeginPasskeyRegistration starts registering a passkey for a user and
+// returns the options to pass to navigator.credentials.create.
+func (us *UserService) BeginPasskeyRegistration(ctx context.Context, userID uuid.UUID) (*webauthn.CreationOptions, error) {
+	if us.webauthn == nil {
+		return nil, ErrPasskeysNotConfigured
+	}
+
+	user, err := us.store.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	passkeys, err := us.store.ListPasskeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	exclude := make([][]byte, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exclude = append(exclude, passkey.CredentialID)
+	}
+
+	challenge, err := us.newWebAuthnChallenge(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the user handle is the user ID, which says nothing about the user
+	options := us.webauthn.CreationOptions(challenge, webauthn.User{
+		ID:          user.Id[:],
+		Name:        user.Email,
+		DisplayName: user.Name,
+	}, exclude)
+	return &options, nil
+}
+
+// FinishPasskeyRegistration verifies the credential the authenticator
+// created for a registration started by BeginPasskeyRegistration and saves
+// it as a passkey called name.
+func (us *UserService) FinishPasskeyRegistration(ctx context.Context, userID uuid.UUID, name string, response *webauthn.AttestationResponse) (*model.Passkey, error) {
+	if us.webauthn == nil {
+		return nil, ErrPasskeysNotConfigured
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, ErrInvalidPasskeyName
+	}
+
+	challenge, err := response.Challenge()
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	if err := us.takeWebAuthnChallenge(ctx, challenge, userID); err != nil {
+		return nil, err
+	}
+
+	credential, err := us.webauthn.VerifyRegistration(response, challenge)
+	if err != nil {
+		slog.Warn("passkey registration failed", "user", userID, "error", err)
+		return nil, ErrInvalidPasskey
+	}
+
+	passkey := model.Passkey{
+		Id:           uuid.New(),
+		UserID:       userID,
+		Name:         name,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := us.store.InsertPasskey(ctx, &passkey); err != nil {
+		if errors.Is(err, model.ErrConflict) {
+			return nil, ErrPasskeyExists
+		}
+		return nil, err
+	}
+
+	return &passkey, nil
+}
+
+// BeginPasskeyLogin starts a passkey login and returns the options to pass
+// to navigator.credentials.get. Passkeys are discoverable, so the user does
+// not say who they are until the authenticator answers.
+func (us *UserService) BeginPasskeyLogin(ctx context.Context) (*webauthn.RequestOptions, error) {
+	if us.webauthn == nil {
+		return nil, ErrPasskeysNotConfigured
+	}
+
+	challenge, err := us.newWebAuthnChallenge(ctx, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+
+	options := us.webauthn.RequestOptions(challenge)
+	return &options, nil
+}
+
+// FinishPasskeyLogin verifies the assertion for a login started by
+// BeginPasskeyLogin and starts a session for the passkey's user. Passkeys
+// verify the user themselves, so no two-factor challenge follows.
+func (us *UserService) FinishPasskeyLogin(ctx context.Context, response *webauthn.AssertionResponse, client model.ClientInfo) (*session.UserSession, error) {
+	if us.webauthn == nil {
+		return nil, ErrPasskeysNotConfigured
+	}
+
+	challenge, err := response.Challenge()
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+	if err := us.takeWebAuthnChallenge(ctx, challenge, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	passkey, err := us.store.GetPasskeyByCredentialID(ctx, response.RawID)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, ErrInvalidPasskey
+		}
+		return nil, err
+	}
+	// the authenticator must agree on whose passkey it is
+	if len(response.Response.UserHandle) != 0 && !bytes.Equal(response.Response.UserHandle, passkey.UserID[:]) {
+		return nil, ErrInvalidPasskey
+	}
+
+	signCount, err := us.webauthn.VerifyAssertion(response, challenge, webauthn.Credential{
+		ID:        passkey.CredentialID,
+		PublicKey: passkey.PublicKey,
+		SignCount: passkey.SignCount,
+	})
+	if err != nil {
+		slog.Warn("passkey login failed", "user", passkey.UserID, "passkey", passkey.Id, "error", err)
+		return nil, ErrInvalidPasskey
+	}
+	if err := us.store.UsePasskey(ctx, passkey.Id, signCount); err != nil {
+		if errors.Is(err, model.ErrConflict) {
+			// another login with this count got there first
+			slog.Warn("passkey login replayed", "user", passkey.UserID, "passkey", passkey.Id)
+			return nil, ErrInvalidPasskey
+		}
+		return nil, err
+	}
+
+	user, err := us.store.GetUser(ctx, passkey.UserID)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, ErrInvalidPasskey
+		}
+		return nil, err
+	}
+
+	return us.startSession(ctx, user, client)
+}
+
+// ListPasskeys returns a user's passkeys.
+func (us *UserService) ListPasskeys(ctx context.Context, userID uuid.UUID) ([]model.Passkey, error) {
+	return us.store.ListPasskeys(ctx, userID)
+}
+
+// DeletePasskey removes one of a user's passkeys.
+func (us *UserService) DeletePasskey(ctx context.Context, userID, id uuid.UUID) error {
+	return us.store.DeletePasskey(ctx, userID, id)
+}
+
+// newWebAuthnChallenge creates and stores the challenge for a ceremony by
+// userID, or for a login if userID is uuid.Nil.
+func (us *UserService) newWebAuthnChallenge(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	challenge := make([]byte, 32)
+	_, _ = rand.Read(challenge)
+
+	err := us.store.InsertWebAuthnChallenge(ctx, &model.WebAuthnChallenge{
+		ChallengeHash: hashString(base64.RawURLEncoding.EncodeToString(challenge)),
+		UserID:        userID,
+		ExpiresAt:     time.Now().UTC().Add(webauthn.Timeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// takeWebAuthnChallenge uses up a challenge issued by newWebAuthnChallenge
+// for the same userID.
+func (us *UserService) takeWebAuthnChallenge(ctx context.Context, challenge []byte, userID uuid.UUID) error {
+	stored, err := us.store.TakeWebAuthnChallenge(ctx, hashString(base64.RawURLEncoding.EncodeToString(challenge)))
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+	if stored.UserID != userID || time.Now().After(stored.ExpiresAt) {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
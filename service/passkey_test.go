@@ -0,0 +1,258 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/freekobie/kora/session"
+	"github.com/freekobie/kora/webauthn"
+	"github.com/freekobie/kora/webauthn/webauthntest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *memUserStore) InsertWebAuthnChallenge(ctx context.Context, challenge *model.WebAuthnChallenge) error {
+	m.webauthnChallenges[challenge.ChallengeHash] = *challenge
+	return nil
+}
+
+func (m *memUserStore) TakeWebAuthnChallenge(ctx context.Context, challengeHash string) (model.WebAuthnChallenge, error) {
+	challenge, ok := m.webauthnChallenges[challengeHash]
+	if !ok {
+		return model.WebAuthnChallenge{}, model.ErrNotFound
+	}
+	delete(m.webauthnChallenges, challengeHash)
+	return challenge, nil
+}
+
+func (m *memUserStore) InsertPasskey(ctx context.Context, passkey *model.Passkey) error {
+	if _, err := m.GetPasskeyByCredentialID(ctx, passkey.CredentialID); err == nil {
+		return model.ErrConflict
+	}
+	m.passkeys = append(m.passkeys, *passkey)
+	return nil
+}
+
+func (m *memUserStore) GetPasskeyByCredentialID(ctx context.Context, credentialID []byte) (model.Passkey, error) {
+	for _, passkey := range m.passkeys {
+		if bytes.Equal(passkey.CredentialID, credentialID) {
+			return passkey, nil
+		}
+	}
+	return model.Passkey{}, model.ErrNotFound
+}
+
+func (m *memUserStore) ListPasskeys(ctx context.Context, userID uuid.UUID) ([]model.Passkey, error) {
+	var passkeys []model.Passkey
+	for i := len(m.passkeys) - 1; i >= 0; i-- {
+		if m.passkeys[i].UserID == userID {
+			passkeys = append(passkeys, m.passkeys[i])
+		}
+	}
+	return passkeys, nil
+}
+
+func (m *memUserStore) UsePasskey(ctx context.Context, id uuid.UUID, signCount uint32) error {
+	for i, passkey := range m.passkeys {
+		if passkey.Id != id {
+			continue
+		}
+		if passkey.SignCount >= signCount && (passkey.SignCount != 0 || signCount != 0) {
+			return model.ErrConflict
+		}
+		m.passkeys[i].SignCount = signCount
+		return nil
+	}
+	return model.ErrNotFound
+}
+
+func (m *memUserStore) DeletePasskey(ctx context.Context, userID, id uuid.UUID) error {
+	for i, passkey := range m.passkeys {
+		if passkey.Id == id && passkey.UserID == userID {
+			m.passkeys = append(m.passkeys[:i], m.passkeys[i+1:]...)
+			return nil
+		}
+	}
+	return model.ErrNotFound
+}
+
+const passkeyOrigin = "https://app.kora.example"
+
+func newPasskeyService(users *memUserStore) *service.UserService {
+	svc := service.NewUserService(users, nil)
+	svc.SetWebAuthn(&webauthn.RelyingParty{ID: "kora.example", Name: "Kora", Origins: []string{passkeyOrigin}})
+	return svc
+}
+
+// registerPasskey registers a passkey on a for userID.
+func registerPasskey(t *testing.T, svc *service.UserService, userID uuid.UUID, a *webauthntest.Authenticator) *model.Passkey {
+	t.Helper()
+	ctx := context.Background()
+
+	options, err := svc.BeginPasskeyRegistration(ctx, userID)
+	require.NoError(t, err)
+	response, err := a.Create(*options)
+	require.NoError(t, err)
+	passkey, err := svc.FinishPasskeyRegistration(ctx, userID, "Laptop", response)
+	require.NoError(t, err)
+	return passkey
+}
+
+// passkeyLogin logs in with a.
+func passkeyLogin(t *testing.T, svc *service.UserService, a *webauthntest.Authenticator) (*session.UserSession, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	options, err := svc.BeginPasskeyLogin(ctx)
+	require.NoError(t, err)
+	response, err := a.Get(*options)
+	require.NoError(t, err)
+	return svc.FinishPasskeyLogin(ctx, response, model.ClientInfo{UserAgent: "Browser"})
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	users := newMemUserStore()
+	svc := newPasskeyService(users)
+	user := users.addUser("alice@example.com")
+	a := webauthntest.New(passkeyOrigin)
+
+	passkey := registerPasskey(t, svc, user.Id, a)
+	assert.Equal(t, "Laptop", passkey.Name)
+
+	s, err := passkeyLogin(t, svc, a)
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, s.User.Id)
+	assert.NotEmpty(t, s.RefreshToken)
+
+	passkeys, err := svc.ListPasskeys(context.Background(), user.Id)
+	require.NoError(t, err)
+	require.Len(t, passkeys, 1)
+	assert.EqualValues(t, 1, passkeys[0].SignCount)
+}
+
+func TestPasskeyLogin_SkipsTwoFactor(t *testing.T) {
+	users := newMemUserStore()
+	svc := newPasskeyService(users)
+	user := users.addUser("alice@example.com")
+	users.twoFactor[user.Id] = model.TwoFactor{UserID: user.Id, Enabled: true}
+	a := webauthntest.New(passkeyOrigin)
+	registerPasskey(t, svc, user.Id, a)
+
+	s, err := passkeyLogin(t, svc, a)
+	require.NoError(t, err)
+	assert.False(t, s.TwoFactorRequired, "passkeys verify the user themselves")
+	assert.NotEmpty(t, s.RefreshToken)
+}
+
+func TestPasskeyLogin_ClonedAuthenticator(t *testing.T) {
+	users := newMemUserStore()
+	svc := newPasskeyService(users)
+	user := users.addUser("alice@example.com")
+	a := webauthntest.New(passkeyOrigin)
+	registerPasskey(t, svc, user.Id, a)
+	clone := a.Clone()
+
+	_, err := passkeyLogin(t, svc, a)
+	require.NoError(t, err)
+
+	_, err = passkeyLogin(t, svc, clone)
+	assert.ErrorIs(t, err, service.ErrInvalidPasskey)
+}
+
+func TestPasskeyLogin_UnknownCredential(t *testing.T) {
+	users := newMemUserStore()
+	svc := newPasskeyService(users)
+	user := users.addUser("alice@example.com")
+	a := webauthntest.New(passkeyOrigin)
+	passkey := registerPasskey(t, svc, user.Id, a)
+
+	require.NoError(t, svc.DeletePasskey(context.Background(), user.Id, passkey.Id))
+
+	_, err := passkeyLogin(t, svc, a)
+	assert.ErrorIs(t, err, service.ErrInvalidPasskey)
+}
+
+func TestPasskeyChallenges(t *testing.T) {
+	users := newMemUserStore()
+	svc := newPasskeyService(users)
+	alice := users.addUser("alice@example.com")
+	bob := users.addUser("bob@example.com")
+	ctx := context.Background()
+
+	t.Run("used once", func(t *testing.T) {
+		a := webauthntest.New(passkeyOrigin)
+		registerPasskey(t, svc, alice.Id, a)
+
+		options, err := svc.BeginPasskeyLogin(ctx)
+		require.NoError(t, err)
+		response, err := a.Get(*options)
+		require.NoError(t, err)
+		_, err = svc.FinishPasskeyLogin(ctx, response, model.ClientInfo{})
+		require.NoError(t, err)
+
+		_, err = svc.FinishPasskeyLogin(ctx, response, model.ClientInfo{})
+		assert.ErrorIs(t, err, service.ErrInvalidToken)
+	})
+
+	t.Run("another user's registration", func(t *testing.T) {
+		options, err := svc.BeginPasskeyRegistration(ctx, alice.Id)
+		require.NoError(t, err)
+		response, err := webauthntest.New(passkeyOrigin).Create(*options)
+		require.NoError(t, err)
+
+		_, err = svc.FinishPasskeyRegistration(ctx, bob.Id, "Laptop", response)
+		assert.ErrorIs(t, err, service.ErrInvalidToken)
+	})
+}
+
+func TestFinishPasskeyRegistration_Rejects(t *testing.T) {
+	users := newMemUserStore()
+	svc := newPasskeyService(users)
+	user := users.addUser("alice@example.com")
+	ctx := context.Background()
+
+	t.Run("empty name", func(t *testing.T) {
+		options, err := svc.BeginPasskeyRegistration(ctx, user.Id)
+		require.NoError(t, err)
+		response, err := webauthntest.New(passkeyOrigin).Create(*options)
+		require.NoError(t, err)
+
+		_, err = svc.FinishPasskeyRegistration(ctx, user.Id, " ", response)
+		assert.ErrorIs(t, err, service.ErrInvalidPasskeyName)
+	})
+
+	t.Run("other origin", func(t *testing.T) {
+		options, err := svc.BeginPasskeyRegistration(ctx, user.Id)
+		require.NoError(t, err)
+		response, err := webauthntest.New("https://evil.example").Create(*options)
+		require.NoError(t, err)
+
+		_, err = svc.FinishPasskeyRegistration(ctx, user.Id, "Laptop", response)
+		assert.ErrorIs(t, err, service.ErrInvalidPasskey)
+	})
+
+	t.Run("existing passkeys are excluded", func(t *testing.T) {
+		a := webauthntest.New(passkeyOrigin)
+		registerPasskey(t, svc, user.Id, a)
+
+		options, err := svc.BeginPasskeyRegistration(ctx, user.Id)
+		require.NoError(t, err)
+		_, err = a.Create(*options)
+		assert.Error(t, err)
+	})
+}
+
+func TestPasskeysNotConfigured(t *testing.T) {
+	users := newMemUserStore()
+	svc := service.NewUserService(users, nil)
+	user := users.addUser("alice@example.com")
+
+	_, err := svc.BeginPasskeyRegistration(context.Background(), user.Id)
+	assert.ErrorIs(t, err, service.ErrPasskeysNotConfigured)
+	_, err = svc.BeginPasskeyLogin(context.Background())
+	assert.ErrorIs(t, err, service.ErrPasskeysNotConfigured)
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+)
+
+var accessRank = map[model.Access]int{
+	model.AccessViewer: 1,
+	model.AccessEditor: 2,
+	model.AccessOwner:  3,
+}
+
+// authorize is the access check behind every file and folder operation. It
+// passes when userID is ownerID or has been granted at least need on the
+// item, given by fileID or folderID, or on a folder above it. Users with no
+// access at all get model.ErrNotFound so they cannot tell the item exists;
+// users with too little get ErrForbidden.
+func (s *FileService) authorize(ctx context.Context, userID, ownerID, fileID, folderID uuid.UUID, need model.Access) error {
+	if userID == ownerID {
+		return nil
+	}
+
+	access, err := s.store.GetAccess(ctx, userID, fileID, folderID)
+	if err != nil {
+		return err
+	}
+	if access == "" {
+		return model.ErrNotFound
+	}
+	if accessRank[access] < accessRank[need] {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// file returns a file userID has at least need access to. Files in the trash
+// are not found.
+func (s *FileService) file(ctx context.Context, userID, id uuid.UUID, need model.Access) (*model.File, error) {
+	file, err := s.store.GetFile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if file.DeletedAt != nil {
+		return nil, model.ErrNotFound
+	}
+	if err := s.authorize(ctx, userID, file.UserID, file.Id, uuid.Nil, need); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// folder returns a folder userID has at least need access to. Folders in the
+// trash are not found.
+func (s *FileService) folder(ctx context.Context, userID, id uuid.UUID, need model.Access) (*model.Folder, error) {
+	folder, err := s.store.GetFolder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if folder.DeletedAt != nil {
+		return nil, model.ErrNotFound
+	}
+	if err := s.authorize(ctx, userID, folder.UserID, uuid.Nil, folder.Id, need); err != nil {
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+type GrantAccessRequest struct {
+	FileID   uuid.UUID    `json:"fileId"`
+	FolderID uuid.UUID    `json:"folderId"`
+	Email    string       `json:"email"`
+	Access   model.Access `json:"access"`
+}
+
+// GrantAccess gives the user with req.Email viewer or editor access to a file
+// or folder owned by userID. Granting access to a user who already has some
+// on the same item changes their access level.
+func (s *ShareService) GrantAccess(ctx context.Context, userID uuid.UUID, req GrantAccessRequest) (*model.Permission, error) {
+	if (req.FileID == uuid.Nil) == (req.FolderID == uuid.Nil) {
+		return nil, ErrInvalidShareTarget
+	}
+	if req.Access != model.AccessViewer && req.Access != model.AccessEditor {
+		return nil, ErrInvalidAccess
+	}
+
+	if err := s.checkOwner(ctx, userID, req.FileID, req.FolderID); err != nil {
+		return nil, err
+	}
+
+	grantee, err := s.users.GetUserByMail(ctx, strings.TrimSpace(req.Email))
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, ErrUnknownGrantee
+		}
+		return nil, err
+	}
+	if grantee.Id == userID {
+		return nil, ErrGrantToSelf
+	}
+
+	permission := &model.Permission{
+		Id:        uuid.New(),
+		UserID:    grantee.Id,
+		Email:     grantee.Email,
+		FileID:    req.FileID,
+		FolderID:  req.FolderID,
+		Access:    req.Access,
+		GrantedBy: userID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.files.store.SavePermission(ctx, permission); err != nil {
+		return nil, err
+	}
+
+	return permission, nil
+}
+
+// ListAccess returns the users a file or folder owned by userID has been
+// shared with. Exactly one of fileID and folderID is set.
+func (s *ShareService) ListAccess(ctx context.Context, userID, fileID, folderID uuid.UUID) ([]model.Permission, error) {
+	if (fileID == uuid.Nil) == (folderID == uuid.Nil) {
+		return nil, ErrInvalidShareTarget
+	}
+	if err := s.checkOwner(ctx, userID, fileID, folderID); err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.files.store.ListPermissions(ctx, fileID, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if permissions == nil {
+		permissions = []model.Permission{}
+	}
+
+	return permissions, nil
+}
+
+// RevokeAccess removes a grant. The owner of the item can revoke any grant on
+// it and the grantee can give up their own access.
+func (s *ShareService) RevokeAccess(ctx context.Context, userID, id uuid.UUID) error {
+	permission, err := s.files.store.GetPermission(ctx, id)
+	if err != nil {
+		return err
+	}
+	if permission.UserID != userID {
+		if err := s.checkOwner(ctx, userID, permission.FileID, permission.FolderID); err != nil {
+			return err
+		}
+	}
+
+	return s.files.store.DeletePermission(ctx, permission.Id)
+}
+
+// SharedWithMe lists the files and folders other users have granted userID
+// access to, newest first. Items in the trash are left out.
+func (s *ShareService) SharedWithMe(ctx context.Context, userID uuid.UUID) ([]model.SharedResource, error) {
+	permissions, err := s.files.store.ListUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := []model.SharedResource{}
+	for _, permission := range permissions {
+		resource := model.SharedResource{
+			PermissionID: permission.Id,
+			Access:       permission.Access,
+			SharedAt:     permission.CreatedAt,
+		}
+		if permission.FileID != uuid.Nil {
+			resource.File, err = s.files.GetFile(ctx, userID, permission.FileID)
+		} else {
+			resource.Folder, err = s.files.GetFolder(ctx, userID, permission.FolderID)
+		}
+		if errors.Is(err, model.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		shared = append(shared, resource)
+	}
+
+	return shared, nil
+}
+
+// checkOwner verifies that userID owns the file or folder given by fileID or
+// folderID.
+func (s *ShareService) checkOwner(ctx context.Context, userID, fileID, folderID uuid.UUID) error {
+	var err error
+	if fileID != uuid.Nil {
+		_, err = s.files.file(ctx, userID, fileID, model.AccessOwner)
+	} else {
+		_, err = s.files.folder(ctx, userID, folderID, model.AccessOwner)
+	}
+	return err
+}
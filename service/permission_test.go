@@ -0,0 +1,206 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *memFileStore) SavePermission(ctx context.Context, permission *model.Permission) error {
+	for id, grant := range m.grants {
+		if grant.UserID == permission.UserID && grant.FileID == permission.FileID && grant.FolderID == permission.FolderID {
+			permission.Id, permission.CreatedAt = id, grant.CreatedAt
+		}
+	}
+	m.grants[permission.Id] = *permission
+	return nil
+}
+
+func (m *memFileStore) GetPermission(ctx context.Context, id uuid.UUID) (model.Permission, error) {
+	grant, ok := m.grants[id]
+	if !ok {
+		return model.Permission{}, model.ErrNotFound
+	}
+	return grant, nil
+}
+
+func (m *memFileStore) ListPermissions(ctx context.Context, fileID, folderID uuid.UUID) ([]model.Permission, error) {
+	var grants []model.Permission
+	for _, grant := range m.grants {
+		if grant.FileID == fileID && grant.FolderID == folderID {
+			grants = append(grants, grant)
+		}
+	}
+	return grants, nil
+}
+
+func (m *memFileStore) ListUserPermissions(ctx context.Context, userID uuid.UUID) ([]model.Permission, error) {
+	var grants []model.Permission
+	for _, grant := range m.grants {
+		if grant.UserID == userID {
+			grants = append(grants, grant)
+		}
+	}
+	return grants, nil
+}
+
+func (m *memFileStore) DeletePermission(ctx context.Context, id uuid.UUID) error {
+	if _, ok := m.grants[id]; !ok {
+		return model.ErrNotFound
+	}
+	delete(m.grants, id)
+	return nil
+}
+
+func (m *memFileStore) GetAccess(ctx context.Context, userID, fileID, folderID uuid.UUID) (model.Access, error) {
+	chain := map[uuid.UUID]bool{}
+	if fileID != uuid.Nil {
+		folderID = m.files[fileID].FolderID
+	}
+	for id := folderID; id != uuid.Nil; id = m.folders[id].ParentID {
+		chain[id] = true
+	}
+
+	var access model.Access
+	for _, grant := range m.grants {
+		if grant.UserID != userID {
+			continue
+		}
+		if (fileID != uuid.Nil && grant.FileID == fileID) || chain[grant.FolderID] {
+			if access != model.AccessEditor {
+				access = grant.Access
+			}
+		}
+	}
+	return access, nil
+}
+
+func TestShareService_GrantAccess(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	owner := users.addUser("owner@example.com")
+	bob := users.addUser("bob@example.com")
+	stranger := users.addUser("eve@example.com")
+
+	blobs := newMemBlobStore()
+	files := newMemFileStore()
+	fs := service.NewFileService(files, blobs)
+	svc := service.NewShareService(newMemShareStore(), users, fs)
+
+	docs := files.addFolder(owner.Id, uuid.Nil, "docs")
+	work := files.addFolder(owner.Id, docs.Id, "work")
+	report := files.addFile(blobs, owner.Id, work.Id, "report.txt", []byte("q3"))
+
+	_, err := svc.GrantAccess(ctx, owner.Id, service.GrantAccessRequest{FolderID: docs.Id, Email: "nobody@example.com", Access: model.AccessViewer})
+	assert.ErrorIs(t, err, service.ErrUnknownGrantee)
+	_, err = svc.GrantAccess(ctx, owner.Id, service.GrantAccessRequest{FolderID: docs.Id, Email: owner.Email, Access: model.AccessViewer})
+	assert.ErrorIs(t, err, service.ErrGrantToSelf)
+	_, err = svc.GrantAccess(ctx, owner.Id, service.GrantAccessRequest{FolderID: docs.Id, Email: bob.Email, Access: model.AccessOwner})
+	assert.ErrorIs(t, err, service.ErrInvalidAccess)
+	_, err = svc.GrantAccess(ctx, bob.Id, service.GrantAccessRequest{FolderID: docs.Id, Email: stranger.Email, Access: model.AccessViewer})
+	assert.ErrorIs(t, err, model.ErrNotFound, "only the owner can share")
+
+	viewer, err := svc.GrantAccess(ctx, owner.Id, service.GrantAccessRequest{FolderID: docs.Id, Email: "BOB@example.com", Access: model.AccessViewer})
+	require.NoError(t, err)
+	assert.Equal(t, bob.Id, viewer.UserID)
+
+	// access to docs extends to everything below it
+	got, err := fs.GetFile(ctx, bob.Id, report.Id)
+	require.NoError(t, err)
+	assert.Equal(t, report.Id, got.Id)
+	_, err = fs.GetFile(ctx, stranger.Id, report.Id)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	_, err = fs.RenameFile(ctx, bob.Id, report.Id, "renamed.txt", model.ConflictFail)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+	assert.ErrorIs(t, fs.DeleteFolder(ctx, bob.Id, work.Id), service.ErrForbidden)
+	_, err = svc.GrantAccess(ctx, bob.Id, service.GrantAccessRequest{FolderID: work.Id, Email: stranger.Email, Access: model.AccessViewer})
+	assert.ErrorIs(t, err, service.ErrForbidden)
+
+	editor, err := svc.GrantAccess(ctx, owner.Id, service.GrantAccessRequest{FolderID: docs.Id, Email: bob.Email, Access: model.AccessEditor})
+	require.NoError(t, err)
+	assert.Equal(t, viewer.Id, editor.Id, "granting again changes the existing access")
+
+	renamed, err := fs.RenameFile(ctx, bob.Id, report.Id, "renamed.txt", model.ConflictFail)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed.txt", renamed.Name)
+
+	upload, err := fs.SaveFile(ctx, &model.File{Name: "notes.txt", UserID: bob.Id, FolderID: work.Id, Size: 2}, bytes.NewReader([]byte("hi")), model.ConflictFail)
+	require.NoError(t, err)
+	assert.Equal(t, owner.Id, upload.UserID, "files added to a shared folder belong to its owner")
+
+	_, err = fs.MoveFile(ctx, bob.Id, report.Id, uuid.Nil, model.ConflictFail)
+	assert.ErrorIs(t, err, service.ErrMoveAcrossOwners)
+
+	path, err := fs.GetFolderPath(ctx, bob.Id, work.Id)
+	require.NoError(t, err)
+	require.Len(t, path, 2)
+	assert.Equal(t, docs.Id, path[0].Id)
+
+	permissions, err := svc.ListAccess(ctx, owner.Id, uuid.Nil, docs.Id)
+	require.NoError(t, err)
+	require.Len(t, permissions, 1)
+	assert.Equal(t, model.AccessEditor, permissions[0].Access)
+	_, err = svc.ListAccess(ctx, bob.Id, uuid.Nil, docs.Id)
+	assert.ErrorIs(t, err, service.ErrForbidden)
+}
+
+func TestShareService_SharedWithMe(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	owner := users.addUser("owner@example.com")
+	bob := users.addUser("bob@example.com")
+
+	blobs := newMemBlobStore()
+	files := newMemFileStore()
+	fs := service.NewFileService(files, blobs)
+	svc := service.NewShareService(newMemShareStore(), users, fs)
+
+	photos := files.addFolder(owner.Id, uuid.Nil, "photos")
+	draft := files.addFile(blobs, owner.Id, uuid.Nil, "draft.txt", []byte("draft"))
+	old := files.addFile(blobs, owner.Id, uuid.Nil, "old.txt", []byte("old"))
+
+	folderGrant, err := svc.GrantAccess(ctx, owner.Id, service.GrantAccessRequest{FolderID: photos.Id, Email: bob.Email, Access: model.AccessEditor})
+	require.NoError(t, err)
+	fileGrant, err := svc.GrantAccess(ctx, owner.Id, service.GrantAccessRequest{FileID: draft.Id, Email: bob.Email, Access: model.AccessViewer})
+	require.NoError(t, err)
+	_, err = svc.GrantAccess(ctx, owner.Id, service.GrantAccessRequest{FileID: old.Id, Email: bob.Email, Access: model.AccessViewer})
+	require.NoError(t, err)
+	require.NoError(t, fs.DeleteFile(ctx, owner.Id, old.Id))
+
+	shared, err := svc.SharedWithMe(ctx, bob.Id)
+	require.NoError(t, err)
+	require.Len(t, shared, 2, "items in the trash are left out")
+	for _, item := range shared {
+		switch item.PermissionID {
+		case folderGrant.Id:
+			require.NotNil(t, item.Folder)
+			assert.Equal(t, photos.Id, item.Folder.Id)
+			assert.Equal(t, model.AccessEditor, item.Access)
+		case fileGrant.Id:
+			require.NotNil(t, item.File)
+			assert.Equal(t, draft.Id, item.File.Id)
+		default:
+			t.Fatalf("unexpected shared item %v", item.PermissionID)
+		}
+	}
+
+	// the grantee can give up their own access, but nobody else's
+	assert.ErrorIs(t, svc.RevokeAccess(ctx, uuid.New(), fileGrant.Id), model.ErrNotFound)
+	require.NoError(t, svc.RevokeAccess(ctx, bob.Id, fileGrant.Id))
+	_, err = fs.GetFile(ctx, bob.Id, draft.Id)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	require.NoError(t, svc.RevokeAccess(ctx, owner.Id, folderGrant.Id))
+	shared, err = svc.SharedWithMe(ctx, bob.Id)
+	require.NoError(t, err)
+	assert.Empty(t, shared)
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+)
+
+// DefaultStorageQuota is the storage limit of users who have no quota of
+// their own.
+const DefaultStorageQuota int64 = 15 << 30
+
+// SetDefaultQuota changes the storage limit of users who have no quota of
+// their own. A limit of 0 means unlimited.
+func (s *FileService) SetDefaultQuota(limit int64) {
+	s.defaultQuota = limit
+}
+
+// SetUserQuota gives a user a storage limit of their own, overriding the
+// default. A limit of 0 means unlimited; nil removes the user's own limit so
+// the default applies again. It returns the user's usage under the new limit.
+func (s *FileService) SetUserQuota(ctx context.Context, userID uuid.UUID, limit *int64) (model.StorageUsage, error) {
+	if limit != nil && *limit < 0 {
+		return model.StorageUsage{}, ErrInvalidQuota
+	}
+
+	if err := s.store.SetQuota(ctx, userID, limit); err != nil {
+		return model.StorageUsage{}, err
+	}
+
+	return s.GetUsage(ctx, userID)
+}
+
+// GetUsage reports how much storage a user has used and their limit.
+func (s *FileService) GetUsage(ctx context.Context, userID uuid.UUID) (model.StorageUsage, error) {
+	used, limit, err := s.quota(ctx, userID)
+	if err != nil {
+		return model.StorageUsage{}, err
+	}
+
+	byType, err := s.store.GetUsageByType(ctx, userID)
+	if err != nil {
+		return model.StorageUsage{}, err
+	}
+	if byType == nil {
+		byType = []model.TypeUsage{}
+	}
+
+	return model.StorageUsage{Used: used, Limit: limit, ByType: byType}, nil
+}
+
+// quota returns the bytes a user has stored and the limit that applies to
+// them, 0 meaning unlimited.
+func (s *FileService) quota(ctx context.Context, userID uuid.UUID) (int64, int64, error) {
+	used, limit, err := s.store.GetQuota(ctx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if limit == nil {
+		return used, s.defaultQuota, nil
+	}
+	return used, *limit, nil
+}
+
+// remainingQuota returns how many more bytes a user may store.
+func (s *FileService) remainingQuota(ctx context.Context, userID uuid.UUID) (int64, error) {
+	used, limit, err := s.quota(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if limit == 0 {
+		return math.MaxInt64, nil
+	}
+	return max(limit-used, 0), nil
+}
+
+// quotaReservationTTL is how long bytes stay reserved for a write that
+// never finishes, such as one an instance crashed during. It must outlast the
+// slowest write of a whole file.
+const quotaReservationTTL = 6 * time.Hour
+
+// quotaReservationStep is how many bytes at a time are reserved for a body
+// longer than announced, so that it does not reserve on every read.
+const quotaReservationStep = 8 << 20
+
+// putBlob writes r to blob storage under key on behalf of userID and
+// returns the number of bytes written. size is the expected length; it is
+// reserved in the user's quota up front, and bytes read beyond it are
+// reserved as they stream in, so a body longer than announced cannot exceed
+// the quota either. Reserving is atomic, so concurrent writes cannot
+// together exceed it. The returned reservation must be released with
+// releaseQuota once the bytes are recorded in a file version.
+func (s *FileService) putBlob(ctx context.Context, userID uuid.UUID, key string, r io.Reader, size int64, mimeType string) (int64, uuid.UUID, error) {
+	reservation := uuid.New()
+	size = max(size, 0)
+	if err := s.reserveQuota(ctx, userID, reservation, size); err != nil {
+		return 0, uuid.Nil, err
+	}
+
+	reader := &quotaReader{ctx: ctx, files: s, userID: userID, reservation: reservation, r: r, reserved: size}
+	err := s.blobs.Put(ctx, key, reader, size, mimeType)
+	if err == nil && reader.exceeded {
+		err = ErrQuotaExceeded
+	}
+	if err != nil {
+		s.releaseQuota(ctx, reservation)
+		if reader.exceeded {
+			s.deleteBlob(ctx, key)
+			return 0, uuid.Nil, ErrQuotaExceeded
+		}
+		return 0, uuid.Nil, err
+	}
+
+	return reader.n, reservation, nil
+}
+
+// reserveQuota sets bytes aside in userID's quota under the reservation id,
+// failing with ErrQuotaExceeded if they do not fit.
+func (s *FileService) reserveQuota(ctx context.Context, userID, id uuid.UUID, bytes int64) error {
+	ok, err := s.store.ReserveQuota(ctx, &model.QuotaReservation{
+		Id:        id,
+		UserID:    userID,
+		Bytes:     bytes,
+		ExpiresAt: time.Now().UTC().Add(quotaReservationTTL),
+	}, s.defaultQuota)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// releaseQuota gives back the bytes of a reservation. A reservation that
+// cannot be released lapses on its own.
+func (s *FileService) releaseQuota(ctx context.Context, id uuid.UUID) {
+	if err := s.store.ReleaseQuota(context.WithoutCancel(ctx), id); err != nil {
+		slog.Error("failed to release quota reservation", "reservation", id, "error", err)
+	}
+}
+
+// quotaReader reserves quota for bytes read beyond those reserved up front,
+// failing with ErrQuotaExceeded once they do not fit.
+type quotaReader struct {
+	ctx         context.Context
+	files       *FileService
+	userID      uuid.UUID
+	reservation uuid.UUID
+
+	r        io.Reader
+	reserved int64
+	n        int64
+	exceeded bool
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.n += int64(n)
+	if q.n > q.reserved {
+		if err := q.grow(q.n - q.reserved); err != nil {
+			q.exceeded = errors.Is(err, ErrQuotaExceeded)
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// grow reserves at least need more bytes, a whole step if that fits.
+func (q *quotaReader) grow(need int64) error {
+	if step := max(need, quotaReservationStep); step > need {
+		err := q.files.reserveQuota(q.ctx, q.userID, q.reservation, step)
+		if err == nil {
+			q.reserved += step
+			return nil
+		}
+		if !errors.Is(err, ErrQuotaExceeded) {
+			return err
+		}
+	}
+
+	if err := q.files.reserveQuota(q.ctx, q.userID, q.reservation, need); err != nil {
+		return err
+	}
+	q.reserved += need
+	return nil
+}
@@ -0,0 +1,239 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *memFileStore) GetQuota(ctx context.Context, userID uuid.UUID) (int64, *int64, error) {
+	var used int64
+	for id, file := range m.files {
+		if file.UserID == userID {
+			for _, version := range m.versions[id] {
+				used += version.Size
+			}
+		}
+	}
+	if limit, ok := m.quotas[userID]; ok {
+		return used, &limit, nil
+	}
+	return used, nil, nil
+}
+
+func (m *memFileStore) SetQuota(ctx context.Context, userID uuid.UUID, limit *int64) error {
+	if limit == nil {
+		delete(m.quotas, userID)
+	} else {
+		m.quotas[userID] = *limit
+	}
+	return nil
+}
+
+func (m *memFileStore) ReserveQuota(ctx context.Context, r *model.QuotaReservation, defaultLimit int64) (bool, error) {
+	used, limit, _ := m.GetQuota(ctx, r.UserID)
+	if limit == nil {
+		limit = &defaultLimit
+	}
+	for _, other := range m.reserved {
+		if other.UserID == r.UserID {
+			used += other.Bytes
+		}
+	}
+	if r.Bytes > 0 && *limit > 0 && used+r.Bytes > *limit {
+		return false, nil
+	}
+
+	reservation := *r
+	reservation.Bytes += m.reserved[r.Id].Bytes
+	m.reserved[r.Id] = reservation
+	return true, nil
+}
+
+func (m *memFileStore) ReleaseQuota(ctx context.Context, id uuid.UUID) error {
+	delete(m.reserved, id)
+	return nil
+}
+
+func (m *memFileStore) GetUsageByType(ctx context.Context, userID uuid.UUID) ([]model.TypeUsage, error) {
+	byType := make(map[string]*model.TypeUsage)
+	for id, file := range m.files {
+		if file.UserID != userID {
+			continue
+		}
+		counted := make(map[string]bool)
+		for _, version := range m.versions[id] {
+			usage, ok := byType[version.MimeType]
+			if !ok {
+				usage = &model.TypeUsage{MimeType: version.MimeType}
+				byType[version.MimeType] = usage
+			}
+			if !counted[version.MimeType] {
+				usage.Files++
+				counted[version.MimeType] = true
+			}
+			usage.Bytes += version.Size
+		}
+	}
+
+	var usage []model.TypeUsage
+	for _, u := range byType {
+		usage = append(usage, *u)
+	}
+	slices.SortFunc(usage, func(a, b model.TypeUsage) int { return int(b.Bytes - a.Bytes) })
+	return usage, nil
+}
+
+func TestFileService_Quota(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	store := newMemFileStore()
+	store.quotas[userID] = 10
+	fs := service.NewFileService(store, blobs)
+
+	save := func(name, content string, size int64) (*model.File, error) {
+		return fs.SaveFile(ctx, &model.File{
+			Name:     name,
+			UserID:   userID,
+			MimeType: "text/plain",
+			Size:     size,
+		}, strings.NewReader(content), model.ConflictFail)
+	}
+
+	_, err := save("a.txt", "123456", 6)
+	require.NoError(t, err)
+
+	_, err = save("b.txt", "12345", 5)
+	assert.ErrorIs(t, err, service.ErrQuotaExceeded, "declared size over the quota")
+
+	_, err = save("c.txt", "12345", 1)
+	assert.ErrorIs(t, err, service.ErrQuotaExceeded, "body longer than declared")
+
+	objects, err := blobs.List(ctx, userID.String()+"/")
+	require.NoError(t, err)
+	assert.Len(t, objects, 1, "rejected uploads should not leave blobs behind")
+
+	file, err := save("d.txt", "1234", 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), file.Size)
+
+	_, err = fs.SaveVersion(ctx, userID, file.Id, strings.NewReader("x"), 1, "")
+	assert.ErrorIs(t, err, service.ErrQuotaExceeded, "old versions count towards the quota")
+
+	usage, err := fs.GetUsage(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), usage.Used)
+	assert.Equal(t, int64(10), usage.Limit)
+	assert.Equal(t, []model.TypeUsage{{MimeType: "text/plain", Files: 2, Bytes: 10}}, usage.ByType)
+
+	fs.SetDefaultQuota(0)
+	usage, err = fs.GetUsage(ctx, uuid.New())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), usage.Limit, "no default quota")
+	assert.Empty(t, usage.ByType)
+}
+
+func TestFileService_SetUserQuota(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+
+	store := newMemFileStore()
+	fs := service.NewFileService(store, newMemBlobStore())
+	fs.SetDefaultQuota(10)
+
+	save := func(userID uuid.UUID, name string) error {
+		_, err := fs.SaveFile(ctx, &model.File{
+			Name:     name,
+			UserID:   userID,
+			MimeType: "text/plain",
+			Size:     20,
+		}, strings.NewReader(strings.Repeat("x", 20)), model.ConflictFail)
+		return err
+	}
+
+	limit := func(bytes int64) *int64 { return &bytes }
+
+	_, err := fs.SetUserQuota(ctx, alice, limit(-1))
+	assert.ErrorIs(t, err, service.ErrInvalidQuota)
+
+	usage, err := fs.SetUserQuota(ctx, alice, limit(30))
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), usage.Limit)
+
+	require.NoError(t, save(alice, "a.txt"), "the user's own limit overrides the default")
+	assert.ErrorIs(t, save(bob, "b.txt"), service.ErrQuotaExceeded, "others keep the default")
+	assert.ErrorIs(t, save(alice, "c.txt"), service.ErrQuotaExceeded, "the user's own limit is enforced")
+
+	_, err = fs.SetUserQuota(ctx, alice, limit(0))
+	require.NoError(t, err)
+	require.NoError(t, save(alice, "c.txt"), "a limit of 0 is unlimited")
+
+	usage, err = fs.SetUserQuota(ctx, alice, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), usage.Limit, "clearing the limit restores the default")
+	assert.ErrorIs(t, save(alice, "d.txt"), service.ErrQuotaExceeded)
+}
+
+func TestFileService_ConcurrentQuota(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	store := newMemFileStore()
+	store.quotas[userID] = 10
+	fs := service.NewFileService(store, newMemBlobStore())
+
+	save := func(name string, r io.Reader, size int64) error {
+		_, err := fs.SaveFile(ctx, &model.File{
+			Name:     name,
+			UserID:   userID,
+			MimeType: "text/plain",
+			Size:     size,
+		}, r, model.ConflictFail)
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() { done <- save("a.txt", pr, 6) }()
+
+	// The first write is being read, so its bytes are reserved.
+	_, err := pw.Write([]byte("123"))
+	require.NoError(t, err)
+
+	err = save("b.txt", strings.NewReader("12345"), 5)
+	assert.ErrorIs(t, err, service.ErrQuotaExceeded, "bytes reserved by a write in progress count towards the quota")
+
+	pw.CloseWithError(errors.New("connection reset"))
+	require.Error(t, <-done)
+	assert.Empty(t, store.reserved, "a failed write should release its reservation")
+
+	require.NoError(t, save("b.txt", strings.NewReader("12345"), 5))
+	assert.Empty(t, store.reserved, "a stored file should release its reservation")
+}
+
+func TestUploadService_Quota(t *testing.T) {
+	svc, _, files, _ := newTestUploadService()
+	ctx := context.Background()
+	userID := uuid.New()
+	files.quotas[userID] = 100
+
+	_, _, err := svc.CreateUpload(ctx, userID, service.CreateUploadRequest{Name: "a.bin", Size: 60})
+	require.NoError(t, err)
+
+	_, _, err = svc.CreateUpload(ctx, userID, service.CreateUploadRequest{Name: "b.bin", Size: 60})
+	assert.ErrorIs(t, err, service.ErrQuotaExceeded, "unfinished uploads reserve their size")
+
+	_, _, err = svc.CreateUpload(ctx, userID, service.CreateUploadRequest{Name: "c.bin", Size: 40})
+	assert.NoError(t, err)
+}
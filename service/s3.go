@@ -0,0 +1,526 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/freekobie/kora/model"
+)
+
+const (
+	defaultS3PartSize = 16 << 20
+	maxS3Parts        = 10000
+	emptyPayloadHash  = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Config holds the settings for an S3-compatible object store.
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.us-east-1.amazonaws.com
+	// or http://localhost:9000 for MinIO.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses objects as <endpoint>/<bucket>/<key> instead of
+	// <bucket>.<endpoint host>/<key>. Most self-hosted stores need this.
+	PathStyle bool
+	// PartSize is the multipart chunk size. Objects smaller than one part are
+	// uploaded with a single PUT. S3 requires at least 5 MiB per part.
+	PartSize int64
+}
+
+// S3 is a model.BlobStore that speaks the S3 REST API with SigV4 signing.
+type S3 struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3 creates a new S3 service.
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("s3 bucket name is required")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, errors.New("s3 credentials are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = defaultS3PartSize
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", config.Endpoint)
+	}
+
+	return &S3{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{},
+	}, nil
+}
+
+// Put uploads an object. Objects larger than one part are sent as a
+// multipart upload, which is aborted if any part fails or r does not hold
+// exactly size bytes.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	partSize := s.config.PartSize
+	if size > 0 && size/partSize >= maxS3Parts {
+		partSize = size/(maxS3Parts-1) + 1
+	}
+
+	// avoid allocating a whole part for small objects of known size
+	firstSize := partSize
+	if size >= 0 && size < partSize {
+		firstSize = size + 1
+	}
+
+	first := make([]byte, firstSize)
+	n, err := io.ReadFull(r, first)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		if size >= 0 && int64(n) != size {
+			return fmt.Errorf("failed to read object data: expected %d bytes but received %d", size, n)
+		}
+		return s.putObject(ctx, key, first[:n], contentType)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read object data: %w", err)
+	}
+	if size >= 0 && size < partSize {
+		return fmt.Errorf("failed to read object data: expected %d bytes but received more", size)
+	}
+
+	return s.putMultipart(ctx, key, io.MultiReader(bytes.NewReader(first), r), size, partSize, contentType)
+}
+
+func (s *S3) putObject(ctx context.Context, key string, data []byte, contentType string) error {
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	res, err := s.do(ctx, http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return fmt.Errorf("failed to put s3 object: %w", err)
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+type s3InitiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompletePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteUpload struct {
+	XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletePart `xml:"Part"`
+}
+
+func (s *S3) putMultipart(ctx context.Context, key string, r io.Reader, size, partSize int64, contentType string) error {
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	res, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	var initiated s3InitiateResult
+	err = xml.NewDecoder(res.Body).Decode(&initiated)
+	res.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode multipart upload response: %w", err)
+	}
+
+	parts, sent, err := s.uploadParts(ctx, key, initiated.UploadID, r, partSize)
+	if err == nil && size >= 0 && sent != size {
+		err = fmt.Errorf("failed to read object data: expected %d bytes but received %d", size, sent)
+	}
+	if err != nil {
+		abort := url.Values{"uploadId": {initiated.UploadID}}
+		if res, abortErr := s.do(context.WithoutCancel(ctx), http.MethodDelete, key, abort, nil, nil); abortErr == nil {
+			res.Body.Close()
+		}
+		return err
+	}
+
+	body, err := xml.Marshal(s3CompleteUpload{Parts: parts})
+	if err != nil {
+		return fmt.Errorf("failed to encode multipart completion: %w", err)
+	}
+
+	res, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, nil, body)
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	defer res.Body.Close()
+
+	// S3 can report a failed completion with a 200 status and an error body.
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.NewDecoder(res.Body).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+		return fmt.Errorf("failed to complete multipart upload: %s: %s", result.Code, result.Message)
+	}
+
+	return nil
+}
+
+// uploadParts sends r in parts and returns them along with the number of
+// bytes sent.
+func (s *S3) uploadParts(ctx context.Context, key, uploadID string, r io.Reader, partSize int64) ([]s3CompletePart, int64, error) {
+	var parts []s3CompletePart
+	var sent int64
+	buf := make([]byte, partSize)
+
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(r, buf)
+		if n == 0 && errors.Is(err, io.EOF) {
+			return parts, sent, nil
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, fmt.Errorf("failed to read object data: %w", err)
+		}
+
+		query := url.Values{
+			"partNumber": {strconv.Itoa(number)},
+			"uploadId":   {uploadID},
+		}
+		res, err := s.do(ctx, http.MethodPut, key, query, nil, buf[:n])
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to upload part %d: %w", number, err)
+		}
+		res.Body.Close()
+		parts = append(parts, s3CompletePart{PartNumber: number, ETag: res.Header.Get("ETag")})
+		sent += int64(n)
+	}
+}
+
+// Get opens a reader over a range of an object. Reading from the end of an
+// object gives no data; starting past its end is an error.
+func (s *S3) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	header := make(http.Header)
+	switch {
+	case length > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := s.do(ctx, http.MethodGet, key, nil, header, nil)
+	if err != nil {
+		var s3Err *s3Error
+		if errors.As(err, &s3Err) && s3Err.Status == http.StatusRequestedRangeNotSatisfiable {
+			// S3 rejects any range starting at the end, which is empty
+			info, statErr := s.Stat(ctx, key)
+			if statErr != nil {
+				return nil, statErr
+			}
+			if offset == info.Size {
+				return io.NopCloser(bytes.NewReader(nil)), nil
+			}
+			return nil, fmt.Errorf("offset %d is past the end of the %d byte object: %w", offset, info.Size, err)
+		}
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// Stat returns the attributes of an object.
+func (s *S3) Stat(ctx context.Context, key string) (model.BlobInfo, error) {
+	res, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return model.BlobInfo{}, err
+	}
+	res.Body.Close()
+
+	modified, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+
+	return model.BlobInfo{
+		Key:          key,
+		Size:         res.ContentLength,
+		ContentType:  res.Header.Get("Content-Type"),
+		ETag:         strings.Trim(res.Header.Get("ETag"), `"`),
+		LastModified: modified,
+	}, nil
+}
+
+// Delete removes an object. S3 reports success for missing keys, so the
+// object is checked first to keep the model.BlobStore contract.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if _, err := s.Stat(ctx, key); err != nil {
+		return err
+	}
+
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete s3 object: %w", err)
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		ETag         string    `xml:"ETag"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns all objects whose key starts with prefix.
+func (s *S3) List(ctx context.Context, prefix string) ([]model.BlobInfo, error) {
+	var blobs []model.BlobInfo
+	token := ""
+
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		res, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3 objects: %w", err)
+		}
+		var page s3ListResult
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode s3 object list: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			blobs = append(blobs, model.BlobInfo{
+				Key:          obj.Key,
+				Size:         obj.Size,
+				ETag:         strings.Trim(obj.ETag, `"`),
+				LastModified: obj.LastModified,
+			})
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return blobs, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// s3Error is an error response returned by the object store.
+type s3Error struct {
+	Status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 request failed with status %d", e.Status)
+	}
+	return fmt.Sprintf("s3 request failed with status %d: %s: %s", e.Status, e.Code, e.Message)
+}
+
+// do sends a signed request for key and returns the response when it has a
+// 2xx status. Missing objects are reported as model.ErrNotFound.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key)
+	u.RawQuery = s3EncodeQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	signS3Request(req, body, s.config.AccessKey, s.config.SecretKey, s.config.Region, time.Now())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	s3Err := &s3Error{Status: res.StatusCode}
+	_ = xml.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(s3Err)
+	if res.StatusCode == http.StatusNotFound && (s3Err.Code == "" || s3Err.Code == "NoSuchKey") {
+		return nil, model.ErrNotFound
+	}
+
+	return nil, s3Err
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+
+	if s.config.PathStyle {
+		u.Path = base + "/" + s.config.Bucket + "/" + key
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = base + "/" + key
+	}
+	u.RawPath = s3EncodePath(u.Path)
+
+	return &u
+}
+
+// signS3Request adds AWS Signature Version 4 headers to req.
+func signS3Request(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3EncodeQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EncodeQuery builds a canonical query string: keys sorted and every
+// reserved character percent-encoded.
+func s3EncodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func s3EncodePath(path string) string {
+	return s3Escape(path, false)
+}
+
+// s3Escape percent-encodes everything except unreserved characters and,
+// when encodeSlash is false, forward slashes.
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,287 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is a minimal in-process S3 server supporting the calls made by
+// service.S3 with path-style addressing.
+type fakeS3 struct {
+	mu       sync.Mutex
+	bucket   string
+	objects  map[string][]byte
+	types    map[string]string
+	uploads  map[string]map[int][]byte
+	aborted  int
+	failPart int
+	requests int
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		bucket:  bucket,
+		objects: make(map[string][]byte),
+		types:   make(map[string]string),
+		uploads: make(map[string]map[int][]byte),
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != f.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<Error><Code>NoSuchBucket</Code></Error>")
+		return
+	}
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, query.Get("prefix"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = make(map[int][]byte)
+		f.types[key] = r.Header.Get("Content-Type")
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		if number == f.failPart {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.uploads[query.Get("uploadId")][number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		_ = xml.Unmarshal(body, &complete)
+		parts := f.uploads[query.Get("uploadId")]
+		var data []byte
+		for _, p := range complete.Parts {
+			data = append(data, parts[p.PartNumber]...)
+		}
+		f.objects[key] = data
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		f.aborted++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+		f.types[key] = r.Header.Get("Content-Type")
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+			}
+			return
+		}
+		w.Header().Set("Content-Type", f.types[key])
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	fmt.Fprint(w, "<ListBucketResult><IsTruncated>false</IsTruncated>")
+	for _, key := range keys {
+		fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><ETag>&quot;etag&quot;</ETag><LastModified>2024-01-01T00:00:00.000Z</LastModified></Contents>", key, len(f.objects[key]))
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+func newTestS3(t *testing.T, endpoint string, partSize int64) *service.S3 {
+	store, err := service.NewS3(service.S3Config{
+		Endpoint:  endpoint,
+		Bucket:    "kora",
+		AccessKey: "test-key",
+		SecretKey: "test-secret",
+		PathStyle: true,
+		PartSize:  partSize,
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func TestS3_PutGet(t *testing.T) {
+	fake, srv := newFakeS3(t, "kora")
+	store := newTestS3(t, srv.URL, 1024)
+	ctx := context.Background()
+
+	small := []byte("hello s3")
+	large := bytes.Repeat([]byte("0123456789"), 350)
+
+	tests := []struct {
+		name      string
+		key       string
+		data      []byte
+		size      int64
+		multipart bool
+	}{
+		{name: "single put", key: "user/small file.txt", data: small, size: int64(len(small))},
+		{name: "multipart with known size", key: "user/large", data: large, size: int64(len(large)), multipart: true},
+		{name: "multipart with unknown size", key: "user/stream", data: large, size: -1, multipart: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := fake.requests
+			require.NoError(t, store.Put(ctx, tt.key, bytes.NewReader(tt.data), tt.size, "text/plain"))
+			if tt.multipart {
+				assert.Greater(t, fake.requests-before, 2)
+			} else {
+				assert.Equal(t, 1, fake.requests-before)
+			}
+			assert.Equal(t, tt.data, fake.objects[tt.key])
+
+			rc, err := store.Get(ctx, tt.key, 2, 5)
+			require.NoError(t, err)
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			require.NoError(t, err)
+			assert.Equal(t, tt.data[2:7], got)
+
+			info, err := store.Stat(ctx, tt.key)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(tt.data)), info.Size)
+			assert.Equal(t, "text/plain", info.ContentType)
+			assert.Equal(t, "etag", info.ETag)
+		})
+	}
+}
+
+func TestS3_GetPastEnd(t *testing.T) {
+	_, srv := newFakeS3(t, "kora")
+	store := newTestS3(t, srv.URL, 1024)
+	ctx := context.Background()
+	require.NoError(t, store.Put(ctx, "user/file", strings.NewReader("hello"), 5, ""))
+
+	rc, err := store.Get(ctx, "user/file", 5, -1)
+	require.NoError(t, err, "reading from the end gives no data")
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	_, err = store.Get(ctx, "user/file", 6, -1)
+	assert.Error(t, err, "reading past the end is an error")
+	_, err = store.Get(ctx, "user/file", 6, 10)
+	assert.Error(t, err, "reading past the end is an error")
+}
+
+func TestS3_PutSizeMismatch(t *testing.T) {
+	fake, srv := newFakeS3(t, "kora")
+	store := newTestS3(t, srv.URL, 1024)
+	large := make([]byte, 3000)
+
+	tests := []struct {
+		name string
+		data []byte
+		size int64
+	}{
+		{name: "short single put", data: []byte("hello"), size: 6},
+		{name: "long single put", data: []byte("hello"), size: 4},
+		{name: "short multipart", data: large, size: 3001},
+		{name: "long multipart", data: large, size: 2999},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := "user/" + tt.name
+			err := store.Put(context.Background(), key, bytes.NewReader(tt.data), tt.size, "")
+			assert.Error(t, err)
+			assert.NotContains(t, fake.objects, key)
+		})
+	}
+	assert.Equal(t, 2, fake.aborted, "multipart uploads of the wrong size are aborted")
+}
+
+func TestS3_MultipartAbort(t *testing.T) {
+	fake, srv := newFakeS3(t, "kora")
+	fake.failPart = 2
+	store := newTestS3(t, srv.URL, 1024)
+
+	err := store.Put(context.Background(), "user/broken", bytes.NewReader(make([]byte, 4096)), 4096, "")
+	assert.Error(t, err)
+	assert.Equal(t, 1, fake.aborted)
+	assert.NotContains(t, fake.objects, "user/broken")
+}
+
+func TestS3_DeleteAndList(t *testing.T) {
+	_, srv := newFakeS3(t, "kora")
+	store := newTestS3(t, srv.URL, 1024)
+	ctx := context.Background()
+
+	for _, key := range []string{"alice/1", "alice/2", "bob/1"} {
+		require.NoError(t, store.Put(ctx, key, strings.NewReader(key), -1, ""))
+	}
+
+	blobs, err := store.List(ctx, "alice/")
+	require.NoError(t, err)
+	require.Len(t, blobs, 2)
+	assert.Equal(t, "alice/1", blobs[0].Key)
+	assert.Equal(t, "etag", blobs[0].ETag)
+
+	require.NoError(t, store.Delete(ctx, "alice/1"))
+	assert.ErrorIs(t, store.Delete(ctx, "alice/1"), model.ErrNotFound)
+
+	_, err = store.Get(ctx, "alice/1", 0, -1)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ShareService manages public share links and access granted to other
+// users. Visitors identify a link by its token; everything they can reach is
+// resolved through FileService on behalf of the link's owner.
+type ShareService struct {
+	store model.ShareStorage
+	users model.UserStore
+	files *FileService
+}
+
+// NewShareService creates a new ShareService.
+func NewShareService(store model.ShareStorage, users model.UserStore, files *FileService) *ShareService {
+	return &ShareService{store: store, users: users, files: files}
+}
+
+type CreateShareRequest struct {
+	FileID       uuid.UUID  `json:"fileId"`
+	FolderID     uuid.UUID  `json:"folderId"`
+	Password     string     `json:"password"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	MaxDownloads *int       `json:"maxDownloads"`
+}
+
+// CreateShareLink creates a link to a file or folder owned by userID and
+// returns it with its token. Only a hash of the token is stored, so it cannot
+// be retrieved again later.
+func (s *ShareService) CreateShareLink(ctx context.Context, userID uuid.UUID, req CreateShareRequest) (*model.ShareLink, string, error) {
+	if (req.FileID == uuid.Nil) == (req.FolderID == uuid.Nil) {
+		return nil, "", ErrInvalidShareTarget
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, "", ErrInvalidExpiry
+	}
+	if req.MaxDownloads != nil && *req.MaxDownloads < 1 {
+		return nil, "", ErrInvalidMaxDownloads
+	}
+
+	if err := s.checkOwner(ctx, userID, req.FileID, req.FolderID); err != nil {
+		return nil, "", err
+	}
+
+	token := generateToken()
+	link := &model.ShareLink{
+		Id:           uuid.New(),
+		TokenHash:    hashString(token),
+		UserID:       userID,
+		FileID:       req.FileID,
+		FolderID:     req.FolderID,
+		MaxDownloads: req.MaxDownloads,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		link.ExpiresAt = &expiresAt
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", err
+		}
+		link.PasswordHash = hash
+		link.HasPassword = true
+	}
+
+	if err := s.store.CreateShareLink(ctx, link); err != nil {
+		return nil, "", err
+	}
+
+	return link, token, nil
+}
+
+// ListShareLinks returns the links created by userID, including revoked and
+// expired ones.
+func (s *ShareService) ListShareLinks(ctx context.Context, userID uuid.UUID) ([]model.ShareLink, error) {
+	links, err := s.store.ListShareLinks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if links == nil {
+		links = []model.ShareLink{}
+	}
+
+	return links, nil
+}
+
+// RevokeShareLink disables a link owned by userID.
+func (s *ShareService) RevokeShareLink(ctx context.Context, userID, id uuid.UUID) error {
+	link, err := s.store.GetShareLink(ctx, id)
+	if err != nil {
+		return err
+	}
+	if link.UserID != userID {
+		return model.ErrNotFound
+	}
+
+	return s.store.RevokeShareLink(ctx, link.Id, time.Now().UTC())
+}
+
+// openShare resolves a token to a link that can still be used. Unknown and
+// revoked links are not found.
+func (s *ShareService) openShare(ctx context.Context, token, password string) (*model.ShareLink, error) {
+	link, err := s.store.GetShareLinkByToken(ctx, hashString(token))
+	if err != nil {
+		return nil, err
+	}
+	if link.RevokedAt != nil {
+		return nil, model.ErrNotFound
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return nil, ErrShareExpired
+	}
+	if link.MaxDownloads != nil && link.DownloadCount >= *link.MaxDownloads {
+		return nil, ErrShareLimitReached
+	}
+	if link.HasPassword {
+		if err := bcrypt.CompareHashAndPassword(link.PasswordHash, []byte(password)); err != nil {
+			return nil, ErrInvalidSharePassword
+		}
+	}
+
+	return &link, nil
+}
+
+// GetSharedItem returns the file or folder a link points at.
+func (s *ShareService) GetSharedItem(ctx context.Context, token, password string) (*model.SharedItem, error) {
+	link, err := s.openShare(ctx, token, password)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &model.SharedItem{ExpiresAt: link.ExpiresAt}
+	if link.MaxDownloads != nil {
+		left := *link.MaxDownloads - link.DownloadCount
+		item.DownloadsLeft = &left
+	}
+
+	if link.FileID != uuid.Nil {
+		item.File, err = s.files.GetFile(ctx, link.UserID, link.FileID)
+	} else {
+		item.Folder, err = s.files.GetFolder(ctx, link.UserID, link.FolderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ListSharedFolder lists a folder reached through a folder link: the shared
+// folder itself when folderID is uuid.Nil, or one of its subfolders.
+func (s *ShareService) ListSharedFolder(ctx context.Context, token, password string, folderID uuid.UUID, opts model.ListOptions) (model.FolderContents, error) {
+	link, err := s.openShare(ctx, token, password)
+	if err != nil {
+		return model.FolderContents{}, err
+	}
+
+	folder, err := s.sharedFolder(ctx, link, folderID)
+	if err != nil {
+		return model.FolderContents{}, err
+	}
+
+	return s.files.ListFolder(ctx, link.UserID, folder.Id, opts)
+}
+
+// OpenSharedFile returns a file reached through a link, ready to be passed
+// to FileService.OpenFile. For a file link fileID may be uuid.Nil; for a
+// folder link it must be a file inside the shared folder. When download is
+// true the request counts against the link's download limit.
+func (s *ShareService) OpenSharedFile(ctx context.Context, token, password string, fileID uuid.UUID, download bool) (*model.File, error) {
+	link, err := s.openShare(ctx, token, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var file *model.File
+	if link.FileID != uuid.Nil {
+		if fileID != uuid.Nil && fileID != link.FileID {
+			return nil, model.ErrNotFound
+		}
+		file, err = s.files.GetFile(ctx, link.UserID, link.FileID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		file, err = s.files.GetFile(ctx, link.UserID, fileID)
+		if err != nil {
+			return nil, err
+		}
+		if file.FolderID == uuid.Nil {
+			return nil, model.ErrNotFound
+		}
+		if _, err := s.sharedFolder(ctx, link, file.FolderID); err != nil {
+			return nil, err
+		}
+	}
+
+	if download {
+		if err := s.recordDownload(ctx, link); err != nil {
+			return nil, err
+		}
+	}
+
+	return file, nil
+}
+
+// ResolveSharedArchive expands a folder reached through a folder link into
+// archive entries. It counts as one download.
+func (s *ShareService) ResolveSharedArchive(ctx context.Context, token, password string, folderID uuid.UUID) ([]ArchiveEntry, error) {
+	link, err := s.openShare(ctx, token, password)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, err := s.sharedFolder(ctx, link, folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.files.ResolveArchive(ctx, link.UserID, ArchiveRequest{FolderIDs: []uuid.UUID{folder.Id}})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.recordDownload(ctx, link); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// sharedFolder returns folderID, or the link's folder when folderID is
+// uuid.Nil, provided it is the link's folder or below it and none of the
+// folders in between are in the trash.
+func (s *ShareService) sharedFolder(ctx context.Context, link *model.ShareLink, folderID uuid.UUID) (*model.Folder, error) {
+	if link.FolderID == uuid.Nil {
+		return nil, model.ErrNotFound
+	}
+	if folderID == uuid.Nil {
+		folderID = link.FolderID
+	}
+
+	ancestors, err := s.files.store.GetAncestors(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, folder := range ancestors {
+		if folder.Id != link.FolderID {
+			continue
+		}
+		for _, folder := range ancestors[i:] {
+			if folder.UserID != link.UserID || folder.DeletedAt != nil {
+				return nil, model.ErrNotFound
+			}
+		}
+		return &ancestors[len(ancestors)-1], nil
+	}
+
+	return nil, model.ErrNotFound
+}
+
+func (s *ShareService) recordDownload(ctx context.Context, link *model.ShareLink) error {
+	err := s.store.RecordShareDownload(ctx, link.Id)
+	if errors.Is(err, model.ErrConflict) {
+		return ErrShareLimitReached
+	}
+	return err
+}
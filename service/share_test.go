@@ -0,0 +1,207 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memShareStore struct {
+	links map[uuid.UUID]model.ShareLink
+}
+
+func newMemShareStore() *memShareStore {
+	return &memShareStore{links: make(map[uuid.UUID]model.ShareLink)}
+}
+
+func (m *memShareStore) CreateShareLink(ctx context.Context, link *model.ShareLink) error {
+	m.links[link.Id] = *link
+	return nil
+}
+
+func (m *memShareStore) GetShareLink(ctx context.Context, id uuid.UUID) (model.ShareLink, error) {
+	link, ok := m.links[id]
+	if !ok {
+		return model.ShareLink{}, model.ErrNotFound
+	}
+	return link, nil
+}
+
+func (m *memShareStore) GetShareLinkByToken(ctx context.Context, tokenHash string) (model.ShareLink, error) {
+	for _, link := range m.links {
+		if link.TokenHash == tokenHash {
+			return link, nil
+		}
+	}
+	return model.ShareLink{}, model.ErrNotFound
+}
+
+func (m *memShareStore) ListShareLinks(ctx context.Context, userID uuid.UUID) ([]model.ShareLink, error) {
+	var links []model.ShareLink
+	for _, link := range m.links {
+		if link.UserID == userID {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (m *memShareStore) RevokeShareLink(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	link, ok := m.links[id]
+	if !ok || link.RevokedAt != nil {
+		return model.ErrNotFound
+	}
+	link.RevokedAt = &revokedAt
+	m.links[id] = link
+	return nil
+}
+
+func (m *memShareStore) RecordShareDownload(ctx context.Context, id uuid.UUID) error {
+	link, ok := m.links[id]
+	if !ok || (link.MaxDownloads != nil && link.DownloadCount >= *link.MaxDownloads) {
+		return model.ErrConflict
+	}
+	link.DownloadCount++
+	m.links[id] = link
+	return nil
+}
+
+func TestShareService_CreateShareLink(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	files := newMemFileStore()
+	svc := service.NewShareService(newMemShareStore(), nil, service.NewFileService(files, blobs))
+
+	file := files.addFile(blobs, userID, uuid.Nil, "a.txt", []byte("a"))
+	folder := files.addFolder(userID, uuid.Nil, "docs")
+	past := time.Now().Add(-time.Hour)
+	zero := 0
+
+	tests := []struct {
+		name string
+		user uuid.UUID
+		req  service.CreateShareRequest
+		err  error
+	}{
+		{"no target", userID, service.CreateShareRequest{}, service.ErrInvalidShareTarget},
+		{"two targets", userID, service.CreateShareRequest{FileID: file.Id, FolderID: folder.Id}, service.ErrInvalidShareTarget},
+		{"expired", userID, service.CreateShareRequest{FileID: file.Id, ExpiresAt: &past}, service.ErrInvalidExpiry},
+		{"no downloads", userID, service.CreateShareRequest{FileID: file.Id, MaxDownloads: &zero}, service.ErrInvalidMaxDownloads},
+		{"other user", uuid.New(), service.CreateShareRequest{FileID: file.Id}, model.ErrNotFound},
+		{"file", userID, service.CreateShareRequest{FileID: file.Id}, nil},
+		{"folder", userID, service.CreateShareRequest{FolderID: folder.Id}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, token, err := svc.CreateShareLink(ctx, tt.user, tt.req)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, token)
+			assert.NotEqual(t, token, link.TokenHash, "only a hash of the token is stored")
+		})
+	}
+}
+
+func TestShareService_OpenSharedFile(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	files := newMemFileStore()
+	shares := newMemShareStore()
+	svc := service.NewShareService(shares, nil, service.NewFileService(files, blobs))
+
+	file := files.addFile(blobs, userID, uuid.Nil, "a.txt", []byte("a"))
+	one := 1
+	link, token, err := svc.CreateShareLink(ctx, userID, service.CreateShareRequest{
+		FileID:       file.Id,
+		Password:     "hunter22",
+		MaxDownloads: &one,
+	})
+	require.NoError(t, err)
+	assert.True(t, link.HasPassword)
+
+	_, err = svc.OpenSharedFile(ctx, "unknown", "hunter22", uuid.Nil, true)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	_, err = svc.OpenSharedFile(ctx, token, "wrong", uuid.Nil, true)
+	assert.ErrorIs(t, err, service.ErrInvalidSharePassword)
+
+	_, err = svc.OpenSharedFile(ctx, token, "hunter22", uuid.Nil, false)
+	require.NoError(t, err, "partial requests do not count")
+
+	got, err := svc.OpenSharedFile(ctx, token, "hunter22", uuid.Nil, true)
+	require.NoError(t, err)
+	assert.Equal(t, file.Id, got.Id)
+
+	_, err = svc.OpenSharedFile(ctx, token, "hunter22", uuid.Nil, true)
+	assert.ErrorIs(t, err, service.ErrShareLimitReached)
+
+	// expiry and revocation
+	expiring, token, err := svc.CreateShareLink(ctx, userID, service.CreateShareRequest{FileID: file.Id})
+	require.NoError(t, err)
+	past := time.Now().Add(-time.Minute)
+	stored := shares.links[expiring.Id]
+	stored.ExpiresAt = &past
+	shares.links[expiring.Id] = stored
+
+	_, err = svc.GetSharedItem(ctx, token, "")
+	assert.ErrorIs(t, err, service.ErrShareExpired)
+
+	assert.ErrorIs(t, svc.RevokeShareLink(ctx, uuid.New(), expiring.Id), model.ErrNotFound)
+	require.NoError(t, svc.RevokeShareLink(ctx, userID, expiring.Id))
+	_, err = svc.GetSharedItem(ctx, token, "")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestShareService_FolderLink(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	files := newMemFileStore()
+	fs := service.NewFileService(files, blobs)
+	svc := service.NewShareService(newMemShareStore(), nil, fs)
+
+	docs := files.addFolder(userID, uuid.Nil, "docs")
+	work := files.addFolder(userID, docs.Id, "work")
+	private := files.addFolder(userID, uuid.Nil, "private")
+	inside := files.addFile(blobs, userID, work.Id, "a.txt", []byte("a"))
+	outside := files.addFile(blobs, userID, private.Id, "b.txt", []byte("b"))
+	root := files.addFile(blobs, userID, uuid.Nil, "c.txt", []byte("c"))
+
+	_, token, err := svc.CreateShareLink(ctx, userID, service.CreateShareRequest{FolderID: docs.Id})
+	require.NoError(t, err)
+
+	item, err := svc.GetSharedItem(ctx, token, "")
+	require.NoError(t, err)
+	require.NotNil(t, item.Folder)
+	assert.Equal(t, docs.Id, item.Folder.Id)
+
+	got, err := svc.OpenSharedFile(ctx, token, "", inside.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, inside.Id, got.Id)
+
+	for _, id := range []uuid.UUID{outside.Id, root.Id, uuid.Nil} {
+		_, err = svc.OpenSharedFile(ctx, token, "", id, true)
+		assert.ErrorIs(t, err, model.ErrNotFound)
+	}
+
+	_, err = svc.ListSharedFolder(ctx, token, "", private.Id, model.ListOptions{})
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	require.NoError(t, fs.DeleteFolder(ctx, userID, work.Id))
+	_, err = svc.OpenSharedFile(ctx, token, "", inside.Id, true)
+	assert.ErrorIs(t, err, model.ErrNotFound, "trashed items are no longer shared")
+}
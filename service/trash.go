@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+)
+
+// DefaultTrashRetention is how long deleted items stay in the trash before
+// they are purged.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// ListTrash returns the items userID has deleted.
+func (s *FileService) ListTrash(ctx context.Context, userID uuid.UUID) (model.Trash, error) {
+	trash, err := s.store.ListTrash(ctx, userID)
+	if err != nil {
+		return model.Trash{}, err
+	}
+	if trash.Folders == nil {
+		trash.Folders = []model.Folder{}
+	}
+	if trash.Files == nil {
+		trash.Files = []model.File{}
+	}
+
+	return trash, nil
+}
+
+// RestoreFile takes a file out of the trash and puts it back in its original
+// folder. Missing folders on the way are recreated and a name that has been
+// taken in the meantime gets a " (n)" suffix.
+func (s *FileService) RestoreFile(ctx context.Context, userID, id uuid.UUID) (*model.File, error) {
+	file, err := s.store.GetFile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if file.TrashID != file.Id {
+		return nil, model.ErrNotFound
+	}
+	if err := s.authorize(ctx, userID, file.UserID, file.Id, uuid.Nil, model.AccessOwner); err != nil {
+		return nil, err
+	}
+
+	folderID, err := s.restoreLocation(ctx, userID, file.FolderID)
+	if err != nil {
+		return nil, err
+	}
+
+	file.FolderID = folderID
+	file.LastModified = time.Now().UTC()
+	err = saveUnique(ctx, model.ConflictRename, file.Name, func(name string) error {
+		file.Name = name
+		return s.store.RestoreFile(ctx, &file)
+	}, func(ctx context.Context, prefix string) ([]string, error) {
+		return s.store.ListFileNames(ctx, userID, folderID, prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file.DeletedAt = nil
+	file.TrashID = uuid.Nil
+	return &file, nil
+}
+
+// RestoreFolder takes a folder out of the trash together with everything
+// that was deleted with it. Its location is restored as in RestoreFile.
+func (s *FileService) RestoreFolder(ctx context.Context, userID, id uuid.UUID) (*model.Folder, error) {
+	folder, err := s.store.GetFolder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if folder.TrashID != folder.Id {
+		return nil, model.ErrNotFound
+	}
+	if err := s.authorize(ctx, userID, folder.UserID, uuid.Nil, folder.Id, model.AccessOwner); err != nil {
+		return nil, err
+	}
+
+	parentID, err := s.restoreLocation(ctx, userID, folder.ParentID)
+	if err != nil {
+		return nil, err
+	}
+
+	folder.ParentID = parentID
+	folder.LastModified = time.Now().UTC()
+	err = saveUnique(ctx, model.ConflictRename, folder.Name, func(name string) error {
+		folder.Name = name
+		return s.store.RestoreFolder(ctx, &folder)
+	}, func(ctx context.Context, prefix string) ([]string, error) {
+		return s.store.ListFolderNames(ctx, userID, parentID, prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	folder.DeletedAt = nil
+	folder.TrashID = uuid.Nil
+	return &folder, nil
+}
+
+// restoreLocation returns the folder an item from the trash goes back to.
+// If folderID or one of its ancestors is itself in the trash, the path is
+// rebuilt from the deepest folder that still exists, reusing folders with the
+// same names where there are any.
+func (s *FileService) restoreLocation(ctx context.Context, userID, folderID uuid.UUID) (uuid.UUID, error) {
+	if folderID == uuid.Nil {
+		return uuid.Nil, nil
+	}
+
+	ancestors, err := s.store.GetAncestors(ctx, folderID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	parentID := uuid.Nil
+	for _, ancestor := range ancestors {
+		if ancestor.DeletedAt == nil {
+			parentID = ancestor.Id
+			continue
+		}
+
+		folder, err := s.store.GetFolderByName(ctx, userID, parentID, ancestor.Name)
+		if errors.Is(err, model.ErrNotFound) {
+			now := time.Now().UTC()
+			folder = model.Folder{
+				Id:           uuid.New(),
+				Name:         ancestor.Name,
+				UserID:       userID,
+				ParentID:     parentID,
+				CreatedAt:    now,
+				LastModified: now,
+			}
+			err = s.store.CreateFolder(ctx, &folder)
+		}
+		if err != nil {
+			return uuid.Nil, err
+		}
+		parentID = folder.Id
+	}
+
+	return parentID, nil
+}
+
+// EmptyTrash permanently deletes everything in userID's trash.
+func (s *FileService) EmptyTrash(ctx context.Context, userID uuid.UUID) error {
+	keys, err := s.store.PurgeTrash(ctx, userID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		s.deleteBlob(ctx, key)
+	}
+
+	return nil
+}
+
+// PurgeTrash permanently deletes every item that has been in the trash for
+// longer than retention and returns the number of stored objects removed,
+// one per file version.
+func (s *FileService) PurgeTrash(ctx context.Context, retention time.Duration) (int, error) {
+	keys, err := s.store.PurgeTrash(ctx, uuid.Nil, time.Now().UTC().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, key := range keys {
+		s.deleteBlob(ctx, key)
+	}
+
+	return len(keys), nil
+}
+
+// RunCleanup calls PurgeTrash and PruneVersions every interval until ctx is
+// cancelled.
+func (s *FileService) RunCleanup(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.PurgeTrash(ctx, retention)
+		if err != nil {
+			slog.Error("failed to purge trash", "error", err)
+		} else if n > 0 {
+			slog.Info("purged trash", "objects", n)
+		}
+
+		n, err = s.PruneVersions(ctx)
+		if err != nil {
+			slog.Error("failed to prune file versions", "error", err)
+		} else if n > 0 {
+			slog.Info("pruned file versions", "versions", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *memFileStore) GetFolderByName(ctx context.Context, userID, parentID uuid.UUID, name string) (model.Folder, error) {
+	for _, folder := range m.folders {
+		if folder.DeletedAt == nil && folder.UserID == userID && folder.ParentID == parentID && strings.EqualFold(folder.Name, name) {
+			return folder, nil
+		}
+	}
+	return model.Folder{}, model.ErrNotFound
+}
+
+func (m *memFileStore) TrashFile(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	file, ok := m.files[id]
+	if !ok || file.DeletedAt != nil {
+		return model.ErrNotFound
+	}
+	file.DeletedAt, file.TrashID = &deletedAt, id
+	m.files[id] = file
+	return nil
+}
+
+func (m *memFileStore) TrashFolder(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	folders, files, err := m.GetSubtree(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, folder := range folders {
+		folder.DeletedAt, folder.TrashID = &deletedAt, id
+		m.folders[folder.Id] = folder
+	}
+	for _, file := range files {
+		file.DeletedAt, file.TrashID = &deletedAt, id
+		m.files[file.Id] = file
+	}
+	return nil
+}
+
+func (m *memFileStore) ListTrash(ctx context.Context, userID uuid.UUID) (model.Trash, error) {
+	var trash model.Trash
+	for _, folder := range m.folders {
+		if folder.UserID == userID && folder.TrashID == folder.Id {
+			trash.Folders = append(trash.Folders, folder)
+		}
+	}
+	for _, file := range m.files {
+		if file.UserID == userID && file.TrashID == file.Id {
+			trash.Files = append(trash.Files, file)
+		}
+	}
+	return trash, nil
+}
+
+func (m *memFileStore) RestoreFile(ctx context.Context, file *model.File) error {
+	if current, ok := m.files[file.Id]; !ok || current.TrashID != file.Id {
+		return model.ErrNotFound
+	}
+	restored := *file
+	restored.DeletedAt, restored.TrashID = nil, uuid.Nil
+	if m.fileNameTaken(&restored) {
+		return model.ErrDuplicateName
+	}
+	m.files[file.Id] = restored
+	return nil
+}
+
+func (m *memFileStore) RestoreFolder(ctx context.Context, folder *model.Folder) error {
+	if current, ok := m.folders[folder.Id]; !ok || current.TrashID != folder.Id {
+		return model.ErrNotFound
+	}
+	restored := *folder
+	restored.DeletedAt, restored.TrashID = nil, uuid.Nil
+	if m.folderNameTaken(&restored) {
+		return model.ErrDuplicateName
+	}
+	m.folders[folder.Id] = restored
+
+	for id, other := range m.folders {
+		if other.TrashID == folder.Id {
+			other.DeletedAt, other.TrashID = nil, uuid.Nil
+			m.folders[id] = other
+		}
+	}
+	for id, file := range m.files {
+		if file.TrashID == folder.Id {
+			file.DeletedAt, file.TrashID = nil, uuid.Nil
+			m.files[id] = file
+		}
+	}
+	return nil
+}
+
+func (m *memFileStore) PurgeTrash(ctx context.Context, userID uuid.UUID, before time.Time) ([]string, error) {
+	expired := func(id, trashID, owner uuid.UUID, deletedAt *time.Time) bool {
+		return trashID == id && !deletedAt.After(before) && (userID == uuid.Nil || owner == userID)
+	}
+
+	// like ON DELETE CASCADE, purging a folder removes everything below it
+	removed := make(map[uuid.UUID]bool)
+	for _, folder := range m.folders {
+		if expired(folder.Id, folder.TrashID, folder.UserID, folder.DeletedAt) {
+			removed[folder.Id] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, folder := range m.folders {
+			if removed[folder.ParentID] && !removed[folder.Id] {
+				removed[folder.Id], changed = true, true
+			}
+		}
+	}
+
+	var keys []string
+	for id, file := range m.files {
+		if removed[file.FolderID] || expired(file.Id, file.TrashID, file.UserID, file.DeletedAt) {
+			for _, version := range m.versions[id] {
+				keys = append(keys, version.StorageKey)
+			}
+			delete(m.files, id)
+			delete(m.versions, id)
+		}
+	}
+	for id := range removed {
+		delete(m.folders, id)
+	}
+	return keys, nil
+}
+
+func TestFileService_TrashFolder(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	store := newMemFileStore()
+	fs := service.NewFileService(store, blobs)
+
+	docs := store.addFolder(userID, uuid.Nil, "docs")
+	work := store.addFolder(userID, docs.Id, "work")
+	a := store.addFile(blobs, userID, docs.Id, "a.txt", []byte("a"))
+	store.addFile(blobs, userID, work.Id, "b.txt", []byte("b"))
+	kept := store.addFile(blobs, userID, uuid.Nil, "c.txt", []byte("c"))
+
+	assert.ErrorIs(t, fs.DeleteFolder(ctx, uuid.New(), docs.Id), model.ErrNotFound)
+	require.NoError(t, fs.DeleteFolder(ctx, userID, docs.Id))
+
+	_, err := fs.GetFolder(ctx, userID, work.Id)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+	_, err = fs.GetFile(ctx, userID, a.Id)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	trash, err := fs.ListTrash(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, trash.Folders, 1, "contents of a deleted folder are not listed separately")
+	assert.Equal(t, docs.Id, trash.Folders[0].Id)
+	assert.Empty(t, trash.Files)
+
+	// the name is free again while the folder is in the trash
+	_, err = fs.CreateFolder(ctx, service.CreateFolderRequest{Name: "docs"}, userID)
+	require.NoError(t, err)
+
+	require.NoError(t, fs.EmptyTrash(ctx, userID))
+
+	assert.NotContains(t, store.folders, docs.Id)
+	assert.NotContains(t, store.folders, work.Id)
+	objects, err := blobs.List(ctx, userID.String()+"/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, kept.StorageKey, objects[0].Key)
+}
+
+func TestFileService_RestoreFile(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	store := newMemFileStore()
+	fs := service.NewFileService(store, blobs)
+
+	docs := store.addFolder(userID, uuid.Nil, "docs")
+	work := store.addFolder(userID, docs.Id, "work")
+	report := store.addFile(blobs, userID, work.Id, "report.txt", []byte("q3"))
+
+	t.Run("into its original folder with a free name", func(t *testing.T) {
+		require.NoError(t, fs.DeleteFile(ctx, userID, report.Id))
+		store.addFile(blobs, userID, work.Id, "report.txt", []byte("q4"))
+
+		restored, err := fs.RestoreFile(ctx, userID, report.Id)
+		require.NoError(t, err)
+		assert.Equal(t, work.Id, restored.FolderID)
+		assert.Equal(t, "report (1).txt", restored.Name)
+		assert.Nil(t, restored.DeletedAt)
+	})
+
+	t.Run("recreates folders that are in the trash", func(t *testing.T) {
+		require.NoError(t, fs.DeleteFile(ctx, userID, report.Id))
+		require.NoError(t, fs.DeleteFolder(ctx, userID, docs.Id))
+
+		restored, err := fs.RestoreFile(ctx, userID, report.Id)
+		require.NoError(t, err)
+		assert.NotEqual(t, work.Id, restored.FolderID)
+
+		path, err := fs.GetFolderPath(ctx, userID, restored.FolderID)
+		require.NoError(t, err)
+		require.Len(t, path, 2)
+		assert.Equal(t, "docs", path[0].Name)
+		assert.Equal(t, "work", path[1].Name)
+
+		// restoring the original folder now needs a new name
+		folder, err := fs.RestoreFolder(ctx, userID, docs.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "docs (1)", folder.Name)
+		_, err = fs.GetFolder(ctx, userID, work.Id)
+		assert.NoError(t, err, "folders deleted with docs are restored with it")
+	})
+
+	t.Run("items deleted with a folder cannot be restored alone", func(t *testing.T) {
+		inner := store.addFile(blobs, userID, work.Id, "inner.txt", []byte("x"))
+		require.NoError(t, fs.DeleteFolder(ctx, userID, work.Id))
+
+		_, err := fs.RestoreFile(ctx, userID, inner.Id)
+		assert.ErrorIs(t, err, model.ErrNotFound)
+		_, err = fs.RestoreFile(ctx, uuid.New(), report.Id)
+		assert.ErrorIs(t, err, model.ErrNotFound)
+	})
+}
+
+func TestFileService_PurgeTrash(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	store := newMemFileStore()
+	fs := service.NewFileService(store, blobs)
+
+	old := store.addFile(blobs, userID, uuid.Nil, "old.txt", []byte("old"))
+	recent := store.addFile(blobs, userID, uuid.Nil, "recent.txt", []byte("recent"))
+	require.NoError(t, store.TrashFile(ctx, old.Id, time.Now().Add(-31*24*time.Hour)))
+	require.NoError(t, store.TrashFile(ctx, recent.Id, time.Now().Add(-time.Hour)))
+
+	n, err := fs.PurgeTrash(ctx, service.DefaultTrashRetention)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.NotContains(t, store.files, old.Id)
+	assert.Contains(t, store.files, recent.Id)
+	_, err = blobs.Stat(ctx, old.StorageKey)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/session"
+	"github.com/freekobie/kora/totp"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// totpIssuer names the account in authenticator apps.
+	totpIssuer = "Kora"
+	// twoFactorChallengeTTL is how long a user has to enter their code after
+	// giving their password.
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+	// recoveryCodeBytes is the randomness in a recovery code, 80 bits, which
+	// keeps its unsalted hash from being reversed by brute force.
+	recoveryCodeBytes = 10
+)
+
+// SetupTwoFactor starts enrolling a TOTP authenticator for userID. It is not
+// used at login until ConfirmTwoFactor succeeds; calling SetupTwoFactor again
+// before that starts over with a new secret.
+func (us *UserService) SetupTwoFactor(ctx context.Context, userID uuid.UUID) (*model.TwoFactorSetup, error) {
+	user, err := us.store.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := model.TwoFactor{
+		UserID:    user.Id,
+		Secret:    totp.GenerateSecret(),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := us.store.SaveTwoFactor(ctx, &tf); err != nil {
+		if errors.Is(err, model.ErrConflict) {
+			return nil, ErrTwoFactorEnabled
+		}
+		return nil, err
+	}
+
+	return &model.TwoFactorSetup{
+		Secret: tf.Secret,
+		URI:    totp.URI(tf.Secret, totpIssuer, user.Email),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves
+// their authenticator works by entering a code from it. It returns recovery
+// codes, each of which can be used once in place of a TOTP code. Only their
+// hashes are kept, so this is the only time they can be shown.
+func (us *UserService) ConfirmTwoFactor(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	tf, err := us.store.GetTwoFactor(ctx, userID)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, ErrTwoFactorNotSetUp
+		}
+		return nil, err
+	}
+	if tf.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	step, ok := totp.Validate(tf.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes := generateRecoveryCodes()
+	if err := us.store.EnableTwoFactor(ctx, userID, step, hashes); err != nil {
+		if errors.Is(err, model.ErrConflict) {
+			return nil, ErrTwoFactorEnabled
+		}
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes, for when they
+// have run low or lost them. A current TOTP or recovery code is required.
+func (us *UserService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	if err := us.checkSecondFactor(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes := generateRecoveryCodes()
+	if err := us.store.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor turns off two-factor authentication. Both the password
+// and a TOTP or recovery code are required.
+func (us *UserService) DisableTwoFactor(ctx context.Context, userID uuid.UUID, password, code string) error {
+	user, err := us.store.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		slog.Error("failed to compare password and hash", "error", err)
+		return ErrFailedOperation
+	}
+
+	if err := us.checkSecondFactor(ctx, userID, code); err != nil {
+		return err
+	}
+
+	return us.store.DeleteTwoFactor(ctx, userID)
+}
+
+// VerifyTwoFactor completes a login started by NewSession for a user with
+// two-factor authentication, exchanging the challenge token and a TOTP or
+// recovery code for a refresh token. Wrong codes count as failed logins, as
+// in NewSession.
+func (us *UserService) VerifyTwoFactor(ctx context.Context, challengeToken, code string, client model.ClientInfo) (*session.UserSession, error) {
+	ipKey := ipAttemptKey(client.IPAddress)
+	if err := us.checkAttempts(ctx, ipKey); err != nil {
+		return nil, err
+	}
+
+	hash := hashString(challengeToken)
+	token, err := us.store.GetToken(ctx, hash, TWO_FACTOR)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	accountKey := accountAttemptKey(token.UserId)
+	if err := us.checkAttempts(ctx, accountKey); err != nil {
+		return nil, err
+	}
+
+	user, err := us.store.GetUser(ctx, token.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.checkSecondFactor(ctx, token.UserId, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			us.failedLogin(ctx, user, client.IPAddress)
+		}
+		return nil, err
+	}
+
+	// the challenge is spent whether or not a session can be started
+	if err := us.store.DeleteToken(ctx, hash, TWO_FACTOR); err != nil {
+		return nil, err
+	}
+	us.clearAttempts(ctx, accountKey)
+
+	return us.startSession(ctx, user, client)
+}
+
+// newTwoFactorChallenge stores a challenge token for a user who has given
+// the right password and now has to give a second factor.
+func (us *UserService) newTwoFactorChallenge(ctx context.Context, user model.User) (*session.UserSession, error) {
+	challenge := generateToken()
+	token := model.UserToken{
+		Hash:      hashString(challenge),
+		UserId:    user.Id,
+		ExpiresAt: time.Now().Add(twoFactorChallengeTTL),
+		Scope:     TWO_FACTOR,
+	}
+	if err := us.store.InsertToken(ctx, &token); err != nil {
+		return nil, err
+	}
+
+	return &session.UserSession{
+		User:              user,
+		ExpiresAt:         token.ExpiresAt,
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+	}, nil
+}
+
+// checkSecondFactor accepts a TOTP code from the user's authenticator or one
+// of their recovery codes. Each code works only once.
+func (us *UserService) checkSecondFactor(ctx context.Context, userID uuid.UUID, code string) error {
+	tf, err := us.store.GetTwoFactor(ctx, userID)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return ErrTwoFactorNotEnabled
+		}
+		return err
+	}
+	if !tf.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(tf.Secret, code, time.Now())
+		if !ok || step <= tf.LastStep {
+			return ErrInvalidTwoFactorCode
+		}
+		if err := us.store.UseTwoFactorStep(ctx, userID, step); err != nil {
+			if errors.Is(err, model.ErrConflict) {
+				return ErrInvalidTwoFactorCode
+			}
+			return err
+		}
+		return nil
+	}
+
+	err = us.store.UseRecoveryCode(ctx, userID, hashString(normalizeRecoveryCode(code)))
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+
+	return nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns new recovery codes formatted as
+// xxxx-xxxx-xxxx-xxxx, and their hashes.
+func generateRecoveryCodes() (codes, hashes []string) {
+	for range recoveryCodeCount {
+		b := make([]byte, recoveryCodeBytes)
+		_, _ = rand.Read(b)
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))
+
+		groups := make([]string, 0, len(code)/4)
+		for i := 0; i < len(code); i += 4 {
+			groups = append(groups, code[i:i+4])
+		}
+		codes = append(codes, strings.Join(groups, "-"))
+		hashes = append(hashes, hashString(code))
+	}
+
+	return codes, hashes
+}
+
+// normalizeRecoveryCode undoes the formatting users may or may not keep when
+// typing a recovery code.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,193 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/freekobie/kora/totp"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *memUserStore) GetTwoFactor(ctx context.Context, userID uuid.UUID) (model.TwoFactor, error) {
+	tf, ok := m.twoFactor[userID]
+	if !ok {
+		return model.TwoFactor{}, model.ErrNotFound
+	}
+	return tf, nil
+}
+
+func (m *memUserStore) SaveTwoFactor(ctx context.Context, tf *model.TwoFactor) error {
+	if m.twoFactor[tf.UserID].Enabled {
+		return model.ErrConflict
+	}
+	m.twoFactor[tf.UserID] = *tf
+	return nil
+}
+
+func (m *memUserStore) EnableTwoFactor(ctx context.Context, userID uuid.UUID, step int64, recoveryHashes []string) error {
+	tf, ok := m.twoFactor[userID]
+	if !ok || tf.Enabled {
+		return model.ErrConflict
+	}
+	tf.Enabled = true
+	tf.LastStep = step
+	m.twoFactor[userID] = tf
+	return m.ReplaceRecoveryCodes(ctx, userID, recoveryHashes)
+}
+
+func (m *memUserStore) UseTwoFactorStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	tf := m.twoFactor[userID]
+	if tf.LastStep >= step {
+		return model.ErrConflict
+	}
+	tf.LastStep = step
+	m.twoFactor[userID] = tf
+	return nil
+}
+
+func (m *memUserStore) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, recoveryHashes []string) error {
+	for hash, owner := range m.recovery {
+		if owner == userID {
+			delete(m.recovery, hash)
+		}
+	}
+	for _, hash := range recoveryHashes {
+		m.recovery[hash] = userID
+	}
+	return nil
+}
+
+func (m *memUserStore) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	if owner, ok := m.recovery[codeHash]; !ok || owner != userID {
+		return model.ErrNotFound
+	}
+	delete(m.recovery, codeHash)
+	return nil
+}
+
+func (m *memUserStore) DeleteTwoFactor(ctx context.Context, userID uuid.UUID) error {
+	if _, ok := m.twoFactor[userID]; !ok {
+		return model.ErrNotFound
+	}
+	delete(m.twoFactor, userID)
+	return m.ReplaceRecoveryCodes(ctx, userID, nil)
+}
+
+// currentCode returns the authenticator code for secret, shifted by the
+// given number of periods.
+func currentCode(t *testing.T, secret string, periods int) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now())+int64(periods))
+	require.NoError(t, err)
+	return code
+}
+
+func TestUserService_TwoFactorEnrollment(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	_, err := svc.ConfirmTwoFactor(ctx, user.Id, "123456")
+	assert.ErrorIs(t, err, service.ErrTwoFactorNotSetUp)
+
+	// starting over replaces the secret
+	first, err := svc.SetupTwoFactor(ctx, user.Id)
+	require.NoError(t, err)
+	setup, err := svc.SetupTwoFactor(ctx, user.Id)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Secret, setup.Secret)
+	assert.Contains(t, setup.URI, "secret="+setup.Secret)
+
+	_, err = svc.ConfirmTwoFactor(ctx, user.Id, "000000x")
+	assert.ErrorIs(t, err, service.ErrInvalidTwoFactorCode)
+
+	confirmation := currentCode(t, setup.Secret, -1)
+	codes, err := svc.ConfirmTwoFactor(ctx, user.Id, confirmation)
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Len(t, users.recovery, 10)
+	for _, code := range codes {
+		assert.Regexp(t, `^[a-z2-7]{4}(-[a-z2-7]{4}){3}$`, code, "recovery codes hold 80 random bits")
+	}
+	for hash := range users.recovery {
+		assert.NotContains(t, codes, hash, "recovery codes are stored hashed")
+	}
+
+	_, err = svc.SetupTwoFactor(ctx, user.Id)
+	assert.ErrorIs(t, err, service.ErrTwoFactorEnabled)
+
+	// the code used for confirming cannot be used again
+	_, err = svc.RegenerateRecoveryCodes(ctx, user.Id, confirmation)
+	assert.ErrorIs(t, err, service.ErrInvalidTwoFactorCode)
+	fresh, err := svc.RegenerateRecoveryCodes(ctx, user.Id, codes[0])
+	require.NoError(t, err)
+	assert.Len(t, users.recovery, 10)
+
+	assert.ErrorIs(t, svc.DisableTwoFactor(ctx, user.Id, "wrong", fresh[0]), service.ErrInvalidCredentials)
+	assert.ErrorIs(t, svc.DisableTwoFactor(ctx, user.Id, "password", codes[1]), service.ErrInvalidTwoFactorCode, "old recovery codes are replaced")
+	require.NoError(t, svc.DisableTwoFactor(ctx, user.Id, "password", fresh[0]))
+	assert.Empty(t, users.twoFactor)
+	assert.Empty(t, users.recovery)
+}
+
+func TestUserService_TwoFactorLogin(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	setup, err := svc.SetupTwoFactor(ctx, user.Id)
+	require.NoError(t, err)
+
+	login, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	assert.False(t, login.TwoFactorRequired, "unconfirmed authenticators are not asked for")
+
+	codes, err := svc.ConfirmTwoFactor(ctx, user.Id, currentCode(t, setup.Secret, -1))
+	require.NoError(t, err)
+
+	login, err = svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	assert.True(t, login.TwoFactorRequired)
+	assert.NotEmpty(t, login.ChallengeToken)
+	assert.Empty(t, login.RefreshToken, "no session before the second factor")
+
+	_, err = svc.VerifyTwoFactor(ctx, "not-a-challenge", currentCode(t, setup.Secret, 0), model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+	_, err = svc.VerifyTwoFactor(ctx, login.ChallengeToken, "999999", model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidTwoFactorCode)
+
+	code := currentCode(t, setup.Secret, 0)
+	verified, err := svc.VerifyTwoFactor(ctx, login.ChallengeToken, code, model.ClientInfo{UserAgent: "Phone"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, verified.RefreshToken)
+	_, err = svc.RefreshSession(ctx, verified.RefreshToken, model.ClientInfo{})
+	assert.NoError(t, err)
+
+	_, err = svc.VerifyTwoFactor(ctx, login.ChallengeToken, currentCode(t, setup.Secret, 1), model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken, "challenges work once")
+
+	login, err = svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	_, err = svc.VerifyTwoFactor(ctx, login.ChallengeToken, code, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidTwoFactorCode, "TOTP codes cannot be replayed")
+
+	// recovery codes work without the dash and in upper case
+	recovery := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	_, err = svc.VerifyTwoFactor(ctx, login.ChallengeToken, recovery, model.ClientInfo{})
+	require.NoError(t, err)
+
+	login, err = svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	_, err = svc.VerifyTwoFactor(ctx, login.ChallengeToken, codes[0], model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidTwoFactorCode, "recovery codes work once")
+}
@@ -0,0 +1,433 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+)
+
+// MaxUploadSize is the largest file accepted by a resumable upload.
+const MaxUploadSize int64 = 10 << 30
+
+// UploadChecksumAlgorithms lists the algorithms accepted for chunk checksums.
+var UploadChecksumAlgorithms = []string{"md5", "sha1", "sha256"}
+
+// UploadService manages resumable uploads. Each chunk is stored as its own
+// object and the chunks are joined into a file once every byte has arrived.
+type UploadService struct {
+	store model.UploadStorage
+	blobs model.BlobStore
+	files *FileService
+}
+
+// NewUploadService creates a new UploadService.
+func NewUploadService(store model.UploadStorage, blobs model.BlobStore, files *FileService) *UploadService {
+	return &UploadService{store: store, blobs: blobs, files: files}
+}
+
+type CreateUploadRequest struct {
+	Name     string
+	MimeType string
+	FolderID uuid.UUID
+	// FileID makes the upload a new version of an existing file. Name,
+	// FolderID and OnConflict are then ignored.
+	FileID     uuid.UUID
+	Size       int64
+	OnConflict model.ConflictPolicy
+}
+
+// CreateUpload starts a new upload session. An empty upload is committed
+// straight away, in which case the created file is returned as well. Name
+// conflicts are resolved when the upload is committed, but with
+// model.ConflictFail a name that is already taken is rejected up front.
+func (s *UploadService) CreateUpload(ctx context.Context, userID uuid.UUID, req CreateUploadRequest) (*model.Upload, *model.File, error) {
+	if req.Size < 0 {
+		return nil, nil, ErrInvalidUploadLength
+	}
+	if req.Size > MaxUploadSize {
+		return nil, nil, ErrUploadTooLarge
+	}
+	ownerID := userID
+	if req.FileID != uuid.Nil {
+		file, err := s.files.file(ctx, userID, req.FileID, model.AccessEditor)
+		if err != nil {
+			return nil, nil, err
+		}
+		ownerID = file.UserID
+		req.Name, req.FolderID = file.Name, file.FolderID
+		req.OnConflict = model.ConflictReplace
+		if req.MimeType == "" {
+			req.MimeType = file.MimeType
+		}
+	}
+	if req.Name == "" {
+		req.Name = "untitled"
+	}
+	name, err := validateName(req.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.FileID == uuid.Nil {
+		// uploads into a folder shared with userID count against its owner
+		ownerID, err = s.files.checkFolder(ctx, userID, req.FolderID, model.AccessEditor)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if req.OnConflict == "" {
+		req.OnConflict = model.ConflictFail
+	}
+	if req.OnConflict == model.ConflictFail {
+		_, err := s.files.store.GetFileByName(ctx, ownerID, req.FolderID, name)
+		if err == nil {
+			return nil, nil, model.ErrDuplicateName
+		}
+		if !errors.Is(err, model.ErrNotFound) {
+			return nil, nil, err
+		}
+	}
+	if req.MimeType == "" {
+		req.MimeType = "application/octet-stream"
+	}
+	if err := s.checkQuota(ctx, ownerID, req.Size); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	upload := &model.Upload{
+		Id:           uuid.New(),
+		UserID:       userID,
+		FolderID:     req.FolderID,
+		FileID:       req.FileID,
+		Name:         name,
+		MimeType:     req.MimeType,
+		Size:         req.Size,
+		OnConflict:   req.OnConflict,
+		CreatedAt:    now,
+		LastModified: now,
+	}
+
+	if err := s.store.CreateUpload(ctx, upload); err != nil {
+		return nil, nil, err
+	}
+
+	if upload.Size == 0 {
+		file, err := s.commit(ctx, upload)
+		if err != nil {
+			return nil, nil, err
+		}
+		return upload, file, nil
+	}
+
+	return upload, nil, nil
+}
+
+// checkQuota makes sure a new upload of size bytes fits in the quota of the
+// user who will own the file, together with their other unfinished uploads. The final size is checked
+// again when the upload is committed.
+func (s *UploadService) checkQuota(ctx context.Context, userID uuid.UUID, size int64) error {
+	remaining, err := s.files.remainingQuota(ctx, userID)
+	if err != nil {
+		return err
+	}
+	pending, err := s.store.PendingUploadSize(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if size > remaining-pending {
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// GetUpload returns an upload owned by userID.
+func (s *UploadService) GetUpload(ctx context.Context, userID, id uuid.UUID) (*model.Upload, error) {
+	upload, err := s.store.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.UserID != userID {
+		return nil, model.ErrNotFound
+	}
+
+	return &upload, nil
+}
+
+// WriteChunk appends the bytes in r to an upload at offset. length is the
+// chunk size if known, or -1. checksum is an optional "<algorithm> <base64>"
+// digest of the chunk. When the last byte arrives the file is committed and
+// returned alongside the upload. If reading r fails partway, the bytes read
+// so far are kept and the upload is returned with the error, at the offset
+// the client should resume from.
+func (s *UploadService) WriteChunk(ctx context.Context, userID, id uuid.UUID, offset int64, r io.Reader, length int64, checksum string) (*model.Upload, *model.File, error) {
+	upload, err := s.GetUpload(ctx, userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset != upload.Offset {
+		return nil, nil, ErrOffsetMismatch
+	}
+
+	remaining := upload.Size - upload.Offset
+	if length > remaining {
+		return nil, nil, ErrUploadTooLarge
+	}
+
+	// A completed upload whose commit failed earlier is retried by sending
+	// an empty chunk at the final offset.
+	if remaining == 0 {
+		file, err := s.commit(ctx, upload)
+		return upload, file, err
+	}
+
+	var digest hash.Hash
+	var expected []byte
+	if checksum != "" {
+		digest, expected, err = parseChecksum(checksum)
+		if err != nil {
+			return nil, nil, err
+		}
+		r = io.TeeReader(r, digest)
+	}
+
+	// The chunk is written with an unknown size and outlives the request, so
+	// that if the client goes away partway through, the bytes that did
+	// arrive are kept and the upload resumes from there.
+	ctx = context.WithoutCancel(ctx)
+	counter := &countingReader{r: io.LimitReader(r, remaining+1)}
+	key := fmt.Sprintf("uploads/%s/%s", upload.Id, uuid.New())
+
+	if err := s.blobs.Put(ctx, key, counter, -1, "application/octet-stream"); err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case counter.n > remaining:
+		s.discardChunk(ctx, key)
+		return nil, nil, ErrUploadTooLarge
+	case digest != nil && counter.err != nil:
+		// a partial chunk cannot be checked against the checksum
+		s.discardChunk(ctx, key)
+		return nil, nil, fmt.Errorf("failed to read upload chunk: %w", counter.err)
+	case digest != nil && !bytes.Equal(digest.Sum(nil), expected):
+		s.discardChunk(ctx, key)
+		return nil, nil, ErrChecksumMismatch
+	case counter.n == 0:
+		s.discardChunk(ctx, key)
+		if counter.err != nil {
+			return nil, nil, fmt.Errorf("failed to read upload chunk: %w", counter.err)
+		}
+		return upload, nil, nil
+	}
+
+	chunk := &model.UploadChunk{
+		UploadID:   upload.Id,
+		Offset:     upload.Offset,
+		Size:       counter.n,
+		StorageKey: key,
+	}
+	if err := s.store.AppendChunk(ctx, chunk); err != nil {
+		s.discardChunk(ctx, key)
+		if errors.Is(err, model.ErrConflict) {
+			return nil, nil, ErrOffsetMismatch
+		}
+		return nil, nil, err
+	}
+
+	upload.Offset += counter.n
+	if counter.err != nil {
+		return upload, nil, fmt.Errorf("failed to read upload chunk: %w", counter.err)
+	}
+	if upload.Offset < upload.Size {
+		return upload, nil, nil
+	}
+
+	// finish the commit even if the client goes away after the last byte
+	file, err := s.commit(ctx, upload)
+	return upload, file, err
+}
+
+// TerminateUpload cancels an upload and removes the chunks received so far.
+func (s *UploadService) TerminateUpload(ctx context.Context, userID, id uuid.UUID) error {
+	upload, err := s.GetUpload(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := s.store.GetChunks(ctx, upload.Id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteUpload(ctx, upload.Id); err != nil {
+		return err
+	}
+	s.deleteChunks(ctx, chunks)
+
+	return nil
+}
+
+// commit joins the chunks of a finished upload into a file, or a new version
+// of one, through FileService and removes the upload session.
+func (s *UploadService) commit(ctx context.Context, upload *model.Upload) (*model.File, error) {
+	chunks, err := s.store.GetChunks(ctx, upload.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var next int64
+	for _, chunk := range chunks {
+		if chunk.Offset != next {
+			slog.Error("upload chunks are not contiguous", "upload", upload.Id, "offset", chunk.Offset, "expected", next)
+			return nil, ErrFailedOperation
+		}
+		next += chunk.Size
+	}
+	if next != upload.Size {
+		return nil, ErrFailedOperation
+	}
+
+	reader := &chunkReader{ctx: ctx, blobs: s.blobs, chunks: chunks}
+	defer reader.Close()
+
+	var file *model.File
+	if upload.FileID != uuid.Nil {
+		file, err = s.files.SaveVersion(ctx, upload.UserID, upload.FileID, reader, upload.Size, upload.MimeType)
+	} else {
+		file, err = s.files.SaveFile(ctx, &model.File{
+			Name:     upload.Name,
+			UserID:   upload.UserID,
+			FolderID: upload.FolderID,
+			MimeType: upload.MimeType,
+			Size:     upload.Size,
+		}, reader, upload.OnConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.DeleteUpload(ctx, upload.Id); err != nil {
+		slog.Error("failed to delete completed upload", "upload", upload.Id, "error", err)
+	}
+	s.deleteChunks(ctx, chunks)
+
+	return file, nil
+}
+
+// discardChunk removes a chunk that was stored but will not be recorded.
+func (s *UploadService) discardChunk(ctx context.Context, key string) {
+	if err := s.blobs.Delete(context.WithoutCancel(ctx), key); err != nil {
+		slog.Error("failed to delete upload chunk", "key", key, "error", err)
+	}
+}
+
+func (s *UploadService) deleteChunks(ctx context.Context, chunks []model.UploadChunk) {
+	for _, chunk := range chunks {
+		if err := s.blobs.Delete(ctx, chunk.StorageKey); err != nil && !errors.Is(err, model.ErrNotFound) {
+			slog.Error("failed to delete upload chunk", "key", chunk.StorageKey, "error", err)
+		}
+	}
+}
+
+// parseChecksum parses an Upload-Checksum value such as "sha1 <base64>".
+func parseChecksum(value string) (hash.Hash, []byte, error) {
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(value), " ")
+	if !ok {
+		return nil, nil, ErrUnsupportedChecksum
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, ErrUnsupportedChecksum
+	}
+
+	switch algorithm {
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	default:
+		return nil, nil, ErrUnsupportedChecksum
+	}
+}
+
+// countingReader counts the bytes read from r. A read error ends the
+// stream as if it were io.EOF and is kept in err, so that the bytes read
+// before it can still be stored.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, io.EOF
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// chunkReader reads a sequence of chunks from blob storage as one stream,
+// opening each chunk only when the previous one is exhausted.
+type chunkReader struct {
+	ctx     context.Context
+	blobs   model.BlobStore
+	chunks  []model.UploadChunk
+	current io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := r.blobs.Get(r.ctx, r.chunks[0].StorageKey, 0, -1)
+			if err != nil {
+				return 0, err
+			}
+			r.current = rc
+			r.chunks = r.chunks[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if errors.Is(err, io.EOF) {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memUploadStore struct {
+	mu      sync.Mutex
+	uploads map[uuid.UUID]model.Upload
+	chunks  map[uuid.UUID][]model.UploadChunk
+}
+
+func newMemUploadStore() *memUploadStore {
+	return &memUploadStore{
+		uploads: make(map[uuid.UUID]model.Upload),
+		chunks:  make(map[uuid.UUID][]model.UploadChunk),
+	}
+}
+
+func (m *memUploadStore) CreateUpload(ctx context.Context, upload *model.Upload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploads[upload.Id] = *upload
+	return nil
+}
+
+func (m *memUploadStore) GetUpload(ctx context.Context, id uuid.UUID) (model.Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	upload, ok := m.uploads[id]
+	if !ok {
+		return model.Upload{}, model.ErrNotFound
+	}
+	return upload, nil
+}
+
+func (m *memUploadStore) AppendChunk(ctx context.Context, chunk *model.UploadChunk) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	upload, ok := m.uploads[chunk.UploadID]
+	if !ok || upload.Offset != chunk.Offset || upload.Offset+chunk.Size > upload.Size {
+		return model.ErrConflict
+	}
+	upload.Offset += chunk.Size
+	m.uploads[chunk.UploadID] = upload
+	m.chunks[chunk.UploadID] = append(m.chunks[chunk.UploadID], *chunk)
+	return nil
+}
+
+func (m *memUploadStore) GetChunks(ctx context.Context, uploadID uuid.UUID) ([]model.UploadChunk, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chunks := append([]model.UploadChunk(nil), m.chunks[uploadID]...)
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Offset < chunks[j].Offset })
+	return chunks, nil
+}
+
+func (m *memUploadStore) PendingUploadSize(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var size int64
+	for _, upload := range m.uploads {
+		if upload.UserID == userID {
+			size += upload.Size
+		}
+	}
+	return size, nil
+}
+
+func (m *memUploadStore) DeleteUpload(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.uploads[id]; !ok {
+		return model.ErrNotFound
+	}
+	delete(m.uploads, id)
+	delete(m.chunks, id)
+	return nil
+}
+
+func sha1Checksum(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func newTestUploadService() (*service.UploadService, *memUploadStore, *memFileStore, *memBlobStore) {
+	uploads := newMemUploadStore()
+	files := newMemFileStore()
+	blobs := newMemBlobStore()
+	fs := service.NewFileService(files, blobs)
+	return service.NewUploadService(uploads, blobs, fs), uploads, files, blobs
+}
+
+func TestUploadService_ChunkedUpload(t *testing.T) {
+	svc, uploads, files, blobs := newTestUploadService()
+	ctx := context.Background()
+	userID := uuid.New()
+	content := []byte("the quick brown fox jumps over the lazy dog")
+
+	upload, file, err := svc.CreateUpload(ctx, userID, service.CreateUploadRequest{
+		Name:     "fox.txt",
+		MimeType: "text/plain",
+		Size:     int64(len(content)),
+	})
+	require.NoError(t, err)
+	assert.Nil(t, file)
+
+	first, second := content[:10], content[10:]
+
+	upload, file, err = svc.WriteChunk(ctx, userID, upload.Id, 0, bytes.NewReader(first), int64(len(first)), sha1Checksum(first))
+	require.NoError(t, err)
+	assert.Nil(t, file)
+	assert.Equal(t, int64(10), upload.Offset)
+
+	_, _, err = svc.WriteChunk(ctx, userID, upload.Id, 0, bytes.NewReader(first), int64(len(first)), "")
+	assert.ErrorIs(t, err, service.ErrOffsetMismatch)
+
+	_, _, err = svc.WriteChunk(ctx, uuid.New(), upload.Id, 10, bytes.NewReader(second), -1, "")
+	assert.ErrorIs(t, err, model.ErrNotFound, "other users must not see the upload")
+
+	upload, file, err = svc.WriteChunk(ctx, userID, upload.Id, 10, bytes.NewReader(second), -1, "")
+	require.NoError(t, err)
+	require.NotNil(t, file)
+	assert.Equal(t, int64(len(content)), upload.Offset)
+
+	assert.Equal(t, "fox.txt", file.Name)
+	assert.Contains(t, files.files, file.Id)
+	assert.Empty(t, uploads.uploads, "upload session should be removed after commit")
+
+	rc, err := blobs.Get(ctx, file.StorageKey, 0, -1)
+	require.NoError(t, err)
+	got, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	chunks, err := blobs.List(ctx, "uploads/")
+	require.NoError(t, err)
+	assert.Empty(t, chunks, "chunks should be removed after commit")
+}
+
+func TestUploadService_RejectedChunks(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	content := []byte("0123456789")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		length   int64
+		checksum string
+		wantErr  error
+	}{
+		{name: "checksum mismatch", data: content, length: 10, checksum: sha1Checksum([]byte("other")), wantErr: service.ErrChecksumMismatch},
+		{name: "unsupported checksum", data: content, length: 10, checksum: "crc32 AAAA", wantErr: service.ErrUnsupportedChecksum},
+		{name: "declared length too large", data: content, length: 11, wantErr: service.ErrUploadTooLarge},
+		{name: "body longer than upload", data: append(content, 'x'), length: -1, wantErr: service.ErrUploadTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, uploads, _, blobs := newTestUploadService()
+
+			upload, _, err := svc.CreateUpload(ctx, userID, service.CreateUploadRequest{Name: "f", Size: 10})
+			require.NoError(t, err)
+
+			_, _, err = svc.WriteChunk(ctx, userID, upload.Id, 0, bytes.NewReader(tt.data), tt.length, tt.checksum)
+			assert.ErrorIs(t, err, tt.wantErr)
+
+			stored, err := uploads.GetUpload(ctx, upload.Id)
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), stored.Offset)
+
+			chunks, err := blobs.List(ctx, "uploads/")
+			require.NoError(t, err)
+			assert.Empty(t, chunks)
+		})
+	}
+}
+
+func TestUploadService_InterruptedChunk(t *testing.T) {
+	svc, _, _, blobs := newTestUploadService()
+	ctx := context.Background()
+	userID := uuid.New()
+	content := []byte("the quick brown fox jumps over the lazy dog")
+
+	upload, _, err := svc.CreateUpload(ctx, userID, service.CreateUploadRequest{Name: "fox.txt", Size: int64(len(content))})
+	require.NoError(t, err)
+
+	// the connection drops after 16 of the declared bytes
+	body := io.MultiReader(bytes.NewReader(content[:16]), iotest.ErrReader(io.ErrUnexpectedEOF))
+	_, _, err = svc.WriteChunk(ctx, userID, upload.Id, 0, body, int64(len(content)), "")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// what a HEAD request reports
+	upload, err = svc.GetUpload(ctx, userID, upload.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), upload.Offset, "the bytes that arrived are kept")
+
+	_, file, err := svc.WriteChunk(ctx, userID, upload.Id, 16, bytes.NewReader(content[16:]), -1, "")
+	require.NoError(t, err)
+	require.NotNil(t, file)
+
+	rc, err := blobs.Get(ctx, file.StorageKey, 0, -1)
+	require.NoError(t, err)
+	got, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+}
+
+func TestUploadService_EmptyAndTerminate(t *testing.T) {
+	svc, uploads, files, blobs := newTestUploadService()
+	ctx := context.Background()
+	userID := uuid.New()
+
+	_, file, err := svc.CreateUpload(ctx, userID, service.CreateUploadRequest{Name: "empty", Size: 0})
+	require.NoError(t, err)
+	require.NotNil(t, file, "empty uploads are committed on creation")
+	assert.Contains(t, files.files, file.Id)
+
+	upload, _, err := svc.CreateUpload(ctx, userID, service.CreateUploadRequest{Name: "big", Size: 100})
+	require.NoError(t, err)
+	_, _, err = svc.WriteChunk(ctx, userID, upload.Id, 0, strings.NewReader("partial"), 7, "")
+	require.NoError(t, err)
+
+	require.NoError(t, svc.TerminateUpload(ctx, userID, upload.Id))
+	assert.NotContains(t, uploads.uploads, upload.Id)
+
+	chunks, err := blobs.List(ctx, "uploads/")
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/freekobie/kora/mail"
 	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/oidc"
 	"github.com/freekobie/kora/session"
+	"github.com/freekobie/kora/webauthn"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -16,11 +19,28 @@ import (
 const (
 	VERIFICATION   = "verification"
 	AUTHENTICATION = "authentication"
+	PASSWORD_RESET = "password_reset"
+	EMAIL_CHANGE   = "email_change"
+	TWO_FACTOR     = "two_factor"
+)
+
+const (
+	accessTokenTTL = 2 * time.Hour // TODO: make time shorter
+	// refreshTokenTTL applies to each refresh token in turn, so a session
+	// that keeps being refreshed does not expire.
+	refreshTokenTTL = 15 * (24 * time.Hour)
+	// MaxTokenLifetime is how long the longest lived JWT stays valid, and so
+	// how long a signing key must verify tokens after it stops signing.
+	MaxTokenLifetime = refreshTokenTTL
 )
 
 type UserService struct {
 	store model.UserStore
 	mail  *mail.Mailer
+	// oidc is the identity provider for single sign-on, if one is set up.
+	oidc *oidc.Provider
+	// webauthn is the relying party for passkeys, if they are set up.
+	webauthn *webauthn.RelyingParty
 }
 
 func NewUserService(us model.UserStore, m *mail.Mailer) *UserService {
@@ -47,6 +67,7 @@ func (s *UserService) CreateUser(ctx context.Context, name, email, password stri
 		CreatedAt:    now,
 		LastModifed:  now,
 		Verified:     false,
+		Role:         model.RoleUser,
 	}
 
 	if err := s.store.InsertUser(ctx, user); err != nil {
@@ -83,7 +104,7 @@ func (us *UserService) VerifyUser(ctx context.Context, code string, email string
 	user, err := us.store.GetUserForToken(ctx, hash, VERIFICATION, email)
 	if err != nil {
 		if errors.Is(err, model.ErrNotFound) {
-			return nil, ErrInvalidToken
+			return nil, us.wrongCode(ctx, email, VERIFICATION)
 		}
 		return nil, err
 	}
@@ -97,6 +118,7 @@ func (us *UserService) VerifyUser(ctx context.Context, code string, email string
 
 	// Delete otp after successful verification
 	_ = us.store.DeleteToken(ctx, hash, VERIFICATION)
+	us.clearAttempts(ctx, codeAttemptKey(VERIFICATION, user.Id))
 
 	address := mail.Address{Name: user.Name, Email: user.Email}
 	us.sendEmail([]mail.Address{address}, "welcome_email.gotmpl", mail.Data{"Address": address})
@@ -140,9 +162,192 @@ func (us *UserService) ResendVerificationEmail(ctx context.Context, email string
 	return nil
 }
 
-func (us *UserService) NewSession(ctx context.Context, email string, password string) (*session.UserSession, error) {
+// RequestPasswordReset emails a one-time code for resetting the password of
+// the account with the given email. Unknown addresses are ignored without
+// an error, so callers cannot tell whether an account exists.
+func (us *UserService) RequestPasswordReset(ctx context.Context, email string) error {
 	user, err := us.store.GetUserByMail(ctx, email)
 	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// only the most recent code works
+	if err := us.store.DeleteUserTokens(ctx, user.Id, PASSWORD_RESET); err != nil {
+		return err
+	}
+
+	otpString := generateOTP()
+	token := model.UserToken{
+		Hash:      hashString(otpString),
+		UserId:    user.Id,
+		ExpiresAt: time.Now().Add(15 * time.Minute),
+		Scope:     PASSWORD_RESET,
+	}
+	if err := us.store.InsertToken(ctx, &token); err != nil {
+		return err
+	}
+
+	userAddr := mail.Address{Name: user.Name, Email: user.Email}
+	us.sendEmail([]mail.Address{userAddr}, "reset_password.gotmpl", mail.Data{
+		"Address": userAddr,
+		"Code":    otpString,
+	})
+
+	return nil
+}
+
+// ResetPassword sets a new password using a code sent by
+// RequestPasswordReset. All of the user's sessions are ended.
+func (us *UserService) ResetPassword(ctx context.Context, email, code, password string) error {
+	if len(password) < 8 || len(password) > 20 {
+		return ErrInvalidPassword
+	}
+
+	hash := hashString(code)
+	user, err := us.store.GetUserForToken(ctx, hash, PASSWORD_RESET, email)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return us.wrongCode(ctx, email, PASSWORD_RESET)
+		}
+		return err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.Error("failed to hash password", "error", err)
+		return ErrFailedOperation
+	}
+	user.PasswordHash = passwordHash
+	user.LastModifed = time.Now().UTC()
+	if err := us.store.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	if err := us.store.DeleteUserTokens(ctx, user.Id, PASSWORD_RESET); err != nil {
+		slog.Error("failed to delete password reset codes", "user", user.Id, "error", err)
+	}
+	us.clearAttempts(ctx, codeAttemptKey(PASSWORD_RESET, user.Id))
+	// a new password is a fresh start for a locked account
+	us.clearAttempts(ctx, accountAttemptKey(user.Id))
+
+	return us.LogoutEverywhere(ctx, user.Id)
+}
+
+// RequestEmailChange starts moving a user's account to newEmail. The
+// current password must be given. A code is sent to the new address and the
+// old one is told about the request; the email only changes once
+// ConfirmEmailChange is called with the code.
+func (us *UserService) RequestEmailChange(ctx context.Context, userID uuid.UUID, newEmail, password string) error {
+	user, err := us.store.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		slog.Error("failed to compare password and hash", "error", err)
+		return ErrFailedOperation
+	}
+
+	if strings.EqualFold(user.Email, newEmail) {
+		return ErrSameEmail
+	}
+	if _, err := us.store.GetUserByMail(ctx, newEmail); err == nil {
+		return ErrEmailInUse
+	} else if !errors.Is(err, model.ErrNotFound) {
+		return err
+	}
+
+	// only the most recent request can be confirmed
+	if err := us.store.DeleteUserTokens(ctx, user.Id, EMAIL_CHANGE); err != nil {
+		return err
+	}
+
+	otpString := generateOTP()
+	token := model.UserToken{
+		Hash:      hashString(otpString),
+		UserId:    user.Id,
+		ExpiresAt: time.Now().Add(15 * time.Minute),
+		Scope:     EMAIL_CHANGE,
+		NewEmail:  newEmail,
+	}
+	if err := us.store.InsertToken(ctx, &token); err != nil {
+		return err
+	}
+
+	newAddr := mail.Address{Name: user.Name, Email: newEmail}
+	us.sendEmail([]mail.Address{newAddr}, "verify_email_change.gotmpl", mail.Data{
+		"Address": newAddr,
+		"Code":    otpString,
+	})
+	oldAddr := mail.Address{Name: user.Name, Email: user.Email}
+	us.sendEmail([]mail.Address{oldAddr}, "email_change_notice.gotmpl", mail.Data{
+		"Address":  oldAddr,
+		"NewEmail": newEmail,
+	})
+
+	return nil
+}
+
+// ConfirmEmailChange switches a user's email to the address the code was
+// sent to by RequestEmailChange. All of the user's sessions are ended.
+func (us *UserService) ConfirmEmailChange(ctx context.Context, userID uuid.UUID, code string) (*model.User, error) {
+	token, err := us.store.GetToken(ctx, hashString(code), EMAIL_CHANGE)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil || token.UserId != userID || token.NewEmail == "" {
+		return nil, us.failedCodeGuess(ctx, userID, EMAIL_CHANGE)
+	}
+
+	if err := us.store.ChangeEmail(ctx, userID, token.NewEmail); err != nil {
+		if errors.Is(err, model.ErrDuplicateUser) {
+			return nil, ErrEmailInUse
+		}
+		return nil, err
+	}
+	us.clearAttempts(ctx, codeAttemptKey(EMAIL_CHANGE, userID))
+
+	if err := us.LogoutEverywhere(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	user, err := us.store.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// NewSession logs a user in on the device described by client and returns a
+// refresh token for the new session. Users with two-factor authentication
+// get a challenge token instead, to be passed to VerifyTwoFactor along with
+// a code.
+//
+// Failed logins are counted per account and per client address. After a few
+// failures further attempts are refused for a time that doubles with each
+// failure, and an account is locked, and its owner told, after
+// accountLockoutThreshold failures. Refused attempts get a
+// TooManyAttemptsError.
+func (us *UserService) NewSession(ctx context.Context, email string, password string, client model.ClientInfo) (*session.UserSession, error) {
+	ipKey := ipAttemptKey(client.IPAddress)
+	if err := us.checkAttempts(ctx, ipKey); err != nil {
+		return nil, err
+	}
+
+	user, err := us.store.GetUserByMail(ctx, email)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			us.recordFailure(ctx, ipKey, 0, 0)
+			return nil, ErrInvalidCredentials
+		}
 		return nil, err
 	}
 
@@ -150,28 +355,45 @@ func (us *UserService) NewSession(ctx context.Context, email string, password st
 		return nil, ErrUnverifiedUser
 	}
 
+	if err := us.checkAttempts(ctx, accountAttemptKey(user.Id)); err != nil {
+		return nil, err
+	}
+
 	err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password))
 	if err != nil {
 		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			us.failedLogin(ctx, user, client.IPAddress)
 			return nil, ErrInvalidCredentials
 		}
 		slog.Error("failed to compare password and hash", "error", err.Error())
 		return nil, ErrFailedOperation
 	}
 
-	ttl := 15 * (24 * time.Hour)
-	refresh, err := session.GenerateToken(user.Id, user.Email, ttl, session.TokenTypeRefresh)
-	if err != nil {
-		return nil, ErrFailedOperation
+	tf, err := us.store.GetTwoFactor(ctx, user.Id)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && tf.Enabled {
+		return us.newTwoFactorChallenge(ctx, user)
 	}
 
-	expiresAt := time.Now().Add(ttl)
-	tokenHash := hashString(refresh)
-	token := model.UserToken{
-		Hash:      tokenHash,
-		UserId:    user.Id,
-		ExpiresAt: expiresAt,
-		Scope:     AUTHENTICATION,
+	us.clearAttempts(ctx, accountAttemptKey(user.Id))
+
+	return us.startSession(ctx, user, client)
+}
+
+// startSession issues the refresh token of a new session for user.
+func (us *UserService) startSession(ctx context.Context, user model.User, client model.ClientInfo) (*session.UserSession, error) {
+	// every login starts a new token family
+	now := time.Now().UTC()
+	refresh, token, err := newRefreshToken(&user, model.UserToken{
+		FamilyID:  uuid.New(),
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, ErrFailedOperation
 	}
 
 	err = us.store.InsertToken(ctx, &token)
@@ -182,13 +404,18 @@ func (us *UserService) NewSession(ctx context.Context, email string, password st
 	session := &session.UserSession{
 		User:         user,
 		RefreshToken: refresh,
-		ExpiresAt:    expiresAt,
+		ExpiresAt:    token.ExpiresAt,
 	}
 
 	return session, nil
 }
 
-func (us *UserService) RefreshSession(ctx context.Context, refreshToken string) (*session.UserAccess, error) {
+// RefreshSession exchanges a refresh token for a new access token and a new
+// refresh token in the same family. Each refresh token works only once:
+// presenting one that has already been exchanged means it has leaked, so
+// the whole family is revoked and the user has to log in again. The session
+// is recorded as last used from client.
+func (us *UserService) RefreshSession(ctx context.Context, refreshToken string, client model.ClientInfo) (*session.UserAccess, error) {
 	claims, err := session.ValidateToken(refreshToken, session.TokenTypeRefresh)
 	if err != nil {
 		slog.Error("failed token validation", "error", err.Error())
@@ -197,30 +424,187 @@ func (us *UserService) RefreshSession(ctx context.Context, refreshToken string)
 
 	hash := hashString(refreshToken)
 
-	user, err := us.store.GetUserForToken(ctx, hash, AUTHENTICATION, claims.Email)
+	token, err := us.store.GetToken(ctx, hash, AUTHENTICATION)
 	if err != nil {
 		if errors.Is(err, model.ErrNotFound) {
 			return nil, ErrInvalidToken
 		}
 		return nil, err
 	}
+	if token.RotatedAt != nil {
+		us.revokeFamily(ctx, token)
+		return nil, ErrInvalidToken
+	}
 
-	ttl := 2 * time.Hour // TODO: make time shorter
-	accessToken, err := session.GenerateToken(user.Id, user.Email, ttl, session.TokenTypeAccess)
+	user, err := us.store.GetUser(ctx, token.UserId)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if user.Email != claims.Email {
+		return nil, ErrInvalidToken
+	}
+
+	refresh, next, err := newRefreshToken(&user, model.UserToken{
+		FamilyID:  token.FamilyID,
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+		CreatedAt: token.CreatedAt,
+	})
+	if err != nil {
+		return nil, ErrFailedOperation
+	}
+	if err := us.store.RotateToken(ctx, hash, &next); err != nil {
+		if errors.Is(err, model.ErrConflict) {
+			// another request rotated the same token first
+			us.revokeFamily(ctx, token)
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	accessToken, err := session.GenerateToken(&user, token.FamilyID, accessTokenTTL, session.TokenTypeAccess)
 	if err != nil {
 		return nil, err
 	}
 	// FIXME: obtain expiry time from GenerateToken function
 	useracc := &session.UserAccess{
-		AccessToken: accessToken,
-		ExpiresAt:   time.Now().Add(ttl),
+		AccessToken:      accessToken,
+		ExpiresAt:        time.Now().Add(accessTokenTTL),
+		RefreshToken:     refresh,
+		RefreshExpiresAt: next.ExpiresAt,
 	}
 
 	return useracc, nil
 }
 
-// UpdateUser updates an existing user's details
-func (us *UserService) UpdateUser(ctx context.Context, userData map[string]any) (*model.User, error) {
+// Logout ends the session a refresh token belongs to by revoking its whole
+// token family.
+func (us *UserService) Logout(ctx context.Context, refreshToken string) error {
+	token, err := us.store.GetToken(ctx, hashString(refreshToken), AUTHENTICATION)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+
+	if err := us.store.DeleteTokenFamily(ctx, token.FamilyID); err != nil {
+		return err
+	}
+
+	return revokeAccess(ctx, token.FamilyID)
+}
+
+// LogoutEverywhere ends all of a user's sessions.
+func (us *UserService) LogoutEverywhere(ctx context.Context, userID uuid.UUID) error {
+	sessions, err := us.store.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := us.store.DeleteUserTokens(ctx, userID, AUTHENTICATION); err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if err := revokeAccess(ctx, s.Id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListSessions returns the devices userID is signed in on. The session
+// current was made in is marked as such.
+func (us *UserService) ListSessions(ctx context.Context, userID, current uuid.UUID) ([]model.Session, error) {
+	sessions, err := us.store.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sessions == nil {
+		sessions = []model.Session{}
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == current
+	}
+
+	return sessions, nil
+}
+
+// logoutOthers ends all of a user's sessions except current, the one the
+// request was made in.
+func (us *UserService) logoutOthers(ctx context.Context, userID, current uuid.UUID) error {
+	sessions, err := us.store.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		if s.Id == current {
+			continue
+		}
+		if err := us.RevokeSession(ctx, userID, s.Id); err != nil && !errors.Is(err, model.ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RevokeSession signs userID out of one of their sessions. Its refresh
+// tokens are deleted and its access tokens are rejected from now on.
+func (us *UserService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	if err := us.store.DeleteSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	return revokeAccess(ctx, sessionID)
+}
+
+// revokeAccess rejects the access tokens already issued for a session for
+// as long as they would otherwise stay valid. It is recorded even if the
+// request is cancelled, since the session's refresh tokens are gone by then.
+func revokeAccess(ctx context.Context, sessionID uuid.UUID) error {
+	return session.RevokeSession(context.WithoutCancel(ctx), sessionID.String(), time.Now().Add(accessTokenTTL))
+}
+
+// newRefreshToken signs a refresh token for user in the session described by
+// token and returns it along with the record to store for it.
+func newRefreshToken(user *model.User, token model.UserToken) (string, model.UserToken, error) {
+	refresh, err := session.GenerateToken(user, token.FamilyID, refreshTokenTTL, session.TokenTypeRefresh)
+	if err != nil {
+		return "", model.UserToken{}, err
+	}
+
+	now := time.Now().UTC()
+	token.Hash = hashString(refresh)
+	token.UserId = user.Id
+	token.ExpiresAt = now.Add(refreshTokenTTL)
+	token.Scope = AUTHENTICATION
+	token.LastUsedAt = now
+
+	return refresh, token, nil
+}
+
+// revokeFamily deletes every refresh token in the family of a token that was
+// used after being rotated.
+func (us *UserService) revokeFamily(ctx context.Context, token model.UserToken) {
+	slog.Warn("refresh token reused, revoking its family", "user", token.UserId, "family", token.FamilyID)
+	if err := us.store.DeleteTokenFamily(context.WithoutCancel(ctx), token.FamilyID); err != nil {
+		slog.Error("failed to revoke token family", "family", token.FamilyID, "error", err)
+	}
+	if err := revokeAccess(ctx, token.FamilyID); err != nil {
+		slog.Error("failed to revoke session", "family", token.FamilyID, "error", err)
+	}
+}
+
+// UpdateUser updates an existing user's details. Changing the password
+// signs the user out of every session but sessionID, the one the request was
+// made in.
+func (us *UserService) UpdateUser(ctx context.Context, sessionID uuid.UUID, userData map[string]any) (*model.User, error) {
 	id, ok := userData["id"]
 	if !ok {
 		return nil, errors.New("user id not found")
@@ -241,6 +625,7 @@ func (us *UserService) UpdateUser(ctx context.Context, userData map[string]any)
 		user.ProfilePhoto = profilePhoto.(string)
 	}
 
+	passwordChanged := false
 	password, ok := userData["password"]
 	if ok {
 		if len(password.(string)) < 8 || len(password.(string)) > 20 {
@@ -255,6 +640,7 @@ func (us *UserService) UpdateUser(ctx context.Context, userData map[string]any)
 				}
 
 				user.PasswordHash = hash
+				passwordChanged = true
 			} else {
 				slog.Error("failed to compare password and hash", "error", err.Error())
 				return nil, ErrFailedOperation
@@ -270,6 +656,12 @@ func (us *UserService) UpdateUser(ctx context.Context, userData map[string]any)
 		return nil, err
 	}
 
+	if passwordChanged {
+		if err := us.logoutOthers(ctx, user.Id, sessionID); err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
 
@@ -282,6 +674,36 @@ func (s *UserService) FetchUser(ctx context.Context, id uuid.UUID) (*model.User,
 	return &user, nil
 }
 
+// SetUserRole changes a user's role. Access tokens carry the role, so the
+// user is signed out everywhere to keep tokens issued before the change from
+// being used with the old one.
+func (s *UserService) SetUserRole(ctx context.Context, id uuid.UUID, role string) (*model.User, error) {
+	if role != model.RoleUser && role != model.RoleAdmin {
+		return nil, ErrInvalidRole
+	}
+
+	user, err := s.store.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Role == role {
+		return &user, nil
+	}
+
+	user.Role = role
+	user.LastModifed = time.Now().UTC()
+	if err := s.store.UpdateUser(ctx, &user); err != nil {
+		return nil, err
+	}
+
+	if err := s.LogoutEverywhere(ctx, user.Id); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 // DeleteUser removes a user from the system
 func (s *UserService) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	return s.store.DeleteUser(ctx, id)
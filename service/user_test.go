@@ -0,0 +1,515 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/mail"
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/freekobie/kora/session"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memUserStore is an in-memory model.UserStore. Methods that a test does not
+// need fall through to the embedded nil interface and panic.
+type memUserStore struct {
+	model.UserStore
+	users     map[uuid.UUID]model.User
+	tokens    map[string]model.UserToken
+	twoFactor map[uuid.UUID]model.TwoFactor
+	// recovery maps recovery code hashes to their users.
+	recovery     map[string]uuid.UUID
+	accessTokens []memAccessToken
+	attempts     map[string]model.LoginAttempts
+	oidcStates   map[string]model.OIDCState
+	// identities maps issuer and subject to linked identities.
+	identities map[[2]string]model.Identity
+	// webauthnChallenges maps challenge hashes to ceremonies in progress.
+	webauthnChallenges map[string]model.WebAuthnChallenge
+	passkeys           []model.Passkey
+}
+
+func newMemUserStore() *memUserStore {
+	return &memUserStore{
+		users:      make(map[uuid.UUID]model.User),
+		tokens:     make(map[string]model.UserToken),
+		twoFactor:  make(map[uuid.UUID]model.TwoFactor),
+		recovery:   make(map[string]uuid.UUID),
+		attempts:   make(map[string]model.LoginAttempts),
+		oidcStates: make(map[string]model.OIDCState),
+		identities: make(map[[2]string]model.Identity),
+
+		webauthnChallenges: make(map[string]model.WebAuthnChallenge),
+	}
+}
+
+// addUser stores a verified user whose password is "password".
+func (m *memUserStore) addUser(email string) model.User {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	user := model.User{Id: uuid.New(), Name: email, Email: email, PasswordHash: hash, Role: model.RoleUser, Verified: true}
+	m.users[user.Id] = user
+	return user
+}
+
+func (m *memUserStore) GetUser(ctx context.Context, id uuid.UUID) (model.User, error) {
+	user, ok := m.users[id]
+	if !ok {
+		return model.User{}, model.ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *memUserStore) InsertUser(ctx context.Context, user *model.User) error {
+	if _, err := m.GetUserByMail(ctx, user.Email); err == nil {
+		return model.ErrDuplicateUser
+	}
+	m.users[user.Id] = *user
+	return nil
+}
+
+func (m *memUserStore) GetUserByMail(ctx context.Context, email string) (model.User, error) {
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return model.User{}, model.ErrNotFound
+}
+
+func (m *memUserStore) UpdateUser(ctx context.Context, user *model.User) error {
+	if _, ok := m.users[user.Id]; !ok {
+		return model.ErrNotFound
+	}
+	m.users[user.Id] = *user
+	return nil
+}
+
+func (m *memUserStore) GetUserForToken(ctx context.Context, tokenHash, scope, email string) (*model.User, error) {
+	token, err := m.GetToken(ctx, tokenHash, scope)
+	if err != nil {
+		return nil, err
+	}
+	user, ok := m.users[token.UserId]
+	if !ok || !strings.EqualFold(user.Email, email) {
+		return nil, model.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (m *memUserStore) ChangeEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	for _, other := range m.users {
+		if other.Id != userID && strings.EqualFold(other.Email, email) {
+			return model.ErrDuplicateUser
+		}
+	}
+	user, ok := m.users[userID]
+	if !ok {
+		return model.ErrNotFound
+	}
+	user.Email = email
+	m.users[userID] = user
+	return m.DeleteUserTokens(ctx, userID, service.EMAIL_CHANGE)
+}
+
+func (m *memUserStore) InsertToken(ctx context.Context, token *model.UserToken) error {
+	m.tokens[token.Hash] = *token
+	return nil
+}
+
+func (m *memUserStore) DeleteToken(ctx context.Context, tokenHash, scope string) error {
+	if token, ok := m.tokens[tokenHash]; ok && token.Scope == scope {
+		delete(m.tokens, tokenHash)
+	}
+	return nil
+}
+
+func (m *memUserStore) GetToken(ctx context.Context, tokenHash, scope string) (model.UserToken, error) {
+	token, ok := m.tokens[tokenHash]
+	if !ok || token.Scope != scope || !token.ExpiresAt.After(time.Now()) {
+		return model.UserToken{}, model.ErrNotFound
+	}
+	return token, nil
+}
+
+func (m *memUserStore) RotateToken(ctx context.Context, oldHash string, next *model.UserToken) error {
+	token, ok := m.tokens[oldHash]
+	if !ok || token.RotatedAt != nil {
+		return model.ErrConflict
+	}
+	now := time.Now()
+	token.RotatedAt = &now
+	m.tokens[oldHash] = token
+	m.tokens[next.Hash] = *next
+	return nil
+}
+
+func (m *memUserStore) DeleteTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	for hash, token := range m.tokens {
+		if token.FamilyID == familyID {
+			delete(m.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (m *memUserStore) DeleteUserTokens(ctx context.Context, userID uuid.UUID, scope string) error {
+	for hash, token := range m.tokens {
+		if token.UserId == userID && token.Scope == scope {
+			delete(m.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (m *memUserStore) ListSessions(ctx context.Context, userID uuid.UUID) ([]model.Session, error) {
+	var sessions []model.Session
+	for _, token := range m.tokens {
+		if token.UserId == userID && token.Scope == service.AUTHENTICATION && token.RotatedAt == nil {
+			sessions = append(sessions, model.Session{
+				Id:         token.FamilyID,
+				UserAgent:  token.UserAgent,
+				IPAddress:  token.IPAddress,
+				CreatedAt:  token.CreatedAt,
+				LastUsedAt: token.LastUsedAt,
+				ExpiresAt:  token.ExpiresAt,
+			})
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memUserStore) DeleteSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	found := false
+	for hash, token := range m.tokens {
+		if token.UserId == userID && token.FamilyID == sessionID {
+			delete(m.tokens, hash)
+			found = true
+		}
+	}
+	if !found {
+		return model.ErrNotFound
+	}
+	return nil
+}
+
+// newTestMailer returns a mailer that delivers to a local server. Sent
+// messages arrive on the returned channel.
+func newTestMailer(t *testing.T) (*mail.Mailer, <-chan mail.Message) {
+	sent := make(chan mail.Message, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg mail.Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sent <- msg
+	}))
+	t.Cleanup(srv.Close)
+
+	return mail.NewMailer(&mail.Config{Host: srv.URL, Timeout: time.Second}), sent
+}
+
+var codePattern = regexp.MustCompile(`\b\d{6}\b`)
+
+// receiveCode waits for the next message and returns the code in it.
+func receiveCode(t *testing.T, sent <-chan mail.Message) string {
+	t.Helper()
+	select {
+	case msg := <-sent:
+		code := codePattern.FindString(msg.Text)
+		require.NotEmpty(t, code, "message has no code: %s", msg.Text)
+		return code
+	case <-time.After(2 * time.Second):
+		t.Fatal("no email was sent")
+		return ""
+	}
+}
+
+// receiveMail waits for n messages and returns their text by recipient.
+func receiveMail(t *testing.T, sent <-chan mail.Message, n int) map[string]string {
+	t.Helper()
+	texts := make(map[string]string)
+	for range n {
+		select {
+		case msg := <-sent:
+			texts[msg.To[0].Email] = msg.Text
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d of %d emails", len(texts), n)
+		}
+	}
+	return texts
+}
+
+func TestUserService_RefreshSession(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	login, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+
+	first, err := svc.RefreshSession(ctx, login.RefreshToken, model.ClientInfo{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.AccessToken)
+	assert.NotEqual(t, login.RefreshToken, first.RefreshToken, "refresh tokens are rotated")
+
+	second, err := svc.RefreshSession(ctx, first.RefreshToken, model.ClientInfo{})
+	require.NoError(t, err)
+
+	// reusing a rotated token revokes the whole family, including the
+	// newest token
+	_, err = svc.RefreshSession(ctx, login.RefreshToken, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+	_, err = svc.RefreshSession(ctx, second.RefreshToken, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+
+	// other sessions are not affected
+	other, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	_, err = svc.RefreshSession(ctx, other.RefreshToken, model.ClientInfo{})
+	assert.NoError(t, err)
+}
+
+func TestUserService_Logout(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	phone, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	laptop, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+
+	refreshed, err := svc.RefreshSession(ctx, phone.RefreshToken, model.ClientInfo{})
+	require.NoError(t, err)
+	require.NoError(t, svc.Logout(ctx, refreshed.RefreshToken))
+	_, err = svc.RefreshSession(ctx, refreshed.RefreshToken, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+	assert.ErrorIs(t, svc.Logout(ctx, refreshed.RefreshToken), service.ErrInvalidToken)
+
+	_, err = svc.RefreshSession(ctx, laptop.RefreshToken, model.ClientInfo{})
+	require.NoError(t, err, "logging out ends only the current session")
+
+	again, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	require.NoError(t, svc.LogoutEverywhere(ctx, user.Id))
+	_, err = svc.RefreshSession(ctx, again.RefreshToken, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+	assert.Empty(t, users.tokens)
+}
+
+func TestUserService_UpdatePassword(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	phone, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	laptop, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	phoneAccess, err := svc.RefreshSession(ctx, phone.RefreshToken, model.ClientInfo{})
+	require.NoError(t, err)
+	laptopAccess, err := svc.RefreshSession(ctx, laptop.RefreshToken, model.ClientInfo{})
+	require.NoError(t, err)
+	phoneClaims, err := session.ValidateToken(phoneAccess.AccessToken, session.TokenTypeAccess)
+	require.NoError(t, err)
+	laptopClaims, err := session.ValidateToken(laptopAccess.AccessToken, session.TokenTypeAccess)
+	require.NoError(t, err)
+	current := uuid.MustParse(phoneClaims.SessionID)
+
+	// keeping the same password ends no sessions
+	_, err = svc.UpdateUser(ctx, current, map[string]any{"id": user.Id, "password": "password"})
+	require.NoError(t, err)
+	sessions, err := svc.ListSessions(ctx, user.Id, current)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	_, err = svc.UpdateUser(ctx, current, map[string]any{"id": user.Id, "password": "new password"})
+	require.NoError(t, err)
+
+	_, err = svc.RefreshSession(ctx, laptopAccess.RefreshToken, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken, "other sessions end when the password changes")
+	revoked, err := session.IsRevoked(ctx, laptopClaims.SessionID)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	_, err = svc.RefreshSession(ctx, phoneAccess.RefreshToken, model.ClientInfo{})
+	assert.NoError(t, err, "the session that changed the password is kept")
+	revoked, err = session.IsRevoked(ctx, phoneClaims.SessionID)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestUserService_SetUserRole(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	_, err := svc.SetUserRole(ctx, user.Id, "owner")
+	assert.ErrorIs(t, err, service.ErrInvalidRole)
+
+	login, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+	access, err := svc.RefreshSession(ctx, login.RefreshToken, model.ClientInfo{})
+	require.NoError(t, err)
+	claims, err := session.ValidateToken(access.AccessToken, session.TokenTypeAccess)
+	require.NoError(t, err)
+
+	updated, err := svc.SetUserRole(ctx, user.Id, model.RoleAdmin)
+	require.NoError(t, err)
+	assert.Equal(t, model.RoleAdmin, updated.Role)
+	assert.Equal(t, model.RoleAdmin, users.users[user.Id].Role)
+
+	_, err = svc.RefreshSession(ctx, access.RefreshToken, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken, "changing the role ends the user's sessions")
+	revoked, err := session.IsRevoked(ctx, claims.SessionID)
+	require.NoError(t, err)
+	assert.True(t, revoked, "access tokens with the old role are rejected")
+}
+
+func TestUserService_Sessions(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	svc := service.NewUserService(users, nil)
+
+	phone := model.ClientInfo{UserAgent: "Phone", IPAddress: "10.0.0.1"}
+	laptop := model.ClientInfo{UserAgent: "Laptop", IPAddress: "10.0.0.2"}
+
+	login, err := svc.NewSession(ctx, user.Email, "password", phone)
+	require.NoError(t, err)
+	_, err = svc.NewSession(ctx, user.Email, "password", laptop)
+	require.NoError(t, err)
+
+	// refreshing from a new address keeps the session and updates it
+	access, err := svc.RefreshSession(ctx, login.RefreshToken, model.ClientInfo{UserAgent: "Phone", IPAddress: "10.0.0.3"})
+	require.NoError(t, err)
+	claims, err := session.ValidateToken(access.AccessToken, session.TokenTypeAccess)
+	require.NoError(t, err)
+	current := uuid.MustParse(claims.SessionID)
+
+	sessions, err := svc.ListSessions(ctx, user.Id, current)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	var phoneSession model.Session
+	for _, s := range sessions {
+		if s.Current {
+			phoneSession = s
+		}
+	}
+	assert.Equal(t, current, phoneSession.Id)
+	assert.Equal(t, "Phone", phoneSession.UserAgent)
+	assert.Equal(t, "10.0.0.3", phoneSession.IPAddress)
+
+	assert.ErrorIs(t, svc.RevokeSession(ctx, uuid.New(), current), model.ErrNotFound, "only the user can revoke their sessions")
+	require.NoError(t, svc.RevokeSession(ctx, user.Id, current))
+	revoked, err := session.IsRevoked(ctx, claims.SessionID)
+	require.NoError(t, err)
+	assert.True(t, revoked, "access tokens of a revoked session are rejected")
+	_, err = svc.RefreshSession(ctx, access.RefreshToken, phone)
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+
+	sessions, err = svc.ListSessions(ctx, user.Id, current)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "Laptop", sessions[0].UserAgent)
+	assert.False(t, sessions[0].Current)
+}
+
+func TestUserService_ResetPassword(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	mailer, sent := newTestMailer(t)
+	svc := service.NewUserService(users, mailer)
+
+	login, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RequestPasswordReset(ctx, "nobody@example.com"), "unknown addresses look like known ones")
+
+	require.NoError(t, svc.RequestPasswordReset(ctx, user.Email))
+	stale := receiveCode(t, sent)
+	require.NoError(t, svc.RequestPasswordReset(ctx, user.Email))
+	code := receiveCode(t, sent)
+	if stale != code {
+		assert.ErrorIs(t, svc.ResetPassword(ctx, user.Email, stale, "new-password"), service.ErrInvalidToken, "a new code replaces the old one")
+	}
+
+	assert.ErrorIs(t, svc.ResetPassword(ctx, user.Email, code, "short"), service.ErrInvalidPassword)
+	assert.ErrorIs(t, svc.ResetPassword(ctx, "bob@example.com", code, "new-password"), service.ErrInvalidToken)
+	require.NoError(t, svc.ResetPassword(ctx, user.Email, code, "new-password"))
+	assert.ErrorIs(t, svc.ResetPassword(ctx, user.Email, code, "other-password"), service.ErrInvalidToken, "codes work once")
+
+	_, err = svc.RefreshSession(ctx, login.RefreshToken, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken, "existing sessions end")
+	_, err = svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	_, err = svc.NewSession(ctx, user.Email, "new-password", model.ClientInfo{})
+	assert.NoError(t, err)
+}
+
+func TestUserService_ChangeEmail(t *testing.T) {
+	ctx := context.Background()
+
+	users := newMemUserStore()
+	user := users.addUser("alice@example.com")
+	bob := users.addUser("bob@example.com")
+	mailer, sent := newTestMailer(t)
+	svc := service.NewUserService(users, mailer)
+
+	login, err := svc.NewSession(ctx, user.Email, "password", model.ClientInfo{})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.RequestEmailChange(ctx, user.Id, "alice@new.example.com", "wrong"), service.ErrInvalidCredentials)
+	assert.ErrorIs(t, svc.RequestEmailChange(ctx, user.Id, "Alice@example.com", "password"), service.ErrSameEmail)
+	assert.ErrorIs(t, svc.RequestEmailChange(ctx, user.Id, bob.Email, "password"), service.ErrEmailInUse)
+
+	require.NoError(t, svc.RequestEmailChange(ctx, user.Id, "alice@new.example.com", "password"))
+	recipients := receiveMail(t, sent, 2)
+	code := codePattern.FindString(recipients["alice@new.example.com"])
+	require.NotEmpty(t, code, "the code goes to the new address")
+	assert.Contains(t, recipients["alice@example.com"], "alice@new.example.com", "the old address is told about the change")
+	assert.NotContains(t, recipients["alice@example.com"], code)
+
+	_, err = svc.ConfirmEmailChange(ctx, bob.Id, code)
+	assert.ErrorIs(t, err, service.ErrInvalidToken, "codes belong to the user who asked for them")
+
+	changed, err := svc.ConfirmEmailChange(ctx, user.Id, code)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@new.example.com", changed.Email)
+	_, err = svc.ConfirmEmailChange(ctx, user.Id, code)
+	assert.ErrorIs(t, err, service.ErrInvalidToken, "codes work once")
+
+	_, err = svc.RefreshSession(ctx, login.RefreshToken, model.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken, "existing sessions end")
+	_, err = svc.NewSession(ctx, "alice@new.example.com", "password", model.ClientInfo{})
+	assert.NoError(t, err)
+
+	// the address was taken after the code was sent
+	require.NoError(t, svc.RequestEmailChange(ctx, bob.Id, "carol@example.com", "password"))
+	code = codePattern.FindString(receiveMail(t, sent, 2)["carol@example.com"])
+	users.addUser("carol@example.com")
+	_, err = svc.ConfirmEmailChange(ctx, bob.Id, code)
+	assert.ErrorIs(t, err, service.ErrEmailInUse)
+}
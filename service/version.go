@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+)
+
+// DefaultVersionRetention applies to users who have not set their own limits.
+var DefaultVersionRetention = model.VersionRetention{MaxVersions: 100}
+
+// UploadVersion stores an uploaded file as the new current version of the
+// file id.
+func (s *FileService) UploadVersion(ctx context.Context, userID, id uuid.UUID, file multipart.File, header *multipart.FileHeader) (*model.File, error) {
+	return s.SaveVersion(ctx, userID, id, file, header.Size, header.Header.Get("Content-Type"))
+}
+
+// SaveVersion writes the contents of r to blob storage as a new version of
+// the file id and makes it current. An empty mimeType keeps the file's type.
+// Like SaveFile it enforces the owner's quota. Versions beyond the owner's
+// retention limits are removed afterwards.
+func (s *FileService) SaveVersion(ctx context.Context, userID, id uuid.UUID, r io.Reader, size int64, mimeType string) (*model.File, error) {
+	file, err := s.file(ctx, userID, id, model.AccessEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	oldKey := file.StorageKey
+	file.StorageKey = fmt.Sprintf("%s/%s", file.UserID, uuid.New())
+	file.Size = size
+	if mimeType != "" {
+		file.MimeType = mimeType
+	}
+	file.LastModified = time.Now().UTC()
+
+	var reservation uuid.UUID
+	file.Size, reservation, err = s.putBlob(ctx, file.UserID, file.StorageKey, r, file.Size, file.MimeType)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseQuota(ctx, reservation)
+
+	if _, err := s.store.AddFileVersion(ctx, file, oldKey, uuid.Nil); err != nil {
+		s.deleteBlob(ctx, file.StorageKey)
+		return nil, err
+	}
+	s.pruneVersions(ctx, file)
+
+	return file, nil
+}
+
+// ListVersions returns the versions of a file, newest first.
+func (s *FileService) ListVersions(ctx context.Context, userID, id uuid.UUID) ([]model.FileVersion, error) {
+	file, err := s.GetFile(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store.ListFileVersions(ctx, file.Id)
+}
+
+// GetVersion returns the file id as it was at the given version, ready to be
+// passed to OpenFile.
+func (s *FileService) GetVersion(ctx context.Context, userID, id uuid.UUID, version int) (*model.File, error) {
+	file, err := s.GetFile(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	fileVersion, err := s.store.GetFileVersion(ctx, file.Id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	file.Version = fileVersion.Version
+	file.MimeType = fileVersion.MimeType
+	file.Size = fileVersion.Size
+	file.StorageKey = fileVersion.StorageKey
+	file.LastModified = fileVersion.CreatedAt
+
+	return file, nil
+}
+
+// RestoreVersion makes an older version of a file current again. Newer
+// versions are kept, so the restore can itself be undone.
+func (s *FileService) RestoreVersion(ctx context.Context, userID, id uuid.UUID, version int) (*model.File, error) {
+	file, err := s.file(ctx, userID, id, model.AccessEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	fileVersion, err := s.store.GetFileVersion(ctx, file.Id, version)
+	if err != nil {
+		return nil, err
+	}
+	if fileVersion.Current {
+		return file, nil
+	}
+
+	oldKey := file.StorageKey
+	file.Version = fileVersion.Version
+	file.LastModified = time.Now().UTC()
+	if err := s.store.SetCurrentVersion(ctx, file, oldKey); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// DeleteVersion permanently removes a version of a file other than the
+// current one.
+func (s *FileService) DeleteVersion(ctx context.Context, userID, id uuid.UUID, version int) error {
+	file, err := s.file(ctx, userID, id, model.AccessEditor)
+	if err != nil {
+		return err
+	}
+	if file.Version == version {
+		return ErrCurrentVersion
+	}
+
+	key, err := s.store.DeleteFileVersion(ctx, file.Id, version)
+	if err != nil {
+		return err
+	}
+	s.deleteBlob(ctx, key)
+
+	return nil
+}
+
+// GetVersionRetention returns the user's version limits, or
+// DefaultVersionRetention if they have not set any.
+func (s *FileService) GetVersionRetention(ctx context.Context, userID uuid.UUID) (model.VersionRetention, error) {
+	retention, err := s.store.GetVersionRetention(ctx, userID)
+	if errors.Is(err, model.ErrNotFound) {
+		return DefaultVersionRetention, nil
+	}
+
+	return retention, err
+}
+
+// SetVersionRetention saves the user's version limits. They are applied to
+// each file the next time it gets a new version, and by PruneVersions.
+func (s *FileService) SetVersionRetention(ctx context.Context, userID uuid.UUID, retention model.VersionRetention) error {
+	if retention.MaxVersions < 0 || retention.MaxAgeDays < 0 {
+		return ErrInvalidRetention
+	}
+
+	return s.store.SetVersionRetention(ctx, userID, retention)
+}
+
+// PruneVersions removes old versions that have outlived their owner's
+// MaxAgeDays and returns the number removed.
+func (s *FileService) PruneVersions(ctx context.Context) (int, error) {
+	keys, err := s.store.PruneExpiredVersions(ctx, time.Now().UTC(), DefaultVersionRetention.MaxAgeDays)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, key := range keys {
+		s.deleteBlob(ctx, key)
+	}
+
+	return len(keys), nil
+}
+
+// pruneVersions applies the owner's retention limits to file after a new
+// version was added. Failures are only logged since the upload succeeded.
+func (s *FileService) pruneVersions(ctx context.Context, file *model.File) {
+	retention, err := s.GetVersionRetention(ctx, file.UserID)
+	if err != nil {
+		slog.Error("failed to fetch version retention", "user", file.UserID, "error", err)
+		return
+	}
+	if retention.MaxVersions == 0 && retention.MaxAgeDays == 0 {
+		return
+	}
+
+	var before time.Time
+	if retention.MaxAgeDays > 0 {
+		before = time.Now().UTC().AddDate(0, 0, -retention.MaxAgeDays)
+	}
+
+	keys, err := s.store.PruneFileVersions(ctx, file.Id, retention.MaxVersions, before)
+	if err != nil {
+		slog.Error("failed to prune file versions", "file", file.Id, "error", err)
+		return
+	}
+	for _, key := range keys {
+		s.deleteBlob(ctx, key)
+	}
+}
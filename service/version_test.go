@@ -0,0 +1,221 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/freekobie/kora/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addVersion records the current contents of file as version file.Version.
+func (m *memFileStore) addVersion(file *model.File) {
+	m.versions[file.Id] = append(m.versions[file.Id], model.FileVersion{
+		Id:         uuid.New(),
+		FileID:     file.Id,
+		Version:    file.Version,
+		MimeType:   file.MimeType,
+		Size:       file.Size,
+		StorageKey: file.StorageKey,
+		CreatedAt:  file.LastModified,
+	})
+}
+
+func (m *memFileStore) AddFileVersion(ctx context.Context, file *model.File, oldKey string, sourceID uuid.UUID) ([]string, error) {
+	current, ok := m.files[file.Id]
+	if !ok || current.StorageKey != oldKey {
+		return nil, model.ErrConflict
+	}
+
+	var orphaned []string
+	if sourceID != uuid.Nil {
+		for _, version := range m.versions[sourceID] {
+			if version.StorageKey != file.StorageKey {
+				orphaned = append(orphaned, version.StorageKey)
+			}
+		}
+		delete(m.files, sourceID)
+		delete(m.versions, sourceID)
+	}
+
+	file.Version = 0
+	for _, version := range m.versions[file.Id] {
+		file.Version = max(file.Version, version.Version)
+	}
+	file.Version++
+	m.files[file.Id] = *file
+	m.addVersion(file)
+	return orphaned, nil
+}
+
+func (m *memFileStore) ListFileVersions(ctx context.Context, fileID uuid.UUID) ([]model.FileVersion, error) {
+	var versions []model.FileVersion
+	for _, version := range m.versions[fileID] {
+		version.Current = version.Version == m.files[fileID].Version
+		versions = append(versions, version)
+	}
+	slices.SortFunc(versions, func(a, b model.FileVersion) int { return b.Version - a.Version })
+	return versions, nil
+}
+
+func (m *memFileStore) GetFileVersion(ctx context.Context, fileID uuid.UUID, version int) (model.FileVersion, error) {
+	versions, _ := m.ListFileVersions(ctx, fileID)
+	for _, v := range versions {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return model.FileVersion{}, model.ErrNotFound
+}
+
+func (m *memFileStore) SetCurrentVersion(ctx context.Context, file *model.File, oldKey string) error {
+	current, ok := m.files[file.Id]
+	if !ok || current.StorageKey != oldKey {
+		return model.ErrConflict
+	}
+	version, err := m.GetFileVersion(ctx, file.Id, file.Version)
+	if err != nil {
+		return model.ErrConflict
+	}
+	file.MimeType, file.Size, file.StorageKey = version.MimeType, version.Size, version.StorageKey
+	m.files[file.Id] = *file
+	return nil
+}
+
+func (m *memFileStore) DeleteFileVersion(ctx context.Context, fileID uuid.UUID, version int) (string, error) {
+	for i, v := range m.versions[fileID] {
+		if v.Version == version && version != m.files[fileID].Version {
+			m.versions[fileID] = slices.Delete(m.versions[fileID], i, i+1)
+			return v.StorageKey, nil
+		}
+	}
+	return "", model.ErrNotFound
+}
+
+func (m *memFileStore) PruneFileVersions(ctx context.Context, fileID uuid.UUID, keep int, before time.Time) ([]string, error) {
+	versions, _ := m.ListFileVersions(ctx, fileID)
+
+	var kept []model.FileVersion
+	var keys []string
+	others := 0
+	for _, v := range versions {
+		if !v.Current {
+			others++
+			if (keep > 0 && others >= keep) || v.CreatedAt.Before(before) {
+				keys = append(keys, v.StorageKey)
+				continue
+			}
+		}
+		v.Current = false
+		kept = append(kept, v)
+	}
+	m.versions[fileID] = kept
+	return keys, nil
+}
+
+func (m *memFileStore) GetVersionRetention(ctx context.Context, userID uuid.UUID) (model.VersionRetention, error) {
+	retention, ok := m.settings[userID]
+	if !ok {
+		return model.VersionRetention{}, model.ErrNotFound
+	}
+	return retention, nil
+}
+
+func (m *memFileStore) SetVersionRetention(ctx context.Context, userID uuid.UUID, retention model.VersionRetention) error {
+	m.settings[userID] = retention
+	return nil
+}
+
+func TestFileService_Versions(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	store := newMemFileStore()
+	fs := service.NewFileService(store, blobs)
+
+	original := store.addFile(blobs, userID, uuid.Nil, "notes.txt", []byte("v1"))
+	for _, content := range []string{"v2", "v3"} {
+		_, err := fs.SaveVersion(ctx, userID, original.Id, strings.NewReader(content), int64(len(content)), "")
+		require.NoError(t, err)
+	}
+
+	read := func(file *model.File) string {
+		rc := fs.OpenFile(ctx, file)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	versions, err := fs.ListVersions(ctx, userID, original.Id)
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, 3, versions[0].Version)
+	assert.True(t, versions[0].Current)
+
+	old, err := fs.GetVersion(ctx, userID, original.Id, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", read(old))
+
+	_, err = fs.GetVersion(ctx, uuid.New(), original.Id, 1)
+	assert.ErrorIs(t, err, model.ErrNotFound, "other users cannot see versions")
+
+	restored, err := fs.RestoreVersion(ctx, userID, original.Id, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored.Version)
+	assert.Equal(t, "v1", read(restored))
+
+	err = fs.DeleteVersion(ctx, userID, original.Id, 1)
+	assert.ErrorIs(t, err, service.ErrCurrentVersion)
+
+	v3, err := fs.GetVersion(ctx, userID, original.Id, 3)
+	require.NoError(t, err)
+	require.NoError(t, fs.DeleteVersion(ctx, userID, original.Id, 3))
+	_, err = blobs.Stat(ctx, v3.StorageKey)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	file, err := fs.SaveVersion(ctx, userID, original.Id, strings.NewReader("v4"), 2, "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, file.Version, "numbering continues after the newest remaining version")
+	assert.Equal(t, "v4", read(file))
+}
+
+func TestFileService_VersionRetention(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	blobs := newMemBlobStore()
+	store := newMemFileStore()
+	fs := service.NewFileService(store, blobs)
+
+	retention, err := fs.GetVersionRetention(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, service.DefaultVersionRetention, retention)
+
+	err = fs.SetVersionRetention(ctx, userID, model.VersionRetention{MaxVersions: -1})
+	assert.ErrorIs(t, err, service.ErrInvalidRetention)
+	require.NoError(t, fs.SetVersionRetention(ctx, userID, model.VersionRetention{MaxVersions: 2}))
+
+	file := store.addFile(blobs, userID, uuid.Nil, "notes.txt", []byte("v1"))
+	for _, content := range []string{"v2", "v3"} {
+		_, err := fs.SaveVersion(ctx, userID, file.Id, bytes.NewReader([]byte(content)), int64(len(content)), "text/plain")
+		require.NoError(t, err)
+	}
+
+	versions, err := fs.ListVersions(ctx, userID, file.Id)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, []int{3, 2}, []int{versions[0].Version, versions[1].Version})
+
+	_, err = blobs.Stat(ctx, file.StorageKey)
+	assert.ErrorIs(t, err, model.ErrNotFound, "pruned versions should be deleted from storage")
+}
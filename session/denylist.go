@@ -0,0 +1,178 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/google/uuid"
+)
+
+// RevocationCacheTTL is how long a DenyList remembers that a session is not
+// revoked. A revocation made by another instance is seen within this time.
+const RevocationCacheTTL = 10 * time.Second
+
+// DenyList holds the sessions revoked while access tokens issued for them
+// may still be valid. Revocations are kept in a store shared by every
+// instance, with a short cache in front of it so that most requests do not
+// query the store.
+type DenyList struct {
+	store model.RevocationStorage
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedRevocation
+	swept time.Time
+}
+
+// cachedRevocation is what a DenyList last learned about a session.
+type cachedRevocation struct {
+	// until is when the session's revocation lapses; zero if it is not
+	// revoked.
+	until     time.Time
+	checkedAt time.Time
+}
+
+// NewDenyList creates a DenyList that keeps revocations in store.
+func NewDenyList(store model.RevocationStorage) *DenyList {
+	return &DenyList{
+		store: store,
+		ttl:   RevocationCacheTTL,
+		cache: make(map[string]cachedRevocation),
+	}
+}
+
+// Revoke rejects access tokens of the session sessionID until the given
+// time, by which all of them have expired.
+func (dl *DenyList) Revoke(ctx context.Context, sessionID string, until time.Time) error {
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := dl.store.InsertRevocation(ctx, id, until); err != nil {
+		return err
+	}
+
+	dl.remember(sessionID, cachedRevocation{until: until, checkedAt: time.Now()})
+	return nil
+}
+
+// IsRevoked reports whether sessionID has been revoked.
+func (dl *DenyList) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	now := time.Now()
+
+	dl.mu.Lock()
+	cached, ok := dl.cache[sessionID]
+	dl.mu.Unlock()
+	if ok {
+		// a revocation holds until it lapses; an absent one may have been
+		// made elsewhere since
+		if cached.until.After(now) {
+			return true, nil
+		}
+		if now.Sub(cached.checkedAt) < dl.ttl {
+			return false, nil
+		}
+	}
+
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		// tokens issued before sessions were tracked have none to revoke
+		return false, nil
+	}
+	until, err := dl.store.GetRevocation(ctx, id)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return false, err
+	}
+
+	dl.remember(sessionID, cachedRevocation{until: until, checkedAt: now})
+	return until.After(now), nil
+}
+
+// remember caches what is known about a session, dropping stale entries
+// once per ttl so the cache stays small.
+func (dl *DenyList) remember(sessionID string, entry cachedRevocation) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(dl.swept) >= dl.ttl {
+		for id, cached := range dl.cache {
+			if !cached.until.After(now) && now.Sub(cached.checkedAt) >= dl.ttl {
+				delete(dl.cache, id)
+			}
+		}
+		dl.swept = now
+	}
+	dl.cache[sessionID] = entry
+}
+
+var (
+	denyListMu sync.Mutex
+	denyList   *DenyList
+)
+
+// UseDenyList makes RevokeSession and IsRevoked use dl.
+func UseDenyList(dl *DenyList) {
+	denyListMu.Lock()
+	defer denyListMu.Unlock()
+	denyList = dl
+}
+
+// currentDenyList returns the deny list in use. Without a call to
+// UseDenyList, as in tests, revocations are kept in memory.
+func currentDenyList() *DenyList {
+	denyListMu.Lock()
+	defer denyListMu.Unlock()
+
+	if denyList == nil {
+		denyList = NewDenyList(&memoryRevocationStore{revocations: make(map[uuid.UUID]time.Time)})
+	}
+	return denyList
+}
+
+// RevokeSession rejects access tokens of the session sessionID until the
+// given time, by which all of them have expired.
+func RevokeSession(ctx context.Context, sessionID string, until time.Time) error {
+	return currentDenyList().Revoke(ctx, sessionID, until)
+}
+
+// IsRevoked reports whether sessionID has been revoked.
+func IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	return currentDenyList().IsRevoked(ctx, sessionID)
+}
+
+// memoryRevocationStore keeps revocations in memory.
+type memoryRevocationStore struct {
+	mu          sync.Mutex
+	revocations map[uuid.UUID]time.Time
+}
+
+func (m *memoryRevocationStore) InsertRevocation(ctx context.Context, sessionID uuid.UUID, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, expiry := range m.revocations {
+		if !expiry.After(now) {
+			delete(m.revocations, id)
+		}
+	}
+	if expiresAt.After(m.revocations[sessionID]) {
+		m.revocations[sessionID] = expiresAt
+	}
+	return nil
+}
+
+func (m *memoryRevocationStore) GetRevocation(ctx context.Context, sessionID uuid.UUID) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expiry, ok := m.revocations[sessionID]
+	if !ok || !expiry.After(time.Now()) {
+		return time.Time{}, model.ErrNotFound
+	}
+	return expiry, nil
+}
@@ -0,0 +1,76 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenyList_SharedBetweenInstances(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryRevocationStore{revocations: make(map[uuid.UUID]time.Time)}
+	a, b := NewDenyList(store), NewDenyList(store)
+	sessionID := uuid.NewString()
+
+	revoked, err := b.IsRevoked(ctx, sessionID)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, a.Revoke(ctx, sessionID, time.Now().Add(time.Hour)))
+	revoked, err = a.IsRevoked(ctx, sessionID)
+	require.NoError(t, err)
+	assert.True(t, revoked, "the revoking instance sees it at once")
+
+	revoked, err = b.IsRevoked(ctx, sessionID)
+	require.NoError(t, err)
+	assert.False(t, revoked, "other instances may answer from their cache for a while")
+
+	b.cache[sessionID] = cachedRevocation{checkedAt: time.Now().Add(-RevocationCacheTTL)}
+	revoked, err = b.IsRevoked(ctx, sessionID)
+	require.NoError(t, err)
+	assert.True(t, revoked, "and see it once their cache is stale")
+
+	// a restarted instance starts with an empty cache
+	revoked, err = NewDenyList(store).IsRevoked(ctx, sessionID)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestDenyList_Lapses(t *testing.T) {
+	ctx := context.Background()
+	dl := NewDenyList(&memoryRevocationStore{revocations: make(map[uuid.UUID]time.Time)})
+	sessionID := uuid.NewString()
+
+	require.NoError(t, dl.Revoke(ctx, sessionID, time.Now().Add(-time.Second)))
+	revoked, err := dl.IsRevoked(ctx, sessionID)
+	require.NoError(t, err)
+	assert.False(t, revoked, "revocations lapse once the session's access tokens have expired")
+
+	revoked, err = dl.IsRevoked(ctx, "")
+	require.NoError(t, err)
+	assert.False(t, revoked, "tokens without a session cannot be revoked")
+}
+
+// failingRevocationStore fails every call.
+type failingRevocationStore struct{}
+
+func (failingRevocationStore) InsertRevocation(ctx context.Context, sessionID uuid.UUID, expiresAt time.Time) error {
+	return errors.New("database unavailable")
+}
+
+func (failingRevocationStore) GetRevocation(ctx context.Context, sessionID uuid.UUID) (time.Time, error) {
+	return time.Time{}, errors.New("database unavailable")
+}
+
+func TestDenyList_StoreErrors(t *testing.T) {
+	dl := NewDenyList(failingRevocationStore{})
+
+	assert.Error(t, dl.Revoke(context.Background(), uuid.NewString(), time.Now().Add(time.Hour)))
+	_, err := dl.IsRevoked(context.Background(), uuid.NewString())
+	assert.Error(t, err, "a session is not assumed to be valid when the store cannot say")
+}
@@ -0,0 +1,420 @@
+package session
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Algorithms tokens can be signed with.
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+)
+
+// keyPublishDelay is how long a new key is published before it is used for
+// signing, so that other instances, which reload keys more often than this,
+// and services caching the JWKS know it by then.
+const keyPublishDelay = time.Hour
+
+// JWKSMaxAge is how long clients may cache the JWKS.
+const JWKSMaxAge = 5 * time.Minute
+
+// EncryptionKeySize is the size of the key that signing keys are encrypted
+// with at rest, for AES-256-GCM.
+const EncryptionKeySize = 32
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("token signing algorithm must be EdDSA or RS256")
+	ErrInvalidEncryptionKey = errors.New("token key encryption key must be 32 bytes")
+)
+
+// KeySet holds the keys tokens are signed and verified with. A new key is
+// created every rotation interval. The newest published key signs, and
+// older keys keep verifying the tokens they signed until those have expired.
+type KeySet struct {
+	store     model.SigningKeyStorage
+	algorithm string
+	rotation  time.Duration
+	// retention is how long tokens signed by a key can stay valid.
+	retention time.Duration
+	// aead encrypts private keys before they are stored.
+	aead cipher.AEAD
+
+	mu   sync.RWMutex
+	keys []signingKey // newest first
+}
+
+type signingKey struct {
+	kid       string
+	algorithm string
+	private   crypto.Signer
+	createdAt time.Time
+}
+
+// NewKeySet creates a KeySet that stores its keys in store, encrypted with
+// encryptionKey, and makes a new algorithm key every rotation. retention is
+// the lifetime of the longest lived token. Call Load before using it.
+func NewKeySet(store model.SigningKeyStorage, algorithm string, encryptionKey []byte, rotation, retention time.Duration) (*KeySet, error) {
+	if algorithm != AlgorithmEdDSA && algorithm != AlgorithmRS256 {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if len(encryptionKey) != EncryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeySet{
+		store:     store,
+		algorithm: algorithm,
+		rotation:  rotation,
+		retention: retention,
+		aead:      aead,
+	}, nil
+}
+
+// Load reads the keys from the store, first creating a new one if the
+// newest is due for rotation or uses another algorithm.
+func (ks *KeySet) Load(ctx context.Context) error {
+	records, err := ks.store.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 || time.Since(records[0].CreatedAt) >= ks.rotation || records[0].Algorithm != ks.algorithm {
+		record, err := ks.newKey()
+		if err != nil {
+			return err
+		}
+		if err := ks.store.InsertSigningKey(ctx, &record); err != nil {
+			return err
+		}
+		slog.Info("created token signing key", "kid", record.Kid, "algorithm", record.Algorithm)
+		records = append([]model.SigningKey{record}, records...)
+	}
+
+	keys := make([]signingKey, 0, len(records))
+	for _, record := range records {
+		der, err := ks.decrypt(record)
+		if err != nil {
+			slog.Error("failed to decrypt signing key", "kid", record.Kid, "error", err)
+			continue
+		}
+		private, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			slog.Error("failed to parse signing key", "kid", record.Kid, "error", err)
+			continue
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			slog.Error("signing key is not a signer", "kid", record.Kid)
+			continue
+		}
+		keys = append(keys, signingKey{
+			kid:       record.Kid,
+			algorithm: record.Algorithm,
+			private:   signer,
+			createdAt: record.CreatedAt,
+		})
+	}
+	if len(keys) == 0 {
+		return errors.New("no usable token signing keys")
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// RunRotation reloads the keys every interval until ctx is cancelled,
+// creating a new one when it is due and picking up keys created by other
+// instances. Retired keys are deleted. interval must be well below an hour,
+// the time a new key waits before it signs.
+func (ks *KeySet) RunRotation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := ks.Load(ctx); err != nil {
+			slog.Error("failed to rotate token signing keys", "error", err)
+		}
+
+		n, err := ks.store.DeleteRetiredSigningKeys(ctx)
+		if err != nil {
+			slog.Error("failed to delete retired signing keys", "error", err)
+		} else if n > 0 {
+			slog.Info("deleted retired signing keys", "keys", n)
+		}
+	}
+}
+
+// newKey generates a key that signs for one rotation interval and verifies
+// for retention after that.
+func (ks *KeySet) newKey() (model.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch ks.algorithm {
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		slog.Error("failed to generate signing key", "error", err)
+		return model.SigningKey{}, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		slog.Error("failed to encode signing key", "error", err)
+		return model.SigningKey{}, err
+	}
+
+	now := time.Now().UTC()
+	key := model.SigningKey{
+		Kid:       uuid.NewString(),
+		Algorithm: ks.algorithm,
+		CreatedAt: now,
+		RetiresAt: now.Add(ks.rotation + keyPublishDelay + ks.retention),
+	}
+	key.PrivateKey = ks.encrypt(key, der)
+
+	return key, nil
+}
+
+// encrypt seals a private key for storage, prefixed with its nonce. The kid
+// and algorithm are authenticated along with it, so that a stored key cannot
+// be passed off as another.
+func (ks *KeySet) encrypt(key model.SigningKey, der []byte) []byte {
+	nonce := make([]byte, ks.aead.NonceSize(), ks.aead.NonceSize()+len(der)+ks.aead.Overhead())
+	_, _ = rand.Read(nonce)
+	return ks.aead.Seal(nonce, nonce, der, keyAAD(key))
+}
+
+// decrypt opens a private key sealed by encrypt.
+func (ks *KeySet) decrypt(key model.SigningKey) ([]byte, error) {
+	if len(key.PrivateKey) < ks.aead.NonceSize() {
+		return nil, errors.New("encrypted key is too short")
+	}
+	nonce, sealed := key.PrivateKey[:ks.aead.NonceSize()], key.PrivateKey[ks.aead.NonceSize():]
+	return ks.aead.Open(nil, nonce, sealed, keyAAD(key))
+}
+
+func keyAAD(key model.SigningKey) []byte {
+	return []byte(key.Kid + "." + key.Algorithm)
+}
+
+// signer returns the key to sign with: the newest one that has been
+// published for keyPublishDelay, or the newest one if none has.
+func (ks *KeySet) signer() (signingKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if len(ks.keys) == 0 {
+		return signingKey{}, errors.New("no token signing keys loaded")
+	}
+	for _, key := range ks.keys {
+		if time.Since(key.createdAt) >= keyPublishDelay {
+			return key, nil
+		}
+	}
+	return ks.keys[0], nil
+}
+
+// sign signs claims with the current signing key, naming it in the kid
+// header.
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	key, err := ks.signer()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.algorithm), claims)
+	token.Header["kid"] = key.kid
+
+	return token.SignedString(key.private)
+}
+
+// verificationKey implements jwt.Keyfunc, finding the public key named by a
+// token's kid header.
+func (ks *KeySet) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, key := range ks.keys {
+		if key.kid == kid {
+			if token.Method.Alg() != key.algorithm {
+				return nil, ErrInvalidToken
+			}
+			return key.private.Public(), nil
+		}
+	}
+
+	return nil, ErrInvalidToken
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set, which other services can verify
+// tokens with.
+func (ks *KeySet) JWKS() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.algorithm}
+		switch public := key.private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			slog.Error("unexpected signing key type", "kid", key.kid, "type", fmt.Sprintf("%T", public))
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+var (
+	keysMu sync.Mutex
+	keys   *KeySet
+)
+
+// UseKeySet makes GenerateToken and ValidateToken use ks.
+func UseKeySet(ks *KeySet) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keys = ks
+}
+
+// currentKeys returns the key set in use. Without a call to UseKeySet, as
+// in tests, an in-memory set is created on first use; tokens signed with it
+// do not survive a restart.
+func currentKeys() (*KeySet, error) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	if keys == nil {
+		encryptionKey := make([]byte, EncryptionKeySize)
+		_, _ = rand.Read(encryptionKey)
+		ks, err := NewKeySet(&memoryKeyStore{}, AlgorithmEdDSA, encryptionKey, 24*time.Hour, 30*24*time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		if err := ks.Load(context.Background()); err != nil {
+			return nil, err
+		}
+		keys = ks
+	}
+
+	return keys, nil
+}
+
+// JWKS returns the public keys of the key set in use.
+func JWKS() (JWKSet, error) {
+	ks, err := currentKeys()
+	if err != nil {
+		return JWKSet{}, err
+	}
+	return ks.JWKS(), nil
+}
+
+// memoryKeyStore keeps signing keys in memory.
+type memoryKeyStore struct {
+	mu   sync.Mutex
+	keys []model.SigningKey
+}
+
+func (m *memoryKeyStore) ListSigningKeys(ctx context.Context) ([]model.SigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []model.SigningKey
+	for _, key := range m.keys {
+		if key.RetiresAt.After(time.Now()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryKeyStore) InsertSigningKey(ctx context.Context, key *model.SigningKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys = append([]model.SigningKey{*key}, m.keys...)
+	return nil
+}
+
+func (m *memoryKeyStore) DeleteRetiredSigningKeys(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var kept []model.SigningKey
+	for _, key := range m.keys {
+		if key.RetiresAt.After(time.Now()) {
+			kept = append(kept, key)
+		}
+	}
+	n := int64(len(m.keys) - len(kept))
+	m.keys = kept
+	return n, nil
+}
@@ -0,0 +1,185 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/freekobie/kora/model"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useKeySet makes ks the key set in use for the rest of the test.
+func useKeySet(t *testing.T, ks *KeySet) {
+	t.Helper()
+	keysMu.Lock()
+	prev := keys
+	keysMu.Unlock()
+	UseKeySet(ks)
+	t.Cleanup(func() { UseKeySet(prev) })
+}
+
+// testEncryptionKey is the key encryption key of test key sets.
+var testEncryptionKey = bytes.Repeat([]byte{0x42}, EncryptionKeySize)
+
+func newLoadedKeySet(t *testing.T, store model.SigningKeyStorage, algorithm string) *KeySet {
+	t.Helper()
+	ks, err := NewKeySet(store, algorithm, testEncryptionKey, 24*time.Hour, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, ks.Load(context.Background()))
+	return ks
+}
+
+// publicKey turns a JWK back into the public key it describes.
+func publicKey(t *testing.T, jwk JWK) any {
+	t.Helper()
+	switch jwk.Kty {
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		require.NoError(t, err)
+		return ed25519.PublicKey(x)
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		require.NoError(t, err)
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		require.NoError(t, err)
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	t.Fatalf("unexpected key type %q", jwk.Kty)
+	return nil
+}
+
+func TestKeySet_SignAndVerify(t *testing.T) {
+	user := &model.User{Id: uuid.New(), Email: "alice@example.com", Role: model.RoleUser}
+
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			ks := newLoadedKeySet(t, &memoryKeyStore{}, algorithm)
+			useKeySet(t, ks)
+
+			tokenString, err := GenerateToken(user, uuid.New(), time.Hour, TokenTypeAccess)
+			require.NoError(t, err)
+			claims, err := ValidateToken(tokenString, TokenTypeAccess)
+			require.NoError(t, err)
+			assert.Equal(t, user.Id.String(), claims.Subject)
+
+			_, err = ValidateToken(tokenString, TokenTypeRefresh)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+
+			// other services can verify tokens with the published keys
+			jwks := ks.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, algorithm, jwks.Keys[0].Alg)
+			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+				assert.Equal(t, jwks.Keys[0].Kid, token.Header["kid"])
+				return publicKey(t, jwks.Keys[0]), nil
+			}, jwt.WithValidMethods([]string{algorithm}))
+			require.NoError(t, err)
+			assert.True(t, token.Valid)
+		})
+	}
+}
+
+func TestKeySet_RejectsForeignTokens(t *testing.T) {
+	useKeySet(t, newLoadedKeySet(t, &memoryKeyStore{}, AlgorithmEdDSA))
+
+	hmac, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"token_type": TokenTypeAccess}).
+		SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = ValidateToken(hmac, TokenTypeAccess)
+	assert.Error(t, err, "HMAC tokens are not accepted")
+
+	other := newLoadedKeySet(t, &memoryKeyStore{}, AlgorithmEdDSA)
+	foreign, err := other.sign(jwt.MapClaims{"token_type": TokenTypeAccess})
+	require.NoError(t, err)
+	_, err = ValidateToken(foreign, TokenTypeAccess)
+	assert.Error(t, err, "tokens signed with unknown keys are not accepted")
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryKeyStore{}
+	ks := newLoadedKeySet(t, store, AlgorithmEdDSA)
+	useKeySet(t, ks)
+	user := &model.User{Id: uuid.New(), Email: "alice@example.com"}
+
+	// another instance sharing the store uses the same key
+	replica := newLoadedKeySet(t, store, AlgorithmEdDSA)
+	assert.Equal(t, ks.JWKS(), replica.JWKS())
+
+	// age the key past the rotation interval
+	store.keys[0].CreatedAt = time.Now().Add(-25 * time.Hour)
+	require.NoError(t, ks.Load(ctx))
+	oldKid := store.keys[1].Kid
+	newKid := store.keys[0].Kid
+	require.Len(t, ks.JWKS().Keys, 2, "the new key is published next to the old one")
+
+	old, err := GenerateToken(user, uuid.New(), time.Hour, TokenTypeAccess)
+	require.NoError(t, err)
+	token, _, err := jwt.NewParser().ParseUnverified(old, &CustomClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, oldKid, token.Header["kid"], "new keys are not used until they have been published for a while")
+
+	store.keys[0].CreatedAt = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, ks.Load(ctx))
+	rotated, err := GenerateToken(user, uuid.New(), time.Hour, TokenTypeAccess)
+	require.NoError(t, err)
+	token, _, err = jwt.NewParser().ParseUnverified(rotated, &CustomClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, newKid, token.Header["kid"])
+
+	_, err = ValidateToken(old, TokenTypeAccess)
+	assert.NoError(t, err, "tokens signed with the old key stay valid")
+
+	// once every token it signed has expired, the old key goes away
+	store.keys[1].RetiresAt = time.Now().Add(-time.Minute)
+	n, err := store.DeleteRetiredSigningKeys(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	require.NoError(t, ks.Load(ctx))
+	assert.Len(t, ks.JWKS().Keys, 1)
+	_, err = ValidateToken(old, TokenTypeAccess)
+	assert.Error(t, err)
+}
+
+func TestKeySet_EncryptsStoredKeys(t *testing.T) {
+	store := &memoryKeyStore{}
+	newLoadedKeySet(t, store, AlgorithmEdDSA)
+	require.Len(t, store.keys, 1)
+
+	_, err := x509.ParsePKCS8PrivateKey(store.keys[0].PrivateKey)
+	assert.Error(t, err, "private keys are not stored in the clear")
+
+	// without the key encryption key, stored keys are of no use
+	other, err := NewKeySet(store, AlgorithmEdDSA, bytes.Repeat([]byte{0x17}, EncryptionKeySize), 24*time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.Error(t, other.Load(context.Background()))
+
+	// a stored key cannot be passed off under another kid
+	tampered := &memoryKeyStore{keys: []model.SigningKey{store.keys[0]}}
+	tampered.keys[0].Kid = uuid.NewString()
+	replica, err := NewKeySet(tampered, AlgorithmEdDSA, testEncryptionKey, 24*time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.Error(t, replica.Load(context.Background()))
+}
+
+func TestNewKeySet_UnsupportedAlgorithm(t *testing.T) {
+	_, err := NewKeySet(&memoryKeyStore{}, "HS256", testEncryptionKey, time.Hour, time.Hour)
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+}
+
+func TestNewKeySet_InvalidEncryptionKey(t *testing.T) {
+	for _, key := range [][]byte{nil, make([]byte, 16)} {
+		_, err := NewKeySet(&memoryKeyStore{}, AlgorithmEdDSA, key, time.Hour, time.Hour)
+		assert.ErrorIs(t, err, ErrInvalidEncryptionKey)
+	}
+}
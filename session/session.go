@@ -3,7 +3,6 @@ package session
 import (
 	"errors"
 	"log/slog"
-	"os"
 	"time"
 
 	"github.com/freekobie/kora/model"
@@ -18,6 +17,8 @@ var (
 type TokenType string
 type CustomClaims struct {
 	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
 	TokenType string `json:"token_type"`
 	jwt.RegisteredClaims
 }
@@ -27,28 +28,46 @@ const (
 	TokenTypeRefresh TokenType = "REFRESH"
 )
 
+// UserSession is the result of a login. For users with two-factor
+// authentication, a password login yields a ChallengeToken instead of a
+// RefreshToken, and ExpiresAt is when the challenge expires.
 type UserSession struct {
-	User         model.User `json:"user"`
-	RefreshToken string     `json:"refreshToken"`
-	ExpiresAt    time.Time  `json:"expiresAt"`
+	User              model.User `json:"user"`
+	RefreshToken      string     `json:"refreshToken,omitempty"`
+	ExpiresAt         time.Time  `json:"expiresAt"`
+	TwoFactorRequired bool       `json:"twoFactorRequired"`
+	ChallengeToken    string     `json:"challengeToken,omitempty"`
 }
 
 type UserAccess struct {
 	AccessToken string    `json:"accessToken"`
 	ExpiresAt   time.Time `json:"expiresAt"`
+	// RefreshToken replaces the refresh token the access token was obtained
+	// with, which can no longer be used.
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
 }
 
-func GenerateToken(userID uuid.UUID, email string, duration time.Duration, tokenType TokenType) (string, error) {
+// GenerateToken signs a token for user in the session sessionID with the
+// key set in use.
+func GenerateToken(user *model.User, sessionID uuid.UUID, duration time.Duration, tokenType TokenType) (string, error) {
+	ks, err := currentKeys()
+	if err != nil {
+		slog.Error("failed to load signing keys", "error", err.Error())
+		return "", err
+	}
+
 	exp := time.Now().Add(duration)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	tokenString, err := ks.sign(jwt.MapClaims{
 		"iat":        time.Now().UTC().Unix(),
 		"exp":        exp.UTC().Unix(),
-		"sub":        userID.String(),
+		"sub":        user.Id.String(),
+		"jti":        uuid.NewString(),
+		"sid":        sessionID.String(),
 		"token_type": tokenType,
-		"email":      email,
+		"email":      user.Email,
+		"role":       user.Role,
 	})
-
-	tokenString, err := token.SignedString([]byte(os.Getenv("TOKEN_SECRET")))
 	if err != nil {
 		slog.Error("failed to sign access token", "error", err.Error())
 		return "", err
@@ -58,9 +77,13 @@ func GenerateToken(userID uuid.UUID, email string, duration time.Duration, token
 }
 
 func ValidateToken(tokenStr string, tokenType TokenType) (*CustomClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &CustomClaims{}, func(t *jwt.Token) (any, error) {
-		return []byte(os.Getenv("TOKEN_SECRET")), nil
-	})
+	ks, err := currentKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.ParseWithClaims(tokenStr, &CustomClaims{}, ks.verificationKey,
+		jwt.WithValidMethods([]string{AlgorithmEdDSA, AlgorithmRS256}))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,60 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The SHA1 test vectors from RFC 6238 appendix B, cut to 6 digits.
+func TestCode(t *testing.T) {
+	secret := encoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "time %d", tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := GenerateSecret()
+	now := time.Now()
+
+	code, err := Code(secret, Step(now))
+	require.NoError(t, err)
+	step, ok := Validate(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	_, ok = Validate(secret, code, now.Add(Period))
+	assert.True(t, ok, "codes from the previous period are accepted")
+	_, ok = Validate(secret, code, now.Add(3*Period))
+	assert.False(t, ok)
+	_, ok = Validate(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("JBSWY3DPEHPK3PXP", "Kora", "alice@example.com"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Kora:alice@example.com", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, "Kora", uri.Query().Get("issuer"))
+}
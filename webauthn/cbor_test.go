@@ -0,0 +1,48 @@
+package webauthn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// {1: 2, "a": h'0102', -1: [true, null]} followed by a trailing byte
+	data := []byte{0xa3, 0x01, 0x02, 0x61, 'a', 0x42, 0x01, 0x02, 0x20, 0x82, 0xf5, 0xf6, 0xff}
+
+	v, rest, err := decodeCBOR(data)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xff}, rest)
+	assert.Equal(t, map[any]any{
+		int64(1):  int64(2),
+		"a":       []byte{1, 2},
+		int64(-1): []any{true, nil},
+	}, v)
+}
+
+func TestDecodeCBOR_Malformed(t *testing.T) {
+	nested := make([]byte, 0, 64)
+	for range 40 {
+		nested = append(nested, 0x81)
+	}
+	nested = append(nested, 0x00)
+
+	tests := map[string][]byte{
+		"empty":             {},
+		"truncated string":  {0x45, 0x01},
+		"truncated length":  {0x59, 0x01},
+		"huge array":        {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"indefinite length": {0x5f, 0x41, 0x01, 0xff},
+		"array map key":     {0xa1, 0x80, 0x00},
+		"float":             {0xf9, 0x3c, 0x00},
+		"tag":               {0xc0, 0x00},
+		"too deep":          nested,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := decodeCBOR(data)
+			assert.ErrorIs(t, err, errCBOR)
+		})
+	}
+}
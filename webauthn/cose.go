@@ -0,0 +1,107 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithm identifiers of the supported credential keys.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters (RFC 9053).
+const (
+	coseKty = 1
+	coseAlg = 3
+	// curve, or modulus for RSA
+	coseCrvOrN = -1
+	// x, or exponent for RSA
+	coseXOrE = -2
+	coseY    = -3
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+var ErrUnsupportedKey = errors.New("webauthn: unsupported credential key")
+
+// publicKey is a credential public key decoded from its COSE form.
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key, accepting only the algorithms offered
+// in creation options.
+func parsePublicKey(cose []byte) (publicKey, error) {
+	v, rest, err := decodeCBOR(cose)
+	if err != nil || len(rest) != 0 {
+		return publicKey{}, ErrUnsupportedKey
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return publicKey{}, ErrUnsupportedKey
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrvOrN)].(int64)
+		x, _ := m[int64(coseXOrE)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: key}, nil
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCrvOrN)].(int64)
+		x, _ := m[int64(coseXOrE)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseCrvOrN)].([]byte)
+		e, _ := m[int64(coseXOrE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}}, nil
+	}
+
+	return publicKey{}, ErrUnsupportedKey
+}
+
+// verify checks sig over data.
+func (k publicKey) verify(data, sig []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
@@ -0,0 +1,389 @@
+// Package webauthn implements the relying party side of WebAuthn
+// registration and authentication ceremonies for passkeys. Only "none"
+// attestation is supported: credentials are trusted on registration, not
+// checked against the authenticator's make and model.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Timeout is how long the browser is given to complete a ceremony.
+const Timeout = 5 * time.Minute
+
+// Authenticator data flags.
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+)
+
+const maxCredentialIDLength = 1023
+
+var (
+	ErrInvalidResponse   = errors.New("webauthn: invalid authenticator response")
+	ErrChallengeMismatch = errors.New("webauthn: challenge does not match")
+	ErrOriginMismatch    = errors.New("webauthn: origin not allowed")
+	ErrInvalidSignature  = errors.New("webauthn: invalid signature")
+	// ErrClonedAuthenticator is returned when a signature counter goes
+	// backwards, which means the credential's private key has been copied.
+	ErrClonedAuthenticator = errors.New("webauthn: signature counter went backwards")
+)
+
+// Bytes is binary data, base64url encoded in JSON as in the WebAuthn JSON
+// serialization.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty is the site passkeys are registered for.
+type RelyingParty struct {
+	// ID is the domain passkeys are scoped to, such as kora.example.
+	ID   string
+	Name string
+	// Origins are the web origins ceremonies may run on, such as
+	// https://app.kora.example.
+	Origins []string
+}
+
+// User is the account a passkey is registered for.
+type User struct {
+	// ID is the user handle, stored on the authenticator. It must not hold
+	// personal information.
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are passed to navigator.credentials.create to register a
+// passkey.
+type CreationOptions struct {
+	Challenge              Bytes                  `json:"challenge"`
+	RelyingParty           RelyingPartyEntity     `json:"rp"`
+	User                   User                   `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are passed to navigator.credentials.get to sign in with a
+// passkey.
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RelyingPartyID   string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is the credential navigator.credentials.create
+// returns.
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes    `json:"clientDataJSON"`
+		AttestationObject Bytes    `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the credential navigator.credentials.get returns.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// Credential is a registered passkey.
+type Credential struct {
+	ID []byte
+	// PublicKey is the credential public key in COSE_Key form.
+	PublicKey []byte
+	SignCount uint32
+}
+
+// CreationOptions returns the options for registering a passkey for user.
+// Passkeys must be discoverable, so that they can be used without giving an
+// email first, and must verify the user, so that they are a second factor
+// of their own. exclude lists the user's existing credentials.
+func (rp *RelyingParty) CreationOptions(challenge []byte, user User, exclude [][]byte) CreationOptions {
+	options := CreationOptions{
+		Challenge:    challenge,
+		RelyingParty: RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:         user,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: []CredentialDescriptor{},
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		Attestation: "none",
+	}
+	for _, id := range exclude {
+		options.ExcludeCredentials = append(options.ExcludeCredentials, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+
+	return options
+}
+
+// RequestOptions returns the options for signing in with any passkey
+// registered for the relying party.
+func (rp *RelyingParty) RequestOptions(challenge []byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RelyingPartyID:   rp.ID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "required",
+	}
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge Bytes  `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func parseClientData(raw []byte) (clientData, error) {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return clientData{}, fmt.Errorf("%w: client data: %v", ErrInvalidResponse, err)
+	}
+	return cd, nil
+}
+
+// Challenge returns the challenge the browser signed, so that the ceremony
+// it belongs to can be found.
+func (r *AttestationResponse) Challenge() ([]byte, error) {
+	cd, err := parseClientData(r.Response.ClientDataJSON)
+	return cd.Challenge, err
+}
+
+// Challenge returns the challenge the browser signed, so that the ceremony
+// it belongs to can be found.
+func (r *AssertionResponse) Challenge() ([]byte, error) {
+	cd, err := parseClientData(r.Response.ClientDataJSON)
+	return cd.Challenge, err
+}
+
+// checkClientData checks the ceremony type, challenge and origin the browser
+// reported.
+func (rp *RelyingParty) checkClientData(raw []byte, ceremony string, challenge []byte) error {
+	cd, err := parseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: type %q", ErrInvalidResponse, cd.Type)
+	}
+	if !bytes.Equal(cd.Challenge, challenge) {
+		return ErrChallengeMismatch
+	}
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return fmt.Errorf("%w: %q", ErrOriginMismatch, cd.Origin)
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	// publicKey is the COSE_Key of the credential, present on registration.
+	publicKey []byte
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+	ad := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&flagAttestedCredential == 0 {
+		return ad, nil
+	}
+
+	// AAGUID, credential ID length, credential ID, credential public key
+	rest := data[37:]
+	if len(rest) < 18 {
+		return authenticatorData{}, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen > maxCredentialIDLength || idLen > len(rest) {
+		return authenticatorData{}, fmt.Errorf("%w: bad credential ID length", ErrInvalidResponse)
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return authenticatorData{}, fmt.Errorf("%w: credential public key: %v", ErrInvalidResponse, err)
+	}
+	ad.publicKey = rest[:len(rest)-len(after)]
+
+	return ad, nil
+}
+
+// checkAuthenticatorData checks that the data is for this relying party and
+// that the user was present and verified.
+func (rp *RelyingParty) checkAuthenticatorData(ad authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return fmt.Errorf("%w: relying party ID does not match", ErrInvalidResponse)
+	}
+	if ad.flags&flagUserPresent == 0 || ad.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user not verified", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// VerifyRegistration checks a response to CreationOptions made with
+// challenge and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(response *AttestationResponse, challenge []byte) (*Credential, error) {
+	if response.Type != "public-key" {
+		return nil, fmt.Errorf("%w: type %q", ErrInvalidResponse, response.Type)
+	}
+	if err := rp.checkClientData(response.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	v, rest, err := decodeCBOR(response.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: attestation object", ErrInvalidResponse)
+	}
+	attestation, _ := v.(map[any]any)
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[any]any)
+	rawAuthData, _ := attestation["authData"].([]byte)
+	if format != "none" || statement == nil || len(statement) != 0 {
+		return nil, fmt.Errorf("%w: only attestation none is supported", ErrInvalidResponse)
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, fmt.Errorf("%w: no credential", ErrInvalidResponse)
+	}
+	if !bytes.Equal(ad.credentialID, response.RawID) {
+		return nil, fmt.Errorf("%w: credential ID does not match", ErrInvalidResponse)
+	}
+	if _, err := parsePublicKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        slices.Clone(ad.credentialID),
+		PublicKey: slices.Clone(ad.publicKey),
+		SignCount: ad.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks a response to RequestOptions made with challenge,
+// signed by credential, and returns the credential's new signature counter.
+func (rp *RelyingParty) VerifyAssertion(response *AssertionResponse, challenge []byte, credential Credential) (uint32, error) {
+	if response.Type != "public-key" {
+		return 0, fmt.Errorf("%w: type %q", ErrInvalidResponse, response.Type)
+	}
+	if !bytes.Equal(response.RawID, credential.ID) {
+		return 0, fmt.Errorf("%w: credential ID does not match", ErrInvalidResponse)
+	}
+	if err := rp.checkClientData(response.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthenticatorData(response.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthenticatorData(ad); err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	signed := append(slices.Clone([]byte(response.Response.AuthenticatorData)), clientDataHash[:]...)
+	if !key.verify(signed, response.Response.Signature) {
+		return 0, ErrInvalidSignature
+	}
+
+	// authenticators that do not count always report zero
+	if (ad.signCount != 0 || credential.SignCount != 0) && ad.signCount <= credential.SignCount {
+		return 0, ErrClonedAuthenticator
+	}
+
+	return ad.signCount, nil
+}
@@ -0,0 +1,172 @@
+package webauthn_test
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/freekobie/kora/webauthn"
+	"github.com/freekobie/kora/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const origin = "https://app.kora.example"
+
+var rp = &webauthn.RelyingParty{ID: "kora.example", Name: "Kora", Origins: []string{origin}}
+
+var alice = webauthn.User{ID: []byte("alice-handle"), Name: "alice@example.com", DisplayName: "Alice"}
+
+func challenge() []byte {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// register creates a credential on a and verifies it.
+func register(t *testing.T, a *webauthntest.Authenticator) webauthn.Credential {
+	t.Helper()
+	c := challenge()
+	response, err := a.Create(rp.CreationOptions(c, alice, nil))
+	require.NoError(t, err)
+	credential, err := rp.VerifyRegistration(response, c)
+	require.NoError(t, err)
+	return *credential
+}
+
+// login signs in with a and verifies the assertion against credential.
+func login(t *testing.T, a *webauthntest.Authenticator, credential webauthn.Credential) (uint32, error) {
+	t.Helper()
+	c := challenge()
+	response, err := a.Get(rp.RequestOptions(c))
+	require.NoError(t, err)
+	return rp.VerifyAssertion(response, c, credential)
+}
+
+func TestCeremonies(t *testing.T) {
+	for name, alg := range map[string]int{"ES256": webauthn.AlgES256, "EdDSA": webauthn.AlgEdDSA} {
+		t.Run(name, func(t *testing.T) {
+			a := webauthntest.New(origin)
+			a.Algorithm = alg
+
+			credential := register(t, a)
+			assert.NotEmpty(t, credential.ID)
+
+			count, err := login(t, a, credential)
+			require.NoError(t, err)
+			assert.EqualValues(t, 1, count)
+		})
+	}
+}
+
+func TestOptionsJSON(t *testing.T) {
+	options := rp.CreationOptions([]byte{0xfb, 0xff}, alice, [][]byte{{1, 2, 3}})
+	data, err := json.Marshal(options)
+	require.NoError(t, err)
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "-_8", decoded["challenge"], "binary fields are base64url without padding")
+	assert.Equal(t, "none", decoded["attestation"])
+	assert.Equal(t, "AQID", decoded["excludeCredentials"].([]any)[0].(map[string]any)["id"])
+
+	var roundTrip webauthn.CreationOptions
+	require.NoError(t, json.Unmarshal(data, &roundTrip))
+	assert.Equal(t, options, roundTrip)
+}
+
+func TestVerifyRegistration_Rejects(t *testing.T) {
+	t.Run("other challenge", func(t *testing.T) {
+		response, err := webauthntest.New(origin).Create(rp.CreationOptions(challenge(), alice, nil))
+		require.NoError(t, err)
+		_, err = rp.VerifyRegistration(response, challenge())
+		assert.ErrorIs(t, err, webauthn.ErrChallengeMismatch)
+	})
+
+	t.Run("other origin", func(t *testing.T) {
+		c := challenge()
+		response, err := webauthntest.New("https://evil.example").Create(rp.CreationOptions(c, alice, nil))
+		require.NoError(t, err)
+		_, err = rp.VerifyRegistration(response, c)
+		assert.ErrorIs(t, err, webauthn.ErrOriginMismatch)
+	})
+
+	t.Run("other relying party", func(t *testing.T) {
+		c := challenge()
+		other := &webauthn.RelyingParty{ID: "evil.example", Origins: []string{origin}}
+		response, err := webauthntest.New(origin).Create(other.CreationOptions(c, alice, nil))
+		require.NoError(t, err)
+		_, err = rp.VerifyRegistration(response, c)
+		assert.ErrorIs(t, err, webauthn.ErrInvalidResponse)
+	})
+
+	t.Run("user not verified", func(t *testing.T) {
+		c := challenge()
+		a := webauthntest.New(origin)
+		a.SkipUserVerification = true
+		response, err := a.Create(rp.CreationOptions(c, alice, nil))
+		require.NoError(t, err)
+		_, err = rp.VerifyRegistration(response, c)
+		assert.ErrorIs(t, err, webauthn.ErrInvalidResponse)
+	})
+
+	t.Run("assertion instead of attestation", func(t *testing.T) {
+		a := webauthntest.New(origin)
+		register(t, a)
+		c := challenge()
+		assertion, err := a.Get(rp.RequestOptions(c))
+		require.NoError(t, err)
+		response := &webauthn.AttestationResponse{RawID: assertion.RawID, Type: "public-key"}
+		response.Response.ClientDataJSON = assertion.Response.ClientDataJSON
+		response.Response.AttestationObject = assertion.Response.AuthenticatorData
+		_, err = rp.VerifyRegistration(response, c)
+		assert.ErrorIs(t, err, webauthn.ErrInvalidResponse)
+	})
+}
+
+func TestVerifyAssertion_Rejects(t *testing.T) {
+	a := webauthntest.New(origin)
+	credential := register(t, a)
+
+	t.Run("other challenge", func(t *testing.T) {
+		response, err := a.Get(rp.RequestOptions(challenge()))
+		require.NoError(t, err)
+		_, err = rp.VerifyAssertion(response, challenge(), credential)
+		assert.ErrorIs(t, err, webauthn.ErrChallengeMismatch)
+	})
+
+	t.Run("tampered data", func(t *testing.T) {
+		c := challenge()
+		response, err := a.Get(rp.RequestOptions(c))
+		require.NoError(t, err)
+		response.Response.AuthenticatorData[36]++
+		_, err = rp.VerifyAssertion(response, c, credential)
+		assert.ErrorIs(t, err, webauthn.ErrInvalidSignature)
+	})
+
+	t.Run("other credential", func(t *testing.T) {
+		other := register(t, webauthntest.New(origin))
+		c := challenge()
+		response, err := a.Get(rp.RequestOptions(c))
+		require.NoError(t, err)
+		response.RawID = other.ID
+		_, err = rp.VerifyAssertion(response, c, other)
+		assert.ErrorIs(t, err, webauthn.ErrInvalidSignature)
+	})
+}
+
+func TestVerifyAssertion_SignCount(t *testing.T) {
+	a := webauthntest.New(origin)
+	credential := register(t, a)
+	clone := a.Clone()
+
+	count, err := login(t, a, credential)
+	require.NoError(t, err)
+	credential.SignCount = count
+	count, err = login(t, a, credential)
+	require.NoError(t, err)
+	credential.SignCount = count
+
+	_, err = login(t, clone, credential)
+	assert.ErrorIs(t, err, webauthn.ErrClonedAuthenticator)
+}
@@ -0,0 +1,266 @@
+// Package webauthntest provides a software WebAuthn authenticator, standing
+// in for a browser and a platform authenticator in tests.
+package webauthntest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/freekobie/kora/webauthn"
+)
+
+var ErrNoCredential = errors.New("webauthntest: no matching credential")
+
+// Authenticator holds discoverable credentials and answers ceremonies for
+// them as a browser on Origin would.
+type Authenticator struct {
+	Origin string
+	// Algorithm is the COSE algorithm of new credentials: webauthn.AlgES256,
+	// the default, or webauthn.AlgEdDSA.
+	Algorithm int
+	// SkipUserVerification makes the authenticator report that it did not
+	// verify the user.
+	SkipUserVerification bool
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        crypto.Signer
+	signCount  uint32
+}
+
+// New returns an authenticator with no credentials.
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, Algorithm: webauthn.AlgES256}
+}
+
+// Clone returns a copy of the authenticator holding the same keys, as if
+// they had been extracted from it. The copy counts signatures separately.
+func (a *Authenticator) Clone() *Authenticator {
+	clone := *a
+	clone.credentials = nil
+	for _, c := range a.credentials {
+		copied := *c
+		clone.credentials = append(clone.credentials, &copied)
+	}
+	return &clone
+}
+
+// Create makes a credential, as navigator.credentials.create does.
+func (a *Authenticator) Create(options webauthn.CreationOptions) (*webauthn.AttestationResponse, error) {
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RelyingParty.ID, excluded.ID) != nil {
+			return nil, errors.New("webauthntest: credential already registered")
+		}
+	}
+	if !slices.ContainsFunc(options.PubKeyCredParams, func(p webauthn.CredentialParameter) bool {
+		return p.Alg == a.Algorithm
+	}) {
+		return nil, errors.New("webauthntest: algorithm not allowed")
+	}
+
+	c := &credential{
+		id:         randomBytes(16),
+		rpID:       options.RelyingParty.ID,
+		userHandle: slices.Clone([]byte(options.User.ID)),
+	}
+	var coseKey []byte
+	switch a.Algorithm {
+	case webauthn.AlgES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		c.key = key
+		coseKey = encodeCBOR(map[any]any{
+			1:  2, // EC2
+			3:  webauthn.AlgES256,
+			-1: 1, // P-256
+			-2: key.X.FillBytes(make([]byte, 32)),
+			-3: key.Y.FillBytes(make([]byte, 32)),
+		})
+	case webauthn.AlgEdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		c.key = private
+		coseKey = encodeCBOR(map[any]any{
+			1:  1, // OKP
+			3:  webauthn.AlgEdDSA,
+			-1: 6, // Ed25519
+			-2: []byte(public),
+		})
+	default:
+		return nil, fmt.Errorf("webauthntest: unsupported algorithm %d", a.Algorithm)
+	}
+
+	var attested bytes.Buffer
+	attested.Write(make([]byte, 16)) // AAGUID
+	_ = binary.Write(&attested, binary.BigEndian, uint16(len(c.id)))
+	attested.Write(c.id)
+	attested.Write(coseKey)
+
+	authData := a.authenticatorData(c, 0x40)
+	authData = append(authData, attested.Bytes()...)
+
+	response := &webauthn.AttestationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(c.id),
+		RawID: c.id,
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = a.clientData("webauthn.create", options.Challenge)
+	response.Response.AttestationObject = encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": authData,
+	})
+	response.Response.Transports = []string{"internal"}
+
+	a.credentials = append(a.credentials, c)
+	return response, nil
+}
+
+// Get signs in with a credential, as navigator.credentials.get does. With
+// no allowed credentials in options, the newest one for the relying party
+// is used.
+func (a *Authenticator) Get(options webauthn.RequestOptions) (*webauthn.AssertionResponse, error) {
+	var c *credential
+	if len(options.AllowCredentials) == 0 {
+		for _, candidate := range a.credentials {
+			if candidate.rpID == options.RelyingPartyID {
+				c = candidate
+			}
+		}
+	}
+	for _, allowed := range options.AllowCredentials {
+		if c = a.find(options.RelyingPartyID, allowed.ID); c != nil {
+			break
+		}
+	}
+	if c == nil {
+		return nil, ErrNoCredential
+	}
+
+	c.signCount++
+	authData := a.authenticatorData(c, 0)
+	clientData := a.clientData("webauthn.get", options.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(slices.Clone(authData), clientDataHash[:]...)
+
+	var signature []byte
+	var err error
+	switch key := c.key.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(signed)
+		signature, err = ecdsa.SignASN1(rand.Reader, key, digest[:])
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, signed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response := &webauthn.AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(c.id),
+		RawID: c.id,
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = clientData
+	response.Response.AuthenticatorData = authData
+	response.Response.Signature = signature
+	response.Response.UserHandle = c.userHandle
+
+	return response, nil
+}
+
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, c := range a.credentials {
+		if c.rpID == rpID && bytes.Equal(c.id, id) {
+			return c
+		}
+	}
+	return nil
+}
+
+// authenticatorData returns the relying party ID hash, flags and signature
+// counter, with the user present and verified flags set along with flags.
+func (a *Authenticator) authenticatorData(c *credential, flags byte) []byte {
+	flags |= 0x01
+	if !a.SkipUserVerification {
+		flags |= 0x04
+	}
+
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, c.signCount)
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// encodeCBOR encodes the values the authenticator sends: integers, byte and
+// text strings, and maps of them.
+func encodeCBOR(v any) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case map[any]any:
+		out := cborHead(5, uint64(len(v)))
+		for key, value := range v {
+			out = append(out, encodeCBOR(key)...)
+			out = append(out, encodeCBOR(value)...)
+		}
+		return out
+	}
+	panic(fmt.Sprintf("webauthntest: cannot encode %T", v))
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}